@@ -0,0 +1,284 @@
+package rgb_lib
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ActivitySource is the subset of Wallet and MultisigWallet needed to build an
+// ActivityFeed.
+type ActivitySource interface {
+	TransferSource
+	ListTransactions(online *Online, skipSync bool) ([]Transaction, error)
+}
+
+type ActivityKind uint8
+
+const (
+	ActivityKindIssuance ActivityKind = iota + 1
+	ActivityKindSend
+	ActivityKindReceive
+	ActivityKindInflation
+	ActivityKindBurn
+	ActivityKindLink
+	ActivityKindCreateUtxos
+	ActivityKindDrain
+	ActivityKindSendBtc
+	ActivityKindReceiveBtc
+)
+
+func (k ActivityKind) String() string {
+	switch k {
+	case ActivityKindIssuance:
+		return "issuance"
+	case ActivityKindSend:
+		return "send"
+	case ActivityKindReceive:
+		return "receive"
+	case ActivityKindInflation:
+		return "inflation"
+	case ActivityKindBurn:
+		return "burn"
+	case ActivityKindLink:
+		return "link"
+	case ActivityKindCreateUtxos:
+		return "create_utxos"
+	case ActivityKindDrain:
+		return "drain"
+	case ActivityKindSendBtc:
+		return "send_btc"
+	case ActivityKindReceiveBtc:
+		return "receive_btc"
+	default:
+		return fmt.Sprintf("ActivityKind(%d)", k)
+	}
+}
+
+// ActivityEntry is one item of the wallet history: a bitcoin transaction with
+// the RGB transfers it carries, or a group of transfers without a transaction
+// yet (issuances, receives waiting for the counterparty).
+type ActivityEntry struct {
+	Kind ActivityKind
+	// Key identifies the entry within the feed: the txid, or "batch:<idx>"
+	// for transfers without a transaction.
+	Key  string
+	Txid *string
+	// Timestamp is the confirmation time when available, otherwise the
+	// creation time of the oldest transfer, or zero if unknown.
+	Timestamp   int64
+	BlockTime   *BlockTime
+	Fee         uint64
+	Transaction *Transaction
+	Transfers   []AssetTransfer
+}
+
+// Pending reports whether the entry is still waiting for a confirmation or for
+// its transfers to settle.
+func (e ActivityEntry) Pending() bool {
+	if e.BlockTime != nil {
+		return false
+	}
+	if len(e.Transfers) == 0 {
+		return true
+	}
+	for _, t := range e.Transfers {
+		if t.Status != TransferStatusSettled && t.Status != TransferStatusFailed {
+			return true
+		}
+	}
+	return false
+}
+
+var ErrInvalidActivityCursor = errors.New("invalid activity cursor")
+
+// ActivityCursor points at the last entry of a page.
+type ActivityCursor struct {
+	Pending   bool
+	Timestamp int64
+	Key       string
+}
+
+func (c ActivityCursor) String() string {
+	pending := "c"
+	if c.Pending {
+		pending = "p"
+	}
+	return fmt.Sprintf("%s.%d.%s", pending, c.Timestamp, c.Key)
+}
+
+func ParseActivityCursor(s string) (ActivityCursor, error) {
+	parts := strings.SplitN(s, ".", 3)
+	if len(parts) != 3 || parts[0] != "p" && parts[0] != "c" {
+		return ActivityCursor{}, fmt.Errorf("%w: %q", ErrInvalidActivityCursor, s)
+	}
+	ts, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return ActivityCursor{}, fmt.Errorf("%w: %q", ErrInvalidActivityCursor, s)
+	}
+	return ActivityCursor{Pending: parts[0] == "p", Timestamp: ts, Key: parts[2]}, nil
+}
+
+func (e ActivityEntry) cursor() ActivityCursor {
+	return ActivityCursor{Pending: e.Pending(), Timestamp: e.Timestamp, Key: e.Key}
+}
+
+// compareActivity orders pending entries first, then newest first.
+func compareActivity(a, b ActivityCursor) int {
+	if a.Pending != b.Pending {
+		if a.Pending {
+			return -1
+		}
+		return 1
+	}
+	if c := cmp.Compare(b.Timestamp, a.Timestamp); c != 0 {
+		return c
+	}
+	return cmp.Compare(b.Key, a.Key)
+}
+
+type ActivityPage struct {
+	Entries []ActivityEntry
+	Next    *ActivityCursor
+}
+
+// ActivityFeed joins the bitcoin transactions and the RGB transfers of a
+// wallet into a single history, pending entries first and then newest first.
+type ActivityFeed struct {
+	src      ActivitySource
+	online   *Online
+	skipSync bool
+}
+
+// NewActivityFeed returns a feed over the given wallet. online and skipSync
+// are passed to ListTransactions.
+func NewActivityFeed(src ActivitySource, online *Online, skipSync bool) *ActivityFeed {
+	return &ActivityFeed{src: src, online: online, skipSync: skipSync}
+}
+
+// Entries returns the whole history.
+func (f *ActivityFeed) Entries() ([]ActivityEntry, error) {
+	transactions, err := f.src.ListTransactions(f.online, f.skipSync)
+	if err != nil {
+		return nil, err
+	}
+	entries := map[string]*ActivityEntry{}
+	for i := range transactions {
+		tx := &transactions[i]
+		txid := tx.Txid
+		entries[txid] = &ActivityEntry{
+			Key:         txid,
+			Txid:        &txid,
+			BlockTime:   tx.ConfirmationTime,
+			Fee:         tx.Fee,
+			Transaction: tx,
+		}
+	}
+	for t, err := range NewTransferQuery().All(f.src) {
+		if err != nil {
+			return nil, err
+		}
+		key := fmt.Sprintf("batch:%d", t.BatchTransferIdx)
+		if t.Txid != nil {
+			key = *t.Txid
+		}
+		e, ok := entries[key]
+		if !ok {
+			e = &ActivityEntry{Key: key, Txid: t.Txid}
+			entries[key] = e
+		}
+		e.Transfers = append(e.Transfers, t)
+	}
+
+	feed := make([]ActivityEntry, 0, len(entries))
+	for _, e := range entries {
+		e.Kind = activityKind(e)
+		switch {
+		case e.BlockTime != nil:
+			e.Timestamp = int64(e.BlockTime.Timestamp)
+		case len(e.Transfers) > 0:
+			// transfers come sorted by creation time
+			e.Timestamp = e.Transfers[0].CreatedAt
+		}
+		feed = append(feed, *e)
+	}
+	slices.SortFunc(feed, func(a, b ActivityEntry) int {
+		return compareActivity(a.cursor(), b.cursor())
+	})
+	return feed, nil
+}
+
+// Page returns up to limit entries following the cursor, which may be nil to
+// start from the top. A zero limit returns every remaining entry.
+func (f *ActivityFeed) Page(after *ActivityCursor, limit int) (ActivityPage, error) {
+	entries, err := f.Entries()
+	if err != nil {
+		return ActivityPage{}, err
+	}
+	if after != nil {
+		start, _ := slices.BinarySearchFunc(entries, *after, func(e ActivityEntry, c ActivityCursor) int {
+			return compareActivity(e.cursor(), c)
+		})
+		for start < len(entries) && compareActivity(entries[start].cursor(), *after) <= 0 {
+			start++
+		}
+		entries = entries[start:]
+	}
+	page := ActivityPage{Entries: entries}
+	if limit > 0 && len(entries) > limit {
+		page.Entries = entries[:limit]
+		next := page.Entries[limit-1].cursor()
+		page.Next = &next
+	}
+	return page, nil
+}
+
+// activityKind labels an entry after the most significant transfer it holds,
+// falling back to the transaction type for vanilla transactions.
+func activityKind(e *ActivityEntry) ActivityKind {
+	var kind ActivityKind
+	for _, t := range e.Transfers {
+		k := transferActivityKind(t.Kind)
+		if kind == 0 || k < kind {
+			kind = k
+		}
+	}
+	if kind != 0 {
+		return kind
+	}
+	if e.Transaction == nil {
+		return ActivityKindReceive
+	}
+	switch e.Transaction.TransactionType {
+	case TransactionTypeRgbSend:
+		return ActivityKindSend
+	case TransactionTypeDrain:
+		return ActivityKindDrain
+	case TransactionTypeCreateUtxos:
+		return ActivityKindCreateUtxos
+	case TransactionTypeSendBtc:
+		return ActivityKindSendBtc
+	default:
+		return ActivityKindReceiveBtc
+	}
+}
+
+func transferActivityKind(kind TransferKind) ActivityKind {
+	switch kind {
+	case TransferKindIssuance:
+		return ActivityKindIssuance
+	case TransferKindSend:
+		return ActivityKindSend
+	case TransferKindInflation:
+		return ActivityKindInflation
+	case TransferKindBurn:
+		return ActivityKindBurn
+	case TransferKindLink:
+		return ActivityKindLink
+	default:
+		return ActivityKindReceive
+	}
+}
@@ -0,0 +1,84 @@
+package rgb_lib
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestActivityFeed(t *testing.T) {
+	wallet := newFakeWallet()
+	t1, t4 := "t1", "t4"
+	wallet.transactions = []Transaction{
+		{TransactionType: TransactionTypeRgbSend, Txid: "t1", Fee: 300, ConfirmationTime: &BlockTime{Height: 1, Timestamp: 100}},
+		{TransactionType: TransactionTypeCreateUtxos, Txid: "t2", ConfirmationTime: &BlockTime{Height: 2, Timestamp: 200}},
+		{TransactionType: TransactionTypeSendBtc, Txid: "t3"},
+	}
+	wallet.transfers["rgb:a"] = []Transfer{
+		{Idx: 1, BatchTransferIdx: 5, CreatedAt: 50, Kind: TransferKindIssuance, Status: TransferStatusSettled},
+		{Idx: 2, BatchTransferIdx: 7, CreatedAt: 90, Kind: TransferKindSend, Status: TransferStatusWaitingConfirmations, Txid: &t1},
+	}
+	wallet.transfers["rgb:b"] = []Transfer{
+		{Idx: 3, BatchTransferIdx: 7, CreatedAt: 90, Kind: TransferKindSend, Status: TransferStatusWaitingConfirmations, Txid: &t1},
+		{Idx: 4, BatchTransferIdx: 6, CreatedAt: 300, Kind: TransferKindReceiveBlind, Status: TransferStatusWaitingCounterparty},
+		{Idx: 5, BatchTransferIdx: 8, CreatedAt: 150, Kind: TransferKindReceiveWitness, Status: TransferStatusSettled, Txid: &t4},
+	}
+
+	feed := NewActivityFeed(wallet, nil, true)
+	entries, err := feed.Entries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		key       string
+		kind      ActivityKind
+		pending   bool
+		timestamp int64
+		transfers []int32
+	}{
+		{"batch:6", ActivityKindReceive, true, 300, []int32{4}},
+		{"t3", ActivityKindSendBtc, true, 0, nil},
+		{"t2", ActivityKindCreateUtxos, false, 200, nil},
+		{"t4", ActivityKindReceive, false, 150, []int32{5}},
+		{"t1", ActivityKindSend, false, 100, []int32{2, 3}},
+		{"batch:5", ActivityKindIssuance, false, 50, []int32{1}},
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("%d entries, want %d", len(entries), len(want))
+	}
+	for i, w := range want {
+		e := entries[i]
+		if e.Key != w.key || e.Kind != w.kind || e.Pending() != w.pending || e.Timestamp != w.timestamp {
+			t.Errorf("entry %d: %s %s pending %t at %d, want %s %s pending %t at %d",
+				i, e.Key, e.Kind, e.Pending(), e.Timestamp, w.key, w.kind, w.pending, w.timestamp)
+		}
+		if got := transferIdxs(e.Transfers); !slices.Equal(got, w.transfers) {
+			t.Errorf("entry %s: transfers %v, want %v", e.Key, got, w.transfers)
+		}
+	}
+	if e := entries[4]; e.Transaction == nil || e.Fee != 300 || *e.Txid != "t1" {
+		t.Errorf("entry t1 not joined with its transaction: %+v", e)
+	}
+
+	var keys []string
+	var after *ActivityCursor
+	for {
+		page, err := feed.Page(after, 4)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, e := range page.Entries {
+			keys = append(keys, e.Key)
+		}
+		if page.Next == nil {
+			break
+		}
+		next, err := ParseActivityCursor(page.Next.String())
+		if err != nil || next != *page.Next {
+			t.Fatalf("ParseActivityCursor(%s) = %v, %v", page.Next, next, err)
+		}
+		after = &next
+	}
+	if want := []string{"batch:6", "t3", "t2", "t4", "t1", "batch:5"}; !slices.Equal(keys, want) {
+		t.Fatalf("pages %v, want %v", keys, want)
+	}
+}
@@ -0,0 +1,201 @@
+package airgap
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// BBQr file types.
+const (
+	BBQrPsbt        byte = 'P'
+	BBQrTransaction byte = 'T'
+	BBQrJSON        byte = 'J'
+	BBQrText        byte = 'U'
+)
+
+const (
+	bbqrHeaderLen = 8
+	bbqrMaxParts  = 36 * 36
+)
+
+// DefaultFrameChars keeps frames small enough for phone cameras to scan an
+// animated sequence reliably.
+const DefaultFrameChars = 500
+
+var (
+	ErrInvalidFrame    = errors.New("invalid bbqr frame")
+	ErrFrameMismatch   = errors.New("bbqr frame does not belong to this sequence")
+	ErrIncompleteFrame = errors.New("bbqr sequence is incomplete")
+)
+
+var bbqrBase32 = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// EncodeBBQr splits data into BBQr frames of at most maxChars characters each,
+// using the base32 encoding. The frames are meant to be shown in a loop as an
+// animated QR code.
+func EncodeBBQr(data []byte, fileType byte, maxChars int) ([]string, error) {
+	if maxChars <= bbqrHeaderLen+8 {
+		return nil, fmt.Errorf("%w: frame size %d is too small", ErrInvalidFrame, maxChars)
+	}
+	encoded := bbqrBase32.EncodeToString(data)
+	perPart := (maxChars - bbqrHeaderLen) / 8 * 8
+	parts := (len(encoded) + perPart - 1) / perPart
+	if parts == 0 {
+		parts = 1
+	}
+	if parts > bbqrMaxParts {
+		return nil, fmt.Errorf("%w: %d frames needed, at most %d allowed", ErrInvalidFrame, parts, bbqrMaxParts)
+	}
+	// spread the data evenly, keeping base32 groups whole
+	perPart = ((len(encoded)+parts-1)/parts + 7) / 8 * 8
+
+	frames := make([]string, 0, parts)
+	for i := 0; i < parts; i++ {
+		start := min(i*perPart, len(encoded))
+		end := min(start+perPart, len(encoded))
+		frames = append(frames, fmt.Sprintf("B$2%c%s%s%s", fileType, base36(parts), base36(i), encoded[start:end]))
+	}
+	return frames, nil
+}
+
+func base36(n int) string {
+	s := strings.ToUpper(strconv.FormatInt(int64(n), 36))
+	if len(s) < 2 {
+		s = "0" + s
+	}
+	return s
+}
+
+// BBQrDecoder collects BBQr frames, in any order and with repetitions, until
+// the sequence is complete.
+type BBQrDecoder struct {
+	encoding byte
+	fileType byte
+	parts    []string
+	seen     []bool
+	received int
+}
+
+// Add records a scanned frame and reports whether the sequence is complete.
+func (d *BBQrDecoder) Add(frame string) (bool, error) {
+	frame = strings.TrimSpace(frame)
+	if len(frame) < bbqrHeaderLen || !strings.HasPrefix(frame, "B$") {
+		return false, ErrInvalidFrame
+	}
+	encoding, fileType := frame[2], frame[3]
+	total, err1 := strconv.ParseUint(frame[4:6], 36, 32)
+	index, err2 := strconv.ParseUint(frame[6:8], 36, 32)
+	if err1 != nil || err2 != nil || total < 1 || index >= total {
+		return false, ErrInvalidFrame
+	}
+	if d.parts == nil {
+		d.encoding, d.fileType = encoding, fileType
+		d.parts = make([]string, total)
+		d.seen = make([]bool, total)
+	} else if encoding != d.encoding || fileType != d.fileType || int(total) != len(d.parts) {
+		return false, ErrFrameMismatch
+	}
+	if !d.seen[index] {
+		d.seen[index] = true
+		d.received++
+	}
+	d.parts[index] = frame[bbqrHeaderLen:]
+	return d.Complete(), nil
+}
+
+func (d *BBQrDecoder) Complete() bool {
+	return d.parts != nil && d.received == len(d.parts)
+}
+
+// Progress returns the number of distinct frames received and the total.
+func (d *BBQrDecoder) Progress() (int, int) {
+	return d.received, len(d.parts)
+}
+
+// Result decodes the complete sequence.
+func (d *BBQrDecoder) Result() (fileType byte, data []byte, err error) {
+	if !d.Complete() {
+		return 0, nil, ErrIncompleteFrame
+	}
+	joined := strings.Join(d.parts, "")
+	switch d.encoding {
+	case 'H':
+		data, err = hex.DecodeString(joined)
+	case '2':
+		data, err = bbqrBase32.DecodeString(joined)
+	case 'Z':
+		var compressed []byte
+		if compressed, err = bbqrBase32.DecodeString(joined); err == nil {
+			data, err = io.ReadAll(flate.NewReader(bytes.NewReader(compressed)))
+		}
+	default:
+		return 0, nil, fmt.Errorf("%w: unsupported encoding %q", ErrInvalidFrame, d.encoding)
+	}
+	if err != nil {
+		return 0, nil, fmt.Errorf("%w: %v", ErrInvalidFrame, err)
+	}
+	return d.fileType, data, nil
+}
+
+// DecodeBBQr decodes a complete set of frames.
+func DecodeBBQr(frames []string) (byte, []byte, error) {
+	var d BBQrDecoder
+	for _, f := range frames {
+		if _, err := d.Add(f); err != nil {
+			return 0, nil, err
+		}
+	}
+	return d.Result()
+}
+
+// PsbtFrames encodes a base64 PSBT as BBQr frames of type P, as read by
+// hardware signers supporting BBQr.
+func PsbtFrames(psbt string, maxChars int) ([]string, error) {
+	raw, err := base64.StdEncoding.DecodeString(psbt)
+	if err != nil {
+		return nil, err
+	}
+	return EncodeBBQr(raw, BBQrPsbt, maxChars)
+}
+
+// PsbtFromFrames decodes BBQr frames of type P back to a base64 PSBT.
+func PsbtFromFrames(frames []string) (string, error) {
+	fileType, data, err := DecodeBBQr(frames)
+	if err != nil {
+		return "", err
+	}
+	if fileType != BBQrPsbt {
+		return "", fmt.Errorf("%w: expected a psbt, got type %q", ErrFrameMismatch, fileType)
+	}
+	return base64.StdEncoding.EncodeToString(data), nil
+}
+
+// Frames encodes the whole envelope as BBQr frames of type J.
+func (e *Envelope) Frames(maxChars int) ([]string, error) {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return nil, err
+	}
+	return EncodeBBQr(data, BBQrJSON, maxChars)
+}
+
+// FromFrames decodes an envelope from BBQr frames of type J.
+func FromFrames(frames []string) (*Envelope, error) {
+	fileType, data, err := DecodeBBQr(frames)
+	if err != nil {
+		return nil, err
+	}
+	if fileType != BBQrJSON {
+		return nil, fmt.Errorf("%w: expected an envelope, got type %q", ErrFrameMismatch, fileType)
+	}
+	return Unmarshal(data)
+}
@@ -0,0 +1,73 @@
+package airgap
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestBBQrRoundTrip(t *testing.T) {
+	data := bytes.Repeat([]byte("rgb-lib bbqr frame "), 100)
+	frames, err := EncodeBBQr(data, BBQrPsbt, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(frames) < 2 {
+		t.Fatalf("expected several frames, got %d", len(frames))
+	}
+	var d BBQrDecoder
+	// frames may come in any order and repeat
+	for i := len(frames) - 1; i >= 0; i-- {
+		if _, err := d.Add(frames[i]); err != nil {
+			t.Fatalf("frame %d: %v", i, err)
+		}
+		if _, err := d.Add(frames[i]); err != nil {
+			t.Fatalf("frame %d repeated: %v", i, err)
+		}
+	}
+	fileType, got, err := d.Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fileType != BBQrPsbt || !bytes.Equal(got, data) {
+		t.Fatalf("round trip mismatch: type %q, %d bytes", fileType, len(got))
+	}
+}
+
+func TestBBQrBadHeaders(t *testing.T) {
+	for _, frame := range []string{
+		"",
+		"B$2P01",
+		"X$2P0100AAAA",
+		"B$2P-100AAAA",
+		"B$2P02-1AAAA",
+		"B$2P+2+1AAAA",
+		"B$2P0000AAAA",
+		"B$2P0202AAAA",
+		"B$2P0205AAAA",
+		"B$2P0!00AAAA",
+	} {
+		var d BBQrDecoder
+		if _, err := d.Add(frame); !errors.Is(err, ErrInvalidFrame) {
+			t.Errorf("Add(%q) = %v, want ErrInvalidFrame", frame, err)
+		}
+		if received, _ := d.Progress(); received != 0 {
+			t.Errorf("Add(%q) recorded a frame", frame)
+		}
+	}
+}
+
+func TestBBQrFrameMismatch(t *testing.T) {
+	var d BBQrDecoder
+	if _, err := d.Add("B$2P0200AAAA"); err != nil {
+		t.Fatal(err)
+	}
+	for _, frame := range []string{"B$2P0301AAAA", "B$2T0201AAAA", "B$HP0201AAAA"} {
+		if _, err := d.Add(frame); !errors.Is(err, ErrFrameMismatch) {
+			t.Errorf("Add(%q) = %v, want ErrFrameMismatch", frame, err)
+		}
+	}
+	if _, _, err := d.Result(); !errors.Is(err, ErrIncompleteFrame) {
+		t.Errorf("Result = %v, want ErrIncompleteFrame", err)
+	}
+}
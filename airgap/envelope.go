@@ -0,0 +1,212 @@
+// Package airgap moves pending wallet operations to an offline signer and
+// back. The online side exports the PSBT of a Begin call, along with the
+// details needed to finish it, to an Envelope that can be written to a file or
+// shown as a sequence of BBQr frames. The offline side signs the PSBT and
+// returns the envelope, which the online side checks against the pending one
+// before calling the matching End method.
+package airgap
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	rgb_lib "github.com/UTEXO-Protocol/rgb-lib-go"
+)
+
+// EnvelopeVersion is the version of the envelope format written by this
+// package.
+const EnvelopeVersion = 1
+
+type Kind string
+
+const (
+	KindSend        Kind = "send"
+	KindBurn        Kind = "burn"
+	KindInflate     Kind = "inflate"
+	KindCreateUtxos Kind = "create_utxos"
+	KindDrainTo     Kind = "drain_to"
+	KindSendBtc     Kind = "send_btc"
+)
+
+var (
+	ErrUnsupportedVersion = errors.New("unsupported envelope version")
+	ErrUnsigned           = errors.New("envelope is not signed")
+	ErrBadSignature       = errors.New("invalid envelope signature")
+	ErrUntrustedKey       = errors.New("envelope signed by an untrusted key")
+	ErrKindMismatch       = errors.New("envelope kind mismatch")
+	ErrTxMismatch         = errors.New("signed psbt does not match the pending transaction")
+)
+
+// Inspector is implemented by Wallet and MultisigWallet.
+type Inspector interface {
+	InspectPsbt(psbt string) (rgb_lib.PsbtInspection, error)
+}
+
+// Envelope carries a pending operation between the online and the offline
+// side. Txid is the id of the unsigned transaction and is used to check that
+// the PSBT coming back spends the same inputs to the same outputs.
+//
+// An envelope can be signed with an ed25519 key so that each side can verify
+// it was produced by the expected peer. The signature covers every field but
+// Signature itself.
+type Envelope struct {
+	Version          int                     `json:"version"`
+	Kind             Kind                    `json:"kind"`
+	Network          string                  `json:"network"`
+	Txid             string                  `json:"txid"`
+	Psbt             string                  `json:"psbt"`
+	Signed           bool                    `json:"signed"`
+	BatchTransferIdx *int32                  `json:"batch_transfer_idx,omitempty"`
+	SendDetails      *rgb_lib.SendDetails    `json:"send_details,omitempty"`
+	BurnDetails      *rgb_lib.BurnDetails    `json:"burn_details,omitempty"`
+	InflateDetails   *rgb_lib.InflateDetails `json:"inflate_details,omitempty"`
+	CreatedAt        int64                   `json:"created_at"`
+	PublicKey        []byte                  `json:"public_key,omitempty"`
+	Signature        []byte                  `json:"signature,omitempty"`
+}
+
+func newEnvelope(inspector Inspector, network rgb_lib.BitcoinNetwork, kind Kind, psbt string) (*Envelope, error) {
+	inspection, err := inspector.InspectPsbt(psbt)
+	if err != nil {
+		return nil, err
+	}
+	return &Envelope{
+		Version:   EnvelopeVersion,
+		Kind:      kind,
+		Network:   network.String(),
+		Txid:      inspection.Txid,
+		Psbt:      psbt,
+		CreatedAt: time.Now().Unix(),
+	}, nil
+}
+
+// NewSendEnvelope exports the result of SendBegin.
+func NewSendEnvelope(inspector Inspector, network rgb_lib.BitcoinNetwork, begin rgb_lib.SendBeginResult) (*Envelope, error) {
+	env, err := newEnvelope(inspector, network, KindSend, begin.Psbt)
+	if err != nil {
+		return nil, err
+	}
+	env.BatchTransferIdx = begin.BatchTransferIdx
+	env.SendDetails = &begin.Details
+	return env, nil
+}
+
+// NewBurnEnvelope exports the result of BurnBegin.
+func NewBurnEnvelope(inspector Inspector, network rgb_lib.BitcoinNetwork, begin rgb_lib.BurnBeginResult) (*Envelope, error) {
+	env, err := newEnvelope(inspector, network, KindBurn, begin.Psbt)
+	if err != nil {
+		return nil, err
+	}
+	env.BatchTransferIdx = begin.BatchTransferIdx
+	env.BurnDetails = &begin.Details
+	return env, nil
+}
+
+// NewInflateEnvelope exports the result of InflateBegin.
+func NewInflateEnvelope(inspector Inspector, network rgb_lib.BitcoinNetwork, begin rgb_lib.InflateBeginResult) (*Envelope, error) {
+	env, err := newEnvelope(inspector, network, KindInflate, begin.Psbt)
+	if err != nil {
+		return nil, err
+	}
+	env.BatchTransferIdx = begin.BatchTransferIdx
+	env.InflateDetails = &begin.Details
+	return env, nil
+}
+
+// NewPsbtEnvelope exports the PSBT of CreateUtxosBegin, DrainToBegin or
+// SendBtcBegin.
+func NewPsbtEnvelope(inspector Inspector, network rgb_lib.BitcoinNetwork, kind Kind, psbt string) (*Envelope, error) {
+	switch kind {
+	case KindCreateUtxos, KindDrainTo, KindSendBtc:
+	default:
+		return nil, fmt.Errorf("%w: %s needs its begin result", ErrKindMismatch, kind)
+	}
+	return newEnvelope(inspector, network, kind, psbt)
+}
+
+// WithSignedPsbt returns a copy of the envelope carrying the signed PSBT. The
+// copy is unsigned and has to be signed again if envelope signatures are in
+// use.
+func (e *Envelope) WithSignedPsbt(signedPsbt string) *Envelope {
+	c := *e
+	c.Psbt = signedPsbt
+	c.Signed = true
+	c.PublicKey = nil
+	c.Signature = nil
+	return &c
+}
+
+func (e *Envelope) signingBytes() ([]byte, error) {
+	c := *e
+	c.Signature = nil
+	return json.Marshal(&c)
+}
+
+// Sign signs the envelope with the given key.
+func (e *Envelope) Sign(key ed25519.PrivateKey) error {
+	e.PublicKey = key.Public().(ed25519.PublicKey)
+	msg, err := e.signingBytes()
+	if err != nil {
+		return err
+	}
+	e.Signature = ed25519.Sign(key, msg)
+	return nil
+}
+
+// Verify checks the envelope signature and that it was made by one of the
+// trusted keys.
+func (e *Envelope) Verify(trusted ...ed25519.PublicKey) error {
+	if len(e.Signature) == 0 || len(e.PublicKey) != ed25519.PublicKeySize {
+		return ErrUnsigned
+	}
+	msg, err := e.signingBytes()
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(e.PublicKey, msg, e.Signature) {
+		return ErrBadSignature
+	}
+	for _, k := range trusted {
+		if bytes.Equal(k, e.PublicKey) {
+			return nil
+		}
+	}
+	return ErrUntrustedKey
+}
+
+func (e *Envelope) Marshal() ([]byte, error) {
+	return json.MarshalIndent(e, "", "  ")
+}
+
+func Unmarshal(data []byte) (*Envelope, error) {
+	var e Envelope
+	if err := json.Unmarshal(data, &e); err != nil {
+		return nil, err
+	}
+	if e.Version != EnvelopeVersion {
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedVersion, e.Version)
+	}
+	return &e, nil
+}
+
+// WriteFile writes the envelope to path, readable only by the owner.
+func WriteFile(path string, e *Envelope) error {
+	data, err := e.Marshal()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o600)
+}
+
+func ReadFile(path string) (*Envelope, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Unmarshal(data)
+}
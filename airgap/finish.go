@@ -0,0 +1,90 @@
+package airgap
+
+import (
+	"context"
+	"fmt"
+
+	rgb_lib "github.com/UTEXO-Protocol/rgb-lib-go"
+)
+
+// SignWith signs the PSBT of a pending envelope on the offline side and
+// returns the envelope to send back.
+func SignWith(ctx context.Context, signer rgb_lib.Signer, pending *Envelope) (*Envelope, error) {
+	if pending.Signed {
+		return nil, fmt.Errorf("%w: envelope already holds a signed psbt", ErrKindMismatch)
+	}
+	signed, err := signer.SignPsbt(ctx, pending.Psbt)
+	if err != nil {
+		return nil, fmt.Errorf("sign psbt: %w", err)
+	}
+	return pending.WithSignedPsbt(signed), nil
+}
+
+// Result is the outcome of Finish. Operation is set for send, burn and
+// inflate, CreatedUtxos for create_utxos and Txid for every kind.
+type Result struct {
+	Kind         Kind
+	Txid         string
+	Operation    *rgb_lib.OperationResult
+	CreatedUtxos uint8
+}
+
+// Check verifies that signed is the signed counterpart of pending: same kind
+// and network, and a PSBT for the same unsigned transaction.
+func Check(inspector Inspector, pending, signed *Envelope) error {
+	if !signed.Signed {
+		return fmt.Errorf("%w: psbt is not signed", ErrKindMismatch)
+	}
+	if signed.Kind != pending.Kind {
+		return fmt.Errorf("%w: expected %s, got %s", ErrKindMismatch, pending.Kind, signed.Kind)
+	}
+	if signed.Network != pending.Network {
+		return fmt.Errorf("%w: expected network %s, got %s", ErrKindMismatch, pending.Network, signed.Network)
+	}
+	inspection, err := inspector.InspectPsbt(signed.Psbt)
+	if err != nil {
+		return err
+	}
+	if inspection.Txid != pending.Txid || signed.Txid != pending.Txid {
+		return fmt.Errorf("%w: expected %s, got %s", ErrTxMismatch, pending.Txid, inspection.Txid)
+	}
+	return nil
+}
+
+// Finish checks the signed envelope against the pending one and completes the
+// operation with the matching End method. Envelope signatures, if used, must
+// be verified by the caller before calling Finish.
+func Finish(wallet rgb_lib.WalletInterface, online rgb_lib.Online, pending, signed *Envelope) (Result, error) {
+	if err := Check(wallet, pending, signed); err != nil {
+		return Result{}, err
+	}
+	res := Result{Kind: pending.Kind}
+	var err error
+	switch pending.Kind {
+	case KindSend:
+		var op rgb_lib.OperationResult
+		op, err = wallet.SendEnd(online, signed.Psbt)
+		res.Operation, res.Txid = &op, op.Txid
+	case KindBurn:
+		var op rgb_lib.OperationResult
+		op, err = wallet.BurnEnd(online, signed.Psbt)
+		res.Operation, res.Txid = &op, op.Txid
+	case KindInflate:
+		var op rgb_lib.OperationResult
+		op, err = wallet.InflateEnd(online, signed.Psbt)
+		res.Operation, res.Txid = &op, op.Txid
+	case KindCreateUtxos:
+		res.CreatedUtxos, err = wallet.CreateUtxosEnd(online, signed.Psbt)
+		res.Txid = pending.Txid
+	case KindDrainTo:
+		res.Txid, err = wallet.DrainToEnd(online, signed.Psbt)
+	case KindSendBtc:
+		res.Txid, err = wallet.SendBtcEnd(online, signed.Psbt)
+	default:
+		return Result{}, fmt.Errorf("%w: unknown kind %q", ErrKindMismatch, pending.Kind)
+	}
+	if err != nil {
+		return Result{}, err
+	}
+	return res, nil
+}
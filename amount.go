@@ -0,0 +1,262 @@
+package rgb_lib
+
+import (
+	"errors"
+	"fmt"
+	"math/bits"
+	"strconv"
+	"strings"
+)
+
+// MaxPrecision is the highest precision accepted by rgb-lib for fungible assets.
+const MaxPrecision uint8 = 18
+
+var (
+	ErrAmountInvalid           = errors.New("invalid amount")
+	ErrAmountOverflow          = errors.New("amount overflow")
+	ErrAmountUnderflow         = errors.New("amount underflow")
+	ErrAmountPrecision         = errors.New("invalid amount precision")
+	ErrAmountPrecisionMismatch = errors.New("amount precision mismatch")
+)
+
+// Amount is a raw asset quantity bound to the precision of its asset, so that
+// "12.345" with precision 3 and the raw value 12345 are the same Amount.
+type Amount struct {
+	Raw       uint64 `json:"raw"`
+	Precision uint8  `json:"precision"`
+}
+
+// NewAmount wraps a raw value expressed in the smallest unit of an asset.
+func NewAmount(raw uint64, precision uint8) (Amount, error) {
+	if precision > MaxPrecision {
+		return Amount{}, fmt.Errorf("%w: %d is above %d", ErrAmountPrecision, precision, MaxPrecision)
+	}
+	return Amount{Raw: raw, Precision: precision}, nil
+}
+
+// ParseAmount parses a decimal string such as "12.345" into an Amount with the
+// given precision. The conversion is exact: more fractional digits than the
+// precision allows, signs, exponents and values above the uint64 range are
+// rejected instead of being rounded.
+func ParseAmount(s string, precision uint8) (Amount, error) {
+	if precision > MaxPrecision {
+		return Amount{}, fmt.Errorf("%w: %d is above %d", ErrAmountPrecision, precision, MaxPrecision)
+	}
+	s = strings.TrimSpace(s)
+	intPart, fracPart, hasDot := strings.Cut(s, ".")
+	if intPart == "" && fracPart == "" || hasDot && fracPart == "" {
+		return Amount{}, fmt.Errorf("%w: %q", ErrAmountInvalid, s)
+	}
+	if len(fracPart) > int(precision) {
+		return Amount{}, fmt.Errorf("%w: %q has more than %d decimals", ErrAmountInvalid, s, precision)
+	}
+	fracPart += strings.Repeat("0", int(precision)-len(fracPart))
+
+	var raw uint64
+	for _, c := range intPart + fracPart {
+		if c < '0' || c > '9' {
+			return Amount{}, fmt.Errorf("%w: %q", ErrAmountInvalid, s)
+		}
+		hi, lo := bits.Mul64(raw, 10)
+		sum, carry := bits.Add64(lo, uint64(c-'0'), 0)
+		if hi != 0 || carry != 0 {
+			return Amount{}, fmt.Errorf("%w: %q", ErrAmountOverflow, s)
+		}
+		raw = sum
+	}
+	return Amount{Raw: raw, Precision: precision}, nil
+}
+
+// MustParseAmount is like ParseAmount but panics on error. It is meant for
+// constants and tests.
+func MustParseAmount(s string, precision uint8) Amount {
+	a, err := ParseAmount(s, precision)
+	if err != nil {
+		panic(err)
+	}
+	return a
+}
+
+// String formats the amount as a decimal string, keeping all the decimals
+// allowed by the precision (e.g. "12.340" for precision 3). It works on the
+// digits of Raw, so that an Amount built with a precision above MaxPrecision
+// still formats.
+func (a Amount) String() string {
+	digits := strconv.FormatUint(a.Raw, 10)
+	p := int(a.Precision)
+	if p == 0 {
+		return digits
+	}
+	if len(digits) <= p {
+		digits = strings.Repeat("0", p-len(digits)+1) + digits
+	}
+	return digits[:len(digits)-p] + "." + digits[len(digits)-p:]
+}
+
+// TrimmedString formats the amount like String but drops trailing zero
+// decimals (e.g. "12.34" instead of "12.340").
+func (a Amount) TrimmedString() string {
+	s := a.String()
+	if a.Precision == 0 {
+		return s
+	}
+	s = strings.TrimRight(s, "0")
+	return strings.TrimSuffix(s, ".")
+}
+
+func (a Amount) IsZero() bool {
+	return a.Raw == 0
+}
+
+// Cmp compares two amounts with the same precision, returning -1, 0 or +1.
+func (a Amount) Cmp(b Amount) (int, error) {
+	if err := a.checkPrecision(b); err != nil {
+		return 0, err
+	}
+	switch {
+	case a.Raw < b.Raw:
+		return -1, nil
+	case a.Raw > b.Raw:
+		return 1, nil
+	default:
+		return 0, nil
+	}
+}
+
+func (a Amount) Add(b Amount) (Amount, error) {
+	if err := a.checkPrecision(b); err != nil {
+		return Amount{}, err
+	}
+	sum, carry := bits.Add64(a.Raw, b.Raw, 0)
+	if carry != 0 {
+		return Amount{}, fmt.Errorf("%w: %s + %s", ErrAmountOverflow, a, b)
+	}
+	return Amount{Raw: sum, Precision: a.Precision}, nil
+}
+
+func (a Amount) Sub(b Amount) (Amount, error) {
+	if err := a.checkPrecision(b); err != nil {
+		return Amount{}, err
+	}
+	diff, borrow := bits.Sub64(a.Raw, b.Raw, 0)
+	if borrow != 0 {
+		return Amount{}, fmt.Errorf("%w: %s - %s", ErrAmountUnderflow, a, b)
+	}
+	return Amount{Raw: diff, Precision: a.Precision}, nil
+}
+
+// Mul multiplies the amount by an integer factor.
+func (a Amount) Mul(factor uint64) (Amount, error) {
+	hi, lo := bits.Mul64(a.Raw, factor)
+	if hi != 0 {
+		return Amount{}, fmt.Errorf("%w: %s * %d", ErrAmountOverflow, a, factor)
+	}
+	return Amount{Raw: lo, Precision: a.Precision}, nil
+}
+
+// SumAmounts adds up amounts sharing the same precision.
+func SumAmounts(precision uint8, amounts ...Amount) (Amount, error) {
+	total, err := NewAmount(0, precision)
+	if err != nil {
+		return Amount{}, err
+	}
+	for _, a := range amounts {
+		if total, err = total.Add(a); err != nil {
+			return Amount{}, err
+		}
+	}
+	return total, nil
+}
+
+func (a Amount) checkPrecision(b Amount) error {
+	if a.Precision != b.Precision {
+		return fmt.Errorf("%w: %d != %d", ErrAmountPrecisionMismatch, a.Precision, b.Precision)
+	}
+	return nil
+}
+
+// Assignment returns the fungible assignment for this amount.
+func (a Amount) Assignment() Assignment {
+	return AssignmentFungible{Amount: a.Raw}
+}
+
+// Recipient returns a Recipient receiving this amount. witnessData must be set
+// for witness recipients and left nil for blinded ones.
+func (a Amount) Recipient(recipientId string, witnessData *WitnessData, transportEndpoints []string) Recipient {
+	return Recipient{
+		RecipientId:        recipientId,
+		WitnessData:        witnessData,
+		Assignment:         a.Assignment(),
+		TransportEndpoints: transportEndpoints,
+	}
+}
+
+// ParseFungibleAssignment builds a fungible Assignment from a user-entered
+// decimal string.
+func ParseFungibleAssignment(s string, precision uint8) (Assignment, error) {
+	a, err := ParseAmount(s, precision)
+	if err != nil {
+		return nil, err
+	}
+	return a.Assignment(), nil
+}
+
+// ParseRecipient builds a fungible Recipient from a user-entered decimal
+// string.
+func ParseRecipient(recipientId string, amount string, precision uint8, witnessData *WitnessData, transportEndpoints []string) (Recipient, error) {
+	a, err := ParseAmount(amount, precision)
+	if err != nil {
+		return Recipient{}, err
+	}
+	return a.Recipient(recipientId, witnessData, transportEndpoints), nil
+}
+
+// AssignmentAmount returns the amount carried by a fungible or inflation-right
+// assignment. The second result is false for the other assignment kinds.
+func AssignmentAmount(assignment Assignment, precision uint8) (Amount, bool) {
+	switch a := assignment.(type) {
+	case AssignmentFungible:
+		return Amount{Raw: a.Amount, Precision: precision}, true
+	case AssignmentInflationRight:
+		return Amount{Raw: a.Amount, Precision: precision}, true
+	default:
+		return Amount{}, false
+	}
+}
+
+// BalanceAmounts is a Balance with each value bound to the asset precision.
+type BalanceAmounts struct {
+	Settled   Amount
+	Future    Amount
+	Spendable Amount
+}
+
+// Amounts binds the balance values to the given precision.
+func (b Balance) Amounts(precision uint8) BalanceAmounts {
+	return BalanceAmounts{
+		Settled:   Amount{Raw: b.Settled, Precision: precision},
+		Future:    Amount{Raw: b.Future, Precision: precision},
+		Spendable: Amount{Raw: b.Spendable, Precision: precision},
+	}
+}
+
+// IssueAmounts converts decimal strings into the raw amounts expected by the
+// IssueAsset* methods, checking that their sum does not overflow.
+func IssueAmounts(precision uint8, amounts ...string) ([]uint64, error) {
+	total, err := NewAmount(0, precision)
+	if err != nil {
+		return nil, err
+	}
+	raw := make([]uint64, 0, len(amounts))
+	for _, s := range amounts {
+		a, err := ParseAmount(s, precision)
+		if err != nil {
+			return nil, err
+		}
+		if total, err = total.Add(a); err != nil {
+			return nil, err
+		}
+		raw = append(raw, a.Raw)
+	}
+	return raw, nil
+}
@@ -0,0 +1,73 @@
+package rgb_lib
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestAmountString(t *testing.T) {
+	for _, c := range []struct {
+		amount  Amount
+		s       string
+		trimmed string
+	}{
+		{Amount{Raw: 12340, Precision: 3}, "12.340", "12.34"},
+		{Amount{Raw: 5, Precision: 3}, "0.005", "0.005"},
+		{Amount{Raw: 0, Precision: 2}, "0.00", "0"},
+		{Amount{Raw: 123, Precision: 0}, "123", "123"},
+		{Amount{Raw: 1<<64 - 1, Precision: MaxPrecision}, "18.446744073709551615", "18.446744073709551615"},
+		// above MaxPrecision, only reachable with a struct literal
+		{Amount{Raw: 1<<64 - 1, Precision: 19}, "1.8446744073709551615", "1.8446744073709551615"},
+		{Amount{Raw: 7, Precision: 255}, "0." + strings.Repeat("0", 254) + "7", "0." + strings.Repeat("0", 254) + "7"},
+	} {
+		if got := c.amount.String(); got != c.s {
+			t.Errorf("%+v: String = %q, want %q", c.amount, got, c.s)
+		}
+		if got := c.amount.TrimmedString(); got != c.trimmed {
+			t.Errorf("%+v: TrimmedString = %q, want %q", c.amount, got, c.trimmed)
+		}
+	}
+}
+
+func TestParseAmount(t *testing.T) {
+	for _, s := range []string{"0", "12.34", "0.000001", "18446744073709.551615"} {
+		a, err := ParseAmount(s, 6)
+		if err != nil {
+			t.Fatalf("ParseAmount(%q): %v", s, err)
+		}
+		if back, err := ParseAmount(a.String(), 6); err != nil || back != a {
+			t.Errorf("round trip of %q: %+v, %v", s, back, err)
+		}
+	}
+	for s, want := range map[string]error{
+		"":                      ErrAmountInvalid,
+		"1.":                    ErrAmountInvalid,
+		"-1":                    ErrAmountInvalid,
+		"1e3":                   ErrAmountInvalid,
+		"0.0000001":             ErrAmountInvalid,
+		"18446744073709.551616": ErrAmountOverflow,
+	} {
+		if _, err := ParseAmount(s, 6); !errors.Is(err, want) {
+			t.Errorf("ParseAmount(%q) = %v, want %v", s, err, want)
+		}
+	}
+	if _, err := ParseAmount("1", MaxPrecision+1); !errors.Is(err, ErrAmountPrecision) {
+		t.Errorf("precision above MaxPrecision: %v", err)
+	}
+}
+
+func TestAmountJSON(t *testing.T) {
+	data, err := json.Marshal(Amount{Raw: 1250, Precision: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"raw":1250,"precision":2}` {
+		t.Fatalf("Marshal = %s", data)
+	}
+	var a Amount
+	if err := json.Unmarshal(data, &a); err != nil || a != (Amount{Raw: 1250, Precision: 2}) {
+		t.Fatalf("Unmarshal = %+v, %v", a, err)
+	}
+}
@@ -0,0 +1,154 @@
+package rgb_lib
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/UTEXO-Protocol/rgb-lib-go/psbt"
+)
+
+// CapacityWallet is the subset of Wallet needed by PlanCapacity.
+type CapacityWallet interface {
+	ListUnspents(online *Online, settledOnly bool, skipSync bool) ([]Unspent, error)
+	GetWalletData() WalletData
+	GetBtcBalance(online *Online, skipSync bool) (BtcBalance, error)
+	CreateUtxosBegin(online Online, upTo bool, num *uint8, size *uint32, feeRate uint64, skipSync bool, dryRun bool) (string, error)
+}
+
+// DefaultUtxoSize is the size, in sats, of the UTXOs created by CreateUtxos
+// when no size is given.
+const DefaultUtxoSize uint32 = 1000
+
+// CapacityRequest describes the expected load. Receives counts blinded
+// receives, which take a slot on a wallet UTXO until they settle; witness
+// receives create their own output and need none. Sends counts sends, each
+// taking a slot for its change.
+type CapacityRequest struct {
+	Receives int
+	Sends    int
+	FeeRate  uint64
+	// UtxoSize is the size of the UTXOs to create. Nil means DefaultUtxoSize.
+	UtxoSize *uint32
+	// DryRun confirms the estimate with CreateUtxosBegin in dry-run mode. It
+	// is skipped when no UTXO or more than one CreateUtxos call is needed,
+	// and the estimate is kept when the wallet lacks the bitcoin for it.
+	DryRun bool
+}
+
+// UtxoCapacity is the allocation room of a colorable UTXO.
+type UtxoCapacity struct {
+	Outpoint       Outpoint
+	BtcAmount      uint64
+	Allocations    int
+	PendingBlinded uint32
+	FreeSlots      int
+}
+
+// CapacityReport tells whether a wallet can handle a CapacityRequest and, if
+// not, what creating the missing UTXOs costs.
+type CapacityReport struct {
+	Request CapacityRequest
+	Utxos   []UtxoCapacity
+	AllocationSlots
+	MaxAllocationsPerUtxo uint32
+	// NeededSlots is the number of slots the request takes and MissingSlots
+	// the part of them not available.
+	NeededSlots  int
+	MissingSlots int
+	// NewUtxos is the number of UTXOs to create and CreateCalls the number of
+	// CreateUtxos calls needed, as each creates at most 255 UTXOs.
+	NewUtxos    int
+	CreateCalls int
+	// UtxoCost is the bitcoin locked in the new UTXOs and FeeCost the
+	// estimated fee of creating them, both in sats.
+	UtxoCost uint64
+	FeeCost  uint64
+	// Confirmed reports whether FeeCost comes from a dry run rather than an
+	// estimate of the transaction size.
+	Confirmed bool
+	Vanilla   Balance
+	// Sufficient reports whether the spendable vanilla balance covers
+	// UtxoCost and FeeCost.
+	Sufficient bool
+}
+
+// PlanCapacity reports the free allocation slots of each colorable UTXO, the
+// UTXOs needed by req and their cost at req.FeeRate.
+func PlanCapacity(wallet CapacityWallet, online Online, req CapacityRequest) (*CapacityReport, error) {
+	unspents, err := wallet.ListUnspents(&online, false, false)
+	if err != nil {
+		return nil, err
+	}
+	balance, err := wallet.GetBtcBalance(&online, true)
+	if err != nil {
+		return nil, err
+	}
+	maxAllocations := wallet.GetWalletData().MaxAllocationsPerUtxo
+	if maxAllocations == 0 {
+		return nil, errors.New("wallet allows no allocations per UTXO")
+	}
+	size := DefaultUtxoSize
+	if req.UtxoSize != nil {
+		size = *req.UtxoSize
+	}
+
+	r := &CapacityReport{
+		Request:               req,
+		AllocationSlots:       CountAllocationSlots(unspents, maxAllocations),
+		MaxAllocationsPerUtxo: maxAllocations,
+		NeededSlots:           req.Receives + req.Sends,
+		Vanilla:               balance.Vanilla,
+	}
+	for _, u := range unspents {
+		if !u.Utxo.Colorable || !u.Utxo.Exists {
+			continue
+		}
+		c := UtxoCapacity{
+			Outpoint:       u.Utxo.Outpoint,
+			BtcAmount:      u.Utxo.BtcAmount,
+			Allocations:    len(u.RgbAllocations),
+			PendingBlinded: u.PendingBlinded,
+		}
+		c.FreeSlots = max(int(maxAllocations)-c.Allocations-int(u.PendingBlinded), 0)
+		r.Utxos = append(r.Utxos, c)
+	}
+
+	r.MissingSlots = max(r.NeededSlots-r.FreeSlots, 0)
+	r.NewUtxos = (r.MissingSlots + int(maxAllocations) - 1) / int(maxAllocations)
+	r.CreateCalls = (r.NewUtxos + 254) / 255
+	r.UtxoCost = uint64(r.NewUtxos) * uint64(size)
+	for n := r.NewUtxos; n > 0; n -= 255 {
+		r.FeeCost += createUtxosVSize(min(n, 255)) * req.FeeRate
+	}
+
+	if req.DryRun && r.CreateCalls == 1 {
+		num := uint8(r.NewUtxos)
+		unsigned, err := wallet.CreateUtxosBegin(online, false, &num, &size, req.FeeRate, true, true)
+		var insufficient *RgbLibErrorInsufficientBitcoins
+		switch {
+		case errors.As(err, &insufficient):
+			// the estimate stands and Sufficient reports the shortfall
+		case err != nil:
+			return nil, fmt.Errorf("dry run: %w", err)
+		default:
+			packet, err := psbt.Parse(unsigned)
+			if err != nil {
+				return nil, fmt.Errorf("dry run: %w", err)
+			}
+			fee, err := packet.Fee()
+			if err != nil {
+				return nil, fmt.Errorf("dry run: %w", err)
+			}
+			r.FeeCost, r.Confirmed = fee, true
+		}
+	}
+	r.Sufficient = r.Vanilla.Spendable >= r.UtxoCost+r.FeeCost
+	return r, nil
+}
+
+// createUtxosVSize estimates the size of a transaction creating n taproot
+// outputs from two taproot inputs, with change.
+func createUtxosVSize(n int) uint64 {
+	const overhead, input, output = 11, 58, 43
+	return overhead + 2*input + uint64(n+1)*output
+}
@@ -0,0 +1,280 @@
+package rgb_lib
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+type OrderState string
+
+const (
+	OrderPending OrderState = "pending"
+	OrderPaid    OrderState = "paid"
+	OrderExpired OrderState = "expired"
+	OrderFailed  OrderState = "failed"
+)
+
+// PaymentMatch compares the amount received for an order with the requested
+// one.
+type PaymentMatch string
+
+const (
+	PaymentExact     PaymentMatch = "exact"
+	PaymentUnderpaid PaymentMatch = "underpaid"
+	PaymentOverpaid  PaymentMatch = "overpaid"
+)
+
+var ErrOrderNotFound = errors.New("order not found")
+
+// Order is a request for a payment in an RGB fungible asset. Received and
+// Match are set once the payment settles.
+type Order struct {
+	Id          string        `json:"id"`
+	AssetId     string        `json:"asset_id"`
+	Amount      Amount        `json:"amount"`
+	Invoice     string        `json:"invoice"`
+	RecipientId string        `json:"recipient_id"`
+	State       OrderState    `json:"state"`
+	Received    *Amount       `json:"received,omitempty"`
+	Match       *PaymentMatch `json:"match,omitempty"`
+	ExpiresAt   *uint64       `json:"expires_at,omitempty"`
+	CreatedAt   int64         `json:"created_at"`
+	UpdatedAt   int64         `json:"updated_at"`
+}
+
+// OrderStore persists orders. Get returns ErrOrderNotFound for unknown IDs
+// and List returns the orders in the given states, or all of them.
+type OrderStore interface {
+	Get(id string) (Order, error)
+	Put(order Order) error
+	List(states ...OrderState) ([]Order, error)
+}
+
+// MemoryOrderStore keeps orders in memory. It is safe for concurrent use.
+type MemoryOrderStore struct {
+	*recordStore[Order]
+}
+
+func NewMemoryOrderStore() *MemoryOrderStore {
+	return &MemoryOrderStore{newRecordStore(
+		func(o Order) string { return o.Id },
+		func(a, b Order) int { return cmp.Compare(a.CreatedAt, b.CreatedAt) },
+		ErrOrderNotFound,
+	)}
+}
+
+func (s *MemoryOrderStore) List(states ...OrderState) ([]Order, error) {
+	return s.list(func(o Order) bool {
+		return len(states) == 0 || slices.Contains(states, o.State)
+	}), nil
+}
+
+type CheckoutOptions struct {
+	// Expiry is the validity of order invoices, e.g. 30 minutes.
+	Expiry             time.Duration
+	TransportEndpoints []string
+	MinConfirmations   uint8
+	// Witness creates invoices with WitnessReceive instead of BlindReceive.
+	Witness bool
+	// Grace is how long an expired invoice still waits for the sender.
+	Grace time.Duration
+	// OnChange, if set, is called after an order changes state.
+	OnChange func(order Order)
+}
+
+// Checkout creates an invoice per order and moves orders to paid, expired or
+// failed as their payments progress. Payments are compared with the ordered
+// amount: an overpaid order is paid, an underpaid one fails with Match set
+// to PaymentUnderpaid so that the merchant can refund or settle it by hand.
+type Checkout struct {
+	receives *ReceiveManager
+	orders   OrderStore
+	opts     CheckoutOptions
+	now      func() time.Time
+}
+
+// NewCheckout returns a checkout tracking invoices in receives and orders in
+// orders. Both stores must be persistent for the checkout to survive
+// restarts.
+func NewCheckout(wallet ReceiveWallet, online Online, receives ReceiveStore, orders OrderStore, opts CheckoutOptions) *Checkout {
+	c := &Checkout{orders: orders, opts: opts, now: time.Now}
+	c.receives = NewReceiveManager(wallet, online, receives, ReceiveCallbacks{
+		OnSettled: c.settled,
+		OnFailed: func(record ReceiveRecord, _ AssetTransfer) error {
+			return c.finish(record.OrderId, OrderFailed, nil)
+		},
+		OnExpired: func(record ReceiveRecord) error {
+			return c.finish(record.OrderId, OrderExpired, nil)
+		},
+	}).WithGrace(opts.Grace)
+	return c
+}
+
+// CreateOrder creates the invoice of an order. amount must use the precision
+// of the asset. Retrying after a failure returns the order created by the
+// first attempt, if any.
+func (c *Checkout) CreateOrder(id, assetId string, amount Amount) (Order, error) {
+	if order, err := c.orders.Get(id); err == nil {
+		return order, nil
+	} else if !errors.Is(err, ErrOrderNotFound) {
+		return Order{}, err
+	}
+	if amount.IsZero() {
+		return Order{}, fmt.Errorf("%w: order amount is zero", ErrAmountInvalid)
+	}
+	record, err := c.receives.Get(id)
+	if errors.Is(err, ErrReceiveNotFound) {
+		record, err = c.receives.Create(ReceiveRequest{
+			OrderId:            id,
+			AssetId:            &assetId,
+			Assignment:         amount.Assignment(),
+			Expiry:             c.opts.Expiry,
+			TransportEndpoints: c.opts.TransportEndpoints,
+			MinConfirmations:   c.opts.MinConfirmations,
+			Witness:            c.opts.Witness,
+		})
+	}
+	if err != nil {
+		return Order{}, err
+	}
+	order := Order{
+		Id:          id,
+		AssetId:     assetId,
+		Amount:      amount,
+		Invoice:     record.Invoice,
+		RecipientId: record.RecipientId,
+		State:       OrderPending,
+		ExpiresAt:   record.ExpirationTimestamp,
+		CreatedAt:   record.CreatedAt,
+		UpdatedAt:   record.CreatedAt,
+	}
+	if err := c.orders.Put(order); err != nil {
+		return Order{}, err
+	}
+	return order, nil
+}
+
+func (c *Checkout) Order(id string) (Order, error) {
+	return c.orders.Get(id)
+}
+
+// Orders returns the orders in the given states, or all of them.
+func (c *Checkout) Orders(states ...OrderState) ([]Order, error) {
+	return c.orders.List(states...)
+}
+
+func (c *Checkout) settled(record ReceiveRecord, transfer AssetTransfer) error {
+	order, err := c.orders.Get(record.OrderId)
+	if errors.Is(err, ErrOrderNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var raw uint64
+	for _, a := range transfer.Assignments {
+		raw += fungibleAmount(a)
+	}
+	received := Amount{Raw: raw, Precision: order.Amount.Precision}
+	match := PaymentExact
+	state := OrderPaid
+	// same precision, Cmp cannot fail
+	sign, _ := received.Cmp(order.Amount)
+	switch sign {
+	case -1:
+		match, state = PaymentUnderpaid, OrderFailed
+	case 1:
+		match = PaymentOverpaid
+	}
+	return c.finish(record.OrderId, state, func(o *Order) {
+		o.Received = &received
+		o.Match = &match
+	})
+}
+
+// finish moves a pending order to state. Orders already final are left as
+// they are, so that a callback called again changes nothing. A receive
+// without an order, whose creation failed, is ignored: if the order is
+// created later, Refresh finishes it.
+func (c *Checkout) finish(id string, state OrderState, update func(*Order)) error {
+	order, err := c.orders.Get(id)
+	if errors.Is(err, ErrOrderNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if order.State != OrderPending {
+		return nil
+	}
+	order.State = state
+	order.UpdatedAt = c.now().Unix()
+	if update != nil {
+		update(&order)
+	}
+	if err := c.orders.Put(order); err != nil {
+		return err
+	}
+	if c.opts.OnChange != nil {
+		c.opts.OnChange(order)
+	}
+	return nil
+}
+
+// Refresh refreshes the pending payments and updates their orders. Orders
+// failing to update are retried by the next Refresh. Pending orders whose
+// receive is already final and notified, e.g. because the order was saved
+// after the notification, are finished from the receive record.
+func (c *Checkout) Refresh(ctx context.Context) error {
+	err := c.receives.Refresh(ctx)
+	return errors.Join(err, c.reconcile(ctx))
+}
+
+func (c *Checkout) reconcile(ctx context.Context) error {
+	orders, err := c.orders.List(OrderPending)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, order := range orders {
+		if err := ctx.Err(); err != nil {
+			return errors.Join(append(errs, err)...)
+		}
+		record, err := c.receives.Get(order.Id)
+		if err == nil && record.State.Final() && record.Notified {
+			err = c.finishFrom(record)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("order %s: %w", order.Id, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// finishFrom finishes the order of a final receive record.
+func (c *Checkout) finishFrom(record ReceiveRecord) error {
+	switch record.State {
+	case ReceiveFailed:
+		return c.finish(record.OrderId, OrderFailed, nil)
+	case ReceiveExpired:
+		return c.finish(record.OrderId, OrderExpired, nil)
+	}
+	page, err := NewTransferQuery().WithRecipientId(record.RecipientId).Run(c.receives.wallet)
+	if err != nil {
+		return err
+	}
+	if len(page.Transfers) == 0 {
+		return errors.New("transfer of settled receive not found")
+	}
+	return c.settled(record, page.Transfers[0])
+}
+
+// Run calls Refresh every interval until ctx is done, passing its errors to
+// onError.
+func (c *Checkout) Run(ctx context.Context, interval time.Duration, onError func(error)) error {
+	return runEvery(ctx, interval, onError, c.Refresh)
+}
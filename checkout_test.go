@@ -0,0 +1,73 @@
+package rgb_lib
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestCheckoutOrders(t *testing.T) {
+	wallet := newFakeWallet()
+	var changes []string
+	c := NewCheckout(wallet, Online{}, NewMemoryReceiveStore(), NewMemoryOrderStore(), CheckoutOptions{
+		Expiry:   time.Hour,
+		Witness:  true,
+		OnChange: func(o Order) { changes = append(changes, o.Id+" "+string(o.State)) },
+	})
+	now := time.Unix(1700000000, 0)
+	c.now = func() time.Time { return now }
+	c.receives.now = c.now
+
+	price := MustParseAmount("1.00", 2)
+	orders := map[string]Order{}
+	for _, id := range []string{"exact", "under", "over", "unpaid"} {
+		order, err := c.CreateOrder(id, "rgb:a", price)
+		if err != nil {
+			t.Fatal(err)
+		}
+		orders[id] = order
+	}
+	if again, err := c.CreateOrder("exact", "rgb:a", price); err != nil || again != orders["exact"] || wallet.receives != 4 {
+		t.Fatalf("CreateOrder again = %+v, %v with %d receives, want the first order", again, err, wallet.receives)
+	}
+	if _, err := c.CreateOrder("zero", "rgb:a", Amount{Precision: 2}); err == nil {
+		t.Fatal("CreateOrder accepted a zero amount")
+	}
+
+	for id, raw := range map[string]uint64{"exact": 100, "under": 99, "over": 150} {
+		wallet.transfer(orders[id].RecipientId, TransferStatusSettled, AssignmentFungible{Amount: raw})
+	}
+	now = now.Add(2 * time.Hour)
+	for range 2 {
+		if err := c.Refresh(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(changes) != 4 {
+		t.Fatalf("changes %v, want one per order", changes)
+	}
+	for id, want := range map[string]struct {
+		state OrderState
+		match PaymentMatch
+	}{
+		"exact":  {OrderPaid, PaymentExact},
+		"under":  {OrderFailed, PaymentUnderpaid},
+		"over":   {OrderPaid, PaymentOverpaid},
+		"unpaid": {OrderExpired, ""},
+	} {
+		o, err := c.Order(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var match PaymentMatch
+		if o.Match != nil {
+			match = *o.Match
+		}
+		if o.State != want.state || match != want.match || o.UpdatedAt != now.Unix() {
+			t.Errorf("order %s: %s %q at %d, want %s %q", id, o.State, match, o.UpdatedAt, want.state, want.match)
+		}
+	}
+	if paid, _ := c.Orders(OrderPaid); len(paid) != 2 {
+		t.Fatalf("%d paid orders, want 2", len(paid))
+	}
+}
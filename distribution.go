@@ -0,0 +1,458 @@
+package rgb_lib
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidManifest = errors.New("invalid distribution manifest")
+	// ErrJournalMismatch is returned when a journal belongs to another
+	// distribution than the one being run.
+	ErrJournalMismatch = errors.New("journal does not match the distribution")
+)
+
+// DistributionEntry is a line of a distribution manifest. Amount is a decimal
+// string in the precision of the asset; it may be empty when the invoice
+// requests an amount.
+type DistributionEntry struct {
+	Invoice string `json:"invoice"`
+	Amount  string `json:"amount,omitempty"`
+}
+
+// ReadDistributionCSV reads a manifest with an "invoice" column and an
+// optional "amount" column. The header row is required.
+func ReadDistributionCSV(r io.Reader) ([]DistributionEntry, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	rows, err := cr.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidManifest, err)
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("%w: missing header", ErrInvalidManifest)
+	}
+	invoiceCol, amountCol := -1, -1
+	for i, name := range rows[0] {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "invoice":
+			invoiceCol = i
+		case "amount":
+			amountCol = i
+		}
+	}
+	if invoiceCol < 0 {
+		return nil, fmt.Errorf("%w: missing invoice column", ErrInvalidManifest)
+	}
+	var entries []DistributionEntry
+	for n, row := range rows[1:] {
+		if len(row) <= invoiceCol {
+			return nil, fmt.Errorf("%w: line %d: missing invoice", ErrInvalidManifest, n+2)
+		}
+		e := DistributionEntry{Invoice: strings.TrimSpace(row[invoiceCol])}
+		if amountCol >= 0 && amountCol < len(row) {
+			e.Amount = strings.TrimSpace(row[amountCol])
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// ReadDistributionJSON reads a manifest holding a JSON array of entries.
+func ReadDistributionJSON(r io.Reader) ([]DistributionEntry, error) {
+	var entries []DistributionEntry
+	if err := json.NewDecoder(r).Decode(&entries); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidManifest, err)
+	}
+	return entries, nil
+}
+
+// LoadDistribution reads the manifest at path, as CSV or JSON depending on
+// its extension.
+func LoadDistribution(path string) ([]DistributionEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return ReadDistributionCSV(f)
+	case ".json":
+		return ReadDistributionJSON(f)
+	}
+	return nil, fmt.Errorf("%w: unknown extension of %s", ErrInvalidManifest, path)
+}
+
+// DistributionPayout is a validated manifest entry.
+type DistributionPayout struct {
+	Line      int       `json:"line"`
+	Invoice   string    `json:"invoice"`
+	Recipient Recipient `json:"-"`
+	Amount    Amount    `json:"amount"`
+	// Expiration is the expiration timestamp of the invoice, if any.
+	Expiration *uint64 `json:"expiration,omitempty"`
+}
+
+var errInvoiceExpired = errors.New("invoice expired")
+
+func (p DistributionPayout) expired(now uint64) bool {
+	return p.Expiration != nil && *p.Expiration <= now
+}
+
+// EntryError reports an invalid manifest entry. Line is 1-based and counts
+// entries, not CSV rows.
+type EntryError struct {
+	Line    int
+	Invoice string
+	Err     error
+}
+
+func (e *EntryError) Error() string {
+	return fmt.Sprintf("entry %d: %v", e.Line, e.Err)
+}
+
+func (e *EntryError) Unwrap() error {
+	return e.Err
+}
+
+// DistributionWallet is the subset of Wallet needed to validate a
+// distribution.
+type DistributionWallet interface {
+	MetadataSource
+	GetWalletData() WalletData
+}
+
+type DistributionOptions struct {
+	// BatchSize is the number of recipients per Send. Zero means 32.
+	BatchSize        int
+	FeeRate          uint64
+	MinConfirmations uint8
+	// WitnessAmountSat is the bitcoin amount sent to witness recipients.
+	// Zero means 1000.
+	WitnessAmountSat uint64
+	// UtxoSize is the size of the UTXOs created when the wallet has no free
+	// allocation slot left. Nil uses the wallet default.
+	UtxoSize *uint32
+	// OnBatch, if set, is called after each batch is sent.
+	OnBatch func(batch DistributionBatch)
+}
+
+// ValidateDistribution checks every entry of a manifest against the wallet
+// and the asset, and returns the payouts. The asset must be NIA or IFA. All
+// invalid entries are reported, joined as EntryErrors.
+func ValidateDistribution(wallet DistributionWallet, assetId string, entries []DistributionEntry, opts DistributionOptions) ([]DistributionPayout, error) {
+	return validateDistribution(wallet, assetId, entries, opts, true)
+}
+
+// validateDistribution is ValidateDistribution, checking invoice expiry only
+// if checkExpiry is set.
+func validateDistribution(wallet DistributionWallet, assetId string, entries []DistributionEntry, opts DistributionOptions, checkExpiry bool) ([]DistributionPayout, error) {
+	meta, err := wallet.GetAssetMetadata(assetId)
+	if err != nil {
+		return nil, err
+	}
+	if meta.AssetSchema != AssetSchemaNia && meta.AssetSchema != AssetSchemaIfa {
+		return nil, fmt.Errorf("%w: asset %s is %s, not NIA or IFA", ErrInvalidManifest, assetId, meta.AssetSchema)
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("%w: no entries", ErrInvalidManifest)
+	}
+	network := wallet.GetWalletData().BitcoinNetwork
+	witnessSat := opts.WitnessAmountSat
+	if witnessSat == 0 {
+		witnessSat = 1000
+	}
+	now := uint64(time.Now().Unix())
+
+	var payouts []DistributionPayout
+	var errs []error
+	seen := map[string]int{}
+	for i, e := range entries {
+		line := i + 1
+		payout, err := validateEntry(e, assetId, meta.Precision, network, witnessSat)
+		if err == nil && checkExpiry && payout.expired(now) {
+			err = errInvoiceExpired
+		}
+		if err == nil {
+			if first, dup := seen[payout.Recipient.RecipientId]; dup {
+				err = fmt.Errorf("same recipient as entry %d", first)
+			}
+		}
+		if err != nil {
+			errs = append(errs, &EntryError{Line: line, Invoice: e.Invoice, Err: err})
+			continue
+		}
+		seen[payout.Recipient.RecipientId] = line
+		payout.Line = line
+		payouts = append(payouts, payout)
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return payouts, nil
+}
+
+func validateEntry(e DistributionEntry, assetId string, precision uint8, network BitcoinNetwork, witnessSat uint64) (DistributionPayout, error) {
+	inv, err := NewInvoice(e.Invoice)
+	if err != nil {
+		return DistributionPayout{}, err
+	}
+	defer inv.Destroy()
+	data := inv.InvoiceData()
+	if data.Network != network {
+		return DistributionPayout{}, fmt.Errorf("invoice network %s, wallet network %s", data.Network, network)
+	}
+	if data.AssetId != nil && *data.AssetId != assetId {
+		return DistributionPayout{}, fmt.Errorf("invoice for asset %s", *data.AssetId)
+	}
+	var requested *Amount
+	switch a := data.Assignment.(type) {
+	case AssignmentFungible:
+		if a.Amount > 0 {
+			requested = &Amount{Raw: a.Amount, Precision: precision}
+		}
+	case AssignmentAny:
+	default:
+		return DistributionPayout{}, fmt.Errorf("invoice requests a %T", data.Assignment)
+	}
+	var amount Amount
+	switch {
+	case e.Amount != "":
+		if amount, err = ParseAmount(e.Amount, precision); err != nil {
+			return DistributionPayout{}, err
+		}
+		if requested != nil && amount.Raw != requested.Raw {
+			return DistributionPayout{}, fmt.Errorf("amount %s, invoice requests %s", amount, requested)
+		}
+	case requested != nil:
+		amount = *requested
+	default:
+		return DistributionPayout{}, errors.New("no amount in entry or invoice")
+	}
+	if amount.IsZero() {
+		return DistributionPayout{}, fmt.Errorf("%w: amount is zero", ErrAmountInvalid)
+	}
+	var witness *WitnessData
+	if strings.HasPrefix(data.RecipientId, "wvout:") {
+		witness = &WitnessData{AmountSat: witnessSat}
+	}
+	return DistributionPayout{
+		Invoice:    e.Invoice,
+		Recipient:  amount.Recipient(data.RecipientId, witness, data.TransportEndpoints),
+		Amount:     amount,
+		Expiration: data.ExpirationTimestamp,
+	}, nil
+}
+
+type BatchState string
+
+const (
+	BatchPending BatchState = "pending"
+	BatchSent    BatchState = "sent"
+	BatchFailed  BatchState = "failed"
+)
+
+// DistributionBatch is a Send of a distribution, as recorded in its journal.
+// Lines are the manifest entries it pays.
+type DistributionBatch struct {
+	Index            int        `json:"index"`
+	Key              string     `json:"key"`
+	Lines            []int      `json:"lines"`
+	State            BatchState `json:"state"`
+	Txid             string     `json:"txid,omitempty"`
+	BatchTransferIdx *int32     `json:"batch_transfer_idx,omitempty"`
+	Error            string     `json:"error,omitempty"`
+	UpdatedAt        int64      `json:"updated_at"`
+}
+
+// DistributionJournal is the progress of a distribution. It is rewritten
+// after every batch so that an interrupted run resumes where it stopped.
+type DistributionJournal struct {
+	RunId     string              `json:"run_id"`
+	AssetId   string              `json:"asset_id"`
+	Manifest  string              `json:"manifest"`
+	Batches   []DistributionBatch `json:"batches"`
+	CreatedAt int64               `json:"created_at"`
+}
+
+// Done reports whether every batch was sent.
+func (j *DistributionJournal) Done() bool {
+	for _, b := range j.Batches {
+		if b.State != BatchSent {
+			return false
+		}
+	}
+	return true
+}
+
+// Distribution pays the entries of a manifest in batches of Send calls. Each
+// batch goes through an IdempotentSender under a key derived from the run ID,
+// so that resuming after a crash never pays a batch twice, even when the crash
+// happened between the broadcast and the journal update.
+type Distribution struct {
+	sender  *IdempotentSender
+	online  Online
+	path    string
+	opts    DistributionOptions
+	journal DistributionJournal
+	payouts map[int]DistributionPayout
+}
+
+// NewDistribution validates entries and loads, or creates, the journal at
+// journalPath. An existing journal must belong to the same run ID, asset and
+// manifest. Invoice expiry is checked only when the journal is created: on
+// resume, Run checks it when it sends a batch without a recorded attempt.
+func NewDistribution(sender *IdempotentSender, online Online, runId, assetId string, entries []DistributionEntry, journalPath string, opts DistributionOptions) (*Distribution, error) {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 32
+	}
+	d := &Distribution{sender: sender, online: online, path: journalPath, opts: opts, payouts: map[int]DistributionPayout{}}
+	manifest := manifestHash(entries)
+	found, err := readJSONFile(journalPath, &d.journal)
+	if err != nil {
+		return nil, err
+	}
+	if found {
+		j := d.journal
+		if j.RunId != runId || j.AssetId != assetId || j.Manifest != manifest {
+			return nil, fmt.Errorf("%w: %s", ErrJournalMismatch, journalPath)
+		}
+	}
+	payouts, err := validateDistribution(sender.wallet.Wallet(), assetId, entries, opts, !found)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range payouts {
+		d.payouts[p.Line] = p
+	}
+	if found {
+		return d, nil
+	}
+	d.journal = DistributionJournal{RunId: runId, AssetId: assetId, Manifest: manifest, CreatedAt: time.Now().Unix()}
+	for start := 0; start < len(payouts); start += opts.BatchSize {
+		batch := DistributionBatch{Index: len(d.journal.Batches), State: BatchPending}
+		batch.Key = fmt.Sprintf("%s/%d", runId, batch.Index)
+		for _, p := range payouts[start:min(start+opts.BatchSize, len(payouts))] {
+			batch.Lines = append(batch.Lines, p.Line)
+		}
+		d.journal.Batches = append(d.journal.Batches, batch)
+	}
+	if err := writeJSONFile(journalPath, d.journal); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// Journal returns a copy of the journal.
+func (d *Distribution) Journal() DistributionJournal {
+	j := d.journal
+	j.Batches = append([]DistributionBatch(nil), j.Batches...)
+	return j
+}
+
+// Run sends the batches not sent yet, in order. A batch with an expired
+// invoice fails with an EntryError and the run goes on with the next one;
+// any other failure stops the run. Running it again retries the failed
+// batches.
+func (d *Distribution) Run(ctx context.Context) error {
+	var errs []error
+	for i := range d.journal.Batches {
+		batch := &d.journal.Batches[i]
+		if batch.State == BatchSent {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		err := d.ensureSlots(ctx)
+		var res OperationResult
+		if err == nil {
+			res, err = d.send(ctx, batch)
+		}
+		batch.UpdatedAt = time.Now().Unix()
+		if err != nil {
+			batch.State, batch.Error = BatchFailed, err.Error()
+		} else {
+			batch.State, batch.Error = BatchSent, ""
+			batch.Txid, batch.BatchTransferIdx = res.Txid, &res.BatchTransferIdx
+		}
+		if werr := writeJSONFile(d.path, d.journal); werr != nil {
+			return errors.Join(append(errs, err, fmt.Errorf("write journal: %w", werr))...)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("batch %d: %w", batch.Index, err))
+			if errors.Is(err, errInvoiceExpired) {
+				continue
+			}
+			break
+		}
+		if d.opts.OnBatch != nil {
+			d.opts.OnBatch(*batch)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (d *Distribution) send(ctx context.Context, batch *DistributionBatch) (OperationResult, error) {
+	// a batch with an intent may have been broadcast and must reach the
+	// sender to be reconciled, whatever the expiry of its invoices
+	_, err := d.sender.Lookup(batch.Key)
+	if err != nil && !errors.Is(err, ErrSendIntentNotFound) {
+		return OperationResult{}, err
+	}
+	checkExpiry := err != nil
+	now := uint64(time.Now().Unix())
+	recipients := make([]Recipient, 0, len(batch.Lines))
+	var expired []error
+	for _, line := range batch.Lines {
+		p := d.payouts[line]
+		if checkExpiry && p.expired(now) {
+			expired = append(expired, &EntryError{Line: line, Invoice: p.Invoice, Err: errInvoiceExpired})
+		}
+		recipients = append(recipients, p.Recipient)
+	}
+	if len(expired) > 0 {
+		return OperationResult{}, errors.Join(expired...)
+	}
+	recipientMap := map[string][]Recipient{d.journal.AssetId: recipients}
+	return d.sender.Send(ctx, batch.Key, d.online, recipientMap, false, d.opts.FeeRate, d.opts.MinConfirmations, nil)
+}
+
+// ensureSlots creates UTXOs when no colorable UTXO can take the change of a
+// batch.
+func (d *Distribution) ensureSlots(ctx context.Context) error {
+	w := d.sender.wallet
+	unspents, err := w.Wallet().ListUnspents(&d.online, false, false)
+	if err != nil {
+		return err
+	}
+	if CountAllocationSlots(unspents, w.Wallet().GetWalletData().MaxAllocationsPerUtxo).FreeSlots > 0 {
+		return nil
+	}
+	if _, err := w.CreateUtxos(ctx, d.online, false, nil, d.opts.UtxoSize, d.opts.FeeRate, true); err != nil {
+		return fmt.Errorf("create utxos: %w", err)
+	}
+	return nil
+}
+
+// manifestHash identifies a manifest, so that a journal is never resumed
+// against a different one.
+func manifestHash(entries []DistributionEntry) string {
+	h := sha256.New()
+	for _, e := range entries {
+		fmt.Fprintf(h, "%s\t%s\n", e.Invoice, e.Amount)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,63 @@
+package rgb_lib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestDistributionResumeWithExpiredInvoice(t *testing.T) {
+	const assetId = "rgb:asset"
+	receiver := newOfflineWallet(t)
+	past := uint64(time.Now().Add(-time.Hour).Unix())
+	entries := []DistributionEntry{
+		{Invoice: witnessInvoice(t, receiver, 10, nil)},
+		{Invoice: witnessInvoice(t, receiver, 20, &past)},
+		{Invoice: witnessInvoice(t, receiver, 30, nil)},
+	}
+
+	wallet := newFakeWallet()
+	wallet.metadata[assetId] = Metadata{AssetSchema: AssetSchemaNia}
+	sender := NewIdempotentSender(NewSigningWallet(wallet, echoSigner), NewMemorySendIntentStore())
+	journalPath := filepath.Join(t.TempDir(), "journal.json")
+	opts := DistributionOptions{BatchSize: 1, FeeRate: 2}
+
+	// a fresh run rejects the expired invoice
+	if _, err := NewDistribution(sender, Online{}, "run", assetId, entries, journalPath, opts); !errors.Is(err, errInvoiceExpired) {
+		t.Fatalf("NewDistribution = %v, want %v", err, errInvoiceExpired)
+	}
+
+	// the invoice expired after the journal was written
+	journal := DistributionJournal{RunId: "run", AssetId: assetId, Manifest: manifestHash(entries)}
+	for i := range entries {
+		journal.Batches = append(journal.Batches, DistributionBatch{
+			Index: i, Key: fmt.Sprintf("run/%d", i), Lines: []int{i + 1}, State: BatchPending,
+		})
+	}
+	if err := writeJSONFile(journalPath, journal); err != nil {
+		t.Fatal(err)
+	}
+	d, err := NewDistribution(sender, Online{}, "run", assetId, entries, journalPath, opts)
+	if err != nil {
+		t.Fatalf("NewDistribution on resume: %v", err)
+	}
+	err = d.Run(context.Background())
+	var entryErr *EntryError
+	if !errors.As(err, &entryErr) || entryErr.Line != 2 || !errors.Is(err, errInvoiceExpired) {
+		t.Fatalf("Run = %v, want an expired invoice error for entry 2", err)
+	}
+	var states []BatchState
+	for _, b := range d.Journal().Batches {
+		states = append(states, b.State)
+	}
+	if want := []BatchState{BatchSent, BatchFailed, BatchSent}; !slices.Equal(states, want) {
+		t.Fatalf("batch states %v, want %v", states, want)
+	}
+	if len(wallet.sends) != 2 {
+		t.Fatalf("%d sends, want 2", len(wallet.sends))
+	}
+}
@@ -0,0 +1,136 @@
+package rgb_lib
+
+import "fmt"
+
+// String methods for the generated enums, using the snake_case names of the
+// rgb-lib variants.
+
+func (s AssetSchema) String() string {
+	switch s {
+	case AssetSchemaNia:
+		return "nia"
+	case AssetSchemaUda:
+		return "uda"
+	case AssetSchemaCfa:
+		return "cfa"
+	case AssetSchemaIfa:
+		return "ifa"
+	default:
+		return fmt.Sprintf("AssetSchema(%d)", uint(s))
+	}
+}
+
+func (n BitcoinNetwork) String() string {
+	switch n {
+	case BitcoinNetworkMainnet:
+		return "mainnet"
+	case BitcoinNetworkTestnet:
+		return "testnet"
+	case BitcoinNetworkTestnet4:
+		return "testnet4"
+	case BitcoinNetworkSignet:
+		return "signet"
+	case BitcoinNetworkRegtest:
+		return "regtest"
+	case BitcoinNetworkSignetCustom:
+		return "signet_custom"
+	default:
+		return fmt.Sprintf("BitcoinNetwork(%d)", uint(n))
+	}
+}
+
+func (s TransferStatus) String() string {
+	switch s {
+	case TransferStatusWaitingCounterparty:
+		return "waiting_counterparty"
+	case TransferStatusWaitingSafeHeight:
+		return "waiting_safe_height"
+	case TransferStatusWaitingConfirmations:
+		return "waiting_confirmations"
+	case TransferStatusSettled:
+		return "settled"
+	case TransferStatusFailed:
+		return "failed"
+	case TransferStatusInitiated:
+		return "initiated"
+	default:
+		return fmt.Sprintf("TransferStatus(%d)", uint(s))
+	}
+}
+
+func (k TransferKind) String() string {
+	switch k {
+	case TransferKindIssuance:
+		return "issuance"
+	case TransferKindReceiveBlind:
+		return "receive_blind"
+	case TransferKindReceiveWitness:
+		return "receive_witness"
+	case TransferKindSend:
+		return "send"
+	case TransferKindInflation:
+		return "inflation"
+	case TransferKindBurn:
+		return "burn"
+	case TransferKindLink:
+		return "link"
+	default:
+		return fmt.Sprintf("TransferKind(%d)", uint(k))
+	}
+}
+
+func (t TransactionType) String() string {
+	switch t {
+	case TransactionTypeRgbSend:
+		return "rgb_send"
+	case TransactionTypeDrain:
+		return "drain"
+	case TransactionTypeCreateUtxos:
+		return "create_utxos"
+	case TransactionTypeSendBtc:
+		return "send_btc"
+	case TransactionTypeIncoming:
+		return "incoming"
+	default:
+		return fmt.Sprintf("TransactionType(%d)", uint(t))
+	}
+}
+
+func (t WalletTransactionType) String() string {
+	switch t {
+	case WalletTransactionTypeCreateUtxos:
+		return "create_utxos"
+	case WalletTransactionTypeDrain:
+		return "drain"
+	case WalletTransactionTypeSendBtc:
+		return "send_btc"
+	default:
+		return fmt.Sprintf("WalletTransactionType(%d)", uint(t))
+	}
+}
+
+func (t TypeOfTransition) String() string {
+	switch t {
+	case TypeOfTransitionInflate:
+		return "inflate"
+	case TypeOfTransitionTransfer:
+		return "transfer"
+	case TypeOfTransitionBurn:
+		return "burn"
+	case TypeOfTransitionLink:
+		return "link"
+	default:
+		return fmt.Sprintf("TypeOfTransition(%d)", uint(t))
+	}
+}
+
+func (m CloseMethod) String() string {
+	switch m {
+	case CloseMethodOpretFirst:
+		return "opret1st"
+	case CloseMethodTapretFirst:
+		return "tapret1st"
+	default:
+		return fmt.Sprintf("CloseMethod(%d)", uint(m))
+	}
+}
@@ -0,0 +1,287 @@
+package rgb_lib
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"strings"
+)
+
+// MetadataSource is implemented by Wallet and MultisigWallet.
+type MetadataSource interface {
+	GetAssetMetadata(assetId string) (Metadata, error)
+}
+
+// ExplanationRow is a line of the input or output table of an Explanation.
+type ExplanationRow struct {
+	Index  int
+	Ref    string
+	Amount string
+	Ours   bool
+	Assets []string
+}
+
+// Explanation is a human-readable summary of an operation, built from its
+// PSBT and, for RGB operations, its RGB inspection. Summary holds one sentence
+// per movement, e.g. "Sends 10.5 USDT to a concealed recipient".
+type Explanation struct {
+	Txid    string
+	Summary []string
+	Inputs  []ExplanationRow
+	Outputs []ExplanationRow
+}
+
+type assetLabel struct {
+	ticker    string
+	precision uint8
+}
+
+// Explain builds the explanation of an operation. Either inspection may be
+// nil; meta is used to show asset tickers and precision and may be nil when
+// rgb is nil. Assets unknown to meta are shown by ID with no decimals.
+func Explain(meta MetadataSource, psbt *PsbtInspection, rgb *RgbInspection) (*Explanation, error) {
+	if psbt == nil && rgb == nil {
+		return nil, errors.New("nothing to explain")
+	}
+	e := &Explanation{}
+	labels := map[string]assetLabel{}
+	label := func(assetId string) assetLabel {
+		if l, ok := labels[assetId]; ok {
+			return l
+		}
+		l := assetLabel{ticker: assetId}
+		if meta != nil {
+			if m, err := meta.GetAssetMetadata(assetId); err == nil {
+				l.precision = m.Precision
+				l.ticker = m.Name
+				if m.Ticker != nil {
+					l.ticker = *m.Ticker
+				}
+			}
+		}
+		labels[assetId] = l
+		return l
+	}
+	inputAssets := map[uint32][]string{}
+	outputAssets := map[uint32][]string{}
+
+	if rgb != nil {
+		for _, op := range rgb.Operations {
+			l := label(op.AssetId)
+			format := func(a Assignment) string {
+				switch a := a.(type) {
+				case AssignmentFungible:
+					return fmt.Sprintf("%s %s", Amount{Raw: a.Amount, Precision: l.precision}.TrimmedString(), l.ticker)
+				case AssignmentInflationRight:
+					return fmt.Sprintf("the right to inflate %s %s", Amount{Raw: a.Amount, Precision: l.precision}.TrimmedString(), l.ticker)
+				case AssignmentNonFungible:
+					return fmt.Sprintf("the %s token", l.ticker)
+				default:
+					return fmt.Sprintf("a %s right", l.ticker)
+				}
+			}
+			for _, t := range op.Transitions {
+				for _, in := range t.Inputs {
+					inputAssets[in.Vin] = append(inputAssets[in.Vin], l.ticker)
+				}
+				if t.Type == TypeOfTransitionBurn {
+					var burned uint64
+					for _, in := range t.Inputs {
+						burned += fungibleAmount(in.Assignment)
+					}
+					for _, out := range t.Outputs {
+						burned -= min(burned, fungibleAmount(out.Assignment))
+					}
+					e.Summary = append(e.Summary, fmt.Sprintf("Burns %s %s", Amount{Raw: burned, Precision: l.precision}.TrimmedString(), l.ticker))
+				}
+				for _, out := range t.Outputs {
+					where := "a concealed recipient"
+					if out.Vout != nil {
+						where = fmt.Sprintf("output #%d", *out.Vout)
+						outputAssets[*out.Vout] = append(outputAssets[*out.Vout], l.ticker)
+					}
+					switch {
+					case t.Type == TypeOfTransitionInflate && out.IsOurs:
+						e.Summary = append(e.Summary, fmt.Sprintf("Inflates %s to our UTXO (%s)", format(out.Assignment), where))
+					case t.Type == TypeOfTransitionInflate:
+						e.Summary = append(e.Summary, fmt.Sprintf("Inflates %s to %s", format(out.Assignment), where))
+					case out.IsOurs:
+						e.Summary = append(e.Summary, fmt.Sprintf("Returns change %s to our UTXO (%s)", format(out.Assignment), where))
+					case out.IsConcealed:
+						e.Summary = append(e.Summary, fmt.Sprintf("Sends %s to a concealed recipient", format(out.Assignment)))
+					default:
+						e.Summary = append(e.Summary, fmt.Sprintf("Sends %s to %s", format(out.Assignment), where))
+					}
+				}
+			}
+		}
+	}
+
+	if psbt != nil {
+		e.Txid = psbt.Txid
+		for i, in := range psbt.Inputs {
+			e.Inputs = append(e.Inputs, ExplanationRow{
+				Index:  i,
+				Ref:    fmt.Sprintf("%s:%d", in.Outpoint.Txid, in.Outpoint.Vout),
+				Amount: fmt.Sprintf("%d sat", in.AmountSat),
+				Ours:   in.IsMine,
+				Assets: inputAssets[uint32(i)],
+			})
+			if !in.IsMine {
+				e.Summary = append(e.Summary, fmt.Sprintf("Spends input #%d (%s:%d), not owned by this wallet", i, in.Outpoint.Txid, in.Outpoint.Vout))
+			}
+		}
+		for i, out := range psbt.Outputs {
+			dest := out.ScriptPubkeyHex
+			if out.Address != nil {
+				dest = *out.Address
+			} else if out.IsOpReturn {
+				dest = "OP_RETURN"
+			}
+			e.Outputs = append(e.Outputs, ExplanationRow{
+				Index:  i,
+				Ref:    dest,
+				Amount: fmt.Sprintf("%d sat", out.AmountSat),
+				Ours:   out.IsMine,
+				Assets: outputAssets[uint32(i)],
+			})
+			if !out.IsMine && out.AmountSat > 0 {
+				e.Summary = append(e.Summary, fmt.Sprintf("Sends %d sats to %s", out.AmountSat, dest))
+			}
+		}
+		fee := fmt.Sprintf("Pays %d sats", psbt.FeeSat)
+		if psbt.SizeVbytes > 0 {
+			fee += fmt.Sprintf(" (%.2f sat/vB)", float64(psbt.FeeSat)/float64(psbt.SizeVbytes))
+		}
+		e.Summary = append(e.Summary, fee)
+		e.Summary = append(e.Summary, fmt.Sprintf("%d signatures present", psbt.SignatureCount))
+	}
+	return e, nil
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
+
+// Text renders the explanation as plain text.
+func (e *Explanation) Text() string {
+	var b strings.Builder
+	if e.Txid != "" {
+		fmt.Fprintf(&b, "Transaction %s\n", e.Txid)
+	}
+	for _, s := range e.Summary {
+		fmt.Fprintf(&b, "- %s\n", s)
+	}
+	section := func(title string, rows []ExplanationRow) {
+		if len(rows) == 0 {
+			return
+		}
+		fmt.Fprintf(&b, "\n%s:\n", title)
+		for _, r := range rows {
+			fmt.Fprintf(&b, "  #%d %s %s ours=%s", r.Index, r.Ref, r.Amount, yesNo(r.Ours))
+			if len(r.Assets) > 0 {
+				fmt.Fprintf(&b, " assets=%s", strings.Join(r.Assets, ","))
+			}
+			b.WriteString("\n")
+		}
+	}
+	section("Inputs", e.Inputs)
+	section("Outputs", e.Outputs)
+	return b.String()
+}
+
+// escapeMarkdownCell backslash-escapes the CommonMark punctuation that can
+// start inline markup, HTML or a block, so that s renders as plain text in a
+// list item or a table cell. Newlines are replaced with spaces.
+func escapeMarkdownCell(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '\n' || r == '\r':
+			b.WriteByte(' ')
+		case strings.ContainsRune("\\`*_{}[]()<>#+-!|~&", r):
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// markdownCode renders s as a code span within a table cell. The fence is
+// longer than any backtick run in s, as backslashes are literal in code spans.
+func markdownCode(s string) string {
+	s = strings.NewReplacer("|", `\|`, "\n", " ", "\r", " ").Replace(s)
+	run, longest := 0, 0
+	for _, r := range s {
+		if r == '`' {
+			run++
+			longest = max(longest, run)
+		} else {
+			run = 0
+		}
+	}
+	fence := strings.Repeat("`", longest+1)
+	if longest > 0 {
+		return fence + " " + s + " " + fence
+	}
+	return fence + s + fence
+}
+
+// Markdown renders the explanation as Markdown, with tables for the inputs
+// and outputs.
+func (e *Explanation) Markdown() string {
+	var b strings.Builder
+	if e.Txid != "" {
+		fmt.Fprintf(&b, "### Transaction `%s`\n\n", e.Txid)
+	}
+	for _, s := range e.Summary {
+		fmt.Fprintf(&b, "- %s\n", escapeMarkdownCell(s))
+	}
+	section := func(title string, rows []ExplanationRow) {
+		if len(rows) == 0 {
+			return
+		}
+		fmt.Fprintf(&b, "\n#### %s\n\n| # | Reference | Amount | Ours | Assets |\n|---|---|---|---|---|\n", title)
+		for _, r := range rows {
+			fmt.Fprintf(&b, "| %d | %s | %s | %s | %s |\n", r.Index, markdownCode(r.Ref), escapeMarkdownCell(r.Amount), yesNo(r.Ours),
+				escapeMarkdownCell(strings.Join(r.Assets, ", ")))
+		}
+	}
+	section("Inputs", e.Inputs)
+	section("Outputs", e.Outputs)
+	return b.String()
+}
+
+// HTML renders the explanation as an HTML fragment. Every value is escaped.
+func (e *Explanation) HTML() string {
+	var b strings.Builder
+	b.WriteString(`<div class="rgb-explanation">`)
+	if e.Txid != "" {
+		fmt.Fprintf(&b, "<h3>Transaction <code>%s</code></h3>", html.EscapeString(e.Txid))
+	}
+	b.WriteString("<ul>")
+	for _, s := range e.Summary {
+		fmt.Fprintf(&b, "<li>%s</li>", html.EscapeString(s))
+	}
+	b.WriteString("</ul>")
+	section := func(title string, rows []ExplanationRow) {
+		if len(rows) == 0 {
+			return
+		}
+		fmt.Fprintf(&b, "<h4>%s</h4><table><thead><tr><th>#</th><th>Reference</th><th>Amount</th><th>Ours</th><th>Assets</th></tr></thead><tbody>", title)
+		for _, r := range rows {
+			fmt.Fprintf(&b, "<tr><td>%d</td><td><code>%s</code></td><td>%s</td><td>%s</td><td>%s</td></tr>", r.Index,
+				html.EscapeString(r.Ref), html.EscapeString(r.Amount), yesNo(r.Ours), html.EscapeString(strings.Join(r.Assets, ", ")))
+		}
+		b.WriteString("</tbody></table>")
+	}
+	section("Inputs", e.Inputs)
+	section("Outputs", e.Outputs)
+	b.WriteString("</div>")
+	return b.String()
+}
@@ -0,0 +1,26 @@
+package rgb_lib
+
+import "testing"
+
+func TestExplanationMarkdown(t *testing.T) {
+	e := Explanation{
+		Txid:    "ab12",
+		Summary: []string{"Sends 1 *BOLD* [x](http://evil) <img> to\n# a | b"},
+		Outputs: []ExplanationRow{{Index: 0, Ref: "odd`ref|x", Amount: "1000 sat", Assets: []string{"10 T_K", "5 `X`"}}},
+	}
+	want := "### Transaction `ab12`\n\n" +
+		`- Sends 1 \*BOLD\* \[x\]\(http://evil\) \<img\> to \# a \| b` + "\n" +
+		"\n#### Outputs\n\n| # | Reference | Amount | Ours | Assets |\n|---|---|---|---|---|\n" +
+		"| 0 | `` odd`ref\\|x `` | 1000 sat | no | 10 T\\_K, 5 \\`X\\` |\n"
+	if got := e.Markdown(); got != want {
+		t.Fatalf("Markdown =\n%s\nwant\n%s", got, want)
+	}
+	for s, want := range map[string]string{"a": "`a`", "a``b": "``` a``b ```"} {
+		if got := markdownCode(s); got != want {
+			t.Errorf("markdownCode(%q) = %s, want %s", s, got, want)
+		}
+	}
+	if got := escapeMarkdownCell(`\_`); got != `\\\_` {
+		t.Errorf("escapeMarkdownCell(\\_) = %s", got)
+	}
+}
@@ -0,0 +1,249 @@
+package rgb_lib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/UTEXO-Protocol/rgb-lib-go/invoice"
+)
+
+// fakeWallet is a WalletInterface for tests. The methods used by the code
+// under test are served from its fields; calling any other method panics on
+// the nil embedded interface.
+type fakeWallet struct {
+	WalletInterface
+
+	data     WalletData
+	metadata map[string]Metadata
+	balances map[string]Balance
+	unspents []Unspent
+	// transfers maps asset IDs, or "" for transfers not bound to an asset,
+	// to their transfers.
+	transfers    map[string][]Transfer
+	transactions []Transaction
+	btcBalance   BtcBalance
+	refreshes    int
+
+	// receives counts invoices, and expirations records their expiration
+	// timestamps.
+	receives    int
+	expirations []*uint64
+
+	// createUtxos defaults to creating num UTXOs, or 5, and records them in
+	// utxosCreated.
+	createUtxos  func(num *uint8) (uint8, error)
+	utxosCreated int
+
+	// failTransfers defaults to reporting a transfer failed, and records
+	// the batch transfer in failed.
+	failTransfers func(batchTransferIdx int32) (bool, error)
+	failed        []int32
+
+	// sendBegin and sendEnd default to returning the PSBT "send" and a
+	// result with the txid "tx<n>" and batch transfer <n>.
+	sendBegin func(recipientMap map[string][]Recipient) (SendBeginResult, error)
+	sendEnd   func(signed string) (OperationResult, error)
+	sends     []map[string][]Recipient
+	btcSends  []string
+}
+
+func newFakeWallet() *fakeWallet {
+	return &fakeWallet{
+		data:      WalletData{BitcoinNetwork: BitcoinNetworkRegtest, MaxAllocationsPerUtxo: 5},
+		metadata:  map[string]Metadata{},
+		balances:  map[string]Balance{},
+		transfers: map[string][]Transfer{},
+		unspents:  []Unspent{{Utxo: Utxo{Outpoint: Outpoint{Txid: "utxo", Vout: 0}, BtcAmount: 1000, Colorable: true, Exists: true}}},
+	}
+}
+
+func (w *fakeWallet) GetWalletData() WalletData {
+	return w.data
+}
+
+func (w *fakeWallet) GetAssetMetadata(assetId string) (Metadata, error) {
+	m, ok := w.metadata[assetId]
+	if !ok {
+		return Metadata{}, fmt.Errorf("unknown asset %s", assetId)
+	}
+	return m, nil
+}
+
+func (w *fakeWallet) ListUnspents(online *Online, settledOnly bool, skipSync bool) ([]Unspent, error) {
+	return w.unspents, nil
+}
+
+// ListAssets lists the assets with metadata or transfers as NIA assets.
+func (w *fakeWallet) GetAssetBalance(assetId string) (Balance, error) {
+	return w.balances[assetId], nil
+}
+
+func (w *fakeWallet) GetBtcBalance(online *Online, skipSync bool) (BtcBalance, error) {
+	return w.btcBalance, nil
+}
+
+func (w *fakeWallet) CreateUtxos(online Online, upTo bool, num *uint8, size *uint32, feeRate uint64, skipSync bool) (uint8, error) {
+	if w.createUtxos != nil {
+		return w.createUtxos(num)
+	}
+	created := uint8(5)
+	if num != nil {
+		created = *num
+	}
+	w.utxosCreated += int(created)
+	return created, nil
+}
+
+func (w *fakeWallet) ListAssets(filterAssetSchemas []AssetSchema) (Assets, error) {
+	var nia []AssetNia
+	for assetId := range w.transfers {
+		if _, ok := w.metadata[assetId]; !ok && assetId != "" {
+			nia = append(nia, AssetNia{AssetId: assetId})
+		}
+	}
+	for assetId, m := range w.metadata {
+		a := AssetNia{AssetId: assetId, Name: m.Name, Precision: m.Precision}
+		if m.Ticker != nil {
+			a.Ticker = *m.Ticker
+		}
+		nia = append(nia, a)
+	}
+	slices.SortFunc(nia, func(a, b AssetNia) int { return strings.Compare(a.AssetId, b.AssetId) })
+	return Assets{Nia: &nia}, nil
+}
+
+func (w *fakeWallet) ListTransactions(online *Online, skipSync bool) ([]Transaction, error) {
+	return w.transactions, nil
+}
+
+func (w *fakeWallet) ListTransfers(assetFilter AssetFilter, txid *string) ([]Transfer, error) {
+	assetId := ""
+	if f, ok := assetFilter.(AssetFilterId); ok {
+		assetId = f.AssetId
+	}
+	var transfers []Transfer
+	for _, t := range w.transfers[assetId] {
+		if txid == nil || t.Txid != nil && *t.Txid == *txid {
+			transfers = append(transfers, t)
+		}
+	}
+	return transfers, nil
+}
+
+// transfer sets the status, and the assignments if given, of the transfer
+// to recipientId, adding it to the transfers not bound to an asset if needed.
+func (w *fakeWallet) transfer(recipientId string, status TransferStatus, assignments ...Assignment) {
+	for assetId, transfers := range w.transfers {
+		for i, t := range transfers {
+			if t.RecipientId != nil && *t.RecipientId == recipientId {
+				w.transfers[assetId][i].Status = status
+				if assignments != nil {
+					w.transfers[assetId][i].Assignments = assignments
+				}
+				return
+			}
+		}
+	}
+	n := int32(len(w.transfers[""]) + 1)
+	w.transfers[""] = append(w.transfers[""], Transfer{
+		Idx: n, BatchTransferIdx: n, Status: status, Kind: TransferKindReceiveWitness, RecipientId: &recipientId,
+		Assignments: assignments,
+	})
+}
+
+func (w *fakeWallet) BlindReceive(assetId *string, assignment Assignment, expirationTimestamp *uint64, transportEndpoints []string, minConfirmations uint8) (ReceiveData, error) {
+	return w.WitnessReceive(assetId, assignment, expirationTimestamp, transportEndpoints, minConfirmations)
+}
+
+func (w *fakeWallet) WitnessReceive(assetId *string, assignment Assignment, expirationTimestamp *uint64, transportEndpoints []string, minConfirmations uint8) (ReceiveData, error) {
+	w.receives++
+	w.expirations = append(w.expirations, expirationTimestamp)
+	recipientId := fmt.Sprintf("recipient%d", w.receives)
+	return ReceiveData{
+		Invoice:             "invoice:" + recipientId,
+		RecipientId:         recipientId,
+		ExpirationTimestamp: expirationTimestamp,
+		BatchTransferIdx:    int32(w.receives),
+	}, nil
+}
+
+func (w *fakeWallet) Refresh(online Online, assetId *string, filter []RefreshFilter, skipSync bool) (map[int32]RefreshedTransfer, error) {
+	w.refreshes++
+	return nil, nil
+}
+
+func (w *fakeWallet) FailTransfers(online Online, batchTransferIdx *int32, noAssetOnly bool, skipSync bool) (bool, error) {
+	if w.failTransfers != nil {
+		return w.failTransfers(*batchTransferIdx)
+	}
+	w.failed = append(w.failed, *batchTransferIdx)
+	return true, nil
+}
+
+func (w *fakeWallet) SendBegin(online Online, recipientMap map[string][]Recipient, donation bool, feeRate uint64, minConfirmations uint8, expirationTimestamp *uint64, dryRun bool) (SendBeginResult, error) {
+	if w.sendBegin != nil {
+		return w.sendBegin(recipientMap)
+	}
+	w.sends = append(w.sends, recipientMap)
+	return SendBeginResult{Psbt: "send"}, nil
+}
+
+func (w *fakeWallet) SendEnd(online Online, signedPsbt string) (OperationResult, error) {
+	if w.sendEnd != nil {
+		return w.sendEnd(signedPsbt)
+	}
+	n := int32(len(w.sends))
+	return OperationResult{Txid: fmt.Sprintf("tx%d", n), BatchTransferIdx: n}, nil
+}
+
+// Send goes through SendBegin and SendEnd.
+func (w *fakeWallet) Send(online Online, recipientMap map[string][]Recipient, donation bool, feeRate uint64, minConfirmations uint8, expirationTimestamp *uint64) (OperationResult, error) {
+	begin, err := w.SendBegin(online, recipientMap, donation, feeRate, minConfirmations, expirationTimestamp, false)
+	if err != nil {
+		return OperationResult{}, err
+	}
+	return w.SendEnd(online, begin.Psbt)
+}
+
+// SendBtc records "address amount" sends and returns the txid "btctx<n>".
+func (w *fakeWallet) SendBtc(online Online, address string, amount uint64, feeRate uint64, skipSync bool) (string, error) {
+	w.btcSends = append(w.btcSends, fmt.Sprintf("%s %d", address, amount))
+	return fmt.Sprintf("btctx%d", len(w.btcSends)), nil
+}
+
+func (w *fakeWallet) GetAddress() (string, error) {
+	return "address", nil
+}
+
+// echoSigner returns PSBTs unchanged, with "signed:" prepended.
+var echoSigner = SignerFunc(func(ctx context.Context, psbt string) (string, error) {
+	return "signed:" + psbt, nil
+})
+
+var errTest = errors.New("test error")
+
+// witnessInvoice returns a witness invoice of an offline regtest wallet
+// requesting amount, re-encoded with the given expiration.
+func witnessInvoice(t *testing.T, wallet *Wallet, amount uint64, expiration *uint64) string {
+	t.Helper()
+	data, err := wallet.WitnessReceive(nil, AssignmentFungible{Amount: amount}, nil, nil, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inv, err := NewInvoice(data.Invoice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inv.Destroy()
+	invoiceData := inv.InvoiceData()
+	invoiceData.ExpirationTimestamp = expiration
+	s, err := invoice.Encode(InvoiceDataToCodec(invoiceData))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
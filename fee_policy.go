@@ -0,0 +1,317 @@
+package rgb_lib
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// FeeEstimator is implemented by Wallet and MultisigWallet.
+type FeeEstimator interface {
+	GetFeeEstimation(online Online, blocks uint16) (float64, error)
+}
+
+type FeeSource string
+
+const (
+	FeeEstimated FeeSource = "estimated"
+	FeeCached    FeeSource = "cached"
+	// FeeFallback means the estimation failed and the policy used its
+	// fallback or, without one, the last known rate.
+	FeeFallback FeeSource = "fallback"
+)
+
+// FeeQuote is a fee rate chosen by a FeePolicy. Err holds the estimation
+// error when Source is FeeFallback.
+type FeeQuote struct {
+	Rate   uint64
+	Source FeeSource
+	Err    error
+}
+
+// FeePolicy turns fee estimations into the feeRate, in sat/vB, of wallet
+// calls. Estimations for TargetBlocks are cached for a TTL, smoothed with an
+// exponential moving average and clamped between a floor and a ceiling. When
+// estimation fails, for example with CannotEstimateFees on a quiet signet,
+// the fallback rate is used. It is safe for concurrent use.
+type FeePolicy struct {
+	estimator    FeeEstimator
+	online       Online
+	targetBlocks uint16
+	floor        uint64
+	ceiling      uint64
+	fallback     uint64
+	ttl          time.Duration
+	smoothing    float64
+	now          func() time.Time
+
+	mu        sync.Mutex
+	smoothed  float64
+	fetchedAt time.Time
+}
+
+// NewFeePolicy returns a policy targeting confirmation within targetBlocks,
+// with a floor of 1 sat/vB, no ceiling, no fallback, no cache and no
+// smoothing.
+func NewFeePolicy(estimator FeeEstimator, online Online, targetBlocks uint16) *FeePolicy {
+	return &FeePolicy{estimator: estimator, online: online, targetBlocks: targetBlocks, floor: 1, smoothing: 1, now: time.Now}
+}
+
+// WithBounds clamps rates between floor and ceiling. A zero ceiling means no
+// ceiling.
+func (p *FeePolicy) WithBounds(floor, ceiling uint64) *FeePolicy {
+	p.floor, p.ceiling = max(floor, 1), ceiling
+	return p
+}
+
+// WithFallback sets the rate used when estimation fails. Without one, the
+// last known rate is used, if any.
+func (p *FeePolicy) WithFallback(rate uint64) *FeePolicy {
+	p.fallback = rate
+	return p
+}
+
+// WithTTL caches estimations for ttl.
+func (p *FeePolicy) WithTTL(ttl time.Duration) *FeePolicy {
+	p.ttl = ttl
+	return p
+}
+
+// WithSmoothing weights each new estimation by alpha, in (0, 1], against the
+// previous smoothed rate. 1 disables smoothing.
+func (p *FeePolicy) WithSmoothing(alpha float64) *FeePolicy {
+	if alpha > 0 && alpha <= 1 {
+		p.smoothing = alpha
+	}
+	return p
+}
+
+// Quote returns the fee rate to use now. It fails only when estimation fails
+// and there is neither a fallback nor a previous estimation.
+func (p *FeePolicy) Quote() (FeeQuote, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := p.now()
+	if !p.fetchedAt.IsZero() && now.Sub(p.fetchedAt) < p.ttl {
+		return FeeQuote{Rate: p.clamp(p.smoothed), Source: FeeCached}, nil
+	}
+	estimate, err := p.estimator.GetFeeEstimation(p.online, p.targetBlocks)
+	if err != nil {
+		err = fmt.Errorf("fee estimation for %d blocks: %w", p.targetBlocks, err)
+		switch {
+		case p.fallback > 0:
+			return FeeQuote{Rate: p.clamp(float64(p.fallback)), Source: FeeFallback, Err: err}, nil
+		case !p.fetchedAt.IsZero():
+			return FeeQuote{Rate: p.clamp(p.smoothed), Source: FeeFallback, Err: err}, nil
+		}
+		return FeeQuote{}, err
+	}
+	if p.fetchedAt.IsZero() {
+		p.smoothed = estimate
+	} else {
+		p.smoothed = p.smoothing*estimate + (1-p.smoothing)*p.smoothed
+	}
+	p.fetchedAt = now
+	return FeeQuote{Rate: p.clamp(p.smoothed), Source: FeeEstimated}, nil
+}
+
+// FeeRate returns the rate of Quote.
+func (p *FeePolicy) FeeRate() (uint64, error) {
+	q, err := p.Quote()
+	return q.Rate, err
+}
+
+func (p *FeePolicy) clamp(rate float64) uint64 {
+	r := max(uint64(math.Ceil(rate)), p.floor)
+	if p.ceiling > 0 {
+		r = min(r, p.ceiling)
+	}
+	return r
+}
+
+var errNoFeePolicy = errors.New("no fee policy")
+
+// FeeWallet wraps the fee-paying methods of a Wallet, taking the fee rate
+// from a FeePolicy instead of a feeRate argument.
+type FeeWallet struct {
+	wallet WalletInterface
+	policy *FeePolicy
+}
+
+func NewFeeWallet(wallet WalletInterface, policy *FeePolicy) *FeeWallet {
+	return &FeeWallet{wallet: wallet, policy: policy}
+}
+
+// Wallet returns the wrapped wallet.
+func (w *FeeWallet) Wallet() WalletInterface {
+	return w.wallet
+}
+
+func (w *FeeWallet) Policy() *FeePolicy {
+	return w.policy
+}
+
+func feeRateOf(policy *FeePolicy) (uint64, error) {
+	if policy == nil {
+		return 0, errNoFeePolicy
+	}
+	return policy.FeeRate()
+}
+
+func (w *FeeWallet) Burn(online Online, assetId string, amount uint64, minConfirmations uint8) (OperationResult, error) {
+	feeRate, err := feeRateOf(w.policy)
+	if err != nil {
+		return OperationResult{}, err
+	}
+	return w.wallet.Burn(online, assetId, amount, feeRate, minConfirmations)
+}
+
+func (w *FeeWallet) BurnBegin(online Online, assetId string, amount uint64, minConfirmations uint8, dryRun bool) (BurnBeginResult, error) {
+	feeRate, err := feeRateOf(w.policy)
+	if err != nil {
+		return BurnBeginResult{}, err
+	}
+	return w.wallet.BurnBegin(online, assetId, amount, feeRate, minConfirmations, dryRun)
+}
+
+func (w *FeeWallet) CreateUtxos(online Online, upTo bool, num *uint8, size *uint32, skipSync bool) (uint8, error) {
+	feeRate, err := feeRateOf(w.policy)
+	if err != nil {
+		return 0, err
+	}
+	return w.wallet.CreateUtxos(online, upTo, num, size, feeRate, skipSync)
+}
+
+func (w *FeeWallet) CreateUtxosBegin(online Online, upTo bool, num *uint8, size *uint32, skipSync bool, dryRun bool) (string, error) {
+	feeRate, err := feeRateOf(w.policy)
+	if err != nil {
+		return "", err
+	}
+	return w.wallet.CreateUtxosBegin(online, upTo, num, size, feeRate, skipSync, dryRun)
+}
+
+func (w *FeeWallet) DrainTo(online Online, address string) (string, error) {
+	feeRate, err := feeRateOf(w.policy)
+	if err != nil {
+		return "", err
+	}
+	return w.wallet.DrainTo(online, address, feeRate)
+}
+
+func (w *FeeWallet) DrainToBegin(online Online, address string, dryRun bool) (string, error) {
+	feeRate, err := feeRateOf(w.policy)
+	if err != nil {
+		return "", err
+	}
+	return w.wallet.DrainToBegin(online, address, feeRate, dryRun)
+}
+
+func (w *FeeWallet) Inflate(online Online, assetId string, inflationAmounts []uint64, minConfirmations uint8) (OperationResult, error) {
+	feeRate, err := feeRateOf(w.policy)
+	if err != nil {
+		return OperationResult{}, err
+	}
+	return w.wallet.Inflate(online, assetId, inflationAmounts, feeRate, minConfirmations)
+}
+
+func (w *FeeWallet) InflateBegin(online Online, assetId string, inflationAmounts []uint64, minConfirmations uint8, dryRun bool) (InflateBeginResult, error) {
+	feeRate, err := feeRateOf(w.policy)
+	if err != nil {
+		return InflateBeginResult{}, err
+	}
+	return w.wallet.InflateBegin(online, assetId, inflationAmounts, feeRate, minConfirmations, dryRun)
+}
+
+func (w *FeeWallet) Send(online Online, recipientMap map[string][]Recipient, donation bool, minConfirmations uint8, expirationTimestamp *uint64) (OperationResult, error) {
+	feeRate, err := feeRateOf(w.policy)
+	if err != nil {
+		return OperationResult{}, err
+	}
+	return w.wallet.Send(online, recipientMap, donation, feeRate, minConfirmations, expirationTimestamp)
+}
+
+func (w *FeeWallet) SendBegin(online Online, recipientMap map[string][]Recipient, donation bool, minConfirmations uint8, expirationTimestamp *uint64, dryRun bool) (SendBeginResult, error) {
+	feeRate, err := feeRateOf(w.policy)
+	if err != nil {
+		return SendBeginResult{}, err
+	}
+	return w.wallet.SendBegin(online, recipientMap, donation, feeRate, minConfirmations, expirationTimestamp, dryRun)
+}
+
+func (w *FeeWallet) SendBtc(online Online, address string, amount uint64, skipSync bool) (string, error) {
+	feeRate, err := feeRateOf(w.policy)
+	if err != nil {
+		return "", err
+	}
+	return w.wallet.SendBtc(online, address, amount, feeRate, skipSync)
+}
+
+func (w *FeeWallet) SendBtcBegin(online Online, address string, amount uint64, skipSync bool, dryRun bool) (string, error) {
+	feeRate, err := feeRateOf(w.policy)
+	if err != nil {
+		return "", err
+	}
+	return w.wallet.SendBtcBegin(online, address, amount, feeRate, skipSync, dryRun)
+}
+
+// FeeMultisigWallet wraps the fee-paying methods of a MultisigWallet, taking
+// the fee rate from a FeePolicy instead of a feeRate argument.
+type FeeMultisigWallet struct {
+	wallet MultisigWalletInterface
+	policy *FeePolicy
+}
+
+func NewFeeMultisigWallet(wallet MultisigWalletInterface, policy *FeePolicy) *FeeMultisigWallet {
+	return &FeeMultisigWallet{wallet: wallet, policy: policy}
+}
+
+// Wallet returns the wrapped wallet.
+func (w *FeeMultisigWallet) Wallet() MultisigWalletInterface {
+	return w.wallet
+}
+
+func (w *FeeMultisigWallet) Policy() *FeePolicy {
+	return w.policy
+}
+
+func (w *FeeMultisigWallet) BurnInit(online Online, assetId string, amount uint64, minConfirmations uint8) (InitOperationResult, error) {
+	feeRate, err := feeRateOf(w.policy)
+	if err != nil {
+		return InitOperationResult{}, err
+	}
+	return w.wallet.BurnInit(online, assetId, amount, feeRate, minConfirmations)
+}
+
+func (w *FeeMultisigWallet) CreateUtxosInit(online Online, upTo bool, num *uint8, size *uint32, skipSync bool) (InitOperationResult, error) {
+	feeRate, err := feeRateOf(w.policy)
+	if err != nil {
+		return InitOperationResult{}, err
+	}
+	return w.wallet.CreateUtxosInit(online, upTo, num, size, feeRate, skipSync)
+}
+
+func (w *FeeMultisigWallet) InflateInit(online Online, assetId string, inflationAmounts []uint64, minConfirmations uint8) (InitOperationResult, error) {
+	feeRate, err := feeRateOf(w.policy)
+	if err != nil {
+		return InitOperationResult{}, err
+	}
+	return w.wallet.InflateInit(online, assetId, inflationAmounts, feeRate, minConfirmations)
+}
+
+func (w *FeeMultisigWallet) SendBtcInit(online Online, address string, amount uint64, skipSync bool) (InitOperationResult, error) {
+	feeRate, err := feeRateOf(w.policy)
+	if err != nil {
+		return InitOperationResult{}, err
+	}
+	return w.wallet.SendBtcInit(online, address, amount, feeRate, skipSync)
+}
+
+func (w *FeeMultisigWallet) SendInit(online Online, recipientMap map[string][]Recipient, donation bool, minConfirmations uint8, expirationTimestamp *uint64) (InitOperationResult, error) {
+	feeRate, err := feeRateOf(w.policy)
+	if err != nil {
+		return InitOperationResult{}, err
+	}
+	return w.wallet.SendInit(online, recipientMap, donation, feeRate, minConfirmations, expirationTimestamp)
+}
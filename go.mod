@@ -1,3 +1,3 @@
 module github.com/UTEXO-Protocol/rgb-lib-go
 
-go 1.22
+go 1.23
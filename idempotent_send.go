@@ -0,0 +1,315 @@
+package rgb_lib
+
+import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+type SendIntentState string
+
+const (
+	// SendIntended is recorded before SendBegin is called.
+	SendIntended SendIntentState = "intended"
+	// SendBegun is recorded once SendBegin returned, before signing.
+	SendBegun SendIntentState = "begun"
+	SendDone  SendIntentState = "sent"
+)
+
+var (
+	ErrSendIntentNotFound = errors.New("send intent not found")
+	// ErrSendKeyReused is returned when a key is retried with different
+	// recipients.
+	ErrSendKeyReused = errors.New("idempotency key reused with different recipients")
+	// ErrSendInDoubt is returned when a previous attempt created a batch
+	// transfer that never reached SendEnd. The transaction may or may not
+	// have been broadcast: check it, then either fail the batch transfer with
+	// FailTransfers and call Forget, or wait for it to progress.
+	ErrSendInDoubt = errors.New("previous send attempt in doubt")
+)
+
+// SendIntent records a send before it reaches the wallet, so that a retry
+// after a crash finds the transfer created by the first attempt instead of
+// sending the assets twice. Recipients lists the recipient IDs per asset ID.
+type SendIntent struct {
+	Key              string              `json:"key"`
+	Fingerprint      string              `json:"fingerprint"`
+	Recipients       map[string][]string `json:"recipients"`
+	State            SendIntentState     `json:"state"`
+	BatchTransferIdx *int32              `json:"batch_transfer_idx,omitempty"`
+	Txid             string              `json:"txid,omitempty"`
+	CreatedAt        int64               `json:"created_at"`
+	UpdatedAt        int64               `json:"updated_at"`
+}
+
+// Result returns the OperationResult of a completed intent.
+func (i SendIntent) Result() OperationResult {
+	var idx int32
+	if i.BatchTransferIdx != nil {
+		idx = *i.BatchTransferIdx
+	}
+	return OperationResult{Txid: i.Txid, BatchTransferIdx: idx}
+}
+
+// SendIntentStore persists SendIntents. Get returns ErrSendIntentNotFound for
+// unknown keys. Put must be durable when it returns.
+type SendIntentStore interface {
+	Get(key string) (SendIntent, error)
+	Put(intent SendIntent) error
+	Delete(key string) error
+}
+
+// MemorySendIntentStore keeps intents in memory. It does not survive a crash
+// and is meant for tests. It is safe for concurrent use.
+type MemorySendIntentStore struct {
+	*recordStore[SendIntent]
+}
+
+func NewMemorySendIntentStore() *MemorySendIntentStore {
+	return &MemorySendIntentStore{newRecordStore(sendIntentKey, compareSendIntents, ErrSendIntentNotFound)}
+}
+
+func (s *MemorySendIntentStore) Delete(key string) error {
+	return s.delete(key)
+}
+
+// FileSendIntentStore keeps intents in a JSON file, rewritten atomically on
+// every change.
+type FileSendIntentStore struct {
+	*recordStore[SendIntent]
+}
+
+// NewFileSendIntentStore loads the intents of the file at path, which is
+// created on the first Put if it does not exist.
+func NewFileSendIntentStore(path string) (*FileSendIntentStore, error) {
+	s, err := loadRecordStore(path, sendIntentKey, compareSendIntents, ErrSendIntentNotFound)
+	if err != nil {
+		return nil, err
+	}
+	return &FileSendIntentStore{s}, nil
+}
+
+func (s *FileSendIntentStore) Delete(key string) error {
+	return s.delete(key)
+}
+
+func sendIntentKey(i SendIntent) string {
+	return i.Key
+}
+
+func compareSendIntents(a, b SendIntent) int {
+	return cmp.Compare(a.CreatedAt, b.CreatedAt)
+}
+
+// IdempotentSender sends assets at most once per client key. The intended
+// recipients are persisted before SendBegin is called; a retry with the same
+// key looks up the transfers of those recipients with ListTransfers and
+// returns the original Txid and BatchTransferIdx instead of sending again.
+//
+// A key may be retried only with the same recipients. Attempts whose batch
+// transfer failed are sent again.
+type IdempotentSender struct {
+	wallet *SigningWallet
+	store  SendIntentStore
+	now    func() time.Time
+
+	mu   sync.Mutex
+	keys map[string]*sync.Mutex
+}
+
+func NewIdempotentSender(wallet *SigningWallet, store SendIntentStore) *IdempotentSender {
+	return &IdempotentSender{wallet: wallet, store: store, now: time.Now, keys: map[string]*sync.Mutex{}}
+}
+
+// lock serializes the attempts of a key within the process.
+func (s *IdempotentSender) lock(key string) func() {
+	s.mu.Lock()
+	m, ok := s.keys[key]
+	if !ok {
+		m = &sync.Mutex{}
+		s.keys[key] = m
+	}
+	s.mu.Unlock()
+	m.Lock()
+	return m.Unlock
+}
+
+// Send sends recipientMap under key, or returns the result of the previous
+// attempt with the same key.
+func (s *IdempotentSender) Send(ctx context.Context, key string, online Online, recipientMap map[string][]Recipient, donation bool, feeRate uint64, minConfirmations uint8, expirationTimestamp *uint64) (OperationResult, error) {
+	if key == "" {
+		return OperationResult{}, errors.New("empty idempotency key")
+	}
+	defer s.lock(key)()
+
+	fingerprint := recipientFingerprint(recipientMap)
+	intent, err := s.store.Get(key)
+	switch {
+	case err == nil:
+		if intent.Fingerprint != fingerprint {
+			return OperationResult{}, fmt.Errorf("%w: %s", ErrSendKeyReused, key)
+		}
+		if intent.State == SendDone {
+			return intent.Result(), nil
+		}
+		resolved, err := s.reconcile(&intent)
+		if err != nil || resolved {
+			return intent.Result(), err
+		}
+	case errors.Is(err, ErrSendIntentNotFound):
+		now := s.now().Unix()
+		intent = SendIntent{
+			Key:         key,
+			Fingerprint: fingerprint,
+			Recipients:  recipientIds(recipientMap),
+			CreatedAt:   now,
+		}
+	default:
+		return OperationResult{}, err
+	}
+
+	intent.State = SendIntended
+	intent.BatchTransferIdx = nil
+	if err := s.put(&intent); err != nil {
+		return OperationResult{}, err
+	}
+	if err := ctx.Err(); err != nil {
+		return OperationResult{}, err
+	}
+	w := s.wallet.Wallet()
+	begin, err := w.SendBegin(online, recipientMap, donation, feeRate, minConfirmations, expirationTimestamp, false)
+	if err != nil {
+		return OperationResult{}, err
+	}
+	if begin.BatchTransferIdx != nil {
+		intent.State = SendBegun
+		intent.BatchTransferIdx = begin.BatchTransferIdx
+		if err := s.put(&intent); err != nil {
+			return OperationResult{}, err
+		}
+	}
+	signed, err := s.wallet.sign(ctx, begin.Psbt)
+	if err != nil {
+		return OperationResult{}, err
+	}
+	res, err := w.SendEnd(online, signed)
+	if err != nil {
+		return OperationResult{}, err
+	}
+	intent.State = SendDone
+	intent.Txid = res.Txid
+	intent.BatchTransferIdx = &res.BatchTransferIdx
+	if err := s.put(&intent); err != nil {
+		return res, fmt.Errorf("sent %s but could not record it: %w", res.Txid, err)
+	}
+	return res, nil
+}
+
+// reconcile looks for the batch transfer of an unfinished intent. It reports
+// true when the intent is resolved, either completed or in doubt, and false
+// when the assets must be sent again.
+func (s *IdempotentSender) reconcile(intent *SendIntent) (bool, error) {
+	transfers, err := s.sentTransfers(intent.Recipients)
+	if err != nil {
+		return true, err
+	}
+	var inDoubt *Transfer
+	for _, t := range transfers {
+		if intent.BatchTransferIdx != nil && t.BatchTransferIdx != *intent.BatchTransferIdx {
+			continue
+		}
+		switch {
+		case t.Status == TransferStatusFailed:
+			continue
+		case t.Txid != nil && t.Status != TransferStatusInitiated:
+			intent.State = SendDone
+			intent.Txid = *t.Txid
+			intent.BatchTransferIdx = &t.BatchTransferIdx
+			return true, s.put(intent)
+		default:
+			inDoubt = &t
+		}
+	}
+	if inDoubt != nil {
+		return true, fmt.Errorf("%w: key %s, batch transfer %d", ErrSendInDoubt, intent.Key, inDoubt.BatchTransferIdx)
+	}
+	return false, nil
+}
+
+// sentTransfers returns the outgoing transfers to the recipients of an intent.
+func (s *IdempotentSender) sentTransfers(recipients map[string][]string) ([]Transfer, error) {
+	var found []Transfer
+	for assetId, ids := range recipients {
+		transfers, err := s.wallet.Wallet().ListTransfers(AssetFilterId{AssetId: assetId}, nil)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range transfers {
+			if t.Kind == TransferKindSend && t.RecipientId != nil && slices.Contains(ids, *t.RecipientId) {
+				found = append(found, t)
+			}
+		}
+	}
+	return found, nil
+}
+
+func (s *IdempotentSender) put(intent *SendIntent) error {
+	intent.UpdatedAt = s.now().Unix()
+	if err := s.store.Put(*intent); err != nil {
+		return fmt.Errorf("record send intent %s: %w", intent.Key, err)
+	}
+	return nil
+}
+
+// Lookup returns the intent recorded for key.
+func (s *IdempotentSender) Lookup(key string) (SendIntent, error) {
+	return s.store.Get(key)
+}
+
+// Forget deletes the intent of key, so that the next Send with it sends
+// again. Use it after resolving an ErrSendInDoubt by failing the transfer.
+func (s *IdempotentSender) Forget(key string) error {
+	defer s.lock(key)()
+	return s.store.Delete(key)
+}
+
+func recipientIds(recipientMap map[string][]Recipient) map[string][]string {
+	ids := make(map[string][]string, len(recipientMap))
+	for assetId, recipients := range recipientMap {
+		for _, r := range recipients {
+			ids[assetId] = append(ids[assetId], r.RecipientId)
+		}
+		slices.Sort(ids[assetId])
+	}
+	return ids
+}
+
+// recipientFingerprint hashes a recipient map independently of its order.
+func recipientFingerprint(recipientMap map[string][]Recipient) string {
+	var lines []string
+	for assetId, recipients := range recipientMap {
+		for _, r := range recipients {
+			line := fmt.Sprintf("%s|%s|%#v", assetId, r.RecipientId, r.Assignment)
+			if r.WitnessData != nil {
+				line += fmt.Sprintf("|%d", r.WitnessData.AmountSat)
+				if r.WitnessData.Blinding != nil {
+					line += fmt.Sprintf("|%d", *r.WitnessData.Blinding)
+				}
+			}
+			lines = append(lines, line)
+		}
+	}
+	slices.Sort(lines)
+	h := sha256.New()
+	for _, l := range lines {
+		h.Write([]byte(l))
+		h.Write([]byte{'\n'})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
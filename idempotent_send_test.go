@@ -0,0 +1,103 @@
+package rgb_lib
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func sendRecipients(recipientId string, amount uint64) map[string][]Recipient {
+	return map[string][]Recipient{"rgb:a": {{RecipientId: recipientId, Assignment: AssignmentFungible{Amount: amount}}}}
+}
+
+func TestIdempotentSendOnce(t *testing.T) {
+	wallet := newFakeWallet()
+	store, err := NewFileSendIntentStore(filepath.Join(t.TempDir(), "intents.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender := NewIdempotentSender(NewSigningWallet(wallet, echoSigner), store)
+	send := func(recipients map[string][]Recipient) (OperationResult, error) {
+		return sender.Send(context.Background(), "key", Online{}, recipients, false, 2, 1, nil)
+	}
+
+	first, err := send(sendRecipients("r1", 10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := send(sendRecipients("r1", 10))
+	if err != nil || again != first || len(wallet.sends) != 1 {
+		t.Fatalf("Send again = %+v, %v after %d sends, want %+v", again, err, len(wallet.sends), first)
+	}
+	if _, err := send(sendRecipients("r1", 11)); !errors.Is(err, ErrSendKeyReused) {
+		t.Fatalf("Send with other recipients = %v, want %v", err, ErrSendKeyReused)
+	}
+
+	// the result survives a restart
+	if store, err = NewFileSendIntentStore(store.path); err != nil {
+		t.Fatal(err)
+	}
+	intent, err := NewIdempotentSender(NewSigningWallet(wallet, echoSigner), store).Lookup("key")
+	if err != nil || intent.State != SendDone || intent.Result() != first {
+		t.Fatalf("Lookup = %+v, %v", intent, err)
+	}
+}
+
+// TestIdempotentSendInterrupted retries a send whose SendEnd failed, once the
+// wallet shows its batch transfer in the given state.
+func TestIdempotentSendInterrupted(t *testing.T) {
+	txid := "tx1"
+	for _, c := range []struct {
+		name   string
+		status TransferStatus
+		txid   *string
+		want   error
+		sends  int
+	}{
+		{"broadcast", TransferStatusWaitingCounterparty, &txid, nil, 1},
+		{"not broadcast", TransferStatusInitiated, nil, ErrSendInDoubt, 1},
+		{"failed", TransferStatusFailed, nil, nil, 2},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			wallet := newFakeWallet()
+			wallet.sendBegin = func(recipientMap map[string][]Recipient) (SendBeginResult, error) {
+				wallet.sends = append(wallet.sends, recipientMap)
+				idx := int32(len(wallet.sends))
+				return SendBeginResult{Psbt: "send", BatchTransferIdx: &idx}, nil
+			}
+			wallet.sendEnd = func(string) (OperationResult, error) { return OperationResult{}, errTest }
+			sender := NewIdempotentSender(NewSigningWallet(wallet, echoSigner), NewMemorySendIntentStore())
+			send := func() (OperationResult, error) {
+				return sender.Send(context.Background(), "key", Online{}, sendRecipients("r1", 10), false, 2, 1, nil)
+			}
+			if _, err := send(); !errors.Is(err, errTest) {
+				t.Fatalf("Send = %v, want %v", err, errTest)
+			}
+			if intent, _ := sender.Lookup("key"); intent.State != SendBegun || *intent.BatchTransferIdx != 1 {
+				t.Fatalf("intent %s, want %s with batch transfer 1", intent.State, SendBegun)
+			}
+
+			recipientId := "r1"
+			wallet.transfers["rgb:a"] = []Transfer{{
+				BatchTransferIdx: 1, Kind: TransferKindSend, Status: c.status, RecipientId: &recipientId, Txid: c.txid,
+			}}
+			wallet.sendEnd = nil
+			res, err := send()
+			if !errors.Is(err, c.want) || len(wallet.sends) != c.sends {
+				t.Fatalf("Send = %+v, %v after %d sends, want %v after %d", res, err, len(wallet.sends), c.want, c.sends)
+			}
+			if err == nil && (res.BatchTransferIdx != int32(c.sends) || res.Txid == "") {
+				t.Fatalf("result %+v, want batch transfer %d", res, c.sends)
+			}
+			if c.want != nil {
+				if err := sender.Forget("key"); err != nil {
+					t.Fatal(err)
+				}
+				if _, err := send(); err != nil || len(wallet.sends) != 2 {
+					t.Fatalf("Send after Forget = %v after %d sends", err, len(wallet.sends))
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,370 @@
+// Package invoice parses, validates and builds RGB invoices without the native
+// library. An invoice has the form
+//
+//	rgb:<contract>/<schema>/[<assignment name>/]<state>+<network>:<recipient>[?expiry=<ts>&endpoints=<e1>,<e2>]
+//
+// where contract is the asset ID without its "rgb:" prefix, contract and
+// schema are "~" when not set, and state is empty for invoices accepting any
+// assignment. Data mirrors the InvoiceData of the native library; the root
+// package converts between the two and cross-checks both implementations.
+package invoice
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	Scheme    = "rgb:"
+	undefined = "~"
+)
+
+var (
+	ErrInvalidInvoice     = errors.New("invalid invoice")
+	ErrInvalidRecipientId = errors.New("invalid recipient ID")
+	ErrInvalidAssetId     = errors.New("invalid asset ID")
+	ErrInvalidEndpoint    = errors.New("invalid transport endpoint")
+)
+
+// Schema uses the values of the native AssetSchema.
+type Schema uint8
+
+const (
+	SchemaNia Schema = iota + 1
+	SchemaUda
+	SchemaCfa
+	SchemaIfa
+)
+
+var schemaNames = map[Schema]string{SchemaNia: "NIA", SchemaUda: "UDA", SchemaCfa: "CFA", SchemaIfa: "IFA"}
+
+func (s Schema) String() string {
+	if name, ok := schemaNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("Schema(%d)", uint8(s))
+}
+
+func ParseSchema(s string) (Schema, error) {
+	for schema, name := range schemaNames {
+		if strings.EqualFold(s, name) {
+			return schema, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown schema %q", s)
+}
+
+// Network uses the values of the native BitcoinNetwork.
+type Network uint8
+
+const (
+	NetworkMainnet Network = iota + 1
+	NetworkTestnet
+	NetworkTestnet4
+	NetworkSignet
+	NetworkRegtest
+	NetworkSignetCustom
+)
+
+// chainPrefixes holds the prefix of the recipient for each network.
+// SignetCustom shares the signet prefix and is never returned by Parse.
+var chainPrefixes = []struct {
+	network Network
+	prefix  string
+}{
+	{NetworkMainnet, "bc"},
+	{NetworkTestnet, "tb"},
+	{NetworkTestnet4, "tb4"},
+	{NetworkSignet, "sb"},
+	{NetworkRegtest, "bcrt"},
+	{NetworkSignetCustom, "sb"},
+}
+
+// ChainPrefix returns the prefix that qualifies recipient IDs on the network.
+func (n Network) ChainPrefix() string {
+	for _, c := range chainPrefixes {
+		if c.network == n {
+			return c.prefix
+		}
+	}
+	return ""
+}
+
+func networkOf(prefix string) (Network, bool) {
+	for _, c := range chainPrefixes {
+		if c.prefix == prefix {
+			return c.network, true
+		}
+	}
+	return 0, false
+}
+
+type AssignmentKind uint8
+
+const (
+	AssignmentAny AssignmentKind = iota
+	AssignmentFungible
+	AssignmentNonFungible
+	AssignmentInflationRight
+	AssignmentLinkRight
+)
+
+// Assignment is the state requested by an invoice. Amount is set for the
+// fungible and inflation right kinds.
+type Assignment struct {
+	Kind   AssignmentKind
+	Amount uint64
+}
+
+// Assignment names. NameAssetOwner is the default for fungible and
+// non-fungible assignments and is omitted from encoded invoices; inflation
+// rights always carry NameInflationAllowance, which tells their amount apart
+// from a fungible one.
+const (
+	NameAssetOwner         = "assetOwner"
+	NameInflationAllowance = "inflationAllowance"
+)
+
+const (
+	stateNonFungible = "1@0"
+	stateLinkRight   = "link"
+)
+
+// Data holds the content of an invoice. AssetId includes the "rgb:" prefix.
+type Data struct {
+	RecipientId         string
+	AssetSchema         *Schema
+	AssetId             *string
+	Assignment          Assignment
+	AssignmentName      *string
+	Network             Network
+	ExpirationTimestamp *uint64
+	TransportEndpoints  []string
+}
+
+// ProxyRecipientId returns the recipient ID qualified by the network, as used
+// with the transport proxy.
+func (d Data) ProxyRecipientId() string {
+	return d.Network.ChainPrefix() + ":" + d.RecipientId
+}
+
+func isBaid64(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		switch {
+		case c >= '0' && c <= '9', c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+		case strings.ContainsRune("-_~!$#", c):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// ValidateRecipientId checks the form of a blinded UTXO ("utxob:") or witness
+// ("wvout:") recipient ID.
+func ValidateRecipientId(id string) error {
+	for _, prefix := range []string{"utxob:", "wvout:"} {
+		if rest, ok := strings.CutPrefix(id, prefix); ok && isBaid64(rest) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %q", ErrInvalidRecipientId, id)
+}
+
+func ValidateAssetId(id string) error {
+	if rest, ok := strings.CutPrefix(id, Scheme); ok && isBaid64(rest) {
+		return nil
+	}
+	return fmt.Errorf("%w: %q", ErrInvalidAssetId, id)
+}
+
+// ValidateEndpoint checks a transport endpoint, e.g.
+// "rpcs://proxy.example.com/json-rpc".
+func ValidateEndpoint(endpoint string) error {
+	scheme, rest, ok := strings.Cut(endpoint, "://")
+	if !ok || (scheme != "rpc" && scheme != "rpcs") || rest == "" || strings.ContainsAny(rest, ",&? ") {
+		return fmt.Errorf("%w: %q", ErrInvalidEndpoint, endpoint)
+	}
+	return nil
+}
+
+// Validate checks every field of the invoice data.
+func (d Data) Validate() error {
+	if err := ValidateRecipientId(d.RecipientId); err != nil {
+		return err
+	}
+	if d.Network.ChainPrefix() == "" {
+		return fmt.Errorf("%w: unknown network %d", ErrInvalidInvoice, d.Network)
+	}
+	if d.AssetId != nil {
+		if err := ValidateAssetId(*d.AssetId); err != nil {
+			return err
+		}
+	}
+	if d.AssetSchema != nil {
+		if _, ok := schemaNames[*d.AssetSchema]; !ok {
+			return fmt.Errorf("%w: unknown schema %d", ErrInvalidInvoice, *d.AssetSchema)
+		}
+	}
+	if d.Assignment.Kind == AssignmentInflationRight && d.AssignmentName != nil && *d.AssignmentName != NameInflationAllowance {
+		return fmt.Errorf("%w: inflation right with assignment name %q", ErrInvalidInvoice, *d.AssignmentName)
+	}
+	if d.Assignment.Kind > AssignmentLinkRight {
+		return fmt.Errorf("%w: unknown assignment kind %d", ErrInvalidInvoice, d.Assignment.Kind)
+	}
+	if d.AssignmentName != nil && (*d.AssignmentName == "" || strings.ContainsAny(*d.AssignmentName, "/+?&=~")) {
+		return fmt.Errorf("%w: invalid assignment name %q", ErrInvalidInvoice, *d.AssignmentName)
+	}
+	for _, e := range d.TransportEndpoints {
+		if err := ValidateEndpoint(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Encode returns the invoice string of d.
+func Encode(d Data) (string, error) {
+	if err := d.Validate(); err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	b.WriteString(Scheme)
+	if d.AssetId != nil {
+		b.WriteString(strings.TrimPrefix(*d.AssetId, Scheme))
+	} else {
+		b.WriteString(undefined)
+	}
+	b.WriteByte('/')
+	if d.AssetSchema != nil {
+		b.WriteString(d.AssetSchema.String())
+	} else {
+		b.WriteString(undefined)
+	}
+	b.WriteByte('/')
+	switch {
+	case d.Assignment.Kind == AssignmentInflationRight:
+		b.WriteString(NameInflationAllowance + "/")
+	case d.AssignmentName != nil && *d.AssignmentName != NameAssetOwner:
+		b.WriteString(*d.AssignmentName + "/")
+	}
+	var state string
+	switch d.Assignment.Kind {
+	case AssignmentFungible, AssignmentInflationRight:
+		state = strconv.FormatUint(d.Assignment.Amount, 10)
+	case AssignmentNonFungible:
+		state = stateNonFungible
+	case AssignmentLinkRight:
+		state = stateLinkRight
+	}
+	if state != "" {
+		b.WriteString(state)
+		b.WriteByte('+')
+	}
+	b.WriteString(d.ProxyRecipientId())
+
+	var params []string
+	if d.ExpirationTimestamp != nil {
+		params = append(params, "expiry="+strconv.FormatUint(*d.ExpirationTimestamp, 10))
+	}
+	if len(d.TransportEndpoints) > 0 {
+		params = append(params, "endpoints="+strings.Join(d.TransportEndpoints, ","))
+	}
+	if len(params) > 0 {
+		b.WriteByte('?')
+		b.WriteString(strings.Join(params, "&"))
+	}
+	return b.String(), nil
+}
+
+// Parse decodes and validates an invoice string. The assignment name is set
+// only when the invoice carries one. An amount is read as an inflation right
+// when the assignment name is NameInflationAllowance, as fungible otherwise.
+func Parse(s string) (Data, error) {
+	invalid := func(format string, args ...any) (Data, error) {
+		return Data{}, fmt.Errorf("%w: %s", ErrInvalidInvoice, fmt.Sprintf(format, args...))
+	}
+	rest, ok := strings.CutPrefix(s, Scheme)
+	if !ok {
+		return invalid("missing %q scheme", Scheme)
+	}
+	rest, query, _ := strings.Cut(rest, "?")
+	parts := strings.Split(rest, "/")
+	if len(parts) < 3 || len(parts) > 4 {
+		return invalid("expected 3 or 4 path segments, got %d", len(parts))
+	}
+
+	var d Data
+	if parts[0] != undefined {
+		assetId := Scheme + parts[0]
+		d.AssetId = &assetId
+	}
+	if parts[1] != undefined {
+		schema, err := ParseSchema(parts[1])
+		if err != nil {
+			return invalid("%v", err)
+		}
+		d.AssetSchema = &schema
+	}
+	if len(parts) == 4 {
+		name := parts[2]
+		d.AssignmentName = &name
+	}
+
+	state, beneficiary, found := strings.Cut(parts[len(parts)-1], "+")
+	if !found {
+		state, beneficiary = "", state
+	}
+	switch {
+	case state == "":
+		d.Assignment = Assignment{Kind: AssignmentAny}
+	case state == stateNonFungible:
+		d.Assignment = Assignment{Kind: AssignmentNonFungible}
+	case state == stateLinkRight:
+		d.Assignment = Assignment{Kind: AssignmentLinkRight}
+	default:
+		amount, err := strconv.ParseUint(state, 10, 64)
+		if err != nil {
+			return invalid("invalid state %q", state)
+		}
+		d.Assignment = Assignment{Kind: AssignmentFungible, Amount: amount}
+		if d.AssignmentName != nil && *d.AssignmentName == NameInflationAllowance {
+			d.Assignment.Kind = AssignmentInflationRight
+		}
+	}
+
+	prefix, recipientId, found := strings.Cut(beneficiary, ":")
+	network, known := networkOf(prefix)
+	if !found || !known {
+		return invalid("missing network in beneficiary %q", beneficiary)
+	}
+	d.Network = network
+	d.RecipientId = recipientId
+
+	if query != "" {
+		for _, param := range strings.Split(query, "&") {
+			key, value, _ := strings.Cut(param, "=")
+			switch key {
+			case "expiry":
+				ts, err := strconv.ParseUint(value, 10, 64)
+				if err != nil {
+					return invalid("invalid expiry %q", value)
+				}
+				d.ExpirationTimestamp = &ts
+			case "endpoints":
+				if value != "" {
+					d.TransportEndpoints = strings.Split(value, ",")
+				}
+			}
+		}
+	}
+	if err := d.Validate(); err != nil {
+		return Data{}, err
+	}
+	return d, nil
+}
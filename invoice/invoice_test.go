@@ -0,0 +1,123 @@
+package invoice
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+const (
+	testBlinded = "utxob:zlVS28Rb-amM5lih-ONXGACC-IUWD0Y$-0JXcnWZ-PQn8VEI-B39!F"
+	testWitness = "wvout:2ys9mOQ2-KNL~1E5-CFZbJ7y-vLlSYO~-o6xUhzK-LiMaH8G-yVDTEJR"
+	testAssetId = "rgb:BppYGUUL-Qboz3UD-czwAaVV-!LgqBi0-xfU9Aj9-bRpF3mg"
+)
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func TestRoundTrip(t *testing.T) {
+	nia, uda := SchemaNia, SchemaUda
+	for name, d := range map[string]Data{
+		"blinded any": {RecipientId: testBlinded, Network: NetworkRegtest},
+		"witness any": {RecipientId: testWitness, Network: NetworkTestnet},
+		"fungible": {
+			RecipientId: testBlinded, AssetId: ptr(testAssetId), AssetSchema: &nia,
+			Assignment: Assignment{Kind: AssignmentFungible, Amount: 1000}, Network: NetworkMainnet,
+		},
+		"non-fungible": {
+			RecipientId: testWitness, AssetId: ptr(testAssetId), AssetSchema: &uda,
+			Assignment: Assignment{Kind: AssignmentNonFungible}, Network: NetworkSignet,
+		},
+		"inflation right": {
+			RecipientId: testBlinded, Assignment: Assignment{Kind: AssignmentInflationRight, Amount: 7},
+			AssignmentName: ptr(NameInflationAllowance), Network: NetworkTestnet4,
+		},
+		"link right":      {RecipientId: testBlinded, Assignment: Assignment{Kind: AssignmentLinkRight}, Network: NetworkRegtest},
+		"assignment name": {RecipientId: testWitness, Assignment: Assignment{Kind: AssignmentFungible, Amount: 1}, AssignmentName: ptr("custom"), Network: NetworkRegtest},
+		"max amount":      {RecipientId: testWitness, Assignment: Assignment{Kind: AssignmentFungible, Amount: 1<<64 - 1}, Network: NetworkRegtest},
+		"expiry":          {RecipientId: testBlinded, Network: NetworkRegtest, ExpirationTimestamp: ptr(uint64(1700000000))},
+		"endpoints": {
+			RecipientId: testWitness, Network: NetworkRegtest, ExpirationTimestamp: ptr(uint64(0)),
+			TransportEndpoints: []string{"rpcs://proxy.example.com/json-rpc", "rpc://127.0.0.1:3000/json-rpc"},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			s, err := Encode(d)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := Parse(s)
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", s, err)
+			}
+			if !reflect.DeepEqual(got, d) {
+				t.Fatalf("Parse(%q) = %+v, want %+v", s, got, d)
+			}
+			again, err := Encode(got)
+			if err != nil || again != s {
+				t.Fatalf("Encode after Parse = %q, %v, want %q", again, err, s)
+			}
+		})
+	}
+}
+
+func TestParseDefaultAssignmentName(t *testing.T) {
+	s := "rgb:~/~/" + NameAssetOwner + "/10+bcrt:" + testBlinded
+	d, err := Parse(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.AssignmentName == nil || *d.AssignmentName != NameAssetOwner {
+		t.Fatalf("assignment name %v, want %q", d.AssignmentName, NameAssetOwner)
+	}
+	// the default name is left out when encoding
+	want := "rgb:~/~/10+bcrt:" + testBlinded
+	if got, err := Encode(d); err != nil || got != want {
+		t.Fatalf("Encode = %q, %v, want %q", got, err, want)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, s := range []string{
+		"",
+		"bitcoin:~/~/bcrt:" + testBlinded,
+		"rgb:~/bcrt:" + testBlinded,
+		"rgb:~/~/a/b/bcrt:" + testBlinded,
+		"rgb:~/XYZ/bcrt:" + testBlinded,
+		"rgb:~/~/abc+bcrt:" + testBlinded,
+		"rgb:~/~/-1+bcrt:" + testBlinded,
+		"rgb:~/~/bcrt" + testBlinded,
+		"rgb:~/~/xx:" + testBlinded,
+		"rgb:~/~/bcrt:utxoc:abc",
+		"rgb:~/~/bcrt:utxob:",
+		"rgb:~/~/bcrt:" + testBlinded + "?expiry=soon",
+		"rgb:~/~/bcrt:" + testBlinded + "?endpoints=http://proxy.example.com",
+		"rgb:~/~/custom/1+bcrt:" + testBlinded + "?endpoints=rpc://",
+	} {
+		if d, err := Parse(s); !errors.Is(err, ErrInvalidInvoice) &&
+			!errors.Is(err, ErrInvalidRecipientId) && !errors.Is(err, ErrInvalidEndpoint) {
+			t.Errorf("Parse(%q) = %+v, %v, want an error", s, d, err)
+		}
+	}
+}
+
+func TestEncodeInvalid(t *testing.T) {
+	for name, d := range map[string]Data{
+		"no recipient":    {Network: NetworkRegtest},
+		"unknown network": {RecipientId: testBlinded},
+		"bad asset ID":    {RecipientId: testBlinded, Network: NetworkRegtest, AssetId: ptr("BppYGUUL")},
+		"bad schema":      {RecipientId: testBlinded, Network: NetworkRegtest, AssetSchema: ptr(Schema(9))},
+		"inflation name": {
+			RecipientId: testBlinded, Network: NetworkRegtest,
+			Assignment: Assignment{Kind: AssignmentInflationRight, Amount: 1}, AssignmentName: ptr("other"),
+		},
+		"bad kind":     {RecipientId: testBlinded, Network: NetworkRegtest, Assignment: Assignment{Kind: 9}},
+		"bad name":     {RecipientId: testBlinded, Network: NetworkRegtest, AssignmentName: ptr("a/b")},
+		"bad endpoint": {RecipientId: testBlinded, Network: NetworkRegtest, TransportEndpoints: []string{"rpc://a,b"}},
+	} {
+		if s, err := Encode(d); err == nil {
+			t.Errorf("%s: Encode = %q, want an error", name, s)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package rgb_lib
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/UTEXO-Protocol/rgb-lib-go/invoice"
+)
+
+// InvoiceDataFromCodec converts invoice data decoded by the pure-Go codec.
+func InvoiceDataFromCodec(d invoice.Data) InvoiceData {
+	r := InvoiceData{
+		RecipientId:         d.RecipientId,
+		ProxyRecipientId:    d.ProxyRecipientId(),
+		AssetId:             d.AssetId,
+		AssignmentName:      d.AssignmentName,
+		Network:             BitcoinNetwork(d.Network),
+		ExpirationTimestamp: d.ExpirationTimestamp,
+		TransportEndpoints:  d.TransportEndpoints,
+	}
+	if d.AssetSchema != nil {
+		schema := AssetSchema(*d.AssetSchema)
+		r.AssetSchema = &schema
+	}
+	switch d.Assignment.Kind {
+	case invoice.AssignmentFungible:
+		r.Assignment = AssignmentFungible{Amount: d.Assignment.Amount}
+	case invoice.AssignmentNonFungible:
+		r.Assignment = AssignmentNonFungible{}
+	case invoice.AssignmentInflationRight:
+		r.Assignment = AssignmentInflationRight{Amount: d.Assignment.Amount}
+	case invoice.AssignmentLinkRight:
+		r.Assignment = AssignmentLinkRight{}
+	default:
+		r.Assignment = AssignmentAny{}
+	}
+	return r
+}
+
+// InvoiceDataToCodec converts invoice data for the pure-Go codec, e.g. to
+// build an invoice string with invoice.Encode.
+func InvoiceDataToCodec(d InvoiceData) invoice.Data {
+	r := invoice.Data{
+		RecipientId:         d.RecipientId,
+		AssetId:             d.AssetId,
+		AssignmentName:      d.AssignmentName,
+		Network:             invoice.Network(d.Network),
+		ExpirationTimestamp: d.ExpirationTimestamp,
+		TransportEndpoints:  d.TransportEndpoints,
+	}
+	if d.AssetSchema != nil {
+		schema := invoice.Schema(*d.AssetSchema)
+		r.AssetSchema = &schema
+	}
+	switch a := d.Assignment.(type) {
+	case AssignmentFungible:
+		r.Assignment = invoice.Assignment{Kind: invoice.AssignmentFungible, Amount: a.Amount}
+	case AssignmentNonFungible:
+		r.Assignment = invoice.Assignment{Kind: invoice.AssignmentNonFungible}
+	case AssignmentInflationRight:
+		r.Assignment = invoice.Assignment{Kind: invoice.AssignmentInflationRight, Amount: a.Amount}
+	case AssignmentLinkRight:
+		r.Assignment = invoice.Assignment{Kind: invoice.AssignmentLinkRight}
+	}
+	return r
+}
+
+func optionalEqual[T comparable](a, b *T) bool {
+	return (a == nil && b == nil) || (a != nil && b != nil && *a == *b)
+}
+
+// CheckInvoiceCodec decodes s with both NewInvoice and the pure-Go codec and
+// returns an error describing the first difference, including a difference
+// between the native invoice string and the one the codec re-encodes.
+func CheckInvoiceCodec(s string) error {
+	native, err := NewInvoice(s)
+	if err != nil {
+		if _, codecErr := invoice.Parse(s); codecErr == nil {
+			return fmt.Errorf("native rejects invoice accepted by the codec: %w", err)
+		}
+		return nil
+	}
+	defer native.Destroy()
+	parsed, err := invoice.Parse(s)
+	if err != nil {
+		return fmt.Errorf("codec rejects invoice accepted by the native library: %w", err)
+	}
+
+	want := native.InvoiceData()
+	got := InvoiceDataFromCodec(parsed)
+	// the codec leaves out default assignment names
+	if got.AssignmentName == nil {
+		got.AssignmentName = want.AssignmentName
+	}
+	switch {
+	case got.RecipientId != want.RecipientId:
+		return fmt.Errorf("recipient ID: codec %q, native %q", got.RecipientId, want.RecipientId)
+	case got.ProxyRecipientId != want.ProxyRecipientId:
+		return fmt.Errorf("proxy recipient ID: codec %q, native %q", got.ProxyRecipientId, want.ProxyRecipientId)
+	case !optionalEqual(got.AssetSchema, want.AssetSchema):
+		return fmt.Errorf("asset schema: codec %v, native %v", got.AssetSchema, want.AssetSchema)
+	case !optionalEqual(got.AssetId, want.AssetId):
+		return fmt.Errorf("asset ID: codec %v, native %v", got.AssetId, want.AssetId)
+	case got.Assignment != want.Assignment:
+		return fmt.Errorf("assignment: codec %#v, native %#v", got.Assignment, want.Assignment)
+	case !optionalEqual(got.AssignmentName, want.AssignmentName):
+		return fmt.Errorf("assignment name: codec %v, native %v", got.AssignmentName, want.AssignmentName)
+	case got.Network != want.Network:
+		return fmt.Errorf("network: codec %v, native %v", got.Network, want.Network)
+	case !optionalEqual(got.ExpirationTimestamp, want.ExpirationTimestamp):
+		return fmt.Errorf("expiration: codec %v, native %v", got.ExpirationTimestamp, want.ExpirationTimestamp)
+	case !slices.Equal(got.TransportEndpoints, want.TransportEndpoints):
+		return fmt.Errorf("endpoints: codec %v, native %v", got.TransportEndpoints, want.TransportEndpoints)
+	}
+
+	encoded, err := invoice.Encode(InvoiceDataToCodec(want))
+	if err != nil {
+		return fmt.Errorf("codec cannot encode native invoice data: %w", err)
+	}
+	if nativeString := native.InvoiceString(); encoded != nativeString {
+		return fmt.Errorf("invoice string: codec %q, native %q", encoded, nativeString)
+	}
+	return nil
+}
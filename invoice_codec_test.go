@@ -0,0 +1,83 @@
+//go:build cgo
+
+package rgb_lib
+
+import (
+	"testing"
+	"time"
+)
+
+// newOfflineWallet returns a regtest wallet with fresh keys, which can create
+// witness invoices without going online.
+func newOfflineWallet(t *testing.T) *Wallet {
+	t.Helper()
+	keys := GenerateKeys(BitcoinNetworkRegtest, WitnessVersionTaproot)
+	wallet, err := NewWallet(WalletData{
+		DataDir:               t.TempDir(),
+		BitcoinNetwork:        BitcoinNetworkRegtest,
+		DatabaseType:          DatabaseTypeSqlite,
+		MaxAllocationsPerUtxo: 5,
+		SupportedSchemas:      []AssetSchema{AssetSchemaNia, AssetSchemaUda, AssetSchemaCfa, AssetSchemaIfa},
+	}, SinglesigKeys{
+		AccountXpubVanilla: keys.AccountXpubVanilla,
+		AccountXpubColored: keys.AccountXpubColored,
+		MasterFingerprint:  keys.MasterFingerprint,
+		Mnemonic:           &keys.Mnemonic,
+		WitnessVersion:     keys.WitnessVersion,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(wallet.Destroy)
+	return wallet
+}
+
+func TestCheckInvoiceCodec(t *testing.T) {
+	wallet := newOfflineWallet(t)
+	expiry := uint64(time.Now().Add(time.Hour).Unix())
+	endpoints := []string{"rpc://127.0.0.1:3000/json-rpc", "rpcs://proxy.example.com/json-rpc"}
+	cases := []struct {
+		name       string
+		blinded    bool
+		assignment Assignment
+		expiry     *uint64
+		endpoints  []string
+	}{
+		{name: "witness any", assignment: AssignmentAny{}},
+		{name: "witness fungible", assignment: AssignmentFungible{Amount: 1000}},
+		{name: "witness non-fungible", assignment: AssignmentNonFungible{}},
+		{name: "witness inflation right", assignment: AssignmentInflationRight{Amount: 50}},
+		{name: "witness link right", assignment: AssignmentLinkRight{}},
+		{name: "witness expiry", assignment: AssignmentFungible{Amount: 1}, expiry: &expiry},
+		{name: "witness endpoints", assignment: AssignmentAny{}, expiry: &expiry, endpoints: endpoints},
+		{name: "blinded any", blinded: true, assignment: AssignmentAny{}},
+		{name: "blinded fungible", blinded: true, assignment: AssignmentFungible{Amount: 1000}, expiry: &expiry, endpoints: endpoints},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			receive := wallet.WitnessReceive
+			if c.blinded {
+				receive = wallet.BlindReceive
+			}
+			data, err := receive(nil, c.assignment, c.expiry, c.endpoints, 1)
+			if err != nil {
+				if c.blinded {
+					// blinding needs a UTXO, which an offline wallet lacks
+					t.Skipf("blind receive: %v", err)
+				}
+				t.Fatal(err)
+			}
+			if err := CheckInvoiceCodec(data.Invoice); err != nil {
+				t.Fatalf("%s: %v", data.Invoice, err)
+			}
+		})
+	}
+}
+
+func TestCheckInvoiceCodecRejected(t *testing.T) {
+	for _, s := range []string{"", "rgb:", "rgb:~/~/bcrt:utxob:", "rgb:~/~/xx:wvout:abc"} {
+		if err := CheckInvoiceCodec(s); err != nil {
+			t.Errorf("%q: %v", s, err)
+		}
+	}
+}
@@ -0,0 +1,510 @@
+package rgb_lib
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ManifestAmount is a decimal amount in the precision of the asset. It may be
+// written as a JSON or YAML number or string; quote decimals with many digits
+// in JSON to keep them exact.
+type ManifestAmount string
+
+func (a *ManifestAmount) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*a = ManifestAmount(s)
+		return nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err != nil {
+		return fmt.Errorf("amount %s is neither a number nor a string", data)
+	}
+	*a = ManifestAmount(n)
+	return nil
+}
+
+// IssuanceSpec describes an asset to issue. Id is chosen by the issuer and
+// identifies the asset across runs. Media and Attachments are file paths,
+// relative to the manifest directory.
+type IssuanceSpec struct {
+	Id               string           `json:"id"`
+	Schema           string           `json:"schema"`
+	Ticker           string           `json:"ticker,omitempty"`
+	Name             string           `json:"name"`
+	Details          *string          `json:"details,omitempty"`
+	Precision        uint8            `json:"precision"`
+	Amounts          []ManifestAmount `json:"amounts,omitempty"`
+	InflationAmounts []ManifestAmount `json:"inflation_amounts,omitempty"`
+	RejectListUrl    *string          `json:"reject_list_url,omitempty"`
+	Media            *string          `json:"media,omitempty"`
+	Attachments      []string         `json:"attachments,omitempty"`
+}
+
+// IssuanceManifest lists the assets to issue.
+type IssuanceManifest struct {
+	Assets []IssuanceSpec `json:"assets"`
+
+	dir  string
+	hash string
+}
+
+// ParseIssuanceManifest decodes a JSON or YAML manifest. Relative file paths
+// are resolved against dir. Unknown fields are rejected.
+func ParseIssuanceManifest(data []byte, dir string) (*IssuanceManifest, error) {
+	js := data
+	if trimmed := bytes.TrimSpace(data); len(trimmed) == 0 || trimmed[0] != '{' {
+		v, err := decodeYAML(data)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidManifest, err)
+		}
+		if js, err = json.Marshal(v); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidManifest, err)
+		}
+	}
+	m := &IssuanceManifest{dir: dir}
+	dec := json.NewDecoder(bytes.NewReader(js))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(m); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidManifest, err)
+	}
+	sum := sha256.Sum256(js)
+	m.hash = hex.EncodeToString(sum[:])
+	return m, nil
+}
+
+// LoadIssuanceManifest reads the manifest at path.
+func LoadIssuanceManifest(path string) (*IssuanceManifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseIssuanceManifest(data, filepath.Dir(path))
+}
+
+// IssuanceSpecError reports an invalid asset of a manifest. Err wraps the
+// RgbLibError the native library would return, when there is one.
+type IssuanceSpecError struct {
+	Id  string
+	Err error
+}
+
+func (e *IssuanceSpecError) Error() string {
+	return fmt.Sprintf("asset %q: %v", e.Id, e.Err)
+}
+
+func (e *IssuanceSpecError) Unwrap() error {
+	return e.Err
+}
+
+// IssuanceStep is a validated IssuanceSpec, with raw amounts and absolute
+// file paths.
+type IssuanceStep struct {
+	Spec             IssuanceSpec
+	Schema           AssetSchema
+	Amounts          []uint64
+	InflationAmounts []uint64
+	Media            *string
+	Attachments      []string
+}
+
+// Supply returns the issued supply of the step.
+func (s IssuanceStep) Supply() uint64 {
+	if s.Schema == AssetSchemaUda {
+		return 1
+	}
+	var total uint64
+	for _, a := range s.Amounts {
+		total += a
+	}
+	return total
+}
+
+// IssuancePlan is a validated manifest, ready to run.
+type IssuancePlan struct {
+	Steps    []IssuanceStep
+	manifest string
+}
+
+// PlanIssuance validates a manifest offline. It checks tickers, names,
+// precisions, details, amounts, reject-list URLs and files, reporting every
+// invalid asset as an IssuanceSpecError wrapping the matching RgbLibError,
+// e.g. ErrRgbLibErrorInvalidTicker.
+func PlanIssuance(m *IssuanceManifest) (*IssuancePlan, error) {
+	if len(m.Assets) == 0 {
+		return nil, fmt.Errorf("%w: no assets", ErrInvalidManifest)
+	}
+	plan := &IssuancePlan{manifest: m.hash}
+	var errs []error
+	ids := map[string]bool{}
+	for _, spec := range m.Assets {
+		step, err := m.step(spec)
+		if err == nil && ids[spec.Id] {
+			err = errors.New("duplicate id")
+		}
+		if err != nil {
+			errs = append(errs, &IssuanceSpecError{Id: spec.Id, Err: err})
+			continue
+		}
+		ids[spec.Id] = true
+		plan.Steps = append(plan.Steps, step)
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return plan, nil
+}
+
+// issuanceFields lists the optional fields each schema accepts.
+var issuanceFields = map[AssetSchema][]string{
+	AssetSchemaNia: {"ticker", "amounts"},
+	AssetSchemaCfa: {"details", "amounts", "media"},
+	AssetSchemaUda: {"ticker", "details", "media", "attachments"},
+	AssetSchemaIfa: {"ticker", "amounts", "inflation_amounts", "reject_list_url"},
+}
+
+func (m *IssuanceManifest) step(spec IssuanceSpec) (IssuanceStep, error) {
+	if spec.Id == "" {
+		return IssuanceStep{}, errors.New("missing id")
+	}
+	var step IssuanceStep
+	schema, ok := parseAssetSchema(spec.Schema)
+	if !ok {
+		return step, fmt.Errorf("unknown schema %q", spec.Schema)
+	}
+	step = IssuanceStep{Spec: spec, Schema: schema}
+	allowed := issuanceFields[schema]
+	for field, set := range map[string]bool{
+		"ticker":            spec.Ticker != "",
+		"details":           spec.Details != nil,
+		"amounts":           len(spec.Amounts) > 0,
+		"inflation_amounts": len(spec.InflationAmounts) > 0,
+		"reject_list_url":   spec.RejectListUrl != nil,
+		"media":             spec.Media != nil,
+		"attachments":       len(spec.Attachments) > 0,
+	} {
+		if set && !slices.Contains(allowed, field) {
+			return step, fmt.Errorf("%s assets have no %s", strings.ToUpper(schema.String()), field)
+		}
+	}
+
+	var errs []error
+	if slices.Contains(allowed, "ticker") {
+		errs = append(errs, validateTicker(spec.Ticker))
+	}
+	errs = append(errs, validateAssetName(spec.Name))
+	if spec.Precision > 18 {
+		errs = append(errs, NewRgbLibErrorInvalidPrecision("precision is too high"))
+	}
+	if spec.Details != nil && strings.TrimSpace(*spec.Details) == "" {
+		errs = append(errs, NewRgbLibErrorInvalidDetails("ignoring empty details"))
+	}
+	if slices.Contains(allowed, "amounts") {
+		var err error
+		step.Amounts, step.InflationAmounts, err = issuanceAmounts(spec)
+		errs = append(errs, err)
+	}
+	if spec.RejectListUrl != nil {
+		if u, err := url.Parse(*spec.RejectListUrl); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, NewRgbLibErrorInvalidRejectListUrl(*spec.RejectListUrl))
+		}
+	}
+	if spec.Media != nil {
+		path, err := m.file(*spec.Media)
+		step.Media = &path
+		errs = append(errs, err)
+	}
+	for _, a := range spec.Attachments {
+		path, err := m.file(a)
+		step.Attachments = append(step.Attachments, path)
+		errs = append(errs, err)
+	}
+	return step, errors.Join(errs...)
+}
+
+func parseAssetSchema(s string) (AssetSchema, bool) {
+	for _, schema := range []AssetSchema{AssetSchemaNia, AssetSchemaUda, AssetSchemaCfa, AssetSchemaIfa} {
+		if strings.EqualFold(s, schema.String()) {
+			return schema, true
+		}
+	}
+	return 0, false
+}
+
+// validateTicker accepts 1 to 8 uppercase letters and digits, starting with a
+// letter.
+func validateTicker(ticker string) error {
+	switch {
+	case ticker == "":
+		return NewRgbLibErrorInvalidTicker("ticker cannot be empty")
+	case len(ticker) > 8:
+		return NewRgbLibErrorInvalidTicker("ticker is too long")
+	case ticker != strings.ToUpper(ticker):
+		return NewRgbLibErrorInvalidTicker("ticker needs to be all uppercase")
+	case ticker[0] < 'A' || ticker[0] > 'Z':
+		return NewRgbLibErrorInvalidTicker("ticker must start with a letter")
+	}
+	for _, c := range ticker {
+		if (c < 'A' || c > 'Z') && (c < '0' || c > '9') {
+			return NewRgbLibErrorInvalidTicker(fmt.Sprintf("invalid character %q", c))
+		}
+	}
+	return nil
+}
+
+// validateAssetName accepts 1 to 40 printable ASCII characters without
+// leading or trailing spaces.
+func validateAssetName(name string) error {
+	switch {
+	case name == "":
+		return NewRgbLibErrorInvalidName("name cannot be empty")
+	case len(name) > 40:
+		return NewRgbLibErrorInvalidName("name is too long")
+	case strings.TrimSpace(name) != name:
+		return NewRgbLibErrorInvalidName("name has leading or trailing spaces")
+	}
+	for _, c := range name {
+		if c < ' ' || c > '~' {
+			return NewRgbLibErrorInvalidName(fmt.Sprintf("invalid character %q", c))
+		}
+	}
+	return nil
+}
+
+func issuanceAmounts(spec IssuanceSpec) ([]uint64, []uint64, error) {
+	if len(spec.Amounts) == 0 {
+		return nil, nil, NewRgbLibErrorNoIssuanceAmounts()
+	}
+	parse := func(amounts []ManifestAmount) ([]uint64, error) {
+		raw := make([]uint64, 0, len(amounts))
+		for _, s := range amounts {
+			a, err := ParseAmount(string(s), spec.Precision)
+			if err != nil {
+				return nil, err
+			}
+			if a.IsZero() {
+				return nil, NewRgbLibErrorInvalidAmountZero()
+			}
+			raw = append(raw, a.Raw)
+		}
+		return raw, nil
+	}
+	amounts, err := parse(spec.Amounts)
+	if err != nil {
+		return nil, nil, err
+	}
+	inflation, err := parse(spec.InflationAmounts)
+	if err != nil {
+		return nil, nil, err
+	}
+	var total uint64
+	for _, a := range amounts {
+		if total+a < total {
+			return nil, nil, NewRgbLibErrorTooHighIssuanceAmounts()
+		}
+		total += a
+	}
+	for _, a := range inflation {
+		if total+a < total {
+			return nil, nil, NewRgbLibErrorTooHighInflationAmounts()
+		}
+		total += a
+	}
+	return amounts, inflation, nil
+}
+
+func (m *IssuanceManifest) file(path string) (string, error) {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(m.dir, path)
+	}
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return path, NewRgbLibErrorInvalidFilePath(path)
+	}
+	return path, nil
+}
+
+// IssuanceWallet is the subset of Wallet needed to run an IssuancePlan.
+type IssuanceWallet interface {
+	IssueAssetNia(ticker string, name string, precision uint8, amounts []uint64) (AssetNia, error)
+	IssueAssetCfa(name string, details *string, precision uint8, amounts []uint64, filePath *string) (AssetCfa, error)
+	IssueAssetUda(ticker string, name string, details *string, precision uint8, mediaFilePath *string, attachmentsFilePaths []string) (AssetUda, error)
+	IssueAssetIfa(ticker string, name string, precision uint8, amounts []uint64, inflationAmounts []uint64, rejectListUrl *string) (AssetIfa, error)
+	ListAssets(filterAssetSchemas []AssetSchema) (Assets, error)
+}
+
+type IssuanceState string
+
+const (
+	// IssuanceStarted is recorded before the IssueAsset* call.
+	IssuanceStarted IssuanceState = "started"
+	IssuanceDone    IssuanceState = "issued"
+)
+
+// IssuanceRecord is the outcome of an IssuanceStep.
+type IssuanceRecord struct {
+	Id        string        `json:"id"`
+	Schema    string        `json:"schema"`
+	State     IssuanceState `json:"state"`
+	AssetId   string        `json:"asset_id,omitempty"`
+	Ticker    string        `json:"ticker,omitempty"`
+	Name      string        `json:"name"`
+	Precision uint8         `json:"precision"`
+	Supply    uint64        `json:"supply"`
+	StartedAt int64         `json:"started_at"`
+	IssuedAt  int64         `json:"issued_at,omitempty"`
+}
+
+// IssuanceReport maps manifest IDs to the issued assets.
+type IssuanceReport struct {
+	Manifest string           `json:"manifest"`
+	Assets   []IssuanceRecord `json:"assets"`
+}
+
+// Record returns the record of the asset with the given manifest ID.
+func (r *IssuanceReport) Record(id string) (*IssuanceRecord, bool) {
+	for i := range r.Assets {
+		if r.Assets[i].Id == id {
+			return &r.Assets[i], true
+		}
+	}
+	return nil, false
+}
+
+// hasAsset reports whether assetId is recorded for any manifest ID.
+func (r *IssuanceReport) hasAsset(assetId string) bool {
+	return slices.ContainsFunc(r.Assets, func(a IssuanceRecord) bool {
+		return a.AssetId == assetId
+	})
+}
+
+// Run issues the assets of the plan not yet issued according to the report at
+// reportPath, rewriting it after every step. Running it again after an
+// interruption continues where it stopped: a step started but not recorded
+// as issued is matched against the assets added to the wallet since, by
+// schema, name, ticker, precision and supply, before being issued again.
+// Assets already recorded for another manifest ID are not matched, so
+// identical specs map to distinct assets.
+func (p *IssuancePlan) Run(wallet IssuanceWallet, reportPath string) (*IssuanceReport, error) {
+	report := &IssuanceReport{Manifest: p.manifest}
+	found, err := readJSONFile(reportPath, report)
+	if err != nil {
+		return nil, err
+	}
+	if found && report.Manifest != p.manifest {
+		return nil, fmt.Errorf("%w: report %s belongs to another manifest", ErrJournalMismatch, reportPath)
+	}
+	for _, step := range p.Steps {
+		record, ok := report.Record(step.Spec.Id)
+		if ok && record.State == IssuanceDone {
+			continue
+		}
+		if ok {
+			assetId, err := findIssued(wallet, step, record.StartedAt, report)
+			if err != nil {
+				return report, err
+			}
+			if assetId != "" {
+				record.AssetId, record.State, record.IssuedAt = assetId, IssuanceDone, time.Now().Unix()
+				if err := writeJSONFile(reportPath, report); err != nil {
+					return report, err
+				}
+				continue
+			}
+		} else {
+			report.Assets = append(report.Assets, IssuanceRecord{Id: step.Spec.Id})
+			record = &report.Assets[len(report.Assets)-1]
+		}
+		*record = IssuanceRecord{
+			Id:        step.Spec.Id,
+			Schema:    step.Schema.String(),
+			State:     IssuanceStarted,
+			Ticker:    step.Spec.Ticker,
+			Name:      step.Spec.Name,
+			Precision: step.Spec.Precision,
+			Supply:    step.Supply(),
+			StartedAt: time.Now().Unix(),
+		}
+		if err := writeJSONFile(reportPath, report); err != nil {
+			return report, err
+		}
+		assetId, err := step.issue(wallet)
+		if err != nil {
+			return report, &IssuanceSpecError{Id: step.Spec.Id, Err: err}
+		}
+		record.AssetId, record.State, record.IssuedAt = assetId, IssuanceDone, time.Now().Unix()
+		if err := writeJSONFile(reportPath, report); err != nil {
+			return report, fmt.Errorf("issued %s but could not record it: %w", assetId, err)
+		}
+	}
+	return report, nil
+}
+
+func (s IssuanceStep) issue(wallet IssuanceWallet) (string, error) {
+	spec := s.Spec
+	switch s.Schema {
+	case AssetSchemaNia:
+		a, err := wallet.IssueAssetNia(spec.Ticker, spec.Name, spec.Precision, s.Amounts)
+		return a.AssetId, err
+	case AssetSchemaCfa:
+		a, err := wallet.IssueAssetCfa(spec.Name, spec.Details, spec.Precision, s.Amounts, s.Media)
+		return a.AssetId, err
+	case AssetSchemaUda:
+		a, err := wallet.IssueAssetUda(spec.Ticker, spec.Name, spec.Details, spec.Precision, s.Media, s.Attachments)
+		return a.AssetId, err
+	default:
+		a, err := wallet.IssueAssetIfa(spec.Ticker, spec.Name, spec.Precision, s.Amounts, s.InflationAmounts, spec.RejectListUrl)
+		return a.AssetId, err
+	}
+}
+
+// findIssued returns the ID of an asset matching step added since startedAt
+// and not yet in report, or "" if there is none.
+func findIssued(wallet IssuanceWallet, step IssuanceStep, startedAt int64, report *IssuanceReport) (string, error) {
+	assets, err := wallet.ListAssets([]AssetSchema{step.Schema})
+	if err != nil {
+		return "", err
+	}
+	spec := step.Spec
+	match := func(assetId string, addedAt int64, ticker, name string, precision uint8, supply uint64) bool {
+		return !report.hasAsset(assetId) && addedAt >= startedAt && ticker == spec.Ticker && name == spec.Name &&
+			precision == spec.Precision && supply == step.Supply()
+	}
+	switch {
+	case assets.Nia != nil:
+		for _, a := range *assets.Nia {
+			if match(a.AssetId, a.AddedAt, a.Ticker, a.Name, a.Precision, a.IssuedSupply) {
+				return a.AssetId, nil
+			}
+		}
+	case assets.Cfa != nil:
+		for _, a := range *assets.Cfa {
+			if match(a.AssetId, a.AddedAt, "", a.Name, a.Precision, a.IssuedSupply) {
+				return a.AssetId, nil
+			}
+		}
+	case assets.Uda != nil:
+		for _, a := range *assets.Uda {
+			if match(a.AssetId, a.AddedAt, a.Ticker, a.Name, a.Precision, 1) {
+				return a.AssetId, nil
+			}
+		}
+	case assets.Ifa != nil:
+		for _, a := range *assets.Ifa {
+			if match(a.AssetId, a.AddedAt, a.Ticker, a.Name, a.Precision, a.InitialSupply) {
+				return a.AssetId, nil
+			}
+		}
+	}
+	return "", nil
+}
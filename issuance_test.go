@@ -0,0 +1,185 @@
+package rgb_lib
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPlanIssuance(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "media.png"), []byte("png"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	media, details, url := "media.png", "details", "https://example.com/list"
+	for _, c := range []struct {
+		name string
+		spec IssuanceSpec
+		want error // nil when the spec is valid
+	}{
+		{"nia", IssuanceSpec{Schema: "nia", Ticker: "TKN", Name: "Token", Precision: 2, Amounts: []ManifestAmount{"1.5", "2"}}, nil},
+		{"nia with details", IssuanceSpec{Schema: "nia", Ticker: "TKN", Name: "Token", Amounts: []ManifestAmount{"1"}, Details: &details}, errors.New("NIA assets have no details")},
+		{"nia with media", IssuanceSpec{Schema: "nia", Ticker: "TKN", Name: "Token", Amounts: []ManifestAmount{"1"}, Media: &media}, errors.New("NIA assets have no media")},
+		{"cfa", IssuanceSpec{Schema: "CFA", Name: "Collectible", Details: &details, Amounts: []ManifestAmount{"10"}, Media: &media}, nil},
+		{"cfa with ticker", IssuanceSpec{Schema: "cfa", Ticker: "TKN", Name: "Collectible", Amounts: []ManifestAmount{"10"}}, errors.New("CFA assets have no ticker")},
+		{"uda", IssuanceSpec{Schema: "uda", Ticker: "UNQ", Name: "Unique", Details: &details, Media: &media, Attachments: []string{media}}, nil},
+		{"uda with amounts", IssuanceSpec{Schema: "uda", Ticker: "UNQ", Name: "Unique", Amounts: []ManifestAmount{"1"}}, errors.New("UDA assets have no amounts")},
+		{"ifa", IssuanceSpec{Schema: "ifa", Ticker: "INF", Name: "Inflatable", Amounts: []ManifestAmount{"1"}, InflationAmounts: []ManifestAmount{"2"}, RejectListUrl: &url}, nil},
+		{"ifa with attachments", IssuanceSpec{Schema: "ifa", Ticker: "INF", Name: "Inflatable", Amounts: []ManifestAmount{"1"}, Attachments: []string{media}}, errors.New("IFA assets have no attachments")},
+		{"unknown schema", IssuanceSpec{Schema: "xyz", Name: "Token"}, errors.New(`unknown schema "xyz"`)},
+		{"missing ticker", IssuanceSpec{Schema: "nia", Name: "Token", Amounts: []ManifestAmount{"1"}}, ErrRgbLibErrorInvalidTicker},
+		{"lowercase ticker", IssuanceSpec{Schema: "nia", Ticker: "Tkn", Name: "Token", Amounts: []ManifestAmount{"1"}}, ErrRgbLibErrorInvalidTicker},
+		{"long ticker", IssuanceSpec{Schema: "uda", Ticker: "TOOLONGTK", Name: "Unique"}, ErrRgbLibErrorInvalidTicker},
+		{"ticker starting with a digit", IssuanceSpec{Schema: "ifa", Ticker: "1TKN", Name: "Token", Amounts: []ManifestAmount{"1"}}, ErrRgbLibErrorInvalidTicker},
+		{"missing name", IssuanceSpec{Schema: "cfa", Amounts: []ManifestAmount{"1"}}, ErrRgbLibErrorInvalidName},
+		{"name with spaces", IssuanceSpec{Schema: "cfa", Name: " Token", Amounts: []ManifestAmount{"1"}}, ErrRgbLibErrorInvalidName},
+		{"name with control character", IssuanceSpec{Schema: "cfa", Name: "To\nken", Amounts: []ManifestAmount{"1"}}, ErrRgbLibErrorInvalidName},
+		{"precision", IssuanceSpec{Schema: "nia", Ticker: "TKN", Name: "Token", Precision: 19, Amounts: []ManifestAmount{"1"}}, ErrRgbLibErrorInvalidPrecision},
+		{"amount above precision", IssuanceSpec{Schema: "nia", Ticker: "TKN", Name: "Token", Precision: 1, Amounts: []ManifestAmount{"1.25"}}, ErrAmountInvalid},
+		{"missing amounts", IssuanceSpec{Schema: "cfa", Name: "Token"}, ErrRgbLibErrorNoIssuanceAmounts},
+		{"missing media", IssuanceSpec{Schema: "uda", Ticker: "UNQ", Name: "Unique", Attachments: []string{"missing.png"}}, ErrRgbLibErrorInvalidFilePath},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			c.spec.Id = "a"
+			plan, err := PlanIssuance(&IssuanceManifest{Assets: []IssuanceSpec{c.spec}, dir: dir})
+			if c.want == nil {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if step := plan.Steps[0]; step.Media != nil && *step.Media != filepath.Join(dir, media) {
+					t.Fatalf("media %s, want it in %s", *step.Media, dir)
+				}
+				return
+			}
+			var specErr *IssuanceSpecError
+			if !errors.As(err, &specErr) || specErr.Id != "a" {
+				t.Fatalf("PlanIssuance = %v, want an IssuanceSpecError", err)
+			}
+			if !errors.Is(err, c.want) && !strings.HasSuffix(err.Error(), c.want.Error()) {
+				t.Fatalf("PlanIssuance = %v, want %v", err, c.want)
+			}
+		})
+	}
+}
+
+func TestPlanIssuanceYAML(t *testing.T) {
+	m, err := ParseIssuanceManifest([]byte(`
+assets:
+  - id: a
+    schema: nia
+    ticker: TKN
+    name: Token
+    precision: 0
+    amounts: [1e3, 0x10, "20"]
+  - id: a
+    schema: nia
+    ticker: TKN
+    name: Token
+    amounts: [1]
+`), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := PlanIssuance(m); err == nil || !strings.Contains(err.Error(), "duplicate id") {
+		t.Fatalf("PlanIssuance = %v, want a duplicate id error", err)
+	}
+	m.Assets = m.Assets[:1]
+	plan, err := PlanIssuance(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := plan.Steps[0].Amounts; !slices.Equal(got, []uint64{1000, 16, 20}) {
+		t.Fatalf("amounts %v, want [1000 16 20]", got)
+	}
+}
+
+// fakeIssuanceWallet issues NIA assets. Issuing asset number crashAt fails
+// after the wallet added it, or before if crashBefore is set.
+type fakeIssuanceWallet struct {
+	IssuanceWallet
+
+	nia         []AssetNia
+	crashAt     int
+	crashBefore bool
+}
+
+func (w *fakeIssuanceWallet) IssueAssetNia(ticker string, name string, precision uint8, amounts []uint64) (AssetNia, error) {
+	crash := len(w.nia)+1 == w.crashAt
+	if crash && w.crashBefore {
+		return AssetNia{}, errTest
+	}
+	var supply uint64
+	for _, a := range amounts {
+		supply += a
+	}
+	a := AssetNia{
+		AssetId: fmt.Sprintf("rgb:nia%d", len(w.nia)+1), Ticker: ticker, Name: name, Precision: precision,
+		IssuedSupply: supply, AddedAt: time.Now().Unix(),
+	}
+	w.nia = append(w.nia, a)
+	if crash {
+		return AssetNia{}, errTest
+	}
+	return a, nil
+}
+
+func (w *fakeIssuanceWallet) ListAssets(filterAssetSchemas []AssetSchema) (Assets, error) {
+	return Assets{Nia: &w.nia}, nil
+}
+
+func issuanceStates(report *IssuanceReport) []string {
+	var states []string
+	for _, r := range report.Assets {
+		states = append(states, fmt.Sprintf("%s %s %s", r.Id, r.State, r.AssetId))
+	}
+	return states
+}
+
+// TestIssuanceResume issues four identical assets, interrupting the run once
+// after the wallet issued an asset and once before.
+func TestIssuanceResume(t *testing.T) {
+	spec := IssuanceSpec{Schema: "nia", Ticker: "TKN", Name: "Token", Amounts: []ManifestAmount{"100"}}
+	var specs []IssuanceSpec
+	for _, id := range []string{"a", "b", "c", "d"} {
+		spec.Id = id
+		specs = append(specs, spec)
+	}
+	plan, err := PlanIssuance(&IssuanceManifest{Assets: specs, hash: "manifest"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reportPath := filepath.Join(t.TempDir(), "report.json")
+	wallet := &fakeIssuanceWallet{crashAt: 2}
+	run := func(want error, states ...string) {
+		t.Helper()
+		report, err := plan.Run(wallet, reportPath)
+		if !errors.Is(err, want) {
+			t.Fatalf("Run = %v, want %v", err, want)
+		}
+		if got := issuanceStates(report); !slices.Equal(got, states) {
+			t.Fatalf("report %q, want %q", got, states)
+		}
+	}
+
+	run(errTest, "a issued rgb:nia1", "b started ")
+	// b is matched to the asset issued since, not to the one of a
+	wallet.crashAt, wallet.crashBefore = 3, true
+	run(errTest, "a issued rgb:nia1", "b issued rgb:nia2", "c started ")
+	// c is issued again, as no unrecorded asset matches it
+	wallet.crashAt = 0
+	run(nil, "a issued rgb:nia1", "b issued rgb:nia2", "c issued rgb:nia3", "d issued rgb:nia4")
+	run(nil, "a issued rgb:nia1", "b issued rgb:nia2", "c issued rgb:nia3", "d issued rgb:nia4")
+	if len(wallet.nia) != 4 {
+		t.Fatalf("%d assets issued, want 4", len(wallet.nia))
+	}
+
+	plan.manifest = "other"
+	if _, err := plan.Run(wallet, reportPath); !errors.Is(err, ErrJournalMismatch) {
+		t.Fatalf("Run = %v, want %v", err, ErrJournalMismatch)
+	}
+}
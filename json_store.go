@@ -0,0 +1,146 @@
+package rgb_lib
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+)
+
+// recordStore keeps records of type T by key, in memory and, when path is
+// set, in a JSON file rewritten atomically on every change. It is safe for
+// concurrent use within a process, and is embedded by the Memory and File
+// stores of the package, which get their Get and Put methods from it.
+type recordStore[T any] struct {
+	mu       sync.Mutex
+	records  map[string]T
+	path     string
+	key      func(T) string
+	compare  func(a, b T) int
+	notFound error
+}
+
+// newRecordStore returns an in-memory store of records identified by key and
+// sorted by compare. Get wraps notFound for unknown keys.
+func newRecordStore[T any](key func(T) string, compare func(a, b T) int, notFound error) *recordStore[T] {
+	return &recordStore[T]{records: map[string]T{}, key: key, compare: compare, notFound: notFound}
+}
+
+// loadRecordStore is like newRecordStore but loads the records of the file at
+// path, which is created on the first change if it does not exist.
+func loadRecordStore[T any](path string, key func(T) string, compare func(a, b T) int, notFound error) (*recordStore[T], error) {
+	s := newRecordStore(key, compare, notFound)
+	s.path = path
+	var records []T
+	if _, err := readJSONFile(path, &records); err != nil {
+		return nil, err
+	}
+	for _, r := range records {
+		s.records[key(r)] = r
+	}
+	return s, nil
+}
+
+func (s *recordStore[T]) Get(key string) (T, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.records[key]
+	if !ok {
+		return r, fmt.Errorf("%w: %s", s.notFound, key)
+	}
+	return r, nil
+}
+
+func (s *recordStore[T]) Put(record T) error {
+	return s.update(s.key(record), &record)
+}
+
+func (s *recordStore[T]) delete(key string) error {
+	return s.update(key, nil)
+}
+
+// list returns the records for which keep returns true, sorted.
+func (s *recordStore[T]) list(keep func(T) bool) []T {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var records []T
+	for _, r := range s.records {
+		if keep(r) {
+			records = append(records, r)
+		}
+	}
+	slices.SortFunc(records, s.compare)
+	return records
+}
+
+// update sets or, when record is nil, deletes the record of key and rewrites
+// the file, restoring the previous state if the write fails.
+func (s *recordStore[T]) update(key string, record *T) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	previous, existed := s.records[key]
+	if record != nil {
+		s.records[key] = *record
+	} else {
+		delete(s.records, key)
+	}
+	if s.path == "" {
+		return nil
+	}
+	records := slices.SortedFunc(maps.Values(s.records), s.compare)
+	if err := writeJSONFile(s.path, records); err != nil {
+		if existed {
+			s.records[key] = previous
+		} else {
+			delete(s.records, key)
+		}
+		return err
+	}
+	return nil
+}
+
+// readJSONFile decodes the file at path into v. It reports false, and no
+// error, when the file does not exist.
+func readJSONFile(path string, v any) (bool, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return false, fmt.Errorf("%s: %w", path, err)
+	}
+	return true, nil
+}
+
+// writeJSONFile writes v to path through a synced temporary file renamed over
+// the previous version, so that a crash never leaves a partial file.
+func writeJSONFile(path string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,60 @@
+package rgb_lib
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileReceiveStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "receives.json")
+	s, err := NewFileReceiveStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := []ReceiveRecord{
+		{OrderId: "b", State: ReceiveSettled, Notified: true, CreatedAt: 2},
+		{OrderId: "a", State: ReceivePending, CreatedAt: 3},
+		{OrderId: "c", State: ReceiveFailed, CreatedAt: 1},
+	}
+	for _, r := range records {
+		if err := s.Put(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	loaded, err := NewFileReceiveStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r, err := loaded.Get("b"); err != nil || r != records[0] {
+		t.Fatalf("Get = %+v, %v", r, err)
+	}
+	if _, err := loaded.Get("d"); !errors.Is(err, ErrReceiveNotFound) {
+		t.Fatalf("Get of a missing record = %v, want %v", err, ErrReceiveNotFound)
+	}
+	pending, _ := loaded.Pending()
+	if len(pending) != 2 || pending[0].OrderId != "c" || pending[1].OrderId != "a" {
+		t.Fatalf("Pending = %+v, want c then a", pending)
+	}
+}
+
+func TestRecordStoreRollback(t *testing.T) {
+	s, err := loadRecordStore(filepath.Join(t.TempDir(), "missing", "receives.json"), receiveKey, compareReceives, ErrReceiveNotFound)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.records["a"] = ReceiveRecord{OrderId: "a", State: ReceivePending}
+	if err := s.Put(ReceiveRecord{OrderId: "a", State: ReceiveSettled}); err == nil {
+		t.Fatal("Put succeeded without a directory to write to")
+	}
+	if err := s.Put(ReceiveRecord{OrderId: "b"}); err == nil {
+		t.Fatal("Put succeeded without a directory to write to")
+	}
+	if err := s.delete("a"); err == nil {
+		t.Fatal("delete succeeded without a directory to write to")
+	}
+	if len(s.records) != 1 || s.records["a"].State != ReceivePending {
+		t.Fatalf("records %+v, want the first record unchanged", s.records)
+	}
+}
@@ -0,0 +1,392 @@
+package rgb_lib
+
+import (
+	"cmp"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// Ledger accounts. Every LedgerRow moves an amount from CreditAccount to
+// DebitAccount, so each row is a balanced journal entry on its own.
+const (
+	LedgerAccountWallet   = "wallet"
+	LedgerAccountExternal = "external"
+	LedgerAccountIssuance = "issuance"
+	LedgerAccountBurn     = "burn"
+	LedgerAccountFees     = "fees"
+)
+
+const (
+	LedgerDirectionIn  = "in"
+	LedgerDirectionOut = "out"
+)
+
+// LedgerBtcAsset is the AssetId used for bitcoin rows.
+const LedgerBtcAsset = "BTC"
+
+// LedgerRow is a single accounting entry. Amount is formatted with the asset
+// precision while RawAmount keeps the value in the smallest unit. Fee is the
+// fee of the transaction the row belongs to and is repeated on each of its
+// rows; the fee itself is booked once, on a row with DebitAccount "fees".
+//
+// Timestamp is the confirmation time or, for unconfirmed transfers, the
+// creation time. It is zero for unconfirmed bitcoin transactions, whose time
+// is unknown: they have an empty CSV timestamp, pass the date filters and
+// sort after the rows with a time.
+type LedgerRow struct {
+	Timestamp     int64  `json:"timestamp"`
+	AssetId       string `json:"asset_id"`
+	Ticker        string `json:"ticker,omitempty"`
+	Direction     string `json:"direction"`
+	DebitAccount  string `json:"debit_account"`
+	CreditAccount string `json:"credit_account"`
+	Amount        string `json:"amount"`
+	RawAmount     uint64 `json:"raw_amount"`
+	Counterparty  string `json:"counterparty,omitempty"`
+	Txid          string `json:"txid,omitempty"`
+	Fee           uint64 `json:"fee"`
+	Status        string `json:"status"`
+	Kind          string `json:"kind"`
+	TransferIdx   *int32 `json:"transfer_idx,omitempty"`
+}
+
+var ledgerCSVHeader = []string{
+	"timestamp", "asset_id", "ticker", "direction", "debit_account", "credit_account",
+	"amount", "raw_amount", "counterparty", "txid", "fee", "status", "kind", "transfer_idx",
+}
+
+func (r LedgerRow) csvRecord() []string {
+	idx := ""
+	if r.TransferIdx != nil {
+		idx = strconv.FormatInt(int64(*r.TransferIdx), 10)
+	}
+	timestamp := ""
+	if r.Timestamp != 0 {
+		timestamp = time.Unix(r.Timestamp, 0).UTC().Format(time.RFC3339)
+	}
+	return []string{
+		timestamp, r.AssetId, r.Ticker, r.Direction,
+		r.DebitAccount, r.CreditAccount, r.Amount, strconv.FormatUint(r.RawAmount, 10),
+		r.Counterparty, r.Txid, strconv.FormatUint(r.Fee, 10), r.Status, r.Kind, idx,
+	}
+}
+
+// LedgerOptions filter the exported rows. Zero values disable a filter.
+type LedgerOptions struct {
+	// From and To bound the row timestamps to [From, To). Rows without a
+	// timestamp are kept.
+	From time.Time
+	To   time.Time
+	// AssetIds restricts the export to the given assets. Use LedgerBtcAsset to
+	// include bitcoin rows.
+	AssetIds []string
+	// ExcludeBtc drops bitcoin rows (fees and vanilla transactions).
+	ExcludeBtc bool
+	// ExcludeFailed drops rows of failed transfers.
+	ExcludeFailed bool
+}
+
+func (o LedgerOptions) includes(r LedgerRow) bool {
+	if !o.From.IsZero() && r.Timestamp != 0 && r.Timestamp < o.From.Unix() {
+		return false
+	}
+	if !o.To.IsZero() && r.Timestamp != 0 && r.Timestamp >= o.To.Unix() {
+		return false
+	}
+	if o.ExcludeBtc && r.AssetId == LedgerBtcAsset {
+		return false
+	}
+	if len(o.AssetIds) > 0 && !slices.Contains(o.AssetIds, r.AssetId) {
+		return false
+	}
+	return true
+}
+
+// LedgerExporter turns the transfers, transactions and assets of a wallet into
+// ledger rows.
+type LedgerExporter struct {
+	src      ActivitySource
+	online   *Online
+	skipSync bool
+}
+
+// NewLedgerExporter returns an exporter for the given wallet. online and
+// skipSync are passed to ListTransactions.
+func NewLedgerExporter(src ActivitySource, online *Online, skipSync bool) *LedgerExporter {
+	return &LedgerExporter{src: src, online: online, skipSync: skipSync}
+}
+
+type ledgerAsset struct {
+	ticker    string
+	precision uint8
+}
+
+func ledgerAssets(assets Assets) map[string]ledgerAsset {
+	infos := map[string]ledgerAsset{}
+	if assets.Nia != nil {
+		for _, a := range *assets.Nia {
+			infos[a.AssetId] = ledgerAsset{a.Ticker, a.Precision}
+		}
+	}
+	if assets.Uda != nil {
+		for _, a := range *assets.Uda {
+			infos[a.AssetId] = ledgerAsset{a.Ticker, a.Precision}
+		}
+	}
+	if assets.Cfa != nil {
+		for _, a := range *assets.Cfa {
+			infos[a.AssetId] = ledgerAsset{"", a.Precision}
+		}
+	}
+	if assets.Ifa != nil {
+		for _, a := range *assets.Ifa {
+			infos[a.AssetId] = ledgerAsset{a.Ticker, a.Precision}
+		}
+	}
+	return infos
+}
+
+// Rows returns the ledger rows matching the options in a deterministic order:
+// by timestamp, rows without one last, then txid, asset, transfer and
+// account.
+func (e *LedgerExporter) Rows(opts LedgerOptions) ([]LedgerRow, error) {
+	assets, err := e.src.ListAssets(nil)
+	if err != nil {
+		return nil, err
+	}
+	infos := ledgerAssets(assets)
+	transactions, err := e.src.ListTransactions(e.online, e.skipSync)
+	if err != nil {
+		return nil, err
+	}
+	txs := make(map[string]Transaction, len(transactions))
+	for _, tx := range transactions {
+		txs[tx.Txid] = tx
+	}
+
+	query := NewTransferQuery()
+	if len(opts.AssetIds) > 0 {
+		query = query.WithAssets(slices.DeleteFunc(slices.Clone(opts.AssetIds), func(id string) bool {
+			return id == LedgerBtcAsset
+		})...)
+	}
+	if opts.ExcludeFailed {
+		query = query.WithStatus(
+			TransferStatusWaitingCounterparty, TransferStatusWaitingSafeHeight,
+			TransferStatusWaitingConfirmations, TransferStatusSettled, TransferStatusInitiated,
+		)
+	}
+
+	var rows []LedgerRow
+	if len(opts.AssetIds) == 0 || len(query.assetIds) > 0 {
+		for t, err := range query.All(e.src) {
+			if err != nil {
+				return nil, err
+			}
+			if t.AssetId == nil {
+				continue
+			}
+			if row, ok := transferLedgerRow(t, infos[*t.AssetId], txs); ok && opts.includes(row) {
+				rows = append(rows, row)
+			}
+		}
+	}
+	for _, tx := range transactions {
+		for _, row := range transactionLedgerRows(tx) {
+			if opts.includes(row) {
+				rows = append(rows, row)
+			}
+		}
+	}
+	slices.SortFunc(rows, compareLedgerRows)
+	return rows, nil
+}
+
+func compareLedgerRows(a, b LedgerRow) int {
+	if (a.Timestamp == 0) != (b.Timestamp == 0) {
+		if a.Timestamp == 0 {
+			return 1
+		}
+		return -1
+	}
+	if c := cmp.Compare(a.Timestamp, b.Timestamp); c != 0 {
+		return c
+	}
+	if c := cmp.Compare(a.Txid, b.Txid); c != 0 {
+		return c
+	}
+	if c := cmp.Compare(a.AssetId, b.AssetId); c != 0 {
+		return c
+	}
+	ai, bi := int64(-1), int64(-1)
+	if a.TransferIdx != nil {
+		ai = int64(*a.TransferIdx)
+	}
+	if b.TransferIdx != nil {
+		bi = int64(*b.TransferIdx)
+	}
+	if c := cmp.Compare(ai, bi); c != 0 {
+		return c
+	}
+	return cmp.Compare(a.DebitAccount, b.DebitAccount)
+}
+
+// transferLedgerRow books the asset leg of a transfer. Transfers moving no
+// fungible or non-fungible amount (e.g. link transfers) produce no row.
+func transferLedgerRow(t AssetTransfer, info ledgerAsset, txs map[string]Transaction) (LedgerRow, bool) {
+	received := assignmentsTotal(t.Assignments)
+	requested := uint64(0)
+	if t.RequestedAssignment != nil {
+		requested = assignmentsTotal([]Assignment{*t.RequestedAssignment})
+	}
+
+	row := LedgerRow{
+		Timestamp:   t.CreatedAt,
+		AssetId:     *t.AssetId,
+		Ticker:      info.ticker,
+		Status:      t.Status.String(),
+		Kind:        t.Kind.String(),
+		TransferIdx: &t.Idx,
+	}
+	if t.RecipientId != nil {
+		row.Counterparty = *t.RecipientId
+	}
+	if t.Txid != nil {
+		row.Txid = *t.Txid
+		if tx, ok := txs[*t.Txid]; ok {
+			row.Fee = tx.Fee
+			if tx.ConfirmationTime != nil {
+				row.Timestamp = int64(tx.ConfirmationTime.Timestamp)
+			}
+		}
+	}
+
+	switch t.Kind {
+	case TransferKindSend:
+		row.Direction, row.DebitAccount, row.CreditAccount = LedgerDirectionOut, LedgerAccountExternal, LedgerAccountWallet
+		row.RawAmount = requested
+	case TransferKindBurn:
+		row.Direction, row.DebitAccount, row.CreditAccount = LedgerDirectionOut, LedgerAccountBurn, LedgerAccountWallet
+		row.RawAmount = requested
+	case TransferKindIssuance, TransferKindInflation:
+		row.Direction, row.DebitAccount, row.CreditAccount = LedgerDirectionIn, LedgerAccountWallet, LedgerAccountIssuance
+		row.RawAmount = received
+	case TransferKindReceiveBlind, TransferKindReceiveWitness:
+		row.Direction, row.DebitAccount, row.CreditAccount = LedgerDirectionIn, LedgerAccountWallet, LedgerAccountExternal
+		row.RawAmount = received
+		if received == 0 {
+			row.RawAmount = requested
+		}
+	default:
+		return LedgerRow{}, false
+	}
+	if row.RawAmount == 0 {
+		return LedgerRow{}, false
+	}
+	row.Amount = Amount{Raw: row.RawAmount, Precision: info.precision}.String()
+	return row, true
+}
+
+// transactionLedgerRows books the bitcoin legs of a transaction: the net
+// amount leaving or entering the wallet and, for transactions paid by the
+// wallet, the fee.
+func transactionLedgerRows(tx Transaction) []LedgerRow {
+	base := LedgerRow{
+		AssetId: LedgerBtcAsset,
+		Ticker:  LedgerBtcAsset,
+		Txid:    tx.Txid,
+		Fee:     tx.Fee,
+		Status:  "unconfirmed",
+		Kind:    tx.TransactionType.String(),
+	}
+	if tx.ConfirmationTime != nil {
+		base.Timestamp = int64(tx.ConfirmationTime.Timestamp)
+		base.Status = "confirmed"
+	}
+
+	var rows []LedgerRow
+	if tx.Received > tx.Sent {
+		row := base
+		row.Direction, row.DebitAccount, row.CreditAccount = LedgerDirectionIn, LedgerAccountWallet, LedgerAccountExternal
+		row.RawAmount = tx.Received - tx.Sent
+		rows = append(rows, row)
+	} else if out := tx.Sent - tx.Received; out > tx.Fee {
+		// sent includes the fee, which is booked separately
+		row := base
+		row.Direction, row.DebitAccount, row.CreditAccount = LedgerDirectionOut, LedgerAccountExternal, LedgerAccountWallet
+		row.RawAmount = out - tx.Fee
+		rows = append(rows, row)
+	}
+	if tx.Fee > 0 && tx.Sent > tx.Received {
+		row := base
+		row.Direction, row.DebitAccount, row.CreditAccount = LedgerDirectionOut, LedgerAccountFees, LedgerAccountWallet
+		row.RawAmount = tx.Fee
+		rows = append(rows, row)
+	}
+	for i := range rows {
+		rows[i].Amount = Amount{Raw: rows[i].RawAmount, Precision: 8}.String()
+	}
+	return rows
+}
+
+// assignmentsTotal sums fungible amounts, counting each non-fungible
+// assignment as one unit. Inflation and link rights are not asset quantities
+// and are ignored.
+func assignmentsTotal(assignments []Assignment) uint64 {
+	var total uint64
+	for _, a := range assignments {
+		switch a := a.(type) {
+		case AssignmentFungible:
+			total += a.Amount
+		case AssignmentNonFungible:
+			total++
+		}
+	}
+	return total
+}
+
+// WriteCSV writes the rows matching the options as CSV, with a header line.
+func (e *LedgerExporter) WriteCSV(w io.Writer, opts LedgerOptions) error {
+	rows, err := e.Rows(opts)
+	if err != nil {
+		return err
+	}
+	return WriteLedgerCSV(w, rows)
+}
+
+// WriteJSONLines writes the rows matching the options as JSON Lines.
+func (e *LedgerExporter) WriteJSONLines(w io.Writer, opts LedgerOptions) error {
+	rows, err := e.Rows(opts)
+	if err != nil {
+		return err
+	}
+	return WriteLedgerJSONLines(w, rows)
+}
+
+func WriteLedgerCSV(w io.Writer, rows []LedgerRow) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(ledgerCSVHeader); err != nil {
+		return err
+	}
+	for _, r := range rows {
+		if err := cw.Write(r.csvRecord()); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func WriteLedgerJSONLines(w io.Writer, rows []LedgerRow) error {
+	enc := json.NewEncoder(w)
+	for _, r := range rows {
+		if err := enc.Encode(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
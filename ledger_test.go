@@ -0,0 +1,102 @@
+package rgb_lib
+
+import (
+	"bytes"
+	"encoding/csv"
+	"slices"
+	"testing"
+	"time"
+)
+
+const ledgerT0 = 1700000000
+
+// newLedgerWallet returns a wallet with a confirmed asset send and its
+// bitcoin transaction, a pending asset receive and an unconfirmed incoming
+// bitcoin transaction.
+func newLedgerWallet() *fakeWallet {
+	w := newFakeWallet()
+	ticker := "TKN"
+	w.metadata["rgb:a"] = Metadata{AssetSchema: AssetSchemaNia, Ticker: &ticker, Precision: 2}
+	sent, recipient := "tx1", "recipient"
+	var requested Assignment = AssignmentFungible{Amount: 150}
+	w.transfers["rgb:a"] = []Transfer{
+		{Idx: 1, CreatedAt: ledgerT0, Status: TransferStatusSettled, Kind: TransferKindSend, Txid: &sent, RecipientId: &recipient, RequestedAssignment: &requested},
+		{Idx: 2, CreatedAt: ledgerT0 + 200, Status: TransferStatusWaitingCounterparty, Kind: TransferKindReceiveWitness, Assignments: []Assignment{AssignmentFungible{Amount: 50}}},
+	}
+	w.transactions = []Transaction{
+		{TransactionType: TransactionTypeRgbSend, Txid: "tx1", Sent: 1000, Received: 600, Fee: 100, ConfirmationTime: &BlockTime{Timestamp: ledgerT0 + 100}},
+		{TransactionType: TransactionTypeIncoming, Txid: "tx2", Received: 5000},
+	}
+	return w
+}
+
+type ledgerKey struct {
+	timestamp int64
+	assetId   string
+	debit     string
+	amount    string
+}
+
+func ledgerKeys(rows []LedgerRow) []ledgerKey {
+	keys := make([]ledgerKey, len(rows))
+	for i, r := range rows {
+		keys[i] = ledgerKey{r.Timestamp, r.AssetId, r.DebitAccount, r.Amount}
+	}
+	return keys
+}
+
+func TestLedgerRows(t *testing.T) {
+	all := []ledgerKey{
+		{ledgerT0 + 100, LedgerBtcAsset, LedgerAccountExternal, "0.00000300"},
+		{ledgerT0 + 100, LedgerBtcAsset, LedgerAccountFees, "0.00000100"},
+		{ledgerT0 + 100, "rgb:a", LedgerAccountExternal, "1.50"},
+		{ledgerT0 + 200, "rgb:a", LedgerAccountWallet, "0.50"},
+		{0, LedgerBtcAsset, LedgerAccountWallet, "0.00005000"},
+	}
+	for _, c := range []struct {
+		name string
+		opts LedgerOptions
+		want []ledgerKey
+	}{
+		{"all", LedgerOptions{}, all},
+		{"from", LedgerOptions{From: time.Unix(ledgerT0+150, 0)}, all[3:]},
+		{"to", LedgerOptions{To: time.Unix(ledgerT0+150, 0)}, append(slices.Clone(all[:3]), all[4])},
+		{"asset", LedgerOptions{AssetIds: []string{"rgb:a"}}, all[2:4]},
+		{"btc", LedgerOptions{AssetIds: []string{LedgerBtcAsset}}, []ledgerKey{all[0], all[1], all[4]}},
+		{"exclude btc", LedgerOptions{ExcludeBtc: true}, all[2:4]},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			rows, err := NewLedgerExporter(newLedgerWallet(), nil, true).Rows(c.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := ledgerKeys(rows); !slices.Equal(got, c.want) {
+				t.Fatalf("rows %v, want %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestLedgerCSV(t *testing.T) {
+	var buf bytes.Buffer
+	if err := NewLedgerExporter(newLedgerWallet(), nil, true).WriteCSV(&buf, LedgerOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 6 || !slices.Equal(records[0], ledgerCSVHeader) {
+		t.Fatalf("%d records, header %v", len(records), records[0])
+	}
+	if got := records[1][0]; got != "2023-11-14T22:15:00Z" {
+		t.Errorf("confirmed timestamp %q", got)
+	}
+	last := records[5]
+	if last[0] != "" || last[9] != "tx2" || last[11] != "unconfirmed" {
+		t.Errorf("unconfirmed row %v, want an empty timestamp", last)
+	}
+	if sent := records[3]; sent[6] != "1.50" || sent[7] != "150" || sent[13] != "1" {
+		t.Errorf("send row %v", sent)
+	}
+}
@@ -0,0 +1,177 @@
+package rgb_lib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// OperationWallet is the subset of MultisigWallet needed by an OperationLoop.
+type OperationWallet interface {
+	SyncWithHub(online Online) (*OperationInfo, error)
+	GetLocalLastProcessedOperationIdx() (int32, error)
+}
+
+// OperationHandlers holds a callback per Operation variant. Nil callbacks
+// skip their variant. OnOther receives the operations of variants without a
+// field here, if any are added to the library.
+type OperationHandlers struct {
+	OnCreateUtxosToReview     func(info OperationInfo, op OperationCreateUtxosToReview) error
+	OnCreateUtxosPending      func(info OperationInfo, op OperationCreateUtxosPending) error
+	OnCreateUtxosCompleted    func(info OperationInfo, op OperationCreateUtxosCompleted) error
+	OnCreateUtxosDiscarded    func(info OperationInfo, op OperationCreateUtxosDiscarded) error
+	OnSendBtcToReview         func(info OperationInfo, op OperationSendBtcToReview) error
+	OnSendBtcPending          func(info OperationInfo, op OperationSendBtcPending) error
+	OnSendBtcCompleted        func(info OperationInfo, op OperationSendBtcCompleted) error
+	OnSendBtcDiscarded        func(info OperationInfo, op OperationSendBtcDiscarded) error
+	OnSendToReview            func(info OperationInfo, op OperationSendToReview) error
+	OnSendPending             func(info OperationInfo, op OperationSendPending) error
+	OnSendCompleted           func(info OperationInfo, op OperationSendCompleted) error
+	OnSendDiscarded           func(info OperationInfo, op OperationSendDiscarded) error
+	OnInflationToReview       func(info OperationInfo, op OperationInflationToReview) error
+	OnInflationPending        func(info OperationInfo, op OperationInflationPending) error
+	OnInflationCompleted      func(info OperationInfo, op OperationInflationCompleted) error
+	OnInflationDiscarded      func(info OperationInfo, op OperationInflationDiscarded) error
+	OnBurnToReview            func(info OperationInfo, op OperationBurnToReview) error
+	OnBurnPending             func(info OperationInfo, op OperationBurnPending) error
+	OnBurnCompleted           func(info OperationInfo, op OperationBurnCompleted) error
+	OnBurnDiscarded           func(info OperationInfo, op OperationBurnDiscarded) error
+	OnIssuanceCompleted       func(info OperationInfo, op OperationIssuanceCompleted) error
+	OnBlindReceiveCompleted   func(info OperationInfo, op OperationBlindReceiveCompleted) error
+	OnWitnessReceiveCompleted func(info OperationInfo, op OperationWitnessReceiveCompleted) error
+	OnOther                   func(info OperationInfo) error
+}
+
+// handle calls fn, if set, with the variant op of info.
+func handle[T Operation](fn func(OperationInfo, T) error, info OperationInfo, op T) error {
+	if fn == nil {
+		return nil
+	}
+	return fn(info, op)
+}
+
+func (h *OperationHandlers) dispatch(info OperationInfo) error {
+	switch op := info.Operation.(type) {
+	case OperationCreateUtxosToReview:
+		return handle(h.OnCreateUtxosToReview, info, op)
+	case OperationCreateUtxosPending:
+		return handle(h.OnCreateUtxosPending, info, op)
+	case OperationCreateUtxosCompleted:
+		return handle(h.OnCreateUtxosCompleted, info, op)
+	case OperationCreateUtxosDiscarded:
+		return handle(h.OnCreateUtxosDiscarded, info, op)
+	case OperationSendBtcToReview:
+		return handle(h.OnSendBtcToReview, info, op)
+	case OperationSendBtcPending:
+		return handle(h.OnSendBtcPending, info, op)
+	case OperationSendBtcCompleted:
+		return handle(h.OnSendBtcCompleted, info, op)
+	case OperationSendBtcDiscarded:
+		return handle(h.OnSendBtcDiscarded, info, op)
+	case OperationSendToReview:
+		return handle(h.OnSendToReview, info, op)
+	case OperationSendPending:
+		return handle(h.OnSendPending, info, op)
+	case OperationSendCompleted:
+		return handle(h.OnSendCompleted, info, op)
+	case OperationSendDiscarded:
+		return handle(h.OnSendDiscarded, info, op)
+	case OperationInflationToReview:
+		return handle(h.OnInflationToReview, info, op)
+	case OperationInflationPending:
+		return handle(h.OnInflationPending, info, op)
+	case OperationInflationCompleted:
+		return handle(h.OnInflationCompleted, info, op)
+	case OperationInflationDiscarded:
+		return handle(h.OnInflationDiscarded, info, op)
+	case OperationBurnToReview:
+		return handle(h.OnBurnToReview, info, op)
+	case OperationBurnPending:
+		return handle(h.OnBurnPending, info, op)
+	case OperationBurnCompleted:
+		return handle(h.OnBurnCompleted, info, op)
+	case OperationBurnDiscarded:
+		return handle(h.OnBurnDiscarded, info, op)
+	case OperationIssuanceCompleted:
+		return handle(h.OnIssuanceCompleted, info, op)
+	case OperationBlindReceiveCompleted:
+		return handle(h.OnBlindReceiveCompleted, info, op)
+	case OperationWitnessReceiveCompleted:
+		return handle(h.OnWitnessReceiveCompleted, info, op)
+	}
+	if h.OnOther != nil {
+		return h.OnOther(info)
+	}
+	return nil
+}
+
+// OperationLoop pulls the operations of a multisig wallet from its hub and
+// dispatches them to typed handlers. The wallet marks an operation processed
+// when SyncWithHub returns it, so a failing handler does not stop the loop:
+// its error is returned by Sync, wrapped with the operation index, once the
+// wallet is caught up.
+type OperationLoop struct {
+	wallet   OperationWallet
+	online   Online
+	handlers OperationHandlers
+
+	mu      sync.Mutex
+	lastIdx *int32
+}
+
+func NewOperationLoop(wallet OperationWallet, online Online, handlers OperationHandlers) *OperationLoop {
+	return &OperationLoop{wallet: wallet, online: online, handlers: handlers}
+}
+
+// LastProcessedIdx returns the local last processed operation index seen by
+// the last Sync, or nil before the first one.
+func (l *OperationLoop) LastProcessedIdx() *int32 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.lastIdx
+}
+
+// Sync calls SyncWithHub until it returns no operation or ctx is done,
+// dispatching each operation. It returns the number of operations processed.
+func (l *OperationLoop) Sync(ctx context.Context) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var errs []error
+	n := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			errs = append(errs, err)
+			break
+		}
+		info, err := l.wallet.SyncWithHub(l.online)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("sync with hub: %w", err))
+			break
+		}
+		if info == nil {
+			break
+		}
+		n++
+		if err := l.handlers.dispatch(*info); err != nil {
+			errs = append(errs, fmt.Errorf("operation %d: %w", info.OperationIdx, err))
+		}
+	}
+	idx, err := l.wallet.GetLocalLastProcessedOperationIdx()
+	if err != nil {
+		errs = append(errs, err)
+	} else {
+		l.lastIdx = &idx
+	}
+	return n, errors.Join(errs...)
+}
+
+// Run calls Sync every interval until ctx is done, passing its errors to
+// onError.
+func (l *OperationLoop) Run(ctx context.Context, interval time.Duration, onError func(error)) error {
+	return runEvery(ctx, interval, onError, func(ctx context.Context) error {
+		_, err := l.Sync(ctx)
+		return err
+	})
+}
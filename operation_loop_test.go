@@ -0,0 +1,89 @@
+package rgb_lib
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// fakeHub returns its operations one per SyncWithHub, then nil.
+type fakeHub struct {
+	ops     []Operation
+	next    int
+	syncErr error
+}
+
+func (h *fakeHub) SyncWithHub(Online) (*OperationInfo, error) {
+	if h.syncErr != nil {
+		return nil, h.syncErr
+	}
+	if h.next == len(h.ops) {
+		return nil, nil
+	}
+	h.next++
+	return &OperationInfo{OperationIdx: int32(h.next), Operation: h.ops[h.next-1]}, nil
+}
+
+func (h *fakeHub) GetLocalLastProcessedOperationIdx() (int32, error) {
+	return int32(h.next), nil
+}
+
+func TestOperationLoopSync(t *testing.T) {
+	hub := &fakeHub{ops: []Operation{
+		OperationIssuanceCompleted{AssetId: "rgb:a"},
+		OperationSendCompleted{Txid: "tx1"},
+		OperationBurnDiscarded{},
+		OperationIssuanceCompleted{AssetId: "rgb:b"},
+	}}
+	var handled []string
+	loop := NewOperationLoop(hub, Online{}, OperationHandlers{
+		OnIssuanceCompleted: func(info OperationInfo, op OperationIssuanceCompleted) error {
+			handled = append(handled, op.AssetId)
+			if op.AssetId == "rgb:a" {
+				return errTest
+			}
+			return nil
+		},
+		OnSendCompleted: func(info OperationInfo, op OperationSendCompleted) error {
+			handled = append(handled, op.Txid)
+			return nil
+		},
+	})
+	if loop.LastProcessedIdx() != nil {
+		t.Fatal("LastProcessedIdx set before the first Sync")
+	}
+
+	// a failing handler does not stop the loop
+	n, err := loop.Sync(context.Background())
+	if n != 4 || !errors.Is(err, errTest) || err.Error() != "operation 1: "+errTest.Error() {
+		t.Fatalf("Sync = %d, %v, want 4 operations and the error of operation 1", n, err)
+	}
+	if len(handled) != 3 || handled[0] != "rgb:a" || handled[1] != "tx1" || handled[2] != "rgb:b" {
+		t.Fatalf("handled %v", handled)
+	}
+	if idx := loop.LastProcessedIdx(); idx == nil || *idx != 4 {
+		t.Fatalf("LastProcessedIdx = %v, want 4", idx)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	hub.ops = append(hub.ops, OperationSendCompleted{})
+	if n, err := loop.Sync(ctx); n != 0 || !errors.Is(err, context.Canceled) {
+		t.Fatalf("Sync = %d, %v after cancellation", n, err)
+	}
+}
+
+func TestOperationLoopRun(t *testing.T) {
+	loop := NewOperationLoop(&fakeHub{syncErr: errTest}, Online{}, OperationHandlers{})
+	ctx, cancel := context.WithCancel(context.Background())
+	var errs []error
+	err := loop.Run(ctx, time.Millisecond, func(err error) {
+		if errs = append(errs, err); len(errs) == 2 {
+			cancel()
+		}
+	})
+	if !errors.Is(err, context.Canceled) || len(errs) != 2 || !errors.Is(errs[0], errTest) {
+		t.Fatalf("Run = %v with errors %v, want two sync errors then cancellation", err, errs)
+	}
+}
@@ -0,0 +1,296 @@
+package rgb_lib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// AllocationSlots summarizes the room left for RGB allocations on the
+// colorable UTXOs of a wallet.
+type AllocationSlots struct {
+	// Utxos is the number of colorable UTXOs.
+	Utxos int
+	// FreeUtxos is the number of colorable UTXOs with at least one free slot.
+	FreeUtxos int
+	// FreeSlots is the number of allocations the colorable UTXOs can still
+	// receive.
+	FreeSlots int
+	// PendingBlinded is the number of slots held by pending blinded receives.
+	PendingBlinded int
+}
+
+// CountAllocationSlots counts the free allocation slots of unspents, as
+// returned by ListUnspents, given the MaxAllocationsPerUtxo of the wallet.
+// Allocations and pending blinded receives both take a slot.
+func CountAllocationSlots(unspents []Unspent, maxAllocationsPerUtxo uint32) AllocationSlots {
+	var s AllocationSlots
+	for _, u := range unspents {
+		if !u.Utxo.Colorable || !u.Utxo.Exists {
+			continue
+		}
+		s.Utxos++
+		s.PendingBlinded += int(u.PendingBlinded)
+		used := uint32(len(u.RgbAllocations)) + u.PendingBlinded
+		if used < maxAllocationsPerUtxo {
+			s.FreeUtxos++
+			s.FreeSlots += int(maxAllocationsPerUtxo - used)
+		}
+	}
+	return s
+}
+
+// PayoutWallet is the subset of Wallet needed by a PayoutQueue.
+type PayoutWallet interface {
+	Send(online Online, recipientMap map[string][]Recipient, donation bool, feeRate uint64, minConfirmations uint8, expirationTimestamp *uint64) (OperationResult, error)
+	ListUnspents(online *Online, settledOnly bool, skipSync bool) ([]Unspent, error)
+	GetWalletData() WalletData
+	GetFeeEstimation(online Online, blocks uint16) (float64, error)
+}
+
+var (
+	ErrPayoutQueueFull = errors.New("payout queue full")
+	ErrNoFreeSlots     = errors.New("no free allocation slots for change")
+)
+
+// PayoutRequest pays Recipient in AssetId. Id is chosen by the caller to
+// match results to requests.
+type PayoutRequest struct {
+	Id        string
+	AssetId   string
+	Recipient Recipient
+}
+
+// PayoutResult reports the batch a request was sent in. Requests of the same
+// batch share Txid and BatchTransferIdx. Err is set when the batch failed.
+type PayoutResult struct {
+	Request          PayoutRequest
+	Txid             string
+	BatchTransferIdx int32
+	Err              error
+}
+
+type PayoutQueueOptions struct {
+	// MaxBatchSize caps the recipients of a batch and flushes the queue when
+	// reached. Zero means 32.
+	MaxBatchSize int
+	// MaxWait flushes the queue when its oldest request has waited this
+	// long. Zero disables the time window.
+	MaxWait time.Duration
+	// FeeRate is the fee rate, in sat/vB, of the batches. It must be set.
+	FeeRate uint64
+	// FeeTarget, when set, flushes the queue as soon as the fee estimation
+	// for FeeTargetBlocks is at or below it, and the batch then pays the
+	// estimation instead of FeeRate. When the estimation fails, the size and
+	// time triggers still apply. FeeTargetBlocks zero means 6.
+	FeeTarget       uint64
+	FeeTargetBlocks uint16
+	// PollInterval is how often Run checks the time window and the fee
+	// estimation. Zero means 30 seconds.
+	PollInterval     time.Duration
+	MaxQueued        int
+	MinConfirmations uint8
+	Donation         bool
+	// Expiry sets the expiration of the batches, relative to their sending.
+	Expiry time.Duration
+	// OnResult, if set, is called for each request once its batch is sent or
+	// has failed.
+	OnResult func(PayoutResult)
+}
+
+// PayoutQueue collects payouts and sends them in batches, so that many
+// recipients, across assets, share one bitcoin transaction and its fee.
+//
+// A batch holds at most one request per recipient ID and no more assets than
+// the free allocation slots of the wallet, as each asset needs a slot for its
+// change. Requests that do not fit stay queued for the next batch. A failed
+// batch is not retried: its requests are reported with Err set and dropped,
+// as Send may have failed after broadcasting.
+type PayoutQueue struct {
+	wallet PayoutWallet
+	online Online
+	opts   PayoutQueueOptions
+	now    func() time.Time
+
+	mu      sync.Mutex
+	queue   []queuedPayout
+	wake    chan struct{}
+	sending sync.Mutex
+}
+
+type queuedPayout struct {
+	request  PayoutRequest
+	queuedAt time.Time
+}
+
+func NewPayoutQueue(wallet PayoutWallet, online Online, opts PayoutQueueOptions) (*PayoutQueue, error) {
+	if opts.FeeRate == 0 {
+		return nil, errors.New("payout queue needs a fee rate")
+	}
+	if opts.MaxBatchSize <= 0 {
+		opts.MaxBatchSize = 32
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = 30 * time.Second
+	}
+	if opts.FeeTargetBlocks == 0 {
+		opts.FeeTargetBlocks = 6
+	}
+	return &PayoutQueue{wallet: wallet, online: online, opts: opts, now: time.Now, wake: make(chan struct{}, 1)}, nil
+}
+
+// Enqueue adds a request to the queue.
+func (q *PayoutQueue) Enqueue(req PayoutRequest) error {
+	if req.AssetId == "" || req.Recipient.RecipientId == "" {
+		return errors.New("payout request needs an asset ID and a recipient ID")
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.opts.MaxQueued > 0 && len(q.queue) >= q.opts.MaxQueued {
+		return ErrPayoutQueueFull
+	}
+	q.queue = append(q.queue, queuedPayout{request: req, queuedAt: q.now()})
+	if len(q.queue) >= q.opts.MaxBatchSize {
+		select {
+		case q.wake <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// Len returns the number of queued requests.
+func (q *PayoutQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.queue)
+}
+
+// due reports whether the queue should be flushed and the fee rate to use. A
+// fee estimation error is returned along with the decision of the other
+// triggers.
+func (q *PayoutQueue) due() (bool, uint64, error) {
+	q.mu.Lock()
+	n := len(q.queue)
+	var oldest time.Time
+	if n > 0 {
+		oldest = q.queue[0].queuedAt
+	}
+	q.mu.Unlock()
+	if n == 0 {
+		return false, 0, nil
+	}
+	var err error
+	if q.opts.FeeTarget > 0 {
+		var estimate float64
+		estimate, err = q.wallet.GetFeeEstimation(q.online, q.opts.FeeTargetBlocks)
+		if err != nil {
+			err = fmt.Errorf("fee estimation: %w", err)
+		} else if rate := uint64(math.Ceil(estimate)); rate <= q.opts.FeeTarget {
+			return true, max(rate, 1), nil
+		}
+	}
+	if n >= q.opts.MaxBatchSize || (q.opts.MaxWait > 0 && q.now().Sub(oldest) >= q.opts.MaxWait) {
+		return true, q.opts.FeeRate, err
+	}
+	return false, 0, err
+}
+
+// Flush sends one batch from the head of the queue at feeRate, regardless of
+// the flush triggers. It returns the results of the batch.
+func (q *PayoutQueue) Flush(feeRate uint64) ([]PayoutResult, error) {
+	q.sending.Lock()
+	defer q.sending.Unlock()
+
+	unspents, err := q.wallet.ListUnspents(&q.online, false, false)
+	if err != nil {
+		return nil, err
+	}
+	slots := CountAllocationSlots(unspents, q.wallet.GetWalletData().MaxAllocationsPerUtxo)
+
+	q.mu.Lock()
+	batch, recipientMap := q.takeBatch(slots.FreeSlots)
+	q.mu.Unlock()
+	if len(batch) == 0 {
+		if slots.FreeSlots == 0 && q.Len() > 0 {
+			return nil, ErrNoFreeSlots
+		}
+		return nil, nil
+	}
+
+	var expiration *uint64
+	if q.opts.Expiry > 0 {
+		ts := uint64(q.now().Add(q.opts.Expiry).Unix())
+		expiration = &ts
+	}
+	res, sendErr := q.wallet.Send(q.online, recipientMap, q.opts.Donation, feeRate, q.opts.MinConfirmations, expiration)
+	results := make([]PayoutResult, len(batch))
+	for i, req := range batch {
+		results[i] = PayoutResult{Request: req, Txid: res.Txid, BatchTransferIdx: res.BatchTransferIdx, Err: sendErr}
+		if q.opts.OnResult != nil {
+			q.opts.OnResult(results[i])
+		}
+	}
+	return results, sendErr
+}
+
+// takeBatch removes from the queue the requests of the next batch, keeping
+// the order of the others. It must be called with q.mu held.
+func (q *PayoutQueue) takeBatch(freeSlots int) ([]PayoutRequest, map[string][]Recipient) {
+	var batch []PayoutRequest
+	recipientMap := map[string][]Recipient{}
+	recipients := map[string]bool{}
+	rest := q.queue[:0]
+	for _, p := range q.queue {
+		req := p.request
+		_, knownAsset := recipientMap[req.AssetId]
+		switch {
+		case len(batch) >= q.opts.MaxBatchSize,
+			recipients[req.Recipient.RecipientId],
+			!knownAsset && len(recipientMap) >= freeSlots:
+			rest = append(rest, p)
+			continue
+		}
+		batch = append(batch, req)
+		recipients[req.Recipient.RecipientId] = true
+		recipientMap[req.AssetId] = append(recipientMap[req.AssetId], req.Recipient)
+	}
+	clear(q.queue[len(rest):])
+	q.queue = rest
+	return batch, recipientMap
+}
+
+// Run flushes the queue whenever a trigger fires, until ctx is done. Errors
+// are passed to onError, if set, and do not stop the loop.
+func (q *PayoutQueue) Run(ctx context.Context, onError func(error)) error {
+	ticker := time.NewTicker(q.opts.PollInterval)
+	defer ticker.Stop()
+	report := func(err error) {
+		if err != nil && onError != nil {
+			onError(err)
+		}
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-q.wake:
+		case <-ticker.C:
+		}
+		for ctx.Err() == nil {
+			due, feeRate, err := q.due()
+			report(err)
+			if !due {
+				break
+			}
+			results, err := q.Flush(feeRate)
+			report(err)
+			if len(results) == 0 {
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package rgb_lib
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+)
+
+// payoutWallet records the fee rate of each send and serves a fixed fee
+// estimation.
+type payoutWallet struct {
+	*fakeWallet
+	feeRates    []uint64
+	estimate    float64
+	estimateErr error
+}
+
+func (w *payoutWallet) Send(online Online, recipientMap map[string][]Recipient, donation bool, feeRate uint64, minConfirmations uint8, expirationTimestamp *uint64) (OperationResult, error) {
+	w.feeRates = append(w.feeRates, feeRate)
+	return w.fakeWallet.Send(online, recipientMap, donation, feeRate, minConfirmations, expirationTimestamp)
+}
+
+func (w *payoutWallet) GetFeeEstimation(online Online, blocks uint16) (float64, error) {
+	return w.estimate, w.estimateErr
+}
+
+func payout(id, assetId, recipientId string) PayoutRequest {
+	return PayoutRequest{Id: id, AssetId: assetId, Recipient: Recipient{RecipientId: recipientId, Assignment: AssignmentFungible{Amount: 1}}}
+}
+
+func payoutIds(results []PayoutResult) []string {
+	var ids []string
+	for _, r := range results {
+		ids = append(ids, r.Request.Id)
+	}
+	return ids
+}
+
+func TestPayoutQueueFlush(t *testing.T) {
+	wallet := &payoutWallet{fakeWallet: newFakeWallet()}
+	// two free slots on the only UTXO, so at most two assets per batch
+	wallet.unspents[0].RgbAllocations = make([]RgbAllocation, 3)
+	q, err := NewPayoutQueue(wallet, Online{}, PayoutQueueOptions{FeeRate: 2, MaxBatchSize: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, req := range []PayoutRequest{
+		payout("1", "rgb:a", "r1"),
+		payout("2", "rgb:b", "r2"),
+		payout("3", "rgb:c", "r3"),
+		payout("4", "rgb:a", "r1"),
+		payout("5", "rgb:a", "r4"),
+		payout("6", "rgb:b", "r5"),
+	} {
+		if err := q.Enqueue(req); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i, want := range [][]string{{"1", "2", "5"}, {"3", "4"}, {"6"}} {
+		results, err := q.Flush(2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := payoutIds(results); !slices.Equal(got, want) {
+			t.Fatalf("batch %d: %v, want %v", i, got, want)
+		}
+		for _, r := range results {
+			if r.Txid != fmt.Sprintf("tx%d", i+1) || r.BatchTransferIdx != int32(i+1) || r.Err != nil {
+				t.Fatalf("result %+v, want batch transfer %d", r, i+1)
+			}
+		}
+	}
+	if got := wallet.sends[0]; len(got) != 2 || len(got["rgb:a"]) != 2 || len(got["rgb:b"]) != 1 {
+		t.Fatalf("first batch recipients %v, want two for rgb:a and one for rgb:b", got)
+	}
+	if q.Len() != 0 {
+		t.Fatalf("%d requests left", q.Len())
+	}
+
+	// a full wallet keeps the requests queued
+	wallet.unspents[0].RgbAllocations = make([]RgbAllocation, 5)
+	if err := q.Enqueue(payout("7", "rgb:a", "r1")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.Flush(2); !errors.Is(err, ErrNoFreeSlots) || q.Len() != 1 {
+		t.Fatalf("Flush = %v with %d requests left, want %v", err, q.Len(), ErrNoFreeSlots)
+	}
+
+	// a failed batch is reported and dropped
+	wallet.unspents[0].RgbAllocations = nil
+	wallet.sendEnd = func(string) (OperationResult, error) { return OperationResult{}, errTest }
+	var reported []PayoutResult
+	q.opts.OnResult = func(r PayoutResult) { reported = append(reported, r) }
+	if _, err := q.Flush(2); !errors.Is(err, errTest) || q.Len() != 0 {
+		t.Fatalf("Flush = %v with %d requests left, want %v", err, q.Len(), errTest)
+	}
+	if len(reported) != 1 || !errors.Is(reported[0].Err, errTest) {
+		t.Fatalf("reported %+v, want the failed request", reported)
+	}
+}
+
+func TestPayoutQueueDue(t *testing.T) {
+	wallet := &payoutWallet{fakeWallet: newFakeWallet(), estimate: 4.2}
+	if _, err := NewPayoutQueue(wallet, Online{}, PayoutQueueOptions{}); err == nil {
+		t.Fatal("NewPayoutQueue accepted a zero fee rate")
+	}
+	q, err := NewPayoutQueue(wallet, Online{}, PayoutQueueOptions{FeeRate: 10, FeeTarget: 5, MaxWait: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1700000000, 0)
+	q.now = func() time.Time { return now }
+
+	if due, _, err := q.due(); due || err != nil {
+		t.Fatalf("due = %t, %v on an empty queue", due, err)
+	}
+	if err := q.Enqueue(payout("1", "rgb:a", "r1")); err != nil {
+		t.Fatal(err)
+	}
+	// the estimation is rounded up and meets the target
+	if due, rate, err := q.due(); !due || rate != 5 || err != nil {
+		t.Fatalf("due = %t, %d, %v, want the estimated fee rate 5", due, rate, err)
+	}
+	wallet.estimate = 5.5
+	if due, _, err := q.due(); due || err != nil {
+		t.Fatalf("due = %t, %v above the fee target", due, err)
+	}
+	// the time window still applies, at the configured fee rate
+	now = now.Add(time.Hour)
+	if due, rate, err := q.due(); !due || rate != 10 || err != nil {
+		t.Fatalf("due = %t, %d, %v, want the configured fee rate 10", due, rate, err)
+	}
+	wallet.estimateErr = errTest
+	if due, rate, err := q.due(); !due || rate != 10 || !errors.Is(err, errTest) {
+		t.Fatalf("due = %t, %d, %v, want a flush despite the estimation error", due, rate, err)
+	}
+
+	results, err := q.Flush(5)
+	if err != nil || len(results) != 1 || !slices.Equal(wallet.feeRates, []uint64{5}) {
+		t.Fatalf("Flush = %+v, %v at fee rates %v", results, err, wallet.feeRates)
+	}
+}
@@ -0,0 +1,24 @@
+package rgb_lib
+
+import (
+	"context"
+	"time"
+)
+
+// runEvery calls fn now and then every interval until ctx is done, and
+// returns ctx.Err(). Errors of fn are passed to onError, if set, and do not
+// stop the loop; those returned once ctx is done are dropped.
+func runEvery(ctx context.Context, interval time.Duration, onError func(error), fn func(context.Context) error) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := fn(ctx); err != nil && ctx.Err() == nil && onError != nil {
+			onError(err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
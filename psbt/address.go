@@ -0,0 +1,141 @@
+package psbt
+
+import (
+	"crypto/sha256"
+	"math/big"
+	"strings"
+)
+
+// Network holds the address encoding parameters of a bitcoin network.
+type Network struct {
+	Bech32Hrp     string
+	PubKeyHashVer byte
+	ScriptHashVer byte
+}
+
+var (
+	Mainnet = Network{Bech32Hrp: "bc", PubKeyHashVer: 0x00, ScriptHashVer: 0x05}
+	Testnet = Network{Bech32Hrp: "tb", PubKeyHashVer: 0x6f, ScriptHashVer: 0xc4}
+	Signet  = Testnet
+	Regtest = Network{Bech32Hrp: "bcrt", PubKeyHashVer: 0x6f, ScriptHashVer: 0xc4}
+)
+
+// Address returns the address of a standard output script, or "" when the
+// script has no address form (e.g. OP_RETURN or bare multisig).
+func (n Network) Address(script []byte) string {
+	switch {
+	case len(script) == 25 && script[0] == 0x76 && script[1] == 0xa9 && script[2] == 0x14 &&
+		script[23] == 0x88 && script[24] == 0xac:
+		return base58Check(n.PubKeyHashVer, script[3:23])
+	case len(script) == 23 && script[0] == 0xa9 && script[1] == 0x14 && script[22] == 0x87:
+		return base58Check(n.ScriptHashVer, script[2:22])
+	}
+	if version, program, ok := witnessProgram(script); ok {
+		return segwitAddress(n.Bech32Hrp, version, program)
+	}
+	return ""
+}
+
+// witnessProgram splits a segwit output script into version and program.
+func witnessProgram(script []byte) (byte, []byte, bool) {
+	if len(script) < 4 || len(script) > 42 || int(script[1]) != len(script)-2 || script[1] < 2 {
+		return 0, nil, false
+	}
+	switch {
+	case script[0] == 0x00:
+		return 0, script[2:], true
+	case script[0] >= 0x51 && script[0] <= 0x60:
+		return script[0] - 0x50, script[2:], true
+	}
+	return 0, nil, false
+}
+
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+func base58Check(version byte, payload []byte) string {
+	data := append([]byte{version}, payload...)
+	first := sha256.Sum256(data)
+	second := sha256.Sum256(first[:])
+	data = append(data, second[:4]...)
+
+	n := new(big.Int).SetBytes(data)
+	radix := big.NewInt(58)
+	mod := new(big.Int)
+	var out []byte
+	for n.Sign() > 0 {
+		n.DivMod(n, radix, mod)
+		out = append(out, base58Alphabet[mod.Int64()])
+	}
+	for _, b := range data {
+		if b != 0 {
+			break
+		}
+		out = append(out, '1')
+	}
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return string(out)
+}
+
+const bech32Charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+func bech32Polymod(values []byte) uint32 {
+	gen := [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+	chk := uint32(1)
+	for _, v := range values {
+		top := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+		for i := 0; i < 5; i++ {
+			if (top>>i)&1 == 1 {
+				chk ^= gen[i]
+			}
+		}
+	}
+	return chk
+}
+
+// segwitAddress encodes a witness program with bech32 (version 0) or bech32m
+// (version 1 and above), as per BIP-173 and BIP-350.
+func segwitAddress(hrp string, version byte, program []byte) string {
+	data := []byte{version}
+	var acc, bits uint32
+	for _, b := range program {
+		acc = acc<<8 | uint32(b)
+		bits += 8
+		for bits >= 5 {
+			bits -= 5
+			data = append(data, byte(acc>>bits)&0x1f)
+		}
+	}
+	if bits > 0 {
+		data = append(data, byte(acc<<(5-bits))&0x1f)
+	}
+
+	var values []byte
+	for _, c := range hrp {
+		values = append(values, byte(c)>>5)
+	}
+	values = append(values, 0)
+	for _, c := range hrp {
+		values = append(values, byte(c)&0x1f)
+	}
+	values = append(values, data...)
+	values = append(values, 0, 0, 0, 0, 0, 0)
+	constant := uint32(1)
+	if version > 0 {
+		constant = 0x2bc830a3
+	}
+	mod := bech32Polymod(values) ^ constant
+
+	var b strings.Builder
+	b.WriteString(hrp)
+	b.WriteByte('1')
+	for _, d := range data {
+		b.WriteByte(bech32Charset[d])
+	}
+	for i := 0; i < 6; i++ {
+		b.WriteByte(bech32Charset[(mod>>(5*(5-i)))&0x1f])
+	}
+	return b.String()
+}
@@ -0,0 +1,434 @@
+package psbt
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/bits"
+)
+
+// Proprietary key prefixes used by RGB wallets to mark and carry deterministic
+// bitcoin commitments on outputs.
+var (
+	PrefixTapret = []byte("TAPRET")
+	PrefixOpret  = []byte("OPRET")
+	PrefixMpc    = []byte("MPC")
+)
+
+// Proprietary subtypes under PrefixTapret and PrefixOpret.
+const (
+	SubtypeCommitmentHost = 0x00
+	SubtypeCommitment     = 0x01
+)
+
+var (
+	ErrMissingUtxo = errors.New("missing previous output")
+	ErrOverflow    = errors.New("amount overflow")
+)
+
+type proprietaries []Proprietary
+
+func (m proprietaries) find(prefix []byte, subtype uint64) (Proprietary, bool) {
+	for _, p := range m {
+		if bytes.Equal(p.Prefix, prefix) && p.Subtype == subtype {
+			return p, true
+		}
+	}
+	return Proprietary{}, false
+}
+
+// IsTapretHost reports whether the output is marked to host a tapret
+// commitment.
+func (o Output) IsTapretHost() bool {
+	_, ok := proprietaries(o.Proprietary).find(PrefixTapret, SubtypeCommitmentHost)
+	return ok
+}
+
+// TapretCommitment returns the tapret commitment of the output, if any.
+func (o Output) TapretCommitment() []byte {
+	p, _ := proprietaries(o.Proprietary).find(PrefixTapret, SubtypeCommitment)
+	return p.Value
+}
+
+// IsOpretHost reports whether the output is marked to host an opret
+// commitment.
+func (o Output) IsOpretHost() bool {
+	_, ok := proprietaries(o.Proprietary).find(PrefixOpret, SubtypeCommitmentHost)
+	return ok
+}
+
+// OpretCommitment returns the opret commitment of the output, if any.
+func (o Output) OpretCommitment() []byte {
+	p, _ := proprietaries(o.Proprietary).find(PrefixOpret, SubtypeCommitment)
+	return p.Value
+}
+
+// IsFinalized reports whether the input has its final scriptSig or witness.
+func (in Input) IsFinalized() bool {
+	return in.FinalScriptSig != nil || in.FinalScriptWitness != nil
+}
+
+// PrevOut returns the output spent by input i, taken from the witness UTXO
+// or from the non-witness UTXO.
+func (p *Packet) PrevOut(i int) (TxOut, error) {
+	in := p.Inputs[i]
+	if in.WitnessUtxo != nil {
+		return *in.WitnessUtxo, nil
+	}
+	if in.NonWitnessUtxo != nil {
+		vout := p.UnsignedTx.Inputs[i].PrevVout
+		if in.NonWitnessUtxo.Txid() != hashToString(p.UnsignedTx.Inputs[i].PrevTxid) ||
+			int(vout) >= len(in.NonWitnessUtxo.Outputs) {
+			return TxOut{}, fmt.Errorf("input %d: non-witness utxo does not match the spent outpoint", i)
+		}
+		return in.NonWitnessUtxo.Outputs[vout], nil
+	}
+	return TxOut{}, fmt.Errorf("%w for input %d", ErrMissingUtxo, i)
+}
+
+// TotalInput returns the sum of the spent amounts. It fails with ErrOverflow
+// when the sum does not fit in a uint64.
+func (p *Packet) TotalInput() (uint64, error) {
+	var total, carry uint64
+	for i := range p.Inputs {
+		out, err := p.PrevOut(i)
+		if err != nil {
+			return 0, err
+		}
+		if total, carry = bits.Add64(total, out.Value, 0); carry != 0 {
+			return 0, fmt.Errorf("%w: inputs", ErrOverflow)
+		}
+	}
+	return total, nil
+}
+
+// TotalOutput returns the sum of the output amounts. It fails with
+// ErrOverflow when the sum does not fit in a uint64.
+func (p *Packet) TotalOutput() (uint64, error) {
+	var total, carry uint64
+	for _, out := range p.UnsignedTx.Outputs {
+		if total, carry = bits.Add64(total, out.Value, 0); carry != 0 {
+			return 0, fmt.Errorf("%w: outputs", ErrOverflow)
+		}
+	}
+	return total, nil
+}
+
+// Fee returns the fee paid by the transaction.
+func (p *Packet) Fee() (uint64, error) {
+	in, err := p.TotalInput()
+	if err != nil {
+		return 0, err
+	}
+	out, err := p.TotalOutput()
+	if err != nil {
+		return 0, err
+	}
+	if out > in {
+		return 0, fmt.Errorf("outputs (%d) exceed inputs (%d)", out, in)
+	}
+	return in - out, nil
+}
+
+// isECDSASignature reports whether a witness or scriptSig item is a strictly
+// DER-encoded ECDSA signature (BIP-66) followed by a sighash byte.
+func isECDSASignature(sig []byte) bool {
+	if len(sig) < 9 || len(sig) > 73 || sig[0] != 0x30 || int(sig[1]) != len(sig)-3 {
+		return false
+	}
+	rLen := int(sig[3])
+	if sig[2] != 0x02 || rLen == 0 || 5+rLen >= len(sig) {
+		return false
+	}
+	sLen := int(sig[5+rLen])
+	if sig[4+rLen] != 0x02 || sLen == 0 || rLen+sLen+7 != len(sig) {
+		return false
+	}
+	// both integers are positive and minimally encoded
+	for _, n := range [][]byte{sig[4 : 4+rLen], sig[6+rLen : 6+rLen+sLen]} {
+		if n[0]&0x80 != 0 || len(n) > 1 && n[0] == 0x00 && n[1]&0x80 == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// isSchnorrSignature reports whether a taproot witness item is a BIP-340
+// signature, with an optional non-default sighash byte.
+func isSchnorrSignature(sig []byte) bool {
+	return len(sig) == 64 || len(sig) == 65 && sig[64] != 0x00
+}
+
+// pushes returns the data pushes of a script, stopping at the first opcode
+// that is not a push.
+func pushes(script []byte) [][]byte {
+	var items [][]byte
+	for len(script) > 0 {
+		op, data, rest, ok := nextOp(script)
+		if !ok || op > 0x4e {
+			return items
+		}
+		items = append(items, data)
+		script = rest
+	}
+	return items
+}
+
+// spendsTaproot reports whether input i spends a taproot output. It is false
+// when the spent output is unknown.
+func (p *Packet) spendsTaproot(i int) bool {
+	prev, err := p.PrevOut(i)
+	if err != nil {
+		return false
+	}
+	version, program, ok := witnessProgram(prev.ScriptPubKey)
+	return ok && version == 1 && len(program) == 32
+}
+
+// taprootStack returns the items of a taproot witness that may hold
+// signatures: the annex is dropped and, for script path spends, so are the
+// script and the control block.
+func taprootStack(witness [][]byte) [][]byte {
+	if n := len(witness); n >= 2 && len(witness[n-1]) > 0 && witness[n-1][0] == 0x50 {
+		witness = witness[:n-1]
+	}
+	if n := len(witness); n >= 2 {
+		return witness[:n-2]
+	}
+	return witness
+}
+
+// inputSignatures returns the number of signatures of input i: its partial
+// and taproot signatures or, once finalized, the ECDSA signatures of its
+// scriptSig and witness, or the Schnorr signatures of its taproot witness.
+func (p *Packet) inputSignatures(i int) int {
+	in := p.Inputs[i]
+	if !in.IsFinalized() {
+		count := len(in.PartialSigs) + len(in.TapScriptSigs)
+		if in.TapKeySig != nil {
+			count++
+		}
+		return count
+	}
+	var count int
+	if p.spendsTaproot(i) {
+		for _, item := range taprootStack(in.FinalScriptWitness) {
+			if isSchnorrSignature(item) {
+				count++
+			}
+		}
+		return count
+	}
+	for _, item := range append(pushes(in.FinalScriptSig), in.FinalScriptWitness...) {
+		if isECDSASignature(item) {
+			count++
+		}
+	}
+	return count
+}
+
+// SignatureCount returns the number of signatures in the PSBT: partial and
+// taproot signatures, plus the ones found in finalized inputs.
+func (p *Packet) SignatureCount() int {
+	var count int
+	for i := range p.Inputs {
+		count += p.inputSignatures(i)
+	}
+	return count
+}
+
+// estimateInput returns the scriptSig length and the witness size of input i
+// once signed. Finalized inputs are measured, the others are estimated from
+// the type of the spent script, assuming signatures of maximal length.
+func (p *Packet) estimateInput(i int, prev []byte) (scriptSig int, witness int) {
+	in := p.Inputs[i]
+	if in.IsFinalized() {
+		if in.FinalScriptWitness != nil {
+			witness = compactSizeLen(uint64(len(in.FinalScriptWitness)))
+			for _, item := range in.FinalScriptWitness {
+				witness += compactSizeLen(uint64(len(item))) + len(item)
+			}
+		}
+		return len(in.FinalScriptSig), witness
+	}
+
+	const ecdsaSig, schnorrSig, pubKey = 73, 65, 33
+	varItem := func(n int) int { return compactSizeLen(uint64(n)) + n }
+	multisig := func(script []byte) int {
+		// OP_m <keys> OP_n OP_CHECKMULTISIG
+		if len(script) > 0 && script[0] >= 0x51 && script[0] <= 0x60 {
+			return int(script[0]-0x50) * varItem(ecdsaSig)
+		}
+		return varItem(ecdsaSig)
+	}
+
+	script := prev
+	if len(prev) == 23 && prev[0] == 0xa9 && in.RedeemScript != nil {
+		scriptSig = varItem(len(in.RedeemScript))
+		script = in.RedeemScript
+	}
+	version, program, segwit := witnessProgram(script)
+	switch {
+	case !segwit && len(script) == 25 && script[0] == 0x76:
+		scriptSig += varItem(ecdsaSig) + varItem(pubKey)
+	case !segwit && in.RedeemScript != nil:
+		scriptSig = 1 + multisig(in.RedeemScript) + varItem(len(in.RedeemScript))
+	case !segwit:
+		scriptSig += varItem(ecdsaSig)
+	case version == 0 && len(program) == 20:
+		witness = 1 + varItem(ecdsaSig) + varItem(pubKey)
+	case version == 0 && len(program) == 32:
+		ws := in.WitnessScript
+		witness = 1 + 1 + multisig(ws) + varItem(len(ws))
+	case version == 1 && len(in.TapLeafScripts) > 0 && !in.hasKeyPathOrigin():
+		leaf := in.TapLeafScripts[0]
+		keys := max(countXOnlyKeys(leaf.Script), 1)
+		witness = 1 + keys*varItem(schnorrSig) + varItem(len(leaf.Script)) + varItem(len(leaf.ControlBlock))
+	case version == 1:
+		witness = 1 + varItem(schnorrSig)
+	default:
+		witness = 1 + varItem(ecdsaSig)
+	}
+	return scriptSig, witness
+}
+
+// hasKeyPathOrigin reports whether a derivation is known for the taproot
+// internal key, meaning the input can be spent through the key path.
+func (in Input) hasKeyPathOrigin() bool {
+	for _, d := range in.TapBip32Derivation {
+		if bytes.Equal(d.XOnlyPubKey, in.TapInternalKey) && len(d.LeafHashes) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// countXOnlyKeys counts the 32-byte pushes of a tapscript, i.e. the keys it
+// may check a signature against.
+func countXOnlyKeys(script []byte) int {
+	var keys int
+	for len(script) > 0 {
+		op, data, rest, ok := nextOp(script)
+		if !ok {
+			break
+		}
+		if op <= 0x4e && len(data) == 32 {
+			keys++
+		}
+		script = rest
+	}
+	return keys
+}
+
+// VSize returns the virtual size of the transaction once fully signed. It is
+// exact when every input is finalized and an upper estimate otherwise.
+func (p *Packet) VSize() (uint64, error) {
+	tx := p.UnsignedTx
+	base := 4 + compactSizeLen(uint64(len(tx.Inputs))) + compactSizeLen(uint64(len(tx.Outputs))) + 4
+	for _, out := range tx.Outputs {
+		base += 8 + compactSizeLen(uint64(len(out.ScriptPubKey))) + len(out.ScriptPubKey)
+	}
+	var witness int
+	segwit := false
+	for i := range tx.Inputs {
+		var prev []byte
+		if !p.Inputs[i].IsFinalized() {
+			out, err := p.PrevOut(i)
+			if err != nil {
+				return 0, err
+			}
+			prev = out.ScriptPubKey
+		}
+		scriptSig, w := p.estimateInput(i, prev)
+		base += 32 + 4 + compactSizeLen(uint64(scriptSig)) + scriptSig + 4
+		if w > 0 {
+			segwit = true
+			witness += w
+		} else {
+			witness++
+		}
+	}
+	weight := base * 4
+	if segwit {
+		weight += 2 + witness
+	}
+	return uint64((weight + 3) / 4), nil
+}
+
+type InputInfo struct {
+	Outpoint  string
+	AmountSat uint64
+	Finalized bool
+	// Signatures is the number of signatures the input carries.
+	Signatures int
+}
+
+type OutputInfo struct {
+	// Address is empty for scripts with no address form.
+	Address         string
+	ScriptPubkeyHex string
+	AmountSat       uint64
+	IsOpReturn      bool
+	OpReturnData    []byte
+	IsTapretHost    bool
+	IsOpretHost     bool
+}
+
+// Inspection mirrors the PsbtInspection of the native library, without the
+// ownership information that needs a wallet.
+type Inspection struct {
+	Txid           string
+	Inputs         []InputInfo
+	Outputs        []OutputInfo
+	TotalInputSat  uint64
+	TotalOutputSat uint64
+	FeeSat         uint64
+	SignatureCount int
+	SizeVbytes     uint64
+}
+
+// Inspect summarizes the PSBT. Addresses are encoded for network.
+func (p *Packet) Inspect(network Network) (*Inspection, error) {
+	fee, err := p.Fee()
+	if err != nil {
+		return nil, err
+	}
+	vsize, err := p.VSize()
+	if err != nil {
+		return nil, err
+	}
+	totalOutput, err := p.TotalOutput()
+	if err != nil {
+		return nil, err
+	}
+	r := &Inspection{
+		Txid:           p.UnsignedTx.Txid(),
+		TotalOutputSat: totalOutput,
+		FeeSat:         fee,
+		SignatureCount: p.SignatureCount(),
+		SizeVbytes:     vsize,
+	}
+	r.TotalInputSat = r.TotalOutputSat + fee
+	for i, txin := range p.UnsignedTx.Inputs {
+		prev, _ := p.PrevOut(i)
+		r.Inputs = append(r.Inputs, InputInfo{
+			Outpoint:   txin.PrevOutpoint(),
+			AmountSat:  prev.Value,
+			Finalized:  p.Inputs[i].IsFinalized(),
+			Signatures: p.inputSignatures(i),
+		})
+	}
+	for i, txout := range p.UnsignedTx.Outputs {
+		r.Outputs = append(r.Outputs, OutputInfo{
+			Address:         network.Address(txout.ScriptPubKey),
+			ScriptPubkeyHex: hex.EncodeToString(txout.ScriptPubKey),
+			AmountSat:       txout.Value,
+			IsOpReturn:      txout.IsOpReturn(),
+			OpReturnData:    txout.OpReturnData(),
+			IsTapretHost:    p.Outputs[i].IsTapretHost(),
+			IsOpretHost:     p.Outputs[i].IsOpretHost(),
+		})
+	}
+	return r, nil
+}
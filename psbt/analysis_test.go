@@ -0,0 +1,221 @@
+package psbt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+// derSig returns a DER-encoded ECDSA signature with SIGHASH_ALL, of the
+// maximal length.
+func derSig() []byte {
+	sig := []byte{0x30, 0x44, 0x02, 0x20}
+	sig = append(sig, bytes.Repeat([]byte{0x11}, 32)...)
+	sig = append(sig, 0x02, 0x20)
+	sig = append(sig, bytes.Repeat([]byte{0x22}, 32)...)
+	return append(sig, 0x01)
+}
+
+func p2tr(key byte) []byte {
+	return append([]byte{0x51, 0x20}, bytes.Repeat([]byte{key}, 32)...)
+}
+
+func p2wpkh() []byte {
+	return append([]byte{0x00, 0x14}, bytes.Repeat([]byte{0x33}, 20)...)
+}
+
+func p2pkh() []byte {
+	script := append([]byte{0x76, 0xa9, 0x14}, bytes.Repeat([]byte{0x44}, 20)...)
+	return append(script, 0x88, 0xac)
+}
+
+// push returns the minimal push of data.
+func push(data []byte) []byte {
+	if len(data) <= 0x4b {
+		return append([]byte{byte(len(data))}, data...)
+	}
+	return append([]byte{0x4c, byte(len(data))}, data...)
+}
+
+// tapscript2of2 is <key> OP_CHECKSIG <key> OP_CHECKSIGADD OP_2 OP_NUMEQUAL.
+var tapscript2of2 = bytes.Join([][]byte{
+	push(bytes.Repeat([]byte{0x55}, 32)), {0xac},
+	push(bytes.Repeat([]byte{0x66}, 32)), {0xba, 0x52, 0x9c},
+}, nil)
+
+// controlBlock is the 65-byte control block of a leaf at depth one.
+var controlBlock = append([]byte{0xc0}, bytes.Repeat([]byte{0x77}, 64)...)
+
+func TestSignatureCount(t *testing.T) {
+	sig64 := bytes.Repeat([]byte{0x88}, 64)
+	sig65 := append(bytes.Clone(sig64), 0x01)
+	uncompressed := append([]byte{0x04}, bytes.Repeat([]byte{0x99}, 64)...)
+	compressed := append([]byte{0x02}, bytes.Repeat([]byte{0x99}, 32)...)
+	redeemScript := bytes.Repeat([]byte{0xaa}, 105)
+	annex := []byte{0x50, 0x01}
+	for _, c := range []struct {
+		name string
+		prev []byte
+		in   Input
+		want int
+	}{
+		{"p2pkh with uncompressed key", p2pkh(), Input{
+			FinalScriptSig: append(push(derSig()), push(uncompressed)...),
+		}, 1},
+		{"p2sh multisig", nil, Input{
+			FinalScriptSig: bytes.Join([][]byte{{0x00}, push(derSig()), push(derSig()), push(redeemScript)}, nil),
+		}, 2},
+		{"p2wpkh", p2wpkh(), Input{FinalScriptWitness: [][]byte{derSig(), compressed}}, 1},
+		{"p2wsh with a 64-byte item", nil, Input{
+			FinalScriptWitness: [][]byte{nil, derSig(), sig64, {0x51}},
+		}, 1},
+		{"high r", p2wpkh(), Input{
+			FinalScriptWitness: [][]byte{append([]byte{0x30, 0x06, 0x02, 0x01, 0x80, 0x02, 0x01, 0x01}, 0x01), compressed},
+		}, 0},
+		{"taproot key path", p2tr(1), Input{FinalScriptWitness: [][]byte{sig64}}, 1},
+		{"taproot key path with sighash and annex", p2tr(1), Input{FinalScriptWitness: [][]byte{sig65, annex}}, 1},
+		{"taproot key path with default sighash byte", p2tr(1), Input{
+			FinalScriptWitness: [][]byte{append(bytes.Clone(sig64), 0x00)},
+		}, 0},
+		{"taproot script path", p2tr(1), Input{
+			FinalScriptWitness: [][]byte{sig64, sig65, tapscript2of2, controlBlock},
+		}, 2},
+		{"taproot script path with a missing signature", p2tr(1), Input{
+			FinalScriptWitness: [][]byte{{}, sig64, tapscript2of2, controlBlock, annex},
+		}, 1},
+		{"schnorr signature outside taproot", p2wpkh(), Input{FinalScriptWitness: [][]byte{sig64, compressed}}, 0},
+		{"partial", p2wpkh(), Input{PartialSigs: []PartialSig{{PubKey: compressed, Signature: derSig()}}}, 1},
+		{"taproot key path partial", p2tr(1), Input{TapKeySig: sig64}, 1},
+		{"taproot script path partial", p2tr(1), Input{TapScriptSigs: []TapScriptSig{{Signature: sig64}, {Signature: sig65}}}, 2},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			if c.prev != nil {
+				c.in.WitnessUtxo = &TxOut{Value: 1000, ScriptPubKey: c.prev}
+			}
+			p := &Packet{UnsignedTx: &Tx{Inputs: make([]TxIn, 1)}, Inputs: []Input{c.in}}
+			if got := p.SignatureCount(); got != c.want {
+				t.Fatalf("SignatureCount = %d, want %d", got, c.want)
+			}
+		})
+	}
+}
+
+func TestCountXOnlyKeys(t *testing.T) {
+	key := bytes.Repeat([]byte{0x55}, 32)
+	for _, c := range []struct {
+		name   string
+		script []byte
+		want   int
+	}{
+		{"2 of 2", tapscript2of2, 2},
+		{"pushdata1 key", append([]byte{0x4c, 0x20}, append(key, 0xac)...), 1},
+		{"pushdata2 key", append([]byte{0x4d, 0x20, 0x00}, append(key, 0xac)...), 1},
+		{"key-sized data inside a push", append([]byte{0x4c, 0x21, 0x20}, append(key, 0x75)...), 0},
+		{"truncated push", append(push(key), 0x4c, 0x20, 0x01), 1},
+	} {
+		if got := countXOnlyKeys(c.script); got != c.want {
+			t.Errorf("%s: countXOnlyKeys = %d, want %d", c.name, got, c.want)
+		}
+	}
+}
+
+func TestTaprootVSize(t *testing.T) {
+	internalKey := bytes.Repeat([]byte{0x01}, 32)
+	leaf := TapLeafScript{ControlBlock: controlBlock[:33], Script: tapscript2of2, LeafVersion: 0xc0}
+	keyOrigin := TapBip32Derivation{XOnlyPubKey: internalKey}
+	for _, c := range []struct {
+		name string
+		in   Input
+		want uint64
+	}{
+		// 94 base bytes, plus a 66-byte witness
+		{"key path", Input{}, 112},
+		// two signatures, the 70-byte script and the 33-byte control block
+		{"script path", Input{TapLeafScripts: []TapLeafScript{leaf}}, 154},
+		{"key path with a leaf", Input{TapLeafScripts: []TapLeafScript{leaf}, TapBip32Derivation: []TapBip32Derivation{keyOrigin}}, 112},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			c.in.WitnessUtxo = &TxOut{Value: 1000, ScriptPubKey: p2tr(1)}
+			c.in.TapInternalKey = internalKey
+			p := &Packet{
+				UnsignedTx: &Tx{Version: 2, Inputs: make([]TxIn, 1), Outputs: []TxOut{{Value: 500, ScriptPubKey: p2tr(2)}}},
+				Inputs:     []Input{c.in},
+				Outputs:    make([]Output, 1),
+			}
+			if vsize, err := p.VSize(); err != nil || vsize != c.want {
+				t.Fatalf("VSize = %d, %v, want %d", vsize, err, c.want)
+			}
+		})
+	}
+}
+
+func proprietaryKey(prefix []byte, subtype byte) []byte {
+	return append(append([]byte{keyProprietary, byte(len(prefix))}, prefix...), subtype)
+}
+
+func witnessUtxo(value uint64, script []byte) []byte {
+	return append(binary.LittleEndian.AppendUint64(nil, value), push(script)...)
+}
+
+// TestInspect decodes a PSBT with a finalized taproot input, a P2WPKH input
+// with a partial signature, a tapret host output and an opret host output.
+func TestInspect(t *testing.T) {
+	commitment := bytes.Repeat([]byte{0xcc}, 32)
+	opReturn := append([]byte{0x6a}, push(commitment)...)
+	tx := &Tx{
+		Version: 2,
+		Inputs:  []TxIn{{PrevTxid: [32]byte{1}, Sequence: 0xfffffffd}, {PrevTxid: [32]byte{2}, PrevVout: 3, Sequence: 0xfffffffd}},
+		Outputs: []TxOut{{Value: 9000, ScriptPubKey: p2tr(2)}, {Value: 0, ScriptPubKey: opReturn}},
+	}
+	data := encodePsbt(
+		[]KeyValue{{Key: []byte{globalUnsignedTx}, Value: tx.Serialize(false)}},
+		[][]KeyValue{
+			{
+				{Key: []byte{inWitnessUtxo}, Value: witnessUtxo(10000, p2tr(1))},
+				{Key: []byte{inFinalScriptWitness}, Value: append([]byte{1}, push(bytes.Repeat([]byte{0x88}, 64))...)},
+			},
+			{
+				{Key: []byte{inWitnessUtxo}, Value: witnessUtxo(5000, p2wpkh())},
+				{Key: append([]byte{inPartialSig, 0x02}, bytes.Repeat([]byte{0x99}, 32)...), Value: derSig()},
+			},
+		},
+		[][]KeyValue{
+			{
+				{Key: proprietaryKey(PrefixTapret, SubtypeCommitmentHost), Value: nil},
+				{Key: proprietaryKey(PrefixTapret, SubtypeCommitment), Value: commitment},
+			},
+			{{Key: proprietaryKey(PrefixOpret, SubtypeCommitmentHost), Value: nil}},
+		},
+	)
+	p, err := Decode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(p.Outputs[0].TapretCommitment(), commitment) || p.Outputs[1].OpretCommitment() != nil {
+		t.Fatalf("commitments %x, %x", p.Outputs[0].TapretCommitment(), p.Outputs[1].OpretCommitment())
+	}
+
+	r, err := p.Inspect(Regtest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Txid != tx.Txid() || r.TotalInputSat != 15000 || r.TotalOutputSat != 9000 || r.FeeSat != 6000 {
+		t.Fatalf("txid %s, totals %d/%d, fee %d", r.Txid, r.TotalInputSat, r.TotalOutputSat, r.FeeSat)
+	}
+	// 178 base bytes, plus the 66-byte taproot and 109-byte P2WPKH witnesses
+	if r.SignatureCount != 2 || r.SizeVbytes != 223 {
+		t.Fatalf("%d signatures, %d vbytes", r.SignatureCount, r.SizeVbytes)
+	}
+	in0, in1 := r.Inputs[0], r.Inputs[1]
+	if in0.AmountSat != 10000 || !in0.Finalized || in0.Signatures != 1 || in1.Outpoint != tx.Inputs[1].PrevOutpoint() || in1.Finalized || in1.Signatures != 1 {
+		t.Fatalf("inputs %+v", r.Inputs)
+	}
+	out0, out1 := r.Outputs[0], r.Outputs[1]
+	if !strings.HasPrefix(out0.Address, "bcrt1p") || !out0.IsTapretHost || out0.IsOpretHost || out0.IsOpReturn {
+		t.Fatalf("output 0 %+v", out0)
+	}
+	if out1.Address != "" || !out1.IsOpReturn || !bytes.Equal(out1.OpReturnData, commitment) || !out1.IsOpretHost || out1.IsTapretHost {
+		t.Fatalf("output 1 %+v", out1)
+	}
+}
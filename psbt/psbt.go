@@ -0,0 +1,595 @@
+// Package psbt decodes BIP-174 partially signed bitcoin transactions without
+// the native library, so that stateless services can validate the PSBTs
+// produced by rgb-lib without opening a wallet. Both version 0 and version 2
+// (BIP-370) PSBTs are supported, including the taproot fields of BIP-371.
+package psbt
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var magic = []byte{0x70, 0x73, 0x62, 0x74, 0xff}
+
+var ErrInvalidPsbt = errors.New("invalid psbt")
+
+// Global key types.
+const (
+	globalUnsignedTx   = 0x00
+	globalXpub         = 0x01
+	globalTxVersion    = 0x02
+	globalLockTime     = 0x03
+	globalInputCount   = 0x04
+	globalOutputCount  = 0x05
+	globalTxModifiable = 0x06
+	globalVersion      = 0xfb
+	keyProprietary     = 0xfc
+)
+
+// Input key types.
+const (
+	inNonWitnessUtxo     = 0x00
+	inWitnessUtxo        = 0x01
+	inPartialSig         = 0x02
+	inSighashType        = 0x03
+	inRedeemScript       = 0x04
+	inWitnessScript      = 0x05
+	inBip32Derivation    = 0x06
+	inFinalScriptSig     = 0x07
+	inFinalScriptWitness = 0x08
+	inPreviousTxid       = 0x0e
+	inOutputIndex        = 0x0f
+	inSequence           = 0x10
+	inTapKeySig          = 0x13
+	inTapScriptSig       = 0x14
+	inTapLeafScript      = 0x15
+	inTapBip32Derivation = 0x16
+	inTapInternalKey     = 0x17
+	inTapMerkleRoot      = 0x18
+)
+
+// Output key types.
+const (
+	outRedeemScript       = 0x00
+	outWitnessScript      = 0x01
+	outBip32Derivation    = 0x02
+	outAmount             = 0x03
+	outScript             = 0x04
+	outTapInternalKey     = 0x05
+	outTapTree            = 0x06
+	outTapBip32Derivation = 0x07
+)
+
+// KeyValue is a raw map entry. Key includes the key type.
+type KeyValue struct {
+	Key   []byte
+	Value []byte
+}
+
+// Proprietary is a proprietary map entry (key type 0xFC), such as the ones
+// RGB wallets use to carry commitment data.
+type Proprietary struct {
+	Prefix  []byte
+	Subtype uint64
+	KeyData []byte
+	Value   []byte
+}
+
+type Bip32Derivation struct {
+	PubKey      []byte
+	Fingerprint uint32
+	Path        []uint32
+}
+
+type TapBip32Derivation struct {
+	XOnlyPubKey []byte
+	LeafHashes  [][]byte
+	Fingerprint uint32
+	Path        []uint32
+}
+
+type PartialSig struct {
+	PubKey    []byte
+	Signature []byte
+}
+
+type TapScriptSig struct {
+	XOnlyPubKey []byte
+	LeafHash    []byte
+	Signature   []byte
+}
+
+type TapLeafScript struct {
+	ControlBlock []byte
+	Script       []byte
+	LeafVersion  byte
+}
+
+type TapLeaf struct {
+	Depth       byte
+	LeafVersion byte
+	Script      []byte
+}
+
+// Xpub is a global extended public key with its origin.
+type Xpub struct {
+	Xpub        []byte
+	Fingerprint uint32
+	Path        []uint32
+}
+
+type Input struct {
+	NonWitnessUtxo     *Tx
+	WitnessUtxo        *TxOut
+	PartialSigs        []PartialSig
+	SighashType        *uint32
+	RedeemScript       []byte
+	WitnessScript      []byte
+	Bip32Derivation    []Bip32Derivation
+	FinalScriptSig     []byte
+	FinalScriptWitness [][]byte
+	TapKeySig          []byte
+	TapScriptSigs      []TapScriptSig
+	TapLeafScripts     []TapLeafScript
+	TapBip32Derivation []TapBip32Derivation
+	TapInternalKey     []byte
+	TapMerkleRoot      []byte
+	// version 2 fields
+	PreviousTxid []byte
+	OutputIndex  *uint32
+	Sequence     *uint32
+
+	Proprietary []Proprietary
+	Unknown     []KeyValue
+}
+
+type Output struct {
+	RedeemScript       []byte
+	WitnessScript      []byte
+	Bip32Derivation    []Bip32Derivation
+	TapInternalKey     []byte
+	TapTree            []TapLeaf
+	TapBip32Derivation []TapBip32Derivation
+	// version 2 fields
+	Amount *uint64
+	Script []byte
+
+	Proprietary []Proprietary
+	Unknown     []KeyValue
+}
+
+// Packet is a decoded PSBT. UnsignedTx is always set: for version 2 PSBTs it
+// is rebuilt from the per-input and per-output fields.
+type Packet struct {
+	Version     uint32
+	UnsignedTx  *Tx
+	Xpubs       []Xpub
+	Proprietary []Proprietary
+	Unknown     []KeyValue
+	Inputs      []Input
+	Outputs     []Output
+}
+
+// Parse decodes a PSBT given as base64 or hex.
+func Parse(s string) (*Packet, error) {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(strings.ToLower(s), hex.EncodeToString(magic)) {
+		data, err := hex.DecodeString(s)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidPsbt, err)
+		}
+		return Decode(data)
+	}
+	data, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPsbt, err)
+	}
+	return Decode(data)
+}
+
+// Decode decodes a binary PSBT.
+func Decode(data []byte) (*Packet, error) {
+	p, err := decode(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPsbt, err)
+	}
+	return p, nil
+}
+
+func readMap(r reader) ([]KeyValue, error) {
+	var kvs []KeyValue
+	seen := map[string]bool{}
+	for {
+		key, err := r.varBytes()
+		if err != nil {
+			return nil, err
+		}
+		if len(key) == 0 {
+			return kvs, nil
+		}
+		value, err := r.varBytes()
+		if err != nil {
+			return nil, err
+		}
+		if seen[string(key)] {
+			return nil, fmt.Errorf("duplicate key %x", key)
+		}
+		seen[string(key)] = true
+		kvs = append(kvs, KeyValue{Key: key, Value: value})
+	}
+}
+
+// splitKey returns the key type and the key data.
+func splitKey(key []byte) (uint64, []byte, error) {
+	r := reader{bytes.NewReader(key)}
+	t, err := r.compactSize()
+	if err != nil {
+		return 0, nil, err
+	}
+	return t, key[len(key)-r.Len():], nil
+}
+
+func parseProprietary(keyData, value []byte) (Proprietary, error) {
+	r := reader{bytes.NewReader(keyData)}
+	prefix, err := r.varBytes()
+	if err != nil {
+		return Proprietary{}, err
+	}
+	subtype, err := r.compactSize()
+	if err != nil {
+		return Proprietary{}, err
+	}
+	return Proprietary{Prefix: prefix, Subtype: subtype, KeyData: keyData[len(keyData)-r.Len():], Value: value}, nil
+}
+
+func parseKeyPath(value []byte) (uint32, []uint32, error) {
+	if len(value) < 4 || len(value)%4 != 0 {
+		return 0, nil, errors.New("invalid key origin")
+	}
+	fingerprint := binary.BigEndian.Uint32(value[:4])
+	var path []uint32
+	for i := 4; i < len(value); i += 4 {
+		path = append(path, binary.LittleEndian.Uint32(value[i:]))
+	}
+	return fingerprint, path, nil
+}
+
+func parseTapBip32(xonly, value []byte) (TapBip32Derivation, error) {
+	r := reader{bytes.NewReader(value)}
+	n, err := r.compactSize()
+	if err != nil {
+		return TapBip32Derivation{}, err
+	}
+	d := TapBip32Derivation{XOnlyPubKey: xonly}
+	for i := uint64(0); i < n; i++ {
+		h, err := r.bytes(32)
+		if err != nil {
+			return TapBip32Derivation{}, err
+		}
+		d.LeafHashes = append(d.LeafHashes, h)
+	}
+	rest, _ := r.bytes(uint64(r.Len()))
+	if d.Fingerprint, d.Path, err = parseKeyPath(rest); err != nil {
+		return TapBip32Derivation{}, err
+	}
+	return d, nil
+}
+
+func uint32Value(value []byte) (*uint32, error) {
+	if len(value) != 4 {
+		return nil, errors.New("invalid uint32 value")
+	}
+	v := binary.LittleEndian.Uint32(value)
+	return &v, nil
+}
+
+func decode(data []byte) (*Packet, error) {
+	if !bytes.HasPrefix(data, magic) {
+		return nil, errors.New("missing magic bytes")
+	}
+	r := reader{bytes.NewReader(data[len(magic):])}
+	globals, err := readMap(r)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Packet{}
+	var txVersion, lockTime *uint32
+	var inputCount, outputCount *uint64
+	for _, kv := range globals {
+		t, keyData, err := splitKey(kv.Key)
+		if err != nil {
+			return nil, err
+		}
+		switch t {
+		case globalUnsignedTx:
+			if p.UnsignedTx, err = ParseTx(kv.Value); err != nil {
+				return nil, err
+			}
+		case globalXpub:
+			fingerprint, path, err := parseKeyPath(kv.Value)
+			if err != nil {
+				return nil, err
+			}
+			p.Xpubs = append(p.Xpubs, Xpub{Xpub: keyData, Fingerprint: fingerprint, Path: path})
+		case globalTxVersion:
+			if txVersion, err = uint32Value(kv.Value); err != nil {
+				return nil, err
+			}
+		case globalLockTime:
+			if lockTime, err = uint32Value(kv.Value); err != nil {
+				return nil, err
+			}
+		case globalInputCount, globalOutputCount:
+			vr := reader{bytes.NewReader(kv.Value)}
+			n, err := vr.compactSize()
+			if err != nil {
+				return nil, err
+			}
+			if t == globalInputCount {
+				inputCount = &n
+			} else {
+				outputCount = &n
+			}
+		case globalVersion:
+			v, err := uint32Value(kv.Value)
+			if err != nil {
+				return nil, err
+			}
+			p.Version = *v
+		case keyProprietary:
+			prop, err := parseProprietary(keyData, kv.Value)
+			if err != nil {
+				return nil, err
+			}
+			p.Proprietary = append(p.Proprietary, prop)
+		default:
+			p.Unknown = append(p.Unknown, kv)
+		}
+	}
+
+	var nIn, nOut uint64
+	switch p.Version {
+	case 0:
+		if p.UnsignedTx == nil {
+			return nil, errors.New("missing unsigned transaction")
+		}
+		for _, in := range p.UnsignedTx.Inputs {
+			if len(in.ScriptSig) > 0 || len(in.Witness) > 0 {
+				return nil, errors.New("unsigned transaction has signatures")
+			}
+		}
+		nIn, nOut = uint64(len(p.UnsignedTx.Inputs)), uint64(len(p.UnsignedTx.Outputs))
+	case 2:
+		if p.UnsignedTx != nil || txVersion == nil || inputCount == nil || outputCount == nil {
+			return nil, errors.New("invalid version 2 globals")
+		}
+		nIn, nOut = *inputCount, *outputCount
+	default:
+		return nil, fmt.Errorf("unsupported version %d", p.Version)
+	}
+	if nIn > uint64(r.Len()) || nOut > uint64(r.Len()) {
+		return nil, errShortRead
+	}
+
+	for i := uint64(0); i < nIn; i++ {
+		kvs, err := readMap(r)
+		if err != nil {
+			return nil, err
+		}
+		in, err := parseInput(kvs)
+		if err != nil {
+			return nil, fmt.Errorf("input %d: %w", i, err)
+		}
+		p.Inputs = append(p.Inputs, in)
+	}
+	for i := uint64(0); i < nOut; i++ {
+		kvs, err := readMap(r)
+		if err != nil {
+			return nil, err
+		}
+		out, err := parseOutput(kvs)
+		if err != nil {
+			return nil, fmt.Errorf("output %d: %w", i, err)
+		}
+		p.Outputs = append(p.Outputs, out)
+	}
+	if r.Len() != 0 {
+		return nil, errors.New("trailing data")
+	}
+
+	if p.Version == 2 {
+		tx := &Tx{Version: int32(*txVersion)}
+		if lockTime != nil {
+			tx.LockTime = *lockTime
+		}
+		for i, in := range p.Inputs {
+			if len(in.PreviousTxid) != 32 || in.OutputIndex == nil {
+				return nil, fmt.Errorf("input %d: missing previous outpoint", i)
+			}
+			txin := TxIn{PrevVout: *in.OutputIndex, Sequence: 0xffffffff}
+			copy(txin.PrevTxid[:], in.PreviousTxid)
+			if in.Sequence != nil {
+				txin.Sequence = *in.Sequence
+			}
+			tx.Inputs = append(tx.Inputs, txin)
+		}
+		for i, out := range p.Outputs {
+			if out.Amount == nil || out.Script == nil {
+				return nil, fmt.Errorf("output %d: missing amount or script", i)
+			}
+			tx.Outputs = append(tx.Outputs, TxOut{Value: *out.Amount, ScriptPubKey: out.Script})
+		}
+		p.UnsignedTx = tx
+	}
+	return p, nil
+}
+
+func parseInput(kvs []KeyValue) (Input, error) {
+	var in Input
+	for _, kv := range kvs {
+		t, keyData, err := splitKey(kv.Key)
+		if err != nil {
+			return Input{}, err
+		}
+		switch t {
+		case inNonWitnessUtxo:
+			if in.NonWitnessUtxo, err = ParseTx(kv.Value); err != nil {
+				return Input{}, err
+			}
+		case inWitnessUtxo:
+			vr := reader{bytes.NewReader(kv.Value)}
+			var out TxOut
+			if out.Value, err = vr.uint64(); err != nil {
+				return Input{}, err
+			}
+			if out.ScriptPubKey, err = vr.varBytes(); err != nil {
+				return Input{}, err
+			}
+			in.WitnessUtxo = &out
+		case inPartialSig:
+			in.PartialSigs = append(in.PartialSigs, PartialSig{PubKey: keyData, Signature: kv.Value})
+		case inSighashType:
+			if in.SighashType, err = uint32Value(kv.Value); err != nil {
+				return Input{}, err
+			}
+		case inRedeemScript:
+			in.RedeemScript = kv.Value
+		case inWitnessScript:
+			in.WitnessScript = kv.Value
+		case inBip32Derivation:
+			fingerprint, path, err := parseKeyPath(kv.Value)
+			if err != nil {
+				return Input{}, err
+			}
+			in.Bip32Derivation = append(in.Bip32Derivation, Bip32Derivation{PubKey: keyData, Fingerprint: fingerprint, Path: path})
+		case inFinalScriptSig:
+			in.FinalScriptSig = kv.Value
+		case inFinalScriptWitness:
+			vr := reader{bytes.NewReader(kv.Value)}
+			n, err := vr.compactSize()
+			if err != nil {
+				return Input{}, err
+			}
+			in.FinalScriptWitness = [][]byte{}
+			for i := uint64(0); i < n; i++ {
+				item, err := vr.varBytes()
+				if err != nil {
+					return Input{}, err
+				}
+				in.FinalScriptWitness = append(in.FinalScriptWitness, item)
+			}
+		case inPreviousTxid:
+			in.PreviousTxid = kv.Value
+		case inOutputIndex:
+			if in.OutputIndex, err = uint32Value(kv.Value); err != nil {
+				return Input{}, err
+			}
+		case inSequence:
+			if in.Sequence, err = uint32Value(kv.Value); err != nil {
+				return Input{}, err
+			}
+		case inTapKeySig:
+			in.TapKeySig = kv.Value
+		case inTapScriptSig:
+			if len(keyData) != 64 {
+				return Input{}, errors.New("invalid tap script sig key")
+			}
+			in.TapScriptSigs = append(in.TapScriptSigs, TapScriptSig{XOnlyPubKey: keyData[:32], LeafHash: keyData[32:], Signature: kv.Value})
+		case inTapLeafScript:
+			if len(kv.Value) < 1 {
+				return Input{}, errors.New("invalid tap leaf script")
+			}
+			in.TapLeafScripts = append(in.TapLeafScripts, TapLeafScript{
+				ControlBlock: keyData,
+				Script:       kv.Value[:len(kv.Value)-1],
+				LeafVersion:  kv.Value[len(kv.Value)-1],
+			})
+		case inTapBip32Derivation:
+			d, err := parseTapBip32(keyData, kv.Value)
+			if err != nil {
+				return Input{}, err
+			}
+			in.TapBip32Derivation = append(in.TapBip32Derivation, d)
+		case inTapInternalKey:
+			in.TapInternalKey = kv.Value
+		case inTapMerkleRoot:
+			in.TapMerkleRoot = kv.Value
+		case keyProprietary:
+			prop, err := parseProprietary(keyData, kv.Value)
+			if err != nil {
+				return Input{}, err
+			}
+			in.Proprietary = append(in.Proprietary, prop)
+		default:
+			in.Unknown = append(in.Unknown, kv)
+		}
+	}
+	return in, nil
+}
+
+func parseOutput(kvs []KeyValue) (Output, error) {
+	var out Output
+	for _, kv := range kvs {
+		t, keyData, err := splitKey(kv.Key)
+		if err != nil {
+			return Output{}, err
+		}
+		switch t {
+		case outRedeemScript:
+			out.RedeemScript = kv.Value
+		case outWitnessScript:
+			out.WitnessScript = kv.Value
+		case outBip32Derivation:
+			fingerprint, path, err := parseKeyPath(kv.Value)
+			if err != nil {
+				return Output{}, err
+			}
+			out.Bip32Derivation = append(out.Bip32Derivation, Bip32Derivation{PubKey: keyData, Fingerprint: fingerprint, Path: path})
+		case outAmount:
+			if len(kv.Value) != 8 {
+				return Output{}, errors.New("invalid amount")
+			}
+			v := binary.LittleEndian.Uint64(kv.Value)
+			out.Amount = &v
+		case outScript:
+			out.Script = kv.Value
+		case outTapInternalKey:
+			out.TapInternalKey = kv.Value
+		case outTapTree:
+			vr := reader{bytes.NewReader(kv.Value)}
+			for vr.Len() > 0 {
+				depth, _ := vr.ReadByte()
+				version, err := vr.ReadByte()
+				if err != nil {
+					return Output{}, errShortRead
+				}
+				script, err := vr.varBytes()
+				if err != nil {
+					return Output{}, err
+				}
+				out.TapTree = append(out.TapTree, TapLeaf{Depth: depth, LeafVersion: version, Script: script})
+			}
+		case outTapBip32Derivation:
+			d, err := parseTapBip32(keyData, kv.Value)
+			if err != nil {
+				return Output{}, err
+			}
+			out.TapBip32Derivation = append(out.TapBip32Derivation, d)
+		case keyProprietary:
+			prop, err := parseProprietary(keyData, kv.Value)
+			if err != nil {
+				return Output{}, err
+			}
+			out.Proprietary = append(out.Proprietary, prop)
+		default:
+			out.Unknown = append(out.Unknown, kv)
+		}
+	}
+	return out, nil
+}
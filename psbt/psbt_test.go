@@ -0,0 +1,182 @@
+package psbt
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+// bip174Valid is the BIP-174 test vector with one P2PKH input, spent from a
+// non-witness UTXO, and two outputs.
+const bip174Valid = "cHNidP8BAHUCAAAAASaBcTce3/KF6Tet7qSze3gADAVmy7OtZGQXE8pCFxv2AAAAAAD+////AtPf9QUAAAAAGXapFNDFmQPFusKGh2DpD9UhpGZap2UgiKwA4fUFAAAAABepFDVF5uM7gyxHBQ8k0+65PJwDlIvHh7MuEwAAAQD9pQEBAAAAAAECiaPHHqtNIOA3G7ukzGmPopXJRjr6Ljl/hTPMti+VZ+UBAAAAFxYAFL4Y0VKpsBIDna89p95PUzSe7LmF/////4b4qkOnHf8USIk6UwpyN+9rRgi7st0tAXHmOuxqSJC0AQAAABcWABT+Pp7xp0XpdNkCxDVZQ6vLNL1TU/////8CAMLrCwAAAAAZdqkUhc/xCX/Z4Ai7NK9wnGIZeziXikiIrHL++E4sAAAAF6kUM5cluiHv1irHU6m80GfWx6ajnQWHAkcwRAIgJxK+IuAnDzlPVoMR3HyppolwuAJf3TskAinwf4pfOiQCIAGLONfc0xTnNMkna9b7QPZzMlvEuqFEyADS8vAtsnZcASED0uFWdJQbrUqZY3LLh+GFbTZSYG2YVi/jnF6efkE/IQUCSDBFAiEA0SuFLYXc2WHS9fSrZgZU327tzHlMDDPOXMMJ/7X85Y0CIGczio4OFyXBl/saiK9Z9R5E5CVbIBZ8hoQDHAXR8lkqASECI7cr7vCWXRC+B3jv7NYfysb3mk6haTkzgHNEZPhPKrMAAAAAAAAA"
+
+func TestParseBip174(t *testing.T) {
+	p, err := Parse(bip174Valid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Version != 0 || len(p.Inputs) != 1 || len(p.Outputs) != 2 || len(p.UnsignedTx.Outputs) != 2 {
+		t.Fatalf("version %d, %d inputs, %d outputs", p.Version, len(p.Inputs), len(p.Outputs))
+	}
+	in, err := p.TotalInput()
+	if err != nil || in != 200_000_000 {
+		t.Fatalf("TotalInput = %d, %v", in, err)
+	}
+	out, err := p.TotalOutput()
+	if err != nil || out != 199_999_699 {
+		t.Fatalf("TotalOutput = %d, %v", out, err)
+	}
+	if fee, err := p.Fee(); err != nil || fee != 301 {
+		t.Fatalf("Fee = %d, %v", fee, err)
+	}
+	if vsize, err := p.VSize(); err != nil || vsize != 225 {
+		t.Fatalf("VSize = %d, %v", vsize, err)
+	}
+
+	// the same PSBT in hex
+	raw, _ := base64.StdEncoding.DecodeString(bip174Valid)
+	h, err := Parse(hex.EncodeToString(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.UnsignedTx.Txid() != p.UnsignedTx.Txid() {
+		t.Fatalf("hex txid %s, base64 txid %s", h.UnsignedTx.Txid(), p.UnsignedTx.Txid())
+	}
+}
+
+func TestParseBip174Invalid(t *testing.T) {
+	raw, _ := base64.StdEncoding.DecodeString(bip174Valid)
+	p, err := Decode(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unsignedTx := KeyValue{Key: []byte{globalUnsignedTx}, Value: p.UnsignedTx.Serialize(false)}
+	signed := *p.UnsignedTx
+	signed.Inputs = append([]TxIn(nil), signed.Inputs...)
+	signed.Inputs[0].ScriptSig = []byte{0x51}
+	for name, data := range map[string][]byte{
+		"network transaction": p.UnsignedTx.Serialize(false),
+		// the two output maps are left out
+		"missing outputs":              raw[:len(raw)-2],
+		"trailing data":                append(append([]byte(nil), raw...), 0x00),
+		"missing unsigned transaction": encodePsbt(nil, nil, nil),
+		"unsigned transaction with script sig": encodePsbt([]KeyValue{
+			{Key: []byte{globalUnsignedTx}, Value: signed.Serialize(false)},
+		}, nil, nil),
+		"duplicate key":                       encodePsbt([]KeyValue{unsignedTx, unsignedTx}, nil, nil),
+		"unsupported version":                 encodePsbt([]KeyValue{unsignedTx, {Key: []byte{globalVersion}, Value: le32(1)}}, nil, nil),
+		"version 2 with unsigned transaction": encodePsbt([]KeyValue{unsignedTx, {Key: []byte{globalVersion}, Value: le32(2)}}, nil, nil),
+	} {
+		if _, err := Decode(data); err == nil {
+			t.Errorf("%s: Decode succeeded", name)
+		}
+	}
+	if _, err := Parse("not a psbt"); !errors.Is(err, ErrInvalidPsbt) {
+		t.Errorf("Parse of garbage = %v, want ErrInvalidPsbt", err)
+	}
+}
+
+// TestParseBip370 rebuilds the BIP-174 vector as a version 2 PSBT, which
+// must describe the same transaction.
+func TestParseBip370(t *testing.T) {
+	v0, err := Parse(bip174Valid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := v0.UnsignedTx
+	globals := []KeyValue{
+		{Key: []byte{globalTxVersion}, Value: le32(uint32(tx.Version))},
+		{Key: []byte{globalLockTime}, Value: le32(tx.LockTime)},
+		{Key: []byte{globalInputCount}, Value: []byte{byte(len(tx.Inputs))}},
+		{Key: []byte{globalOutputCount}, Value: []byte{byte(len(tx.Outputs))}},
+		{Key: []byte{globalVersion}, Value: le32(2)},
+	}
+	var inputs, outputs [][]KeyValue
+	for i, in := range tx.Inputs {
+		inputs = append(inputs, []KeyValue{
+			{Key: []byte{inNonWitnessUtxo}, Value: v0.Inputs[i].NonWitnessUtxo.Serialize(true)},
+			{Key: []byte{inPreviousTxid}, Value: in.PrevTxid[:]},
+			{Key: []byte{inOutputIndex}, Value: le32(in.PrevVout)},
+			{Key: []byte{inSequence}, Value: le32(in.Sequence)},
+		})
+	}
+	for _, out := range tx.Outputs {
+		outputs = append(outputs, []KeyValue{
+			{Key: []byte{outAmount}, Value: binary.LittleEndian.AppendUint64(nil, out.Value)},
+			{Key: []byte{outScript}, Value: out.ScriptPubKey},
+		})
+	}
+	v2, err := Decode(encodePsbt(globals, inputs, outputs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v2.Version != 2 || v2.UnsignedTx.Txid() != tx.Txid() {
+		t.Fatalf("version %d, txid %s, want %s", v2.Version, v2.UnsignedTx.Txid(), tx.Txid())
+	}
+	if fee, err := v2.Fee(); err != nil || fee != 301 {
+		t.Fatalf("Fee = %d, %v", fee, err)
+	}
+
+	// outputs need both an amount and a script
+	outputs[0] = outputs[0][:1]
+	if _, err := Decode(encodePsbt(globals, inputs, outputs)); err == nil {
+		t.Fatal("Decode accepted an output without script")
+	}
+}
+
+func TestTotalsOverflow(t *testing.T) {
+	script := []byte{0x51}
+	huge := TxOut{Value: 1 << 63, ScriptPubKey: script}
+	p := &Packet{
+		UnsignedTx: &Tx{Version: 2, Inputs: make([]TxIn, 2), Outputs: []TxOut{huge, huge}},
+		Inputs:     []Input{{WitnessUtxo: &huge}, {WitnessUtxo: &huge}},
+		Outputs:    make([]Output, 2),
+	}
+	if _, err := p.TotalInput(); !errors.Is(err, ErrOverflow) {
+		t.Errorf("TotalInput = %v, want ErrOverflow", err)
+	}
+	if _, err := p.TotalOutput(); !errors.Is(err, ErrOverflow) {
+		t.Errorf("TotalOutput = %v, want ErrOverflow", err)
+	}
+	if _, err := p.Fee(); !errors.Is(err, ErrOverflow) {
+		t.Errorf("Fee = %v, want ErrOverflow", err)
+	}
+
+	// outputs above inputs do not wrap either
+	small := TxOut{Value: 1000, ScriptPubKey: script}
+	p.Inputs = []Input{{WitnessUtxo: &small}, {WitnessUtxo: &small}}
+	p.UnsignedTx.Outputs = []TxOut{small, {Value: 1001, ScriptPubKey: script}}
+	if fee, err := p.Fee(); err == nil {
+		t.Errorf("Fee = %d, want an error", fee)
+	}
+}
+
+func le32(v uint32) []byte {
+	return binary.LittleEndian.AppendUint32(nil, v)
+}
+
+// encodePsbt serializes a PSBT from its maps.
+func encodePsbt(globals []KeyValue, inputs, outputs [][]KeyValue) []byte {
+	var b bytes.Buffer
+	b.Write(magic)
+	writeMap := func(kvs []KeyValue) {
+		for _, kv := range kvs {
+			writeCompactSize(&b, uint64(len(kv.Key)))
+			b.Write(kv.Key)
+			writeCompactSize(&b, uint64(len(kv.Value)))
+			b.Write(kv.Value)
+		}
+		b.WriteByte(0)
+	}
+	writeMap(globals)
+	for _, m := range inputs {
+		writeMap(m)
+	}
+	for _, m := range outputs {
+		writeMap(m)
+	}
+	return b.Bytes()
+}
@@ -0,0 +1,333 @@
+package psbt
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Tx is a bitcoin transaction.
+type Tx struct {
+	Version  int32
+	Inputs   []TxIn
+	Outputs  []TxOut
+	LockTime uint32
+}
+
+// TxIn is a transaction input. PrevTxid is in internal byte order, i.e.
+// reversed with respect to the usual hex representation.
+type TxIn struct {
+	PrevTxid  [32]byte
+	PrevVout  uint32
+	ScriptSig []byte
+	Sequence  uint32
+	Witness   [][]byte
+}
+
+// PrevOutpoint returns the spent outpoint as "txid:vout".
+func (in TxIn) PrevOutpoint() string {
+	return fmt.Sprintf("%s:%d", hashToString(in.PrevTxid), in.PrevVout)
+}
+
+type TxOut struct {
+	Value        uint64
+	ScriptPubKey []byte
+}
+
+var errShortRead = errors.New("unexpected end of data")
+
+type reader struct {
+	*bytes.Reader
+}
+
+func (r reader) bytes(n uint64) ([]byte, error) {
+	if n > uint64(r.Len()) {
+		return nil, errShortRead
+	}
+	b := make([]byte, n)
+	_, err := io.ReadFull(r, b)
+	return b, err
+}
+
+func (r reader) uint32() (uint32, error) {
+	b, err := r.bytes(4)
+	if err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint32(b), nil
+}
+
+func (r reader) uint64() (uint64, error) {
+	b, err := r.bytes(8)
+	if err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint64(b), nil
+}
+
+func (r reader) compactSize() (uint64, error) {
+	prefix, err := r.ReadByte()
+	if err != nil {
+		return 0, errShortRead
+	}
+	switch prefix {
+	case 0xfd:
+		b, err := r.bytes(2)
+		if err != nil {
+			return 0, err
+		}
+		return uint64(binary.LittleEndian.Uint16(b)), nil
+	case 0xfe:
+		v, err := r.uint32()
+		return uint64(v), err
+	case 0xff:
+		return r.uint64()
+	default:
+		return uint64(prefix), nil
+	}
+}
+
+func (r reader) varBytes() ([]byte, error) {
+	n, err := r.compactSize()
+	if err != nil {
+		return nil, err
+	}
+	return r.bytes(n)
+}
+
+func writeCompactSize(w *bytes.Buffer, n uint64) {
+	switch {
+	case n < 0xfd:
+		w.WriteByte(byte(n))
+	case n <= 0xffff:
+		w.WriteByte(0xfd)
+		binary.Write(w, binary.LittleEndian, uint16(n))
+	case n <= 0xffffffff:
+		w.WriteByte(0xfe)
+		binary.Write(w, binary.LittleEndian, uint32(n))
+	default:
+		w.WriteByte(0xff)
+		binary.Write(w, binary.LittleEndian, n)
+	}
+}
+
+func compactSizeLen(n uint64) int {
+	switch {
+	case n < 0xfd:
+		return 1
+	case n <= 0xffff:
+		return 3
+	case n <= 0xffffffff:
+		return 5
+	default:
+		return 9
+	}
+}
+
+// ParseTx decodes a serialized transaction, with or without witness data.
+func ParseTx(data []byte) (*Tx, error) {
+	r := reader{bytes.NewReader(data)}
+	tx, err := readTx(r)
+	if err != nil {
+		return nil, fmt.Errorf("invalid transaction: %w", err)
+	}
+	if r.Len() != 0 {
+		return nil, errors.New("invalid transaction: trailing data")
+	}
+	return tx, nil
+}
+
+func readTx(r reader) (*Tx, error) {
+	version, err := r.uint32()
+	if err != nil {
+		return nil, err
+	}
+	tx := &Tx{Version: int32(version)}
+	nIn, err := r.compactSize()
+	if err != nil {
+		return nil, err
+	}
+	segwit := false
+	if nIn == 0 {
+		// segwit marker, followed by the flag
+		flag, err := r.ReadByte()
+		if err != nil || flag != 0x01 {
+			return nil, errors.New("invalid segwit flag")
+		}
+		segwit = true
+		if nIn, err = r.compactSize(); err != nil {
+			return nil, err
+		}
+	}
+	if nIn > uint64(r.Len()) {
+		return nil, errShortRead
+	}
+	for i := uint64(0); i < nIn; i++ {
+		var in TxIn
+		prev, err := r.bytes(32)
+		if err != nil {
+			return nil, err
+		}
+		copy(in.PrevTxid[:], prev)
+		if in.PrevVout, err = r.uint32(); err != nil {
+			return nil, err
+		}
+		if in.ScriptSig, err = r.varBytes(); err != nil {
+			return nil, err
+		}
+		if in.Sequence, err = r.uint32(); err != nil {
+			return nil, err
+		}
+		tx.Inputs = append(tx.Inputs, in)
+	}
+	nOut, err := r.compactSize()
+	if err != nil {
+		return nil, err
+	}
+	if nOut > uint64(r.Len()) {
+		return nil, errShortRead
+	}
+	for i := uint64(0); i < nOut; i++ {
+		var out TxOut
+		if out.Value, err = r.uint64(); err != nil {
+			return nil, err
+		}
+		if out.ScriptPubKey, err = r.varBytes(); err != nil {
+			return nil, err
+		}
+		tx.Outputs = append(tx.Outputs, out)
+	}
+	if segwit {
+		for i := range tx.Inputs {
+			items, err := r.compactSize()
+			if err != nil {
+				return nil, err
+			}
+			if items > uint64(r.Len()) {
+				return nil, errShortRead
+			}
+			for j := uint64(0); j < items; j++ {
+				item, err := r.varBytes()
+				if err != nil {
+					return nil, err
+				}
+				tx.Inputs[i].Witness = append(tx.Inputs[i].Witness, item)
+			}
+		}
+	}
+	if tx.LockTime, err = r.uint32(); err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+func (tx *Tx) hasWitness() bool {
+	for _, in := range tx.Inputs {
+		if len(in.Witness) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Serialize encodes the transaction, including witness data when withWitness
+// is set and some input has a witness.
+func (tx *Tx) Serialize(withWitness bool) []byte {
+	var w bytes.Buffer
+	withWitness = withWitness && tx.hasWitness()
+	binary.Write(&w, binary.LittleEndian, tx.Version)
+	if withWitness {
+		w.Write([]byte{0x00, 0x01})
+	}
+	writeCompactSize(&w, uint64(len(tx.Inputs)))
+	for _, in := range tx.Inputs {
+		w.Write(in.PrevTxid[:])
+		binary.Write(&w, binary.LittleEndian, in.PrevVout)
+		writeCompactSize(&w, uint64(len(in.ScriptSig)))
+		w.Write(in.ScriptSig)
+		binary.Write(&w, binary.LittleEndian, in.Sequence)
+	}
+	writeCompactSize(&w, uint64(len(tx.Outputs)))
+	for _, out := range tx.Outputs {
+		binary.Write(&w, binary.LittleEndian, out.Value)
+		writeCompactSize(&w, uint64(len(out.ScriptPubKey)))
+		w.Write(out.ScriptPubKey)
+	}
+	if withWitness {
+		for _, in := range tx.Inputs {
+			writeCompactSize(&w, uint64(len(in.Witness)))
+			for _, item := range in.Witness {
+				writeCompactSize(&w, uint64(len(item)))
+				w.Write(item)
+			}
+		}
+	}
+	binary.Write(&w, binary.LittleEndian, tx.LockTime)
+	return w.Bytes()
+}
+
+func hashToString(h [32]byte) string {
+	for i, j := 0, len(h)-1; i < j; i, j = i+1, j-1 {
+		h[i], h[j] = h[j], h[i]
+	}
+	return hex.EncodeToString(h[:])
+}
+
+// Txid returns the transaction id in the usual, byte-reversed, hex form.
+func (tx *Tx) Txid() string {
+	first := sha256.Sum256(tx.Serialize(false))
+	return hashToString(sha256.Sum256(first[:]))
+}
+
+// IsOpReturn reports whether the output is a provably unspendable OP_RETURN.
+func (out TxOut) IsOpReturn() bool {
+	return len(out.ScriptPubKey) > 0 && out.ScriptPubKey[0] == 0x6a
+}
+
+// OpReturnData returns the data pushed after OP_RETURN, concatenated. It
+// returns nil for other outputs or malformed pushes.
+func (out TxOut) OpReturnData() []byte {
+	if !out.IsOpReturn() {
+		return nil
+	}
+	s := out.ScriptPubKey[1:]
+	data := []byte{}
+	for len(s) > 0 {
+		op, push, rest, ok := nextOp(s)
+		if !ok || op == 0x00 || op > 0x4e {
+			return nil
+		}
+		data = append(data, push...)
+		s = rest
+	}
+	return data
+}
+
+// nextOp splits the first opcode off a non-empty script, with the data it
+// pushes. ok is false when a push runs past the end of the script.
+func nextOp(script []byte) (op byte, data, rest []byte, ok bool) {
+	op, rest = script[0], script[1:]
+	var n uint64
+	switch {
+	case op <= 0x4b:
+		n = uint64(op)
+	case op == 0x4c && len(rest) >= 1:
+		n, rest = uint64(rest[0]), rest[1:]
+	case op == 0x4d && len(rest) >= 2:
+		n, rest = uint64(binary.LittleEndian.Uint16(rest)), rest[2:]
+	case op == 0x4e && len(rest) >= 4:
+		n, rest = uint64(binary.LittleEndian.Uint32(rest)), rest[4:]
+	case op <= 0x4e:
+		return op, nil, nil, false
+	default:
+		return op, nil, rest, true
+	}
+	if n > uint64(len(rest)) {
+		return op, nil, nil, false
+	}
+	return op, rest[:n], rest[n:], true
+}
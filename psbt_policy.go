@@ -0,0 +1,353 @@
+package rgb_lib
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Policy rule names, reported in PolicyViolation.Rule.
+const (
+	RuleMaxFee            = "max_fee"
+	RuleMaxFeeRate        = "max_fee_rate"
+	RuleAllowedAddress    = "allowed_address"
+	RuleAllowedScriptType = "allowed_script_type"
+	RuleMaxOutflow        = "max_outflow"
+	RuleNoForeignInputs   = "no_foreign_inputs"
+)
+
+// PolicyViolation describes a rule broken by an operation. Input and Output
+// are the indexes of the offending PSBT input or output, when relevant.
+type PolicyViolation struct {
+	Rule    string
+	Message string
+	Input   *int
+	Output  *int
+}
+
+func (v PolicyViolation) String() string {
+	return fmt.Sprintf("%s: %s", v.Rule, v.Message)
+}
+
+var ErrPolicyViolation = errors.New("policy violation")
+
+// PolicyError is returned when signing is rejected by a policy. It matches
+// ErrPolicyViolation with errors.Is.
+type PolicyError struct {
+	Violations []PolicyViolation
+}
+
+func (e *PolicyError) Error() string {
+	msgs := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		msgs[i] = v.String()
+	}
+	return fmt.Sprintf("%s: %s", ErrPolicyViolation, strings.Join(msgs, "; "))
+}
+
+func (e *PolicyError) Unwrap() error {
+	return ErrPolicyViolation
+}
+
+type ScriptType string
+
+const (
+	ScriptTypeP2pkh    ScriptType = "p2pkh"
+	ScriptTypeP2sh     ScriptType = "p2sh"
+	ScriptTypeP2wpkh   ScriptType = "p2wpkh"
+	ScriptTypeP2wsh    ScriptType = "p2wsh"
+	ScriptTypeP2tr     ScriptType = "p2tr"
+	ScriptTypeOpReturn ScriptType = "op_return"
+	ScriptTypeUnknown  ScriptType = "unknown"
+)
+
+// ClassifyScript returns the standard type of a hex-encoded scriptPubKey.
+func ClassifyScript(scriptPubkeyHex string) ScriptType {
+	s, err := hex.DecodeString(scriptPubkeyHex)
+	if err != nil {
+		return ScriptTypeUnknown
+	}
+	switch {
+	case len(s) == 25 && s[0] == 0x76 && s[1] == 0xa9 && s[2] == 0x14 && s[23] == 0x88 && s[24] == 0xac:
+		return ScriptTypeP2pkh
+	case len(s) == 23 && s[0] == 0xa9 && s[1] == 0x14 && s[22] == 0x87:
+		return ScriptTypeP2sh
+	case len(s) == 22 && s[0] == 0x00 && s[1] == 0x14:
+		return ScriptTypeP2wpkh
+	case len(s) == 34 && s[0] == 0x00 && s[1] == 0x20:
+		return ScriptTypeP2wsh
+	case len(s) == 34 && s[0] == 0x51 && s[1] == 0x20:
+		return ScriptTypeP2tr
+	case len(s) > 0 && s[0] == 0x6a:
+		return ScriptTypeOpReturn
+	default:
+		return ScriptTypeUnknown
+	}
+}
+
+// OutflowTracker accumulates the amounts sent out of a wallet so that a
+// PsbtPolicy can cap them over a sliding period. It is safe for concurrent
+// use and can be shared by several policies.
+type OutflowTracker struct {
+	mu      sync.Mutex
+	records []outflowRecord
+	now     func() time.Time
+}
+
+type outflowRecord struct {
+	at     time.Time
+	txid   string
+	amount uint64
+}
+
+func NewOutflowTracker() *OutflowTracker {
+	return &OutflowTracker{now: time.Now}
+}
+
+// Record adds an outflow. Recording the same txid twice has no effect.
+func (t *OutflowTracker) Record(txid string, amount uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, r := range t.records {
+		if r.txid == txid {
+			return
+		}
+	}
+	t.records = append(t.records, outflowRecord{at: t.now(), txid: txid, amount: amount})
+}
+
+// Total returns the outflow recorded during the last period, dropping older
+// records.
+func (t *OutflowTracker) Total(period time.Duration) uint64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.total(period)
+}
+
+// Reserve records an outflow if, added to the outflow recorded during the
+// last period, it stays within limit. A zero limit means no limit. It
+// returns the outflow already recorded and whether the amount fits. A txid
+// already recorded fits and is not recorded again.
+func (t *OutflowTracker) Reserve(txid string, amount uint64, period time.Duration, limit uint64) (uint64, bool) {
+	spent, ok, _ := t.reserve(txid, amount, period, limit)
+	return spent, ok
+}
+
+// reserve is Reserve also reporting whether txid was added.
+func (t *OutflowTracker) reserve(txid string, amount uint64, period time.Duration, limit uint64) (uint64, bool, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	spent := t.total(period)
+	if slices.ContainsFunc(t.records, func(r outflowRecord) bool { return r.txid == txid }) {
+		return spent, true, false
+	}
+	if limit > 0 && (spent > limit || amount > limit-spent) {
+		return spent, false, false
+	}
+	t.records = append(t.records, outflowRecord{at: t.now(), txid: txid, amount: amount})
+	return spent, true, true
+}
+
+// Release drops the outflow recorded for txid, e.g. when the transaction
+// reserved for is not signed after all.
+func (t *OutflowTracker) Release(txid string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.records = slices.DeleteFunc(t.records, func(r outflowRecord) bool {
+		return r.txid == txid
+	})
+}
+
+func (t *OutflowTracker) total(period time.Duration) uint64 {
+	cutoff := t.now().Add(-period)
+	t.records = slices.DeleteFunc(t.records, func(r outflowRecord) bool {
+		return r.at.Before(cutoff)
+	})
+	var total uint64
+	for _, r := range t.records {
+		total += r.amount
+	}
+	return total
+}
+
+// PsbtPolicy is a set of rules checked on a PsbtInspection before signing.
+// Zero-valued fields disable the corresponding rule.
+//
+// Destination rules apply to outputs not belonging to the wallet. OP_RETURN
+// outputs with no value, such as RGB opret commitments, are exempt.
+type PsbtPolicy struct {
+	// MaxFeeSat caps the absolute fee.
+	MaxFeeSat uint64
+	// MaxFeeRate caps the fee rate, in sat/vB.
+	MaxFeeRate float64
+	// AllowedAddresses lists the only addresses funds can be sent to.
+	AllowedAddresses []string
+	// AllowedScriptTypes lists the only output types funds can be sent to.
+	AllowedScriptTypes []ScriptType
+	// MaxOutflow caps the amount, fees included, leaving the wallet during
+	// OutflowPeriod, as recorded by Outflow.
+	MaxOutflow    uint64
+	OutflowPeriod time.Duration
+	Outflow       *OutflowTracker
+	// NoForeignInputs rejects PSBTs spending inputs not owned by the wallet.
+	NoForeignInputs bool
+}
+
+// PsbtOutflow returns the amount leaving the wallet with a PSBT: the value of
+// the outputs not owned by the wallet plus the fee.
+func PsbtOutflow(inspection PsbtInspection) uint64 {
+	out := inspection.FeeSat
+	for _, o := range inspection.Outputs {
+		if !o.IsMine {
+			out += o.AmountSat
+		}
+	}
+	return out
+}
+
+// Evaluate returns the rules broken by the inspected PSBT.
+func (p *PsbtPolicy) Evaluate(inspection PsbtInspection) []PolicyViolation {
+	violations := p.evaluate(inspection)
+	if p.MaxOutflow > 0 && p.Outflow != nil {
+		spent := p.Outflow.Total(p.OutflowPeriod)
+		if out := PsbtOutflow(inspection); spent+out > p.MaxOutflow {
+			violations = append(violations, p.outflowViolation(out, spent))
+		}
+	}
+	return violations
+}
+
+// evaluate returns the rules other than MaxOutflow broken by the inspected
+// PSBT.
+func (p *PsbtPolicy) evaluate(inspection PsbtInspection) []PolicyViolation {
+	var violations []PolicyViolation
+	if p.MaxFeeSat > 0 && inspection.FeeSat > p.MaxFeeSat {
+		violations = append(violations, PolicyViolation{
+			Rule:    RuleMaxFee,
+			Message: fmt.Sprintf("fee %d sat is above %d sat", inspection.FeeSat, p.MaxFeeSat),
+		})
+	}
+	if p.MaxFeeRate > 0 && inspection.SizeVbytes > 0 {
+		rate := float64(inspection.FeeSat) / float64(inspection.SizeVbytes)
+		if rate > p.MaxFeeRate {
+			violations = append(violations, PolicyViolation{
+				Rule:    RuleMaxFeeRate,
+				Message: fmt.Sprintf("fee rate %.2f sat/vB is above %.2f sat/vB", rate, p.MaxFeeRate),
+			})
+		}
+	}
+	if p.NoForeignInputs {
+		for i, in := range inspection.Inputs {
+			if !in.IsMine {
+				violations = append(violations, PolicyViolation{
+					Rule:    RuleNoForeignInputs,
+					Message: fmt.Sprintf("input %s:%d is not owned by the wallet", in.Outpoint.Txid, in.Outpoint.Vout),
+					Input:   &i,
+				})
+			}
+		}
+	}
+	for i, out := range inspection.Outputs {
+		if out.IsMine || out.IsOpReturn && out.AmountSat == 0 {
+			continue
+		}
+		if len(p.AllowedAddresses) > 0 && (out.Address == nil || !slices.Contains(p.AllowedAddresses, *out.Address)) {
+			dest := out.ScriptPubkeyHex
+			if out.Address != nil {
+				dest = *out.Address
+			}
+			violations = append(violations, PolicyViolation{
+				Rule:    RuleAllowedAddress,
+				Message: fmt.Sprintf("destination %s is not allowed", dest),
+				Output:  &i,
+			})
+		}
+		if len(p.AllowedScriptTypes) > 0 {
+			if st := ClassifyScript(out.ScriptPubkeyHex); !slices.Contains(p.AllowedScriptTypes, st) {
+				violations = append(violations, PolicyViolation{
+					Rule:    RuleAllowedScriptType,
+					Message: fmt.Sprintf("output type %s is not allowed", st),
+					Output:  &i,
+				})
+			}
+		}
+	}
+	return violations
+}
+
+func (p *PsbtPolicy) outflowViolation(out, spent uint64) PolicyViolation {
+	return PolicyViolation{
+		Rule:    RuleMaxOutflow,
+		Message: fmt.Sprintf("outflow %d sat plus %d sat already sent in %s is above %d sat", out, spent, p.OutflowPeriod, p.MaxOutflow),
+	}
+}
+
+// PsbtInspector is implemented by Wallet and MultisigWallet.
+type PsbtInspector interface {
+	InspectPsbt(psbt string) (PsbtInspection, error)
+}
+
+// PolicySigner is a Signer enforcing a PsbtPolicy before delegating to another
+// Signer. PSBTs breaking the policy are rejected with a *PolicyError unless
+// Approve is set and returns true.
+type PolicySigner struct {
+	inspector PsbtInspector
+	policy    *PsbtPolicy
+	signer    Signer
+
+	// Approve, when set, is asked whether to sign despite the violations,
+	// e.g. after a manual review.
+	Approve func(ctx context.Context, inspection PsbtInspection, violations []PolicyViolation) bool
+}
+
+func NewPolicySigner(inspector PsbtInspector, policy *PsbtPolicy, signer Signer) *PolicySigner {
+	return &PolicySigner{inspector: inspector, policy: policy, signer: signer}
+}
+
+// SignPsbt reserves the outflow of psbt on the policy's OutflowTracker, if
+// any, while checking MaxOutflow, so that concurrent calls cannot together
+// exceed it. The reservation is released if the PSBT is not signed.
+func (s *PolicySigner) SignPsbt(ctx context.Context, psbt string) (string, error) {
+	inspection, err := s.inspector.InspectPsbt(psbt)
+	if err != nil {
+		return "", err
+	}
+	p := s.policy
+	violations := p.evaluate(inspection)
+	var out uint64
+	reserved := false
+	if p.Outflow != nil {
+		out = PsbtOutflow(inspection)
+		spent, ok, added := p.Outflow.reserve(inspection.Txid, out, p.OutflowPeriod, p.MaxOutflow)
+		if !ok {
+			violations = append(violations, p.outflowViolation(out, spent))
+		}
+		reserved = added
+	}
+	if len(violations) > 0 {
+		if s.Approve == nil || !s.Approve(ctx, inspection, violations) {
+			s.release(inspection.Txid, reserved)
+			return "", &PolicyError{Violations: violations}
+		}
+		if p.Outflow != nil && !reserved {
+			_, _, reserved = p.Outflow.reserve(inspection.Txid, out, p.OutflowPeriod, 0)
+		}
+	}
+	signed, err := s.signer.SignPsbt(ctx, psbt)
+	if err != nil {
+		s.release(inspection.Txid, reserved)
+		return "", err
+	}
+	return signed, nil
+}
+
+func (s *PolicySigner) release(txid string, reserved bool) {
+	if reserved {
+		s.policy.Outflow.Release(txid)
+	}
+}
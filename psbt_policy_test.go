@@ -0,0 +1,97 @@
+package rgb_lib
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeInspector map[string]PsbtInspection
+
+func (f fakeInspector) InspectPsbt(psbt string) (PsbtInspection, error) {
+	return f[psbt], nil
+}
+
+type fakeSigner struct{ err error }
+
+func (f fakeSigner) SignPsbt(ctx context.Context, psbt string) (string, error) {
+	return psbt, f.err
+}
+
+func TestOutflowTrackerReserve(t *testing.T) {
+	tracker := NewOutflowTracker()
+	if spent, ok := tracker.Reserve("a", 60, time.Hour, 100); !ok || spent != 0 {
+		t.Fatalf("Reserve(a) = %d, %v", spent, ok)
+	}
+	if spent, ok := tracker.Reserve("b", 50, time.Hour, 100); ok || spent != 60 {
+		t.Fatalf("Reserve(b) = %d, %v", spent, ok)
+	}
+	if _, ok := tracker.Reserve("a", 60, time.Hour, 100); !ok {
+		t.Fatal("Reserve(a) again does not fit")
+	}
+	if got := tracker.Total(time.Hour); got != 60 {
+		t.Fatalf("Total = %d, want 60", got)
+	}
+	tracker.Release("a")
+	if _, ok := tracker.Reserve("b", 50, time.Hour, 100); !ok {
+		t.Fatal("Reserve(b) after Release does not fit")
+	}
+}
+
+func TestPolicySignerConcurrentOutflow(t *testing.T) {
+	inspector := fakeInspector{}
+	for _, txid := range []string{"a", "b", "c", "d"} {
+		inspector[txid] = PsbtInspection{Txid: txid, FeeSat: 40}
+	}
+	policy := &PsbtPolicy{MaxOutflow: 100, OutflowPeriod: time.Hour, Outflow: NewOutflowTracker()}
+	signer := NewPolicySigner(inspector, policy, fakeSigner{})
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	signed := 0
+	for txid := range inspector {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := signer.SignPsbt(context.Background(), txid)
+			var policyErr *PolicyError
+			switch {
+			case err == nil:
+				mu.Lock()
+				signed++
+				mu.Unlock()
+			case !errors.As(err, &policyErr):
+				t.Errorf("SignPsbt(%s): %v", txid, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if signed != 2 {
+		t.Fatalf("signed %d PSBTs, want 2", signed)
+	}
+	if got := policy.Outflow.Total(time.Hour); got != 80 {
+		t.Fatalf("Total = %d, want 80", got)
+	}
+}
+
+func TestPolicySignerReleasesOnFailure(t *testing.T) {
+	inspector := fakeInspector{"a": {Txid: "a", FeeSat: 40}}
+	policy := &PsbtPolicy{MaxOutflow: 100, OutflowPeriod: time.Hour, Outflow: NewOutflowTracker()}
+	errSign := errors.New("sign failed")
+	if _, err := NewPolicySigner(inspector, policy, fakeSigner{errSign}).SignPsbt(context.Background(), "a"); !errors.Is(err, errSign) {
+		t.Fatalf("SignPsbt = %v, want %v", err, errSign)
+	}
+	if got := policy.Outflow.Total(time.Hour); got != 0 {
+		t.Fatalf("Total after failed sign = %d, want 0", got)
+	}
+
+	policy.MaxFeeSat = 10
+	if _, err := NewPolicySigner(inspector, policy, fakeSigner{}).SignPsbt(context.Background(), "a"); err == nil {
+		t.Fatal("SignPsbt breaking MaxFeeSat succeeded")
+	}
+	if got := policy.Outflow.Total(time.Hour); got != 0 {
+		t.Fatalf("Total after rejection = %d, want 0", got)
+	}
+}
@@ -0,0 +1,49 @@
+package rgb_lib
+
+import (
+	"fmt"
+	"image"
+
+	"github.com/UTEXO-Protocol/rgb-lib-go/qr"
+)
+
+// InvoiceQR encodes the invoice of a BlindReceive or WitnessReceive call as a
+// QR code, at medium error correction or higher when it fits the same size.
+// Render it with the Image, PNG, SVG or Terminal methods of qr.Code.
+func InvoiceQR(data ReceiveData) (*qr.Code, error) {
+	return qr.EncodeString(data.Invoice, qr.Medium)
+}
+
+// CosignerQR encodes the cosigner string of a multisig participant as a QR
+// code. Cosigner strings are long, so low error correction is the starting
+// point to keep the code scannable.
+func CosignerQR(cosigner *Cosigner) (*qr.Code, error) {
+	return qr.EncodeString(cosigner.CosignerString(), qr.Low)
+}
+
+// DecodeInvoiceQR scans an image for a QR code and parses it as an invoice.
+func DecodeInvoiceQR(img image.Image) (*Invoice, error) {
+	s, err := qr.DecodeString(img)
+	if err != nil {
+		return nil, err
+	}
+	invoice, err := NewInvoice(s)
+	if err != nil {
+		return nil, fmt.Errorf("QR code is not an invoice: %w", err)
+	}
+	return invoice, nil
+}
+
+// DecodeCosignerQR scans an image for a QR code and parses it as a cosigner
+// string.
+func DecodeCosignerQR(img image.Image) (*Cosigner, error) {
+	s, err := qr.DecodeString(img)
+	if err != nil {
+		return nil, err
+	}
+	cosigner, err := NewCosigner(s)
+	if err != nil {
+		return nil, fmt.Errorf("QR code is not a cosigner string: %w", err)
+	}
+	return cosigner, nil
+}
@@ -0,0 +1,558 @@
+package qr
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"math"
+	"slices"
+	"strings"
+)
+
+var ErrNotFound = errors.New("no QR code found")
+
+// bitmap is a binarized image.
+type bitmap struct {
+	w, h int
+	dark []bool
+}
+
+func (b *bitmap) at(x, y int) bool {
+	return x >= 0 && y >= 0 && x < b.w && y < b.h && b.dark[y*b.w+x]
+}
+
+func (b *bitmap) inverted() *bitmap {
+	inv := &bitmap{w: b.w, h: b.h, dark: make([]bool, len(b.dark))}
+	for i, d := range b.dark {
+		inv.dark[i] = !d
+	}
+	return inv
+}
+
+// binarize thresholds the luminance of img with Otsu's method.
+func binarize(img image.Image) *bitmap {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	lum := make([]uint8, w*h)
+	var hist [256]int
+	for y := range h {
+		for x := range w {
+			r, g, b, a := img.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+			// transparent pixels are light
+			l := (299*r + 587*g + 114*b + 1000*(0xffff-a)) / 1000 >> 8
+			lum[y*w+x] = uint8(min(l, 255))
+			hist[lum[y*w+x]]++
+		}
+	}
+	total := w * h
+	var sum float64
+	for i, n := range hist {
+		sum += float64(i * n)
+	}
+	var sumBack float64
+	var back int
+	threshold, best := 127, -1.0
+	for t := range 256 {
+		back += hist[t]
+		if back == 0 {
+			continue
+		}
+		fore := total - back
+		if fore == 0 {
+			break
+		}
+		sumBack += float64(t * hist[t])
+		meanBack, meanFore := sumBack/float64(back), (sum-sumBack)/float64(fore)
+		if v := float64(back) * float64(fore) * (meanBack - meanFore) * (meanBack - meanFore); v > best {
+			threshold, best = t, v
+		}
+	}
+	bm := &bitmap{w: w, h: h, dark: make([]bool, w*h)}
+	for i, l := range lum {
+		bm.dark[i] = int(l) <= threshold
+	}
+	return bm
+}
+
+type point struct{ x, y float64 }
+
+func (p point) sub(q point) point     { return point{p.x - q.x, p.y - q.y} }
+func (p point) add(q point) point     { return point{p.x + q.x, p.y + q.y} }
+func (p point) scale(k float64) point { return point{p.x * k, p.y * k} }
+func (p point) dist(q point) float64  { return math.Hypot(p.x-q.x, p.y-q.y) }
+func (p point) cross(q point) float64 { return p.x*q.y - p.y*q.x }
+
+// ratioOK checks the 1:1:3:1:1 proportions of a finder pattern and returns
+// the module size.
+func ratioOK(counts [5]int) (float64, bool) {
+	total := 0
+	for _, c := range counts {
+		if c == 0 {
+			return 0, false
+		}
+		total += c
+	}
+	if total < 7 {
+		return 0, false
+	}
+	module := float64(total) / 7
+	tolerance := module / 2
+	for i, c := range counts {
+		want := module
+		if i == 2 {
+			want, tolerance = 3*module, 3*tolerance
+		}
+		if math.Abs(float64(c)-want) >= tolerance {
+			return 0, false
+		}
+		tolerance = module / 2
+	}
+	return module, true
+}
+
+// crossCheck measures the 1:1:3:1:1 runs through (x, y) along (dx, dy). It
+// returns the center of the middle run on that line and the module size.
+func (b *bitmap) crossCheck(x, y, dx, dy int) (float64, float64, bool) {
+	if !b.at(x, y) {
+		return 0, 0, false
+	}
+	var counts [5]int
+	// backwards: center, light ring, outer dark ring
+	i := 0
+	for state := 2; state >= 0; state-- {
+		dark := state != 1
+		for {
+			px, py := x-dx*i, y-dy*i
+			if px < 0 || py < 0 || px >= b.w || py >= b.h || b.at(px, py) != dark {
+				break
+			}
+			counts[state]++
+			i++
+		}
+	}
+	start := -(counts[2] - 1)
+	i = 1
+	for state := 2; state <= 4; state++ {
+		dark := state != 3
+		for {
+			px, py := x+dx*i, y+dy*i
+			if px < 0 || py < 0 || px >= b.w || py >= b.h || b.at(px, py) != dark {
+				break
+			}
+			counts[state]++
+			i++
+		}
+	}
+	module, ok := ratioOK(counts)
+	if !ok {
+		return 0, 0, false
+	}
+	center := float64(start) + float64(counts[2])/2
+	pos := float64(x)
+	if dy != 0 {
+		pos = float64(y)
+	}
+	return pos + center, module, true
+}
+
+type finder struct {
+	center point
+	module float64
+	count  int
+}
+
+// findFinders scans rows for the 1:1:3:1:1 pattern of the finder patterns and
+// confirms each hit vertically and horizontally.
+func (b *bitmap) findFinders() []finder {
+	var finders []finder
+	for y := range b.h {
+		type run struct {
+			dark  bool
+			start int
+			n     int
+		}
+		var runs []run
+		for x := range b.w {
+			d := b.at(x, y)
+			if len(runs) > 0 && runs[len(runs)-1].dark == d {
+				runs[len(runs)-1].n++
+			} else {
+				runs = append(runs, run{d, x, 1})
+			}
+		}
+		for i := 0; i+5 <= len(runs); i++ {
+			if !runs[i].dark {
+				continue
+			}
+			counts := [5]int{runs[i].n, runs[i+1].n, runs[i+2].n, runs[i+3].n, runs[i+4].n}
+			if _, ok := ratioOK(counts); !ok {
+				continue
+			}
+			cx := runs[i+2].start + runs[i+2].n/2
+			cy, vModule, ok := b.crossCheck(cx, y, 0, 1)
+			if !ok {
+				continue
+			}
+			fx, hModule, ok := b.crossCheck(cx, int(cy), 1, 0)
+			if !ok {
+				continue
+			}
+			f := finder{center: point{fx, cy}, module: (vModule + hModule) / 2, count: 1}
+			merged := false
+			for k := range finders {
+				e := &finders[k]
+				if e.center.dist(f.center) <= e.module*2 && f.module > e.module/2 && f.module < e.module*2 {
+					n := float64(e.count)
+					e.center = e.center.scale(n).add(f.center).scale(1 / (n + 1))
+					e.module = (e.module*n + f.module) / (n + 1)
+					e.count++
+					merged = true
+					break
+				}
+			}
+			if !merged {
+				finders = append(finders, f)
+			}
+		}
+	}
+	return finders
+}
+
+// locate picks the three finders most likely to form a code and returns them
+// as top-left, top-right and bottom-left.
+func locate(finders []finder) (tl, tr, bl finder, ok bool) {
+	slices.SortFunc(finders, func(a, b finder) int { return b.count - a.count })
+	if len(finders) > 12 {
+		finders = finders[:12]
+	}
+	best := math.Inf(1)
+	for i := range finders {
+		for j := i + 1; j < len(finders); j++ {
+			for k := j + 1; k < len(finders); k++ {
+				a, b, c := finders[i], finders[j], finders[k]
+				// make a the right-angle corner, opposite the longest side
+				switch {
+				case b.center.dist(c.center) >= a.center.dist(b.center) && b.center.dist(c.center) >= a.center.dist(c.center):
+				case a.center.dist(c.center) >= a.center.dist(b.center):
+					a, b = b, a
+				default:
+					a, c = c, a
+				}
+				d1, d2, hyp := a.center.dist(b.center), a.center.dist(c.center), b.center.dist(c.center)
+				modules := []float64{a.module, b.module, c.module}
+				spread := (slices.Max(modules) - slices.Min(modules)) / slices.Max(modules)
+				score := math.Abs(d1-d2)/max(d1, d2) + math.Abs(hyp*hyp-d1*d1-d2*d2)/(hyp*hyp) + spread
+				if d1 < 7*a.module || score > 0.6 || score >= best {
+					continue
+				}
+				if b.center.sub(a.center).cross(c.center.sub(a.center)) < 0 {
+					b, c = c, b
+				}
+				best, tl, tr, bl, ok = score, a, b, c, true
+			}
+		}
+	}
+	return tl, tr, bl, ok
+}
+
+// sample reads the modules of a size x size symbol through the affine
+// transform given by the finder centers.
+func (b *bitmap) sample(tl, tr, bl point, size int) [][]bool {
+	ex := tr.sub(tl).scale(1 / float64(size-7))
+	ey := bl.sub(tl).scale(1 / float64(size-7))
+	m := make([][]bool, size)
+	for y := range size {
+		m[y] = make([]bool, size)
+		for x := range size {
+			p := tl.add(ex.scale(float64(x) - 3)).add(ey.scale(float64(y) - 3))
+			m[y][x] = b.at(int(math.Floor(p.x)), int(math.Floor(p.y)))
+		}
+	}
+	return m
+}
+
+func hamming(a, b int) int {
+	n := 0
+	for x := a ^ b; x != 0; x &= x - 1 {
+		n++
+	}
+	return n
+}
+
+func readFormat(m [][]bool) (Level, int, bool) {
+	first, second := formatPositions(len(m))
+	for _, positions := range [][15][2]int{first, second} {
+		bits := 0
+		for i, p := range positions {
+			if m[p[1]][p[0]] {
+				bits |= 1 << i
+			}
+		}
+		bestLevel, bestMask, bestDist := Low, 0, 16
+		for level := Low; level <= High; level++ {
+			for mask := range 8 {
+				if d := hamming(bits, formatBits(level, mask)); d < bestDist {
+					bestLevel, bestMask, bestDist = level, mask, d
+				}
+			}
+		}
+		if bestDist <= 3 {
+			return bestLevel, bestMask, true
+		}
+	}
+	return 0, 0, false
+}
+
+// readVersion decodes the version information of symbols of version 7 and
+// above. It returns 0 when neither copy can be read.
+func readVersion(m [][]bool) int {
+	size := len(m)
+	for copyIdx := range 2 {
+		bits := 0
+		for i := range 18 {
+			a, b := size-11+i%3, i/3
+			x, y := a, b
+			if copyIdx == 1 {
+				x, y = b, a
+			}
+			if m[y][x] {
+				bits |= 1 << i
+			}
+		}
+		for v := 7; v <= MaxVersion; v++ {
+			if hamming(bits, versionBits(v)) <= 3 {
+				return v
+			}
+		}
+	}
+	return 0
+}
+
+// readCodewords unmasks the symbol, reads its codewords and corrects each
+// block, returning the data codewords.
+func readCodewords(m [][]bool, version int, level Level, mask int) ([]byte, error) {
+	g := newGrid(version)
+	raw := make([]byte, totalCodewords(version))
+	for i, p := range g.dataPositions() {
+		if i/8 >= len(raw) {
+			break
+		}
+		x, y := p[0], p[1]
+		if m[y][x] != masked(mask, x, y) {
+			raw[i/8] |= 0x80 >> (i % 8)
+		}
+	}
+
+	blocks, short, shortData, ecc := blockLayout(version, level)
+	dataLen := func(b int) int {
+		if b >= short {
+			return shortData + 1
+		}
+		return shortData
+	}
+	parts := make([][]byte, blocks)
+	for b := range parts {
+		parts[b] = make([]byte, dataLen(b)+ecc)
+	}
+	k := 0
+	for i := 0; i <= shortData; i++ {
+		for b := range parts {
+			if i < dataLen(b) {
+				parts[b][i] = raw[k]
+				k++
+			}
+		}
+	}
+	for i := range ecc {
+		for b := range parts {
+			parts[b][dataLen(b)+i] = raw[k]
+			k++
+		}
+	}
+	var data []byte
+	for b, part := range parts {
+		if _, err := rsCorrect(part, ecc); err != nil {
+			return nil, fmt.Errorf("block %d: %w", b, err)
+		}
+		data = append(data, part[:dataLen(b)]...)
+	}
+	return data, nil
+}
+
+type bitReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *bitReader) remaining() int {
+	return len(r.data)*8 - r.pos
+}
+
+func (r *bitReader) read(n int) (int, error) {
+	if n > r.remaining() {
+		return 0, errors.New("truncated segment")
+	}
+	v := 0
+	for range n {
+		v = v<<1 | int(r.data[r.pos/8]>>(7-r.pos%8)&1)
+		r.pos++
+	}
+	return v, nil
+}
+
+// parseSegments decodes the numeric, alphanumeric and byte segments of the
+// data codewords. ECI designators and structured append headers are skipped.
+func parseSegments(data []byte, version int) ([]byte, error) {
+	r := &bitReader{data: data}
+	var out []byte
+	for r.remaining() >= 4 {
+		indicator, _ := r.read(4)
+		var m mode
+		switch indicator {
+		case 0x0:
+			return out, nil
+		case modeNumeric.indicator:
+			m = modeNumeric
+		case modeAlphanumeric.indicator:
+			m = modeAlphanumeric
+		case modeByte.indicator:
+			m = modeByte
+		case 0x7: // ECI
+			first, err := r.read(8)
+			if err != nil {
+				return nil, err
+			}
+			switch {
+			case first&0x80 == 0:
+			case first&0xc0 == 0x80:
+				_, err = r.read(8)
+			default:
+				_, err = r.read(16)
+			}
+			if err != nil {
+				return nil, err
+			}
+			continue
+		case 0x3: // structured append
+			if _, err := r.read(16); err != nil {
+				return nil, err
+			}
+			continue
+		default:
+			return nil, fmt.Errorf("unsupported segment mode %d", indicator)
+		}
+		count, err := r.read(m.charCountBits(version))
+		if err != nil {
+			return nil, err
+		}
+		switch m {
+		case modeNumeric:
+			for count > 0 {
+				digits := min(count, 3)
+				v, err := r.read(digits*3 + 1)
+				if err != nil {
+					return nil, err
+				}
+				out = fmt.Appendf(out, "%0*d", digits, v)
+				count -= digits
+			}
+		case modeAlphanumeric:
+			for count > 0 {
+				if count == 1 {
+					v, err := r.read(6)
+					if err != nil || v >= 45 {
+						return nil, errors.New("invalid alphanumeric segment")
+					}
+					out = append(out, alphanumericChars[v])
+					break
+				}
+				v, err := r.read(11)
+				if err != nil || v >= 45*45 {
+					return nil, errors.New("invalid alphanumeric segment")
+				}
+				out = append(out, alphanumericChars[v/45], alphanumericChars[v%45])
+				count -= 2
+			}
+		default:
+			for range count {
+				v, err := r.read(8)
+				if err != nil {
+					return nil, err
+				}
+				out = append(out, byte(v))
+			}
+		}
+	}
+	return out, nil
+}
+
+// decodeMatrix decodes a sampled symbol.
+func decodeMatrix(m [][]bool) ([]byte, error) {
+	version := (len(m) - 17) / 4
+	level, mask, ok := readFormat(m)
+	if !ok {
+		return nil, errors.New("unreadable format information")
+	}
+	data, err := readCodewords(m, version, level, mask)
+	if err != nil {
+		return nil, err
+	}
+	return parseSegments(data, version)
+}
+
+func (b *bitmap) decode() ([]byte, error) {
+	tl, tr, bl, ok := locate(b.findFinders())
+	if !ok {
+		return nil, ErrNotFound
+	}
+	module := (tl.module + tr.module + bl.module) / 3
+	estimate := (tl.center.dist(tr.center)+tl.center.dist(bl.center))/2/module + 7
+	version := int(math.Round((estimate - 17) / 4))
+
+	var candidates []int
+	for _, v := range []int{version, version + 1, version - 1} {
+		if v >= MinVersion && v <= MaxVersion {
+			candidates = append(candidates, v)
+		}
+	}
+	var lastErr error
+	for _, v := range candidates {
+		m := b.sample(tl.center, tr.center, bl.center, v*4+17)
+		if v >= 7 {
+			if read := readVersion(m); read != 0 && read != v {
+				v = read
+				m = b.sample(tl.center, tr.center, bl.center, v*4+17)
+			}
+		}
+		data, err := decodeMatrix(m)
+		if err == nil {
+			return data, nil
+		}
+		lastErr = err
+	}
+	return nil, fmt.Errorf("%w: %v", ErrNotFound, lastErr)
+}
+
+// Decode finds and decodes the QR code in img. Light-on-dark codes are tried
+// when no dark-on-light code is found.
+func Decode(img image.Image) ([]byte, error) {
+	bm := binarize(img)
+	data, err := bm.decode()
+	if err == nil {
+		return data, nil
+	}
+	if data, invErr := bm.inverted().decode(); invErr == nil {
+		return data, nil
+	}
+	return nil, err
+}
+
+// DecodeString decodes the QR code in img as text, trimming surrounding
+// whitespace.
+func DecodeString(img image.Image) (string, error) {
+	data, err := Decode(img)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
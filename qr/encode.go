@@ -0,0 +1,571 @@
+// Package qr encodes and decodes QR codes (ISO/IEC 18004, model 2) in pure
+// Go, so invoices and cosigner strings can be shown and scanned offline. The
+// encoder supports every version and error correction level; the decoder reads
+// upright or rotated, non-skewed images such as screenshots, rendered codes
+// and straight-on scans.
+package qr
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Level is an error correction level. Higher levels recover from more damage
+// at the cost of a larger code.
+type Level uint8
+
+const (
+	Low      Level = iota // recovers about 7% of the codewords
+	Medium                // about 15%
+	Quartile              // about 25%
+	High                  // about 30%
+)
+
+func (l Level) String() string {
+	switch l {
+	case Low:
+		return "L"
+	case Medium:
+		return "M"
+	case Quartile:
+		return "Q"
+	case High:
+		return "H"
+	default:
+		return fmt.Sprintf("Level(%d)", uint8(l))
+	}
+}
+
+// formatBits returns the two bits identifying the level in the format
+// information.
+func (l Level) formatBits() int {
+	return [...]int{1, 0, 3, 2}[l]
+}
+
+const (
+	MinVersion = 1
+	MaxVersion = 40
+)
+
+var ErrTooLong = errors.New("data too long for a QR code")
+
+// eccCodewordsPerBlock and numEccBlocks are indexed by level and version.
+var eccCodewordsPerBlock = [4][41]int{
+	{-1, 7, 10, 15, 20, 26, 18, 20, 24, 30, 18, 20, 24, 26, 30, 22, 24, 28, 30, 28, 28, 28, 28, 30, 30, 26, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+	{-1, 10, 16, 26, 18, 24, 16, 18, 22, 22, 26, 30, 22, 22, 24, 24, 28, 28, 26, 26, 26, 26, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28},
+	{-1, 13, 22, 18, 26, 18, 24, 18, 22, 20, 24, 28, 26, 24, 20, 30, 24, 28, 28, 26, 30, 28, 30, 30, 30, 30, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+	{-1, 17, 28, 22, 16, 22, 28, 26, 26, 24, 28, 24, 28, 22, 24, 24, 30, 28, 28, 26, 28, 30, 24, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+}
+
+var numEccBlocks = [4][41]int{
+	{-1, 1, 1, 1, 1, 1, 2, 2, 2, 2, 4, 4, 4, 4, 4, 6, 6, 6, 6, 7, 8, 8, 9, 9, 10, 12, 12, 12, 13, 14, 15, 16, 17, 18, 19, 19, 20, 21, 22, 24, 25},
+	{-1, 1, 1, 1, 2, 2, 4, 4, 4, 5, 5, 5, 8, 9, 9, 10, 10, 11, 13, 14, 16, 17, 17, 18, 20, 21, 23, 25, 26, 28, 29, 31, 33, 35, 37, 38, 40, 43, 45, 47, 49},
+	{-1, 1, 1, 2, 2, 4, 4, 6, 6, 8, 8, 8, 10, 12, 16, 12, 17, 16, 18, 21, 20, 23, 23, 25, 27, 29, 34, 34, 35, 38, 40, 43, 45, 48, 51, 53, 56, 59, 62, 65, 68},
+	{-1, 1, 1, 2, 4, 4, 4, 5, 6, 8, 8, 11, 11, 16, 16, 18, 16, 19, 21, 25, 25, 25, 34, 30, 32, 35, 37, 40, 42, 45, 48, 51, 54, 57, 60, 63, 66, 70, 74, 77, 81},
+}
+
+// rawDataModules returns the number of modules available for codewords,
+// i.e. not used by function patterns, format or version information.
+func rawDataModules(version int) int {
+	result := (16*version+128)*version + 64
+	if version >= 2 {
+		numAlign := version/7 + 2
+		result -= (25*numAlign-10)*numAlign - 55
+		if version >= 7 {
+			result -= 36
+		}
+	}
+	return result
+}
+
+func totalCodewords(version int) int {
+	return rawDataModules(version) / 8
+}
+
+func dataCodewords(version int, level Level) int {
+	return totalCodewords(version) - eccCodewordsPerBlock[level][version]*numEccBlocks[level][version]
+}
+
+// alignmentPositions returns the row and column coordinates of the alignment
+// pattern centers.
+func alignmentPositions(version int) []int {
+	if version == 1 {
+		return nil
+	}
+	numAlign := version/7 + 2
+	step := (version*8 + numAlign*3 + 5) / (numAlign*4 - 4) * 2
+	pos := make([]int, numAlign)
+	pos[0] = 6
+	for i, p := numAlign-1, 4*version+10; i >= 1; i, p = i-1, p-step {
+		pos[i] = p
+	}
+	return pos
+}
+
+// Code is a QR code symbol. Modules are indexed by row, then column; true is
+// dark.
+type Code struct {
+	Version int
+	Level   Level
+	Mask    int
+	Size    int
+	modules [][]bool
+}
+
+// Dark reports whether the module at column x, row y is dark. Modules outside
+// the symbol are light.
+func (c *Code) Dark(x, y int) bool {
+	return x >= 0 && y >= 0 && x < c.Size && y < c.Size && c.modules[y][x]
+}
+
+// grid holds the modules of a symbol being built, together with the function
+// modules that masking and codeword placement skip.
+type grid struct {
+	size     int
+	modules  [][]bool
+	function [][]bool
+}
+
+func newGrid(version int) *grid {
+	size := version*4 + 17
+	g := &grid{size: size, modules: make([][]bool, size), function: make([][]bool, size)}
+	for i := range size {
+		g.modules[i] = make([]bool, size)
+		g.function[i] = make([]bool, size)
+	}
+	g.drawFunctionPatterns(version)
+	return g
+}
+
+func (g *grid) setFunction(x, y int, dark bool) {
+	g.modules[y][x] = dark
+	g.function[y][x] = true
+}
+
+func (g *grid) drawFunctionPatterns(version int) {
+	for i := range g.size {
+		g.setFunction(6, i, i%2 == 0)
+		g.setFunction(i, 6, i%2 == 0)
+	}
+	for _, c := range [][2]int{{3, 3}, {g.size - 4, 3}, {3, g.size - 4}} {
+		for dy := -4; dy <= 4; dy++ {
+			for dx := -4; dx <= 4; dx++ {
+				x, y := c[0]+dx, c[1]+dy
+				if x >= 0 && x < g.size && y >= 0 && y < g.size {
+					dist := max(abs(dx), abs(dy))
+					g.setFunction(x, y, dist != 2 && dist != 4)
+				}
+			}
+		}
+	}
+	pos := alignmentPositions(version)
+	for i, cy := range pos {
+		for j, cx := range pos {
+			if (i == 0 && j == 0) || (i == 0 && j == len(pos)-1) || (i == len(pos)-1 && j == 0) {
+				continue // finder patterns
+			}
+			for dy := -2; dy <= 2; dy++ {
+				for dx := -2; dx <= 2; dx++ {
+					g.setFunction(cx+dx, cy+dy, max(abs(dx), abs(dy)) != 1)
+				}
+			}
+		}
+	}
+	// reserve the format information, drawn once the mask is chosen
+	g.drawFormatBits(0)
+	if version >= 7 {
+		bits := versionBits(version)
+		for i := range 18 {
+			dark := (bits>>i)&1 != 0
+			a, b := g.size-11+i%3, i/3
+			g.setFunction(a, b, dark)
+			g.setFunction(b, a, dark)
+		}
+	}
+}
+
+// formatBits returns the 15-bit format information of a level and mask.
+func formatBits(level Level, mask int) int {
+	data := level.formatBits()<<3 | mask
+	rem := data
+	for range 10 {
+		rem = rem<<1 ^ (rem>>9)*0x537
+	}
+	return (data<<10 | rem) ^ 0x5412
+}
+
+// versionBits returns the 18-bit version information.
+func versionBits(version int) int {
+	rem := version
+	for range 12 {
+		rem = rem<<1 ^ (rem>>11)*0x1f25
+	}
+	return version<<12 | rem
+}
+
+// formatPositions returns the module coordinates, as (x, y), of the two
+// copies of each format information bit, from bit 0 to bit 14.
+func formatPositions(size int) (first, second [15][2]int) {
+	for i := range 15 {
+		switch {
+		case i < 6:
+			first[i] = [2]int{8, i}
+		case i < 8:
+			first[i] = [2]int{8, i + 1}
+		case i == 8:
+			first[i] = [2]int{7, 8}
+		default:
+			first[i] = [2]int{14 - i, 8}
+		}
+		if i < 8 {
+			second[i] = [2]int{size - 1 - i, 8}
+		} else {
+			second[i] = [2]int{8, size - 15 + i}
+		}
+	}
+	return first, second
+}
+
+func (g *grid) drawFormatBits(bits int) {
+	first, second := formatPositions(g.size)
+	for i := range 15 {
+		dark := (bits>>i)&1 != 0
+		g.setFunction(first[i][0], first[i][1], dark)
+		g.setFunction(second[i][0], second[i][1], dark)
+	}
+	g.setFunction(8, g.size-8, true)
+}
+
+// dataPositions returns the coordinates, as (x, y), of the modules holding
+// codeword bits, in placement order.
+func (g *grid) dataPositions() [][2]int {
+	var positions [][2]int
+	for right := g.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		upward := (right+1)&2 == 0
+		for vert := range g.size {
+			y := vert
+			if upward {
+				y = g.size - 1 - vert
+			}
+			for j := range 2 {
+				if x := right - j; !g.function[y][x] {
+					positions = append(positions, [2]int{x, y})
+				}
+			}
+		}
+	}
+	return positions
+}
+
+func masked(mask, x, y int) bool {
+	switch mask {
+	case 0:
+		return (x+y)%2 == 0
+	case 1:
+		return y%2 == 0
+	case 2:
+		return x%3 == 0
+	case 3:
+		return (x+y)%3 == 0
+	case 4:
+		return (x/3+y/2)%2 == 0
+	case 5:
+		return x*y%2+x*y%3 == 0
+	case 6:
+		return (x*y%2+x*y%3)%2 == 0
+	default:
+		return ((x+y)%2+x*y%3)%2 == 0
+	}
+}
+
+func (g *grid) applyMask(mask int) {
+	for y := range g.size {
+		for x := range g.size {
+			if !g.function[y][x] && masked(mask, x, y) {
+				g.modules[y][x] = !g.modules[y][x]
+			}
+		}
+	}
+}
+
+// penalty scores the grid with the four rules of the standard; the mask with
+// the lowest score is used.
+func (g *grid) penalty() int {
+	score := 0
+	line := func(get func(i int) bool) {
+		run := 1
+		for i := 1; i <= g.size; i++ {
+			if i < g.size && get(i) == get(i-1) {
+				run++
+				continue
+			}
+			if run >= 5 {
+				score += run - 2
+			}
+			run = 1
+		}
+		// 1:1:3:1:1 finder-like patterns with four light modules on a side
+		pattern := []bool{true, false, true, true, true, false, true}
+		for i := 0; i+7 <= g.size; i++ {
+			match := true
+			for k, dark := range pattern {
+				if get(i+k) != dark {
+					match = false
+					break
+				}
+			}
+			if !match {
+				continue
+			}
+			lightBefore, lightAfter := true, true
+			for k := 1; k <= 4; k++ {
+				if i-k >= 0 && get(i-k) {
+					lightBefore = false
+				}
+				if i+6+k < g.size && get(i+6+k) {
+					lightAfter = false
+				}
+			}
+			if lightBefore || lightAfter {
+				score += 40
+			}
+		}
+	}
+	dark := 0
+	for y := range g.size {
+		line(func(i int) bool { return g.modules[y][i] })
+		line(func(i int) bool { return g.modules[i][y] })
+		for x := range g.size {
+			if g.modules[y][x] {
+				dark++
+			}
+			if x > 0 && y > 0 {
+				c := g.modules[y][x]
+				if c == g.modules[y-1][x] && c == g.modules[y][x-1] && c == g.modules[y-1][x-1] {
+					score += 3
+				}
+			}
+		}
+	}
+	total := g.size * g.size
+	k := (abs(dark*20-total*10)+total-1)/total - 1
+	return score + max(k, 0)*10
+}
+
+// mode is a segment encoding mode.
+type mode struct {
+	indicator int
+	countBits [3]int // for versions 1-9, 10-26 and 27-40
+}
+
+var (
+	modeNumeric      = mode{0x1, [3]int{10, 12, 14}}
+	modeAlphanumeric = mode{0x2, [3]int{9, 11, 13}}
+	modeByte         = mode{0x4, [3]int{8, 16, 16}}
+)
+
+func (m mode) charCountBits(version int) int {
+	switch {
+	case version <= 9:
+		return m.countBits[0]
+	case version <= 26:
+		return m.countBits[1]
+	default:
+		return m.countBits[2]
+	}
+}
+
+const alphanumericChars = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ $%*+-./:"
+
+func chooseMode(data []byte) mode {
+	numeric, alphanumeric := true, true
+	for _, b := range data {
+		if b < '0' || b > '9' {
+			numeric = false
+		}
+		if strings.IndexByte(alphanumericChars, b) < 0 {
+			alphanumeric = false
+		}
+	}
+	switch {
+	case numeric:
+		return modeNumeric
+	case alphanumeric:
+		return modeAlphanumeric
+	default:
+		return modeByte
+	}
+}
+
+// dataBits returns the number of bits of data in m, without the header.
+func (m mode) dataBits(n int) int {
+	switch m {
+	case modeNumeric:
+		return n/3*10 + [3]int{0, 4, 7}[n%3]
+	case modeAlphanumeric:
+		return n/2*11 + n%2*6
+	default:
+		return n * 8
+	}
+}
+
+type bitBuffer struct {
+	data []byte
+	n    int
+}
+
+func (b *bitBuffer) append(value, bits int) {
+	for i := bits - 1; i >= 0; i-- {
+		if b.n%8 == 0 {
+			b.data = append(b.data, 0)
+		}
+		if (value>>i)&1 != 0 {
+			b.data[b.n/8] |= 0x80 >> (b.n % 8)
+		}
+		b.n++
+	}
+}
+
+func (b *bitBuffer) appendSegment(m mode, version int, data []byte) {
+	b.append(m.indicator, 4)
+	b.append(len(data), m.charCountBits(version))
+	switch m {
+	case modeNumeric:
+		for i := 0; i < len(data); i += 3 {
+			chunk := data[i:min(i+3, len(data))]
+			value := 0
+			for _, c := range chunk {
+				value = value*10 + int(c-'0')
+			}
+			b.append(value, len(chunk)*3+1)
+		}
+	case modeAlphanumeric:
+		for i := 0; i < len(data); i += 2 {
+			value := strings.IndexByte(alphanumericChars, data[i])
+			if i+1 < len(data) {
+				b.append(value*45+strings.IndexByte(alphanumericChars, data[i+1]), 11)
+			} else {
+				b.append(value, 6)
+			}
+		}
+	default:
+		for _, c := range data {
+			b.append(int(c), 8)
+		}
+	}
+}
+
+// Encode encodes data in the smallest symbol with at least the given error
+// correction level. The level is raised when that fits in the same version.
+// Digits-only and uppercase alphanumeric data use the compact numeric and
+// alphanumeric modes.
+func Encode(data []byte, level Level) (*Code, error) {
+	if level > High {
+		return nil, fmt.Errorf("invalid level %d", level)
+	}
+	m := chooseMode(data)
+	version := 0
+	for v := MinVersion; v <= MaxVersion; v++ {
+		if len(data) < 1<<m.charCountBits(v) && 4+m.charCountBits(v)+m.dataBits(len(data)) <= dataCodewords(v, level)*8 {
+			version = v
+			break
+		}
+	}
+	if version == 0 {
+		return nil, fmt.Errorf("%w: %d bytes at level %s", ErrTooLong, len(data), level)
+	}
+	used := 4 + m.charCountBits(version) + m.dataBits(len(data))
+	for level < High && used <= dataCodewords(version, level+1)*8 {
+		level++
+	}
+
+	capacity := dataCodewords(version, level) * 8
+	var b bitBuffer
+	b.appendSegment(m, version, data)
+	b.append(0, min(4, capacity-b.n))
+	b.append(0, (8-b.n%8)%8)
+	for pad := 0xec; b.n < capacity; pad ^= 0xec ^ 0x11 {
+		b.append(pad, 8)
+	}
+
+	g := newGrid(version)
+	codewords := addEcc(b.data, version, level)
+	positions := g.dataPositions()
+	for i, p := range positions {
+		if i/8 < len(codewords) {
+			g.modules[p[1]][p[0]] = (codewords[i/8]>>(7-i%8))&1 != 0
+		}
+	}
+
+	best, bestPenalty := 0, -1
+	for mask := range 8 {
+		g.applyMask(mask)
+		g.drawFormatBits(formatBits(level, mask))
+		if p := g.penalty(); bestPenalty < 0 || p < bestPenalty {
+			best, bestPenalty = mask, p
+		}
+		g.applyMask(mask)
+	}
+	g.applyMask(best)
+	g.drawFormatBits(formatBits(level, best))
+	return &Code{Version: version, Level: level, Mask: best, Size: g.size, modules: g.modules}, nil
+}
+
+// EncodeString encodes s as a QR code.
+func EncodeString(s string, level Level) (*Code, error) {
+	return Encode([]byte(s), level)
+}
+
+// blockLayout returns the number of blocks, the number of short blocks and
+// the data length of short blocks for a version and level. Long blocks hold
+// one more data codeword.
+func blockLayout(version int, level Level) (blocks, short, shortData, ecc int) {
+	blocks = numEccBlocks[level][version]
+	ecc = eccCodewordsPerBlock[level][version]
+	raw := totalCodewords(version)
+	short = blocks - raw%blocks
+	return blocks, short, raw/blocks - ecc, ecc
+}
+
+// addEcc splits the data codewords in blocks, appends their error correction
+// codewords and interleaves the result.
+func addEcc(data []byte, version int, level Level) []byte {
+	blocks, short, shortData, ecc := blockLayout(version, level)
+	divisor := rsDivisor(ecc)
+	var dataBlocks, eccBlocks [][]byte
+	for i, k := 0, 0; i < blocks; i++ {
+		n := shortData
+		if i >= short {
+			n++
+		}
+		block := data[k : k+n]
+		k += n
+		dataBlocks = append(dataBlocks, block)
+		eccBlocks = append(eccBlocks, rsRemainder(block, divisor))
+	}
+	var result []byte
+	for i := 0; i <= shortData; i++ {
+		for _, block := range dataBlocks {
+			if i < len(block) {
+				result = append(result, block[i])
+			}
+		}
+	}
+	for i := range ecc {
+		for _, block := range eccBlocks {
+			result = append(result, block[i])
+		}
+	}
+	return result
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,115 @@
+package qr
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+// maxBytes returns the longest byte-mode payload that fits version at level.
+func maxBytes(version int, level Level) int {
+	return (dataCodewords(version, level)*8 - 4 - modeByte.charCountBits(version)) / 8
+}
+
+func payload(n int, seed int) []byte {
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = byte(i*31 + seed)
+	}
+	return data
+}
+
+func TestRoundTripVersionsAndLevels(t *testing.T) {
+	versions := []int{1, 2, 5, 7, 9, 10, 14, 20, 26, 27, 33, 40}
+	if testing.Short() {
+		versions = []int{1, 7, 10, 27}
+	}
+	for _, level := range []Level{Low, Medium, Quartile, High} {
+		for _, version := range versions {
+			t.Run(fmt.Sprintf("%s/%d", level, version), func(t *testing.T) {
+				data := payload(maxBytes(version, level), version)
+				code, err := Encode(data, level)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if code.Version != version || code.Level != level || code.Size != 17+4*version {
+					t.Fatalf("version %d, level %s, size %d", code.Version, code.Level, code.Size)
+				}
+				got, err := Decode(code.Image(3))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(got, data) {
+					t.Fatalf("decoded %d bytes, want %d", len(got), len(data))
+				}
+			})
+		}
+	}
+}
+
+func TestRoundTripModes(t *testing.T) {
+	for name, s := range map[string]string{
+		"numeric":      "0123456789012345678901234567890",
+		"alphanumeric": "RGB:~/~/BCRT:UTXOB:ABC-DEF $%*+./",
+		"byte":         "rgb:~/~/bcrt:utxob:zlVS28Rb-amM5lih?expiry=1700000000",
+		"utf-8":        "cosigner ✓ ñ",
+	} {
+		t.Run(name, func(t *testing.T) {
+			for _, level := range []Level{Low, High} {
+				code, err := EncodeString(s, level)
+				if err != nil {
+					t.Fatal(err)
+				}
+				// through PNG, as scanned images usually come
+				encoded, err := code.PNG(4)
+				if err != nil {
+					t.Fatal(err)
+				}
+				img, err := png.Decode(bytes.NewReader(encoded))
+				if err != nil {
+					t.Fatal(err)
+				}
+				got, err := DecodeString(img)
+				if err != nil || got != s {
+					t.Fatalf("level %s: DecodeString = %q, %v", level, got, err)
+				}
+			}
+		})
+	}
+}
+
+func TestEncodeTooLong(t *testing.T) {
+	for _, level := range []Level{Low, High} {
+		n := maxBytes(MaxVersion, level) + 1
+		if _, err := Encode(payload(n, 0), level); !errors.Is(err, ErrTooLong) {
+			t.Errorf("level %s, %d bytes: %v, want ErrTooLong", level, n, err)
+		}
+	}
+}
+
+func TestDecodeErrorCorrection(t *testing.T) {
+	data := []byte(strings.Repeat("rgb-lib ", 8))
+	code, err := Encode(data, High)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// flip a few data modules away from the function patterns
+	for _, p := range [][2]int{{10, 10}, {12, 14}, {14, 12}, {16, 16}} {
+		code.modules[p[1]][p[0]] = !code.modules[p[1]][p[0]]
+	}
+	got, err := Decode(code.Image(4))
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("Decode = %q, %v", got, err)
+	}
+}
+
+func TestDecodeNotFound(t *testing.T) {
+	blank := image.NewGray(image.Rect(0, 0, 100, 100))
+	if _, err := Decode(blank); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Decode of a blank image = %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,184 @@
+package qr
+
+import "errors"
+
+var errUncorrectable = errors.New("too many errors to correct")
+
+// GF(2^8) with the QR code polynomial x^8 + x^4 + x^3 + x^2 + 1.
+var gfExp, gfLog = func() (exp [512]byte, log [256]byte) {
+	x := 1
+	for i := range 255 {
+		exp[i] = byte(x)
+		log[x] = byte(i)
+		x <<= 1
+		if x&0x100 != 0 {
+			x ^= 0x11d
+		}
+	}
+	for i := 255; i < 512; i++ {
+		exp[i] = exp[i-255]
+	}
+	return exp, log
+}()
+
+func gfMul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gfExp[int(gfLog[a])+int(gfLog[b])]
+}
+
+func gfDiv(a, b byte) byte {
+	if a == 0 {
+		return 0
+	}
+	return gfExp[int(gfLog[a])+255-int(gfLog[b])]
+}
+
+// gfPow returns alpha^n.
+func gfPow(n int) byte {
+	n %= 255
+	if n < 0 {
+		n += 255
+	}
+	return gfExp[n]
+}
+
+// rsDivisor returns the generator polynomial of the given degree, with roots
+// alpha^0 to alpha^(degree-1), highest coefficient first and the leading 1
+// omitted.
+func rsDivisor(degree int) []byte {
+	result := make([]byte, degree)
+	result[degree-1] = 1
+	root := byte(1)
+	for range degree {
+		for j := range result {
+			result[j] = gfMul(result[j], root)
+			if j+1 < len(result) {
+				result[j] ^= result[j+1]
+			}
+		}
+		root = gfMul(root, 2)
+	}
+	return result
+}
+
+// rsRemainder returns the error correction codewords of data.
+func rsRemainder(data, divisor []byte) []byte {
+	result := make([]byte, len(divisor))
+	for _, b := range data {
+		factor := b ^ result[0]
+		copy(result, result[1:])
+		result[len(result)-1] = 0
+		for i, d := range divisor {
+			result[i] ^= gfMul(d, factor)
+		}
+	}
+	return result
+}
+
+// polyEval evaluates a polynomial, lowest coefficient first, at x.
+func polyEval(p []byte, x byte) byte {
+	var y byte
+	for i := len(p) - 1; i >= 0; i-- {
+		y = gfMul(y, x) ^ p[i]
+	}
+	return y
+}
+
+// rsCorrect corrects a block of codewords, data followed by ecc error
+// correction codewords, in place. It returns the number of corrected
+// codewords.
+func rsCorrect(block []byte, ecc int) (int, error) {
+	n := len(block)
+	// syndromes S_i = r(alpha^i), the first codeword being the highest power
+	syndromes := make([]byte, ecc)
+	clean := true
+	for i := range syndromes {
+		var s byte
+		for _, b := range block {
+			s = gfMul(s, gfPow(i)) ^ b
+		}
+		syndromes[i] = s
+		if s != 0 {
+			clean = false
+		}
+	}
+	if clean {
+		return 0, nil
+	}
+
+	// Berlekamp-Massey, polynomials lowest coefficient first
+	locator, prev := []byte{1}, []byte{1}
+	errs, shift, last := 0, 1, byte(1)
+	for i := range ecc {
+		d := syndromes[i]
+		for j := 1; j <= errs && j < len(locator); j++ {
+			d ^= gfMul(locator[j], syndromes[i-j])
+		}
+		if d == 0 {
+			shift++
+			continue
+		}
+		next := make([]byte, max(len(locator), len(prev)+shift))
+		copy(next, locator)
+		coef := gfDiv(d, last)
+		for j, p := range prev {
+			next[j+shift] ^= gfMul(coef, p)
+		}
+		if 2*errs <= i {
+			prev, errs, last, shift = locator, i+1-errs, d, 1
+		} else {
+			shift++
+		}
+		locator = next
+	}
+	for len(locator) > 1 && locator[len(locator)-1] == 0 {
+		locator = locator[:len(locator)-1]
+	}
+	if errs != len(locator)-1 || 2*errs > ecc {
+		return 0, errUncorrectable
+	}
+
+	// Chien search: an error at power k makes alpha^-k a root
+	var powers []int
+	for k := range n {
+		if polyEval(locator, gfPow(-k)) == 0 {
+			powers = append(powers, k)
+		}
+	}
+	if len(powers) != errs {
+		return 0, errUncorrectable
+	}
+
+	// Forney: e = X * omega(X^-1) / locator'(X^-1)
+	omega := make([]byte, ecc)
+	for i := range ecc {
+		for j := 0; j <= i && j < len(locator); j++ {
+			omega[i] ^= gfMul(syndromes[i-j], locator[j])
+		}
+	}
+	derivative := make([]byte, len(locator))
+	for i := 1; i < len(locator); i += 2 {
+		derivative[i-1] = locator[i]
+	}
+	for _, k := range powers {
+		xInv := gfPow(-k)
+		denom := polyEval(derivative, xInv)
+		if denom == 0 {
+			return 0, errUncorrectable
+		}
+		block[n-1-k] ^= gfMul(gfPow(k), gfDiv(polyEval(omega, xInv), denom))
+	}
+
+	for i := range ecc {
+		var s byte
+		for _, b := range block {
+			s = gfMul(s, gfPow(i)) ^ b
+		}
+		if s != 0 {
+			return 0, errUncorrectable
+		}
+	}
+	return errs, nil
+}
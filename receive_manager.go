@@ -0,0 +1,363 @@
+package rgb_lib
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// ReceiveWallet is the subset of Wallet needed by a ReceiveManager.
+type ReceiveWallet interface {
+	TransferSource
+	BlindReceive(assetId *string, assignment Assignment, expirationTimestamp *uint64, transportEndpoints []string, minConfirmations uint8) (ReceiveData, error)
+	WitnessReceive(assetId *string, assignment Assignment, expirationTimestamp *uint64, transportEndpoints []string, minConfirmations uint8) (ReceiveData, error)
+	Refresh(online Online, assetId *string, filter []RefreshFilter, skipSync bool) (map[int32]RefreshedTransfer, error)
+	FailTransfers(online Online, batchTransferIdx *int32, noAssetOnly bool, skipSync bool) (bool, error)
+}
+
+type ReceiveState string
+
+const (
+	ReceivePending ReceiveState = "pending"
+	ReceiveSettled ReceiveState = "settled"
+	ReceiveFailed  ReceiveState = "failed"
+	ReceiveExpired ReceiveState = "expired"
+)
+
+// Final reports whether the receive can no longer change state.
+func (s ReceiveState) Final() bool {
+	return s != ReceivePending
+}
+
+var (
+	ErrReceiveNotFound = errors.New("receive not found")
+	ErrReceiveExists   = errors.New("receive already exists")
+)
+
+// ReceiveRecord maps an order ID chosen by the application to the invoice
+// created for it. TransferIdx and AssetId are set once the incoming transfer
+// is known to the wallet. Notified is set once the callback of the final
+// state has returned without error.
+type ReceiveRecord struct {
+	OrderId             string       `json:"order_id"`
+	Invoice             string       `json:"invoice"`
+	RecipientId         string       `json:"recipient_id"`
+	BatchTransferIdx    int32        `json:"batch_transfer_idx"`
+	AssetId             *string      `json:"asset_id,omitempty"`
+	Witness             bool         `json:"witness"`
+	ExpirationTimestamp *uint64      `json:"expiration_timestamp,omitempty"`
+	State               ReceiveState `json:"state"`
+	TransferIdx         *int32       `json:"transfer_idx,omitempty"`
+	Notified            bool         `json:"notified,omitempty"`
+	CreatedAt           int64        `json:"created_at"`
+	UpdatedAt           int64        `json:"updated_at"`
+}
+
+// ReceiveStore persists ReceiveRecords. Get returns ErrReceiveNotFound for
+// unknown order IDs. Pending returns the records not final yet, and the final
+// ones not notified yet.
+type ReceiveStore interface {
+	Get(orderId string) (ReceiveRecord, error)
+	Put(record ReceiveRecord) error
+	Pending() ([]ReceiveRecord, error)
+}
+
+// MemoryReceiveStore keeps records in memory. It is safe for concurrent use.
+type MemoryReceiveStore struct {
+	*recordStore[ReceiveRecord]
+}
+
+func NewMemoryReceiveStore() *MemoryReceiveStore {
+	return &MemoryReceiveStore{newRecordStore(receiveKey, compareReceives, ErrReceiveNotFound)}
+}
+
+func (s *MemoryReceiveStore) Pending() ([]ReceiveRecord, error) {
+	return s.list(receivePending), nil
+}
+
+// FileReceiveStore keeps records in a JSON file, rewritten atomically on
+// every change.
+type FileReceiveStore struct {
+	*recordStore[ReceiveRecord]
+}
+
+// NewFileReceiveStore loads the records of the file at path, which is created
+// on the first Put if it does not exist.
+func NewFileReceiveStore(path string) (*FileReceiveStore, error) {
+	s, err := loadRecordStore(path, receiveKey, compareReceives, ErrReceiveNotFound)
+	if err != nil {
+		return nil, err
+	}
+	return &FileReceiveStore{s}, nil
+}
+
+func (s *FileReceiveStore) Pending() ([]ReceiveRecord, error) {
+	return s.list(receivePending), nil
+}
+
+func receiveKey(r ReceiveRecord) string {
+	return r.OrderId
+}
+
+func compareReceives(a, b ReceiveRecord) int {
+	return cmp.Compare(a.CreatedAt, b.CreatedAt)
+}
+
+func receivePending(r ReceiveRecord) bool {
+	return !r.State.Final() || !r.Notified
+}
+
+// ReceiveRequest describes the invoice to create for an order. Expiry is
+// relative to creation; zero uses the wallet default.
+type ReceiveRequest struct {
+	OrderId            string
+	AssetId            *string
+	Assignment         Assignment
+	Expiry             time.Duration
+	TransportEndpoints []string
+	MinConfirmations   uint8
+	// Witness creates the invoice with WitnessReceive instead of BlindReceive.
+	Witness bool
+}
+
+// ReceiveCallbacks are called by ReceiveManager.Refresh when a receive
+// reaches a final state. Any of them may be nil. A callback is called again
+// by the next Refresh until it returns no error, including after a crash, so
+// it may be called more than once for the same receive and must be
+// idempotent.
+type ReceiveCallbacks struct {
+	OnSettled func(record ReceiveRecord, transfer AssetTransfer) error
+	OnFailed  func(record ReceiveRecord, transfer AssetTransfer) error
+	OnExpired func(record ReceiveRecord) error
+}
+
+// ReceiveManager creates invoices for orders and follows them until they
+// settle, fail or expire.
+//
+// A receive still waiting for the sender after its expiration, plus the
+// grace period, is failed with FailTransfers and reported as expired, unless
+// FailTransfers finds nothing to fail because the transfer progressed. Once
+// the consignment has been received the receive is followed until it settles
+// or fails, whatever its expiration.
+type ReceiveManager struct {
+	wallet    ReceiveWallet
+	online    Online
+	store     ReceiveStore
+	callbacks ReceiveCallbacks
+	grace     time.Duration
+	now       func() time.Time
+	mu        sync.Mutex
+}
+
+func NewReceiveManager(wallet ReceiveWallet, online Online, store ReceiveStore, callbacks ReceiveCallbacks) *ReceiveManager {
+	return &ReceiveManager{wallet: wallet, online: online, store: store, callbacks: callbacks, now: time.Now}
+}
+
+// WithGrace sets how long after its expiration a receive waiting for the
+// sender is kept before being failed, to allow for clock skew and slow
+// transports.
+func (m *ReceiveManager) WithGrace(grace time.Duration) *ReceiveManager {
+	m.grace = grace
+	return m
+}
+
+// Create creates the invoice of an order and records it. It fails with
+// ErrReceiveExists if the order already has a receive, which Get returns.
+func (m *ReceiveManager) Create(req ReceiveRequest) (ReceiveRecord, error) {
+	if req.OrderId == "" {
+		return ReceiveRecord{}, errors.New("empty order ID")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, err := m.store.Get(req.OrderId); err == nil {
+		return ReceiveRecord{}, fmt.Errorf("%w: %s", ErrReceiveExists, req.OrderId)
+	} else if !errors.Is(err, ErrReceiveNotFound) {
+		return ReceiveRecord{}, err
+	}
+
+	now := m.now()
+	var expiration *uint64
+	if req.Expiry > 0 {
+		ts := uint64(now.Add(req.Expiry).Unix())
+		expiration = &ts
+	}
+	assignment := req.Assignment
+	if assignment == nil {
+		assignment = AssignmentAny{}
+	}
+	receive := m.wallet.BlindReceive
+	if req.Witness {
+		receive = m.wallet.WitnessReceive
+	}
+	data, err := receive(req.AssetId, assignment, expiration, req.TransportEndpoints, req.MinConfirmations)
+	if err != nil {
+		return ReceiveRecord{}, err
+	}
+	record := ReceiveRecord{
+		OrderId:             req.OrderId,
+		Invoice:             data.Invoice,
+		RecipientId:         data.RecipientId,
+		BatchTransferIdx:    data.BatchTransferIdx,
+		AssetId:             req.AssetId,
+		Witness:             req.Witness,
+		ExpirationTimestamp: data.ExpirationTimestamp,
+		State:               ReceivePending,
+		CreatedAt:           now.Unix(),
+		UpdatedAt:           now.Unix(),
+	}
+	if err := m.store.Put(record); err != nil {
+		// the invoice exists in the wallet but cannot be tracked
+		failed, failErr := m.wallet.FailTransfers(m.online, &data.BatchTransferIdx, false, true)
+		if failErr == nil && !failed {
+			failErr = fmt.Errorf("receive %d was not failed and may still be paid", data.BatchTransferIdx)
+		}
+		return ReceiveRecord{}, errors.Join(err, failErr)
+	}
+	return record, nil
+}
+
+func (m *ReceiveManager) Get(orderId string) (ReceiveRecord, error) {
+	return m.store.Get(orderId)
+}
+
+// Refresh refreshes the incoming transfers of the wallet, then updates every
+// pending receive, calling the callbacks of the ones reaching a final state
+// and of the final ones not notified yet. An error on a receive does not stop
+// the others; all errors are returned joined.
+func (m *ReceiveManager) Refresh(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	pending, err := m.store.Pending()
+	if err != nil || len(pending) == 0 {
+		return err
+	}
+	if slices.ContainsFunc(pending, func(r ReceiveRecord) bool { return !r.State.Final() }) {
+		filter := []RefreshFilter{
+			{Status: RefreshTransferStatusWaitingCounterparty, Incoming: true},
+			{Status: RefreshTransferStatusWaitingSafeHeight, Incoming: true},
+			{Status: RefreshTransferStatusWaitingConfirmations, Incoming: true},
+		}
+		if _, err := m.wallet.Refresh(m.online, nil, filter, false); err != nil {
+			return fmt.Errorf("refresh: %w", err)
+		}
+	}
+
+	recipientIds := make([]string, len(pending))
+	for i, r := range pending {
+		recipientIds[i] = r.RecipientId
+	}
+	page, err := NewTransferQuery().
+		WithKind(TransferKindReceiveBlind, TransferKindReceiveWitness).
+		WithRecipientId(recipientIds...).
+		Run(m.wallet)
+	if err != nil {
+		return err
+	}
+	transfers := map[string]AssetTransfer{}
+	for _, t := range page.Transfers {
+		transfers[*t.RecipientId] = t
+	}
+
+	now := m.now()
+	var errs []error
+	for _, record := range pending {
+		if err := ctx.Err(); err != nil {
+			return errors.Join(append(errs, err)...)
+		}
+		if err := m.update(record, transfers, now); err != nil {
+			errs = append(errs, fmt.Errorf("order %s: %w", record.OrderId, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// update moves record to its final state, if reached, and saves it before
+// calling the callback of that state, so that a crash in between leaves it
+// to be notified by the next Refresh.
+func (m *ReceiveManager) update(record ReceiveRecord, transfers map[string]AssetTransfer, now time.Time) error {
+	t, found := transfers[record.RecipientId]
+	if !record.State.Final() {
+		known := found && record.TransferIdx != nil && (t.AssetId == nil || record.AssetId != nil)
+		if found {
+			record.TransferIdx = &t.Idx
+			if t.AssetId != nil {
+				record.AssetId = t.AssetId
+			}
+		}
+		// FailTransfers fails nothing once the sender has moved the transfer
+		// on, which the next Refresh sees
+		expired := false
+		if (!found || t.Status == TransferStatusWaitingCounterparty) && m.expired(record, now) {
+			failed, err := m.wallet.FailTransfers(m.online, &record.BatchTransferIdx, false, true)
+			if err != nil {
+				return fmt.Errorf("fail expired receive: %w", err)
+			}
+			expired = failed
+		}
+		switch {
+		case found && t.Status == TransferStatusSettled:
+			record.State = ReceiveSettled
+		case found && t.Status == TransferStatusFailed:
+			record.State = ReceiveFailed
+		case expired:
+			record.State = ReceiveExpired
+		default:
+			if !found || known {
+				return nil
+			}
+		}
+		record.UpdatedAt = now.Unix()
+		if err := m.store.Put(record); err != nil {
+			return err
+		}
+		if !record.State.Final() {
+			return nil
+		}
+	}
+	if err := m.notify(record, t, found); err != nil {
+		return fmt.Errorf("%s callback: %w", record.State, err)
+	}
+	record.Notified = true
+	record.UpdatedAt = now.Unix()
+	return m.store.Put(record)
+}
+
+// notify calls the callback of the final state of record, if any.
+func (m *ReceiveManager) notify(record ReceiveRecord, t AssetTransfer, found bool) error {
+	switch record.State {
+	case ReceiveSettled, ReceiveFailed:
+		callback := m.callbacks.OnSettled
+		if record.State == ReceiveFailed {
+			callback = m.callbacks.OnFailed
+		}
+		if callback == nil {
+			return nil
+		}
+		if !found {
+			return errors.New("transfer not found")
+		}
+		return callback(record, t)
+	case ReceiveExpired:
+		if m.callbacks.OnExpired != nil {
+			return m.callbacks.OnExpired(record)
+		}
+	}
+	return nil
+}
+
+func (m *ReceiveManager) expired(record ReceiveRecord, now time.Time) bool {
+	if record.ExpirationTimestamp == nil {
+		return false
+	}
+	return now.After(time.Unix(int64(*record.ExpirationTimestamp), 0).Add(m.grace))
+}
+
+// Run calls Refresh every interval until ctx is done, passing its errors to
+// onError.
+func (m *ReceiveManager) Run(ctx context.Context, interval time.Duration, onError func(error)) error {
+	return runEvery(ctx, interval, onError, m.Refresh)
+}
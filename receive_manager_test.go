@@ -0,0 +1,117 @@
+package rgb_lib
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+type receiveTest struct {
+	wallet  *fakeWallet
+	manager *ReceiveManager
+	now     time.Time
+	calls   []string
+	fail    error
+}
+
+func newReceiveTest(t *testing.T) *receiveTest {
+	rt := &receiveTest{wallet: newFakeWallet(), now: time.Unix(1700000000, 0)}
+	callback := func(name string) error {
+		rt.calls = append(rt.calls, name)
+		return rt.fail
+	}
+	rt.manager = NewReceiveManager(rt.wallet, Online{}, NewMemoryReceiveStore(), ReceiveCallbacks{
+		OnSettled: func(record ReceiveRecord, transfer AssetTransfer) error { return callback("settled " + record.OrderId) },
+		OnFailed:  func(record ReceiveRecord, transfer AssetTransfer) error { return callback("failed " + record.OrderId) },
+		OnExpired: func(record ReceiveRecord) error { return callback("expired " + record.OrderId) },
+	})
+	rt.manager.now = func() time.Time { return rt.now }
+	return rt
+}
+
+func (rt *receiveTest) state(t *testing.T, orderId string) ReceiveRecord {
+	t.Helper()
+	r, err := rt.manager.Get(orderId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestReceiveExpiresOnlyWhenFailed(t *testing.T) {
+	rt := newReceiveTest(t)
+	if _, err := rt.manager.Create(ReceiveRequest{OrderId: "a", Expiry: time.Hour, Witness: true}); err != nil {
+		t.Fatal(err)
+	}
+	rt.now = rt.now.Add(2 * time.Hour)
+
+	// the sender moved the transfer on: nothing is failed
+	rt.wallet.failTransfers = func(int32) (bool, error) { return false, nil }
+	if err := rt.manager.Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if r := rt.state(t, "a"); r.State != ReceivePending || len(rt.calls) > 0 {
+		t.Fatalf("state %s, calls %v, want pending and no call", r.State, rt.calls)
+	}
+
+	rt.wallet.failTransfers = nil
+	if err := rt.manager.Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if r := rt.state(t, "a"); r.State != ReceiveExpired || !r.Notified || len(rt.calls) != 1 || rt.calls[0] != "expired a" {
+		t.Fatalf("state %s, notified %v, calls %v", r.State, r.Notified, rt.calls)
+	}
+}
+
+func TestReceiveCallbackRetried(t *testing.T) {
+	rt := newReceiveTest(t)
+	record, err := rt.manager.Create(ReceiveRequest{OrderId: "a", Witness: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rt.wallet.transfer(record.RecipientId, TransferStatusSettled)
+
+	rt.fail = errTest
+	if err := rt.manager.Refresh(context.Background()); !errors.Is(err, errTest) {
+		t.Fatalf("Refresh = %v, want %v", err, errTest)
+	}
+	if r := rt.state(t, "a"); r.State != ReceiveSettled || r.Notified {
+		t.Fatalf("state %s, notified %v, want settled and not notified", r.State, r.Notified)
+	}
+
+	rt.fail = nil
+	refreshes := rt.wallet.refreshes
+	for range 2 {
+		if err := rt.manager.Refresh(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if rt.wallet.refreshes != refreshes {
+		t.Fatal("wallet refreshed with only final receives")
+	}
+	if len(rt.calls) != 2 || rt.calls[1] != "settled a" || !rt.state(t, "a").Notified {
+		t.Fatalf("calls %v, want the settled callback twice", rt.calls)
+	}
+}
+
+type failingReceiveStore struct {
+	ReceiveStore
+}
+
+func (failingReceiveStore) Put(record ReceiveRecord) error {
+	return errTest
+}
+
+func TestReceiveCreateUntracked(t *testing.T) {
+	wallet := newFakeWallet()
+	m := NewReceiveManager(wallet, Online{}, failingReceiveStore{NewMemoryReceiveStore()}, ReceiveCallbacks{})
+	if _, err := m.Create(ReceiveRequest{OrderId: "a"}); !errors.Is(err, errTest) || len(wallet.failed) != 1 {
+		t.Fatalf("Create = %v, failed %v", err, wallet.failed)
+	}
+	wallet.failTransfers = func(int32) (bool, error) { return false, nil }
+	if _, err := m.Create(ReceiveRequest{OrderId: "b"}); err == nil || !strings.Contains(err.Error(), "may still be paid") {
+		t.Fatalf("Create = %v, want an error about the receive left open", err)
+	}
+}
@@ -0,0 +1,221 @@
+package rgb_lib
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+)
+
+// RGB policy rule names, reported in PolicyViolation.Rule.
+const (
+	RuleMaxAssetOutflow    = "max_asset_outflow"
+	RuleChangeToOurs       = "change_to_ours"
+	RuleNoBurn             = "no_burn"
+	RuleTransitionMismatch = "transition_mismatch"
+)
+
+// RgbIntent is the kind of operation an RGB transfer is expected to perform.
+type RgbIntent uint8
+
+const (
+	RgbIntentSend RgbIntent = iota + 1
+	RgbIntentBurn
+	RgbIntentInflate
+)
+
+func (i RgbIntent) String() string {
+	switch i {
+	case RgbIntentSend:
+		return "send"
+	case RgbIntentBurn:
+		return "burn"
+	case RgbIntentInflate:
+		return "inflate"
+	default:
+		return fmt.Sprintf("RgbIntent(%d)", uint8(i))
+	}
+}
+
+// IntentOf returns the intent matching the details returned by SendBegin,
+// BurnBegin or InflateBegin.
+func IntentOf(details any) (RgbIntent, error) {
+	switch details.(type) {
+	case SendDetails, *SendDetails:
+		return RgbIntentSend, nil
+	case BurnDetails, *BurnDetails:
+		return RgbIntentBurn, nil
+	case InflateDetails, *InflateDetails:
+		return RgbIntentInflate, nil
+	default:
+		return 0, fmt.Errorf("no rgb intent for %T", details)
+	}
+}
+
+// RgbPolicy is a set of rules checked on an RgbInspection. Burn transitions
+// are always rejected unless the intent is a burn, and transition types must
+// match the intent.
+type RgbPolicy struct {
+	// MaxAssetOutflow caps, per asset ID, the raw amount leaving the wallet
+	// with a single operation.
+	MaxAssetOutflow map[string]uint64
+	// RequireChangeToOurs requires the amount spent and not sent away to
+	// come back to outputs owned by the wallet.
+	RequireChangeToOurs bool
+}
+
+// RgbVerdict is the outcome of an RgbPolicy check. Outflows holds, per asset
+// ID, the raw amount leaving the wallet and Burned the raw amount burned.
+type RgbVerdict struct {
+	Intent     RgbIntent
+	Violations []PolicyViolation
+	Outflows   map[string]uint64
+	Burned     map[string]uint64
+}
+
+func (v RgbVerdict) Allowed() bool {
+	return len(v.Violations) == 0
+}
+
+// Err returns a *PolicyError when the verdict has violations, nil otherwise.
+func (v RgbVerdict) Err() error {
+	if v.Allowed() {
+		return nil
+	}
+	return &PolicyError{Violations: v.Violations}
+}
+
+func fungibleAmount(a Assignment) uint64 {
+	if f, ok := a.(AssignmentFungible); ok {
+		return f.Amount
+	}
+	return 0
+}
+
+// Check evaluates the inspected transfer against the policy.
+func (p *RgbPolicy) Check(inspection RgbInspection, intent RgbIntent) RgbVerdict {
+	v := RgbVerdict{Intent: intent, Outflows: map[string]uint64{}, Burned: map[string]uint64{}}
+	seen := map[TypeOfTransition]bool{}
+	violate := func(rule, format string, args ...any) {
+		v.Violations = append(v.Violations, PolicyViolation{Rule: rule, Message: fmt.Sprintf(format, args...)})
+	}
+
+	for _, op := range inspection.Operations {
+		for _, t := range op.Transitions {
+			seen[t.Type] = true
+			var in, ours, leaving uint64
+			for _, i := range t.Inputs {
+				in += fungibleAmount(i.Assignment)
+			}
+			for _, o := range t.Outputs {
+				if o.IsOurs {
+					ours += fungibleAmount(o.Assignment)
+				} else {
+					leaving += fungibleAmount(o.Assignment)
+				}
+			}
+
+			switch t.Type {
+			case TypeOfTransitionBurn:
+				if in > ours+leaving {
+					v.Burned[op.AssetId] += in - ours - leaving
+				}
+				if intent != RgbIntentBurn {
+					violate(RuleNoBurn, "asset %s has a burn transition in a %s operation", op.AssetId, intent)
+				}
+			case TypeOfTransitionInflate:
+				if intent != RgbIntentInflate {
+					violate(RuleTransitionMismatch, "asset %s has an inflate transition in a %s operation", op.AssetId, intent)
+				}
+			case TypeOfTransitionLink:
+				violate(RuleTransitionMismatch, "asset %s has a link transition in a %s operation", op.AssetId, intent)
+			case TypeOfTransitionTransfer:
+				if p.RequireChangeToOurs && in > leaving && ours < in-leaving {
+					violate(RuleChangeToOurs, "asset %s returns %d of the %d change to the wallet", op.AssetId, ours, in-leaving)
+				}
+			}
+			v.Outflows[op.AssetId] += leaving
+		}
+	}
+
+	switch intent {
+	case RgbIntentBurn:
+		if !seen[TypeOfTransitionBurn] {
+			violate(RuleTransitionMismatch, "burn operation has no burn transition")
+		}
+	case RgbIntentInflate:
+		if !seen[TypeOfTransitionInflate] {
+			violate(RuleTransitionMismatch, "inflate operation has no inflate transition")
+		}
+	}
+	for _, assetId := range slices.Sorted(maps.Keys(p.MaxAssetOutflow)) {
+		if out, limit := v.Outflows[assetId], p.MaxAssetOutflow[assetId]; out > limit {
+			violate(RuleMaxAssetOutflow, "asset %s outflow %d is above %d", assetId, out, limit)
+		}
+	}
+	return v
+}
+
+// RgbInspector is implemented by Wallet and MultisigWallet.
+type RgbInspector interface {
+	InspectRgbTransfer(psbt string, fasciaPath string, entropy uint64) (RgbInspection, error)
+}
+
+func (p *RgbPolicy) CheckSend(inspector RgbInspector, psbt string, details SendDetails) (RgbVerdict, error) {
+	inspection, err := inspector.InspectRgbTransfer(psbt, details.FasciaPath, details.Entropy)
+	if err != nil {
+		return RgbVerdict{}, err
+	}
+	return p.Check(inspection, RgbIntentSend), nil
+}
+
+func (p *RgbPolicy) CheckBurn(inspector RgbInspector, psbt string, details BurnDetails) (RgbVerdict, error) {
+	inspection, err := inspector.InspectRgbTransfer(psbt, details.FasciaPath, details.Entropy)
+	if err != nil {
+		return RgbVerdict{}, err
+	}
+	return p.Check(inspection, RgbIntentBurn), nil
+}
+
+func (p *RgbPolicy) CheckInflate(inspector RgbInspector, psbt string, details InflateDetails) (RgbVerdict, error) {
+	inspection, err := inspector.InspectRgbTransfer(psbt, details.FasciaPath, details.Entropy)
+	if err != nil {
+		return RgbVerdict{}, err
+	}
+	return p.Check(inspection, RgbIntentInflate), nil
+}
+
+// SendEnd calls wallet.SendEnd only if the transfer passes the policy.
+func (p *RgbPolicy) SendEnd(wallet WalletInterface, online Online, signedPsbt string, details SendDetails) (OperationResult, error) {
+	verdict, err := p.CheckSend(wallet, signedPsbt, details)
+	if err != nil {
+		return OperationResult{}, err
+	}
+	if err := verdict.Err(); err != nil {
+		return OperationResult{}, err
+	}
+	return wallet.SendEnd(online, signedPsbt)
+}
+
+// BurnEnd calls wallet.BurnEnd only if the transfer passes the policy.
+func (p *RgbPolicy) BurnEnd(wallet WalletInterface, online Online, signedPsbt string, details BurnDetails) (OperationResult, error) {
+	verdict, err := p.CheckBurn(wallet, signedPsbt, details)
+	if err != nil {
+		return OperationResult{}, err
+	}
+	if err := verdict.Err(); err != nil {
+		return OperationResult{}, err
+	}
+	return wallet.BurnEnd(online, signedPsbt)
+}
+
+// InflateEnd calls wallet.InflateEnd only if the transfer passes the policy.
+func (p *RgbPolicy) InflateEnd(wallet WalletInterface, online Online, signedPsbt string, details InflateDetails) (OperationResult, error) {
+	verdict, err := p.CheckInflate(wallet, signedPsbt, details)
+	if err != nil {
+		return OperationResult{}, err
+	}
+	if err := verdict.Err(); err != nil {
+		return OperationResult{}, err
+	}
+	return wallet.InflateEnd(online, signedPsbt)
+}
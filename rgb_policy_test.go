@@ -0,0 +1,116 @@
+package rgb_lib
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+// inspectingWallet serves InspectRgbTransfer from a fixed inspection.
+type inspectingWallet struct {
+	*fakeWallet
+	inspection RgbInspection
+}
+
+func (w inspectingWallet) InspectRgbTransfer(psbt string, fasciaPath string, entropy uint64) (RgbInspection, error) {
+	return w.inspection, nil
+}
+
+// rgbTransition spends in and assigns ours back to the wallet and leaving
+// to someone else, skipping zero amounts.
+func rgbTransition(typ TypeOfTransition, in, ours, leaving uint64) RgbTransitionInfo {
+	t := RgbTransitionInfo{Type: typ}
+	if in > 0 {
+		t.Inputs = []RgbInputInfo{{Assignment: AssignmentFungible{Amount: in}}}
+	}
+	if ours > 0 {
+		t.Outputs = append(t.Outputs, RgbOutputInfo{Assignment: AssignmentFungible{Amount: ours}, IsOurs: true})
+	}
+	if leaving > 0 {
+		t.Outputs = append(t.Outputs, RgbOutputInfo{Assignment: AssignmentFungible{Amount: leaving}, IsConcealed: true})
+	}
+	return t
+}
+
+func rgbInspection(assetId string, transitions ...RgbTransitionInfo) RgbInspection {
+	return RgbInspection{Operations: []RgbOperationInfo{{AssetId: assetId, Transitions: transitions}}}
+}
+
+func TestRgbPolicyCheck(t *testing.T) {
+	policy := RgbPolicy{MaxAssetOutflow: map[string]uint64{"rgb:a": 50}, RequireChangeToOurs: true}
+	for _, c := range []struct {
+		name       string
+		intent     RgbIntent
+		inspection RgbInspection
+		rules      []string
+		outflow    uint64
+		burned     uint64
+	}{
+		{"send", RgbIntentSend, rgbInspection("rgb:a", rgbTransition(TypeOfTransitionTransfer, 100, 70, 30)), nil, 30, 0},
+		{"send above the limit", RgbIntentSend, rgbInspection("rgb:a", rgbTransition(TypeOfTransitionTransfer, 100, 40, 60)), []string{RuleMaxAssetOutflow}, 60, 0},
+		{"change lost", RgbIntentSend, rgbInspection("rgb:a", rgbTransition(TypeOfTransitionTransfer, 100, 50, 30)), []string{RuleChangeToOurs}, 30, 0},
+		{"burn in a send", RgbIntentSend, rgbInspection("rgb:a", rgbTransition(TypeOfTransitionBurn, 100, 60, 0)), []string{RuleNoBurn}, 0, 40},
+		{"burn", RgbIntentBurn, rgbInspection("rgb:a", rgbTransition(TypeOfTransitionBurn, 100, 60, 0)), nil, 0, 40},
+		{"burn without a burn", RgbIntentBurn, rgbInspection("rgb:a", rgbTransition(TypeOfTransitionTransfer, 100, 100, 0)), []string{RuleTransitionMismatch}, 0, 0},
+		{"inflate in a send", RgbIntentSend, rgbInspection("rgb:a", rgbTransition(TypeOfTransitionInflate, 0, 100, 0)), []string{RuleTransitionMismatch}, 0, 0},
+		{"inflate", RgbIntentInflate, rgbInspection("rgb:a", rgbTransition(TypeOfTransitionInflate, 0, 100, 0)), nil, 0, 0},
+		{"inflate without an inflate", RgbIntentInflate, rgbInspection("rgb:a"), []string{RuleTransitionMismatch}, 0, 0},
+		{"link", RgbIntentSend, rgbInspection("rgb:a", rgbTransition(TypeOfTransitionLink, 0, 0, 0)), []string{RuleTransitionMismatch}, 0, 0},
+		{"unlimited asset", RgbIntentSend, rgbInspection("rgb:b", rgbTransition(TypeOfTransitionTransfer, 1000, 0, 1000)), nil, 1000, 0},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			v := policy.Check(c.inspection, c.intent)
+			var rules []string
+			for _, violation := range v.Violations {
+				rules = append(rules, violation.Rule)
+			}
+			if !slices.Equal(rules, c.rules) || v.Allowed() != (c.rules == nil) {
+				t.Fatalf("violations %v, want %v", v.Violations, c.rules)
+			}
+			assetId := c.inspection.Operations[0].AssetId
+			if v.Outflows[assetId] != c.outflow || v.Burned[assetId] != c.burned {
+				t.Fatalf("outflow %d, burned %d, want %d, %d", v.Outflows[assetId], v.Burned[assetId], c.outflow, c.burned)
+			}
+		})
+	}
+
+	// outflows add up across the transitions of an asset
+	inspection := rgbInspection("rgb:a", rgbTransition(TypeOfTransitionTransfer, 40, 10, 30), rgbTransition(TypeOfTransitionTransfer, 30, 0, 30))
+	if v := policy.Check(inspection, RgbIntentSend); v.Outflows["rgb:a"] != 60 || v.Allowed() {
+		t.Fatalf("Check = %+v, want an outflow of 60 above the limit", v)
+	}
+}
+
+func TestRgbPolicySendEnd(t *testing.T) {
+	policy := RgbPolicy{MaxAssetOutflow: map[string]uint64{"rgb:a": 50}}
+	wallet := inspectingWallet{fakeWallet: newFakeWallet()}
+	var ended int
+	wallet.sendEnd = func(string) (OperationResult, error) {
+		ended++
+		return OperationResult{Txid: "tx1"}, nil
+	}
+
+	wallet.inspection = rgbInspection("rgb:a", rgbTransition(TypeOfTransitionTransfer, 100, 40, 60))
+	_, err := policy.SendEnd(wallet, Online{}, "signed", SendDetails{})
+	var policyErr *PolicyError
+	if !errors.Is(err, ErrPolicyViolation) || !errors.As(err, &policyErr) || ended != 0 {
+		t.Fatalf("SendEnd = %v after %d SendEnd calls, want a policy error", err, ended)
+	}
+	if _, err := policy.BurnEnd(wallet, Online{}, "signed", BurnDetails{}); !errors.Is(err, ErrPolicyViolation) {
+		t.Fatalf("BurnEnd of a transfer = %v, want %v", err, ErrPolicyViolation)
+	}
+
+	wallet.inspection = rgbInspection("rgb:a", rgbTransition(TypeOfTransitionTransfer, 100, 60, 40))
+	if res, err := policy.SendEnd(wallet, Online{}, "signed", SendDetails{}); err != nil || res.Txid != "tx1" || ended != 1 {
+		t.Fatalf("SendEnd = %+v, %v after %d SendEnd calls", res, err, ended)
+	}
+
+	for details, want := range map[any]RgbIntent{SendDetails{}: RgbIntentSend, &BurnDetails{}: RgbIntentBurn, InflateDetails{}: RgbIntentInflate} {
+		if intent, err := IntentOf(details); err != nil || intent != want {
+			t.Errorf("IntentOf(%T) = %s, %v, want %s", details, intent, err, want)
+		}
+	}
+	if _, err := IntentOf(OperationResult{}); err == nil {
+		t.Error("IntentOf(OperationResult) succeeded")
+	}
+}
@@ -0,0 +1,158 @@
+package rgb_lib
+
+import (
+	"context"
+	"fmt"
+)
+
+// Signer signs PSBTs on behalf of a wallet. Implementations may keep keys in
+// memory, call a remote service or drive a hardware device. SignPsbt receives a
+// base64 PSBT and returns it with the signatures added.
+type Signer interface {
+	SignPsbt(ctx context.Context, psbt string) (string, error)
+}
+
+// SignerFunc adapts a function to the Signer interface.
+type SignerFunc func(ctx context.Context, psbt string) (string, error)
+
+func (f SignerFunc) SignPsbt(ctx context.Context, psbt string) (string, error) {
+	return f(ctx, psbt)
+}
+
+// MnemonicSigner is implemented by Wallet when it holds a mnemonic.
+type MnemonicSigner interface {
+	SignPsbt(unsignedPsbt string) (string, error)
+}
+
+// NewWalletSigner returns a Signer using the in-memory mnemonic of a wallet.
+func NewWalletSigner(wallet MnemonicSigner) Signer {
+	return SignerFunc(func(ctx context.Context, psbt string) (string, error) {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		return wallet.SignPsbt(psbt)
+	})
+}
+
+// SigningWallet runs the Begin/End flows of a Wallet through a Signer, so that
+// a watch-only wallet (one without SinglesigKeys.Mnemonic) can complete
+// operations with a remote or hardware signer.
+//
+// If signing fails after the Begin call, the operation is left pending in the
+// wallet and the returned error wraps the signer error. The pending batch
+// transfer, if any, can be discarded with FailTransfers.
+type SigningWallet struct {
+	wallet WalletInterface
+	signer Signer
+}
+
+func NewSigningWallet(wallet WalletInterface, signer Signer) *SigningWallet {
+	return &SigningWallet{wallet: wallet, signer: signer}
+}
+
+// Wallet returns the wrapped wallet.
+func (w *SigningWallet) Wallet() WalletInterface {
+	return w.wallet
+}
+
+func (w *SigningWallet) Signer() Signer {
+	return w.signer
+}
+
+func (w *SigningWallet) sign(ctx context.Context, psbt string) (string, error) {
+	signed, err := w.signer.SignPsbt(ctx, psbt)
+	if err != nil {
+		return "", fmt.Errorf("sign psbt: %w", err)
+	}
+	return signed, nil
+}
+
+func (w *SigningWallet) Send(ctx context.Context, online Online, recipientMap map[string][]Recipient, donation bool, feeRate uint64, minConfirmations uint8, expirationTimestamp *uint64) (OperationResult, error) {
+	if err := ctx.Err(); err != nil {
+		return OperationResult{}, err
+	}
+	begin, err := w.wallet.SendBegin(online, recipientMap, donation, feeRate, minConfirmations, expirationTimestamp, false)
+	if err != nil {
+		return OperationResult{}, err
+	}
+	signed, err := w.sign(ctx, begin.Psbt)
+	if err != nil {
+		return OperationResult{}, err
+	}
+	return w.wallet.SendEnd(online, signed)
+}
+
+func (w *SigningWallet) CreateUtxos(ctx context.Context, online Online, upTo bool, num *uint8, size *uint32, feeRate uint64, skipSync bool) (uint8, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	psbt, err := w.wallet.CreateUtxosBegin(online, upTo, num, size, feeRate, skipSync, false)
+	if err != nil {
+		return 0, err
+	}
+	signed, err := w.sign(ctx, psbt)
+	if err != nil {
+		return 0, err
+	}
+	return w.wallet.CreateUtxosEnd(online, signed)
+}
+
+func (w *SigningWallet) DrainTo(ctx context.Context, online Online, address string, feeRate uint64) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	psbt, err := w.wallet.DrainToBegin(online, address, feeRate, false)
+	if err != nil {
+		return "", err
+	}
+	signed, err := w.sign(ctx, psbt)
+	if err != nil {
+		return "", err
+	}
+	return w.wallet.DrainToEnd(online, signed)
+}
+
+func (w *SigningWallet) Burn(ctx context.Context, online Online, assetId string, amount uint64, feeRate uint64, minConfirmations uint8) (OperationResult, error) {
+	if err := ctx.Err(); err != nil {
+		return OperationResult{}, err
+	}
+	begin, err := w.wallet.BurnBegin(online, assetId, amount, feeRate, minConfirmations, false)
+	if err != nil {
+		return OperationResult{}, err
+	}
+	signed, err := w.sign(ctx, begin.Psbt)
+	if err != nil {
+		return OperationResult{}, err
+	}
+	return w.wallet.BurnEnd(online, signed)
+}
+
+func (w *SigningWallet) Inflate(ctx context.Context, online Online, assetId string, inflationAmounts []uint64, feeRate uint64, minConfirmations uint8) (OperationResult, error) {
+	if err := ctx.Err(); err != nil {
+		return OperationResult{}, err
+	}
+	begin, err := w.wallet.InflateBegin(online, assetId, inflationAmounts, feeRate, minConfirmations, false)
+	if err != nil {
+		return OperationResult{}, err
+	}
+	signed, err := w.sign(ctx, begin.Psbt)
+	if err != nil {
+		return OperationResult{}, err
+	}
+	return w.wallet.InflateEnd(online, signed)
+}
+
+func (w *SigningWallet) SendBtc(ctx context.Context, online Online, address string, amount uint64, feeRate uint64, skipSync bool) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	psbt, err := w.wallet.SendBtcBegin(online, address, amount, feeRate, skipSync, false)
+	if err != nil {
+		return "", err
+	}
+	signed, err := w.sign(ctx, psbt)
+	if err != nil {
+		return "", err
+	}
+	return w.wallet.SendBtcEnd(online, signed)
+}
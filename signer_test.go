@@ -0,0 +1,83 @@
+package rgb_lib
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+type mnemonicSignerFunc func(unsignedPsbt string) (string, error)
+
+func (f mnemonicSignerFunc) SignPsbt(unsignedPsbt string) (string, error) {
+	return f(unsignedPsbt)
+}
+
+func TestSigningWalletSend(t *testing.T) {
+	errSigner := errors.New("signer error")
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, c := range []struct {
+		name     string
+		ctx      context.Context
+		beginErr error
+		signErr  error
+		endErr   error
+		want     error
+		begun    bool
+		signed   bool
+		ended    bool
+		wantTxid string
+	}{
+		{name: "ok", ctx: context.Background(), begun: true, signed: true, ended: true, wantTxid: "tx1"},
+		{name: "cancelled", ctx: cancelled, want: context.Canceled},
+		{name: "begin fails", ctx: context.Background(), beginErr: errTest, want: errTest, begun: true},
+		{name: "signer fails", ctx: context.Background(), signErr: errSigner, want: errSigner, begun: true, signed: true},
+		{name: "end fails", ctx: context.Background(), endErr: errTest, want: errTest, begun: true, signed: true, ended: true},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			wallet := newFakeWallet()
+			var begun, signed, ended bool
+			wallet.sendBegin = func(recipientMap map[string][]Recipient) (SendBeginResult, error) {
+				begun = true
+				return SendBeginResult{Psbt: "send"}, c.beginErr
+			}
+			wallet.sendEnd = func(psbt string) (OperationResult, error) {
+				ended = true
+				if psbt != "signed:send" {
+					t.Errorf("SendEnd got %q, want the signed PSBT", psbt)
+				}
+				return OperationResult{Txid: "tx1"}, c.endErr
+			}
+			signer := SignerFunc(func(ctx context.Context, psbt string) (string, error) {
+				signed = true
+				if c.signErr != nil {
+					return "", c.signErr
+				}
+				return echoSigner(ctx, psbt)
+			})
+			res, err := NewSigningWallet(wallet, signer).Send(c.ctx, Online{}, sendRecipients("r1", 10), false, 2, 1, nil)
+			if !errors.Is(err, c.want) || err == nil && res.Txid != c.wantTxid {
+				t.Fatalf("Send = %+v, %v, want %q, %v", res, err, c.wantTxid, c.want)
+			}
+			if begun != c.begun || signed != c.signed || ended != c.ended {
+				t.Fatalf("begun %t, signed %t, ended %t, want %t, %t, %t", begun, signed, ended, c.begun, c.signed, c.ended)
+			}
+		})
+	}
+}
+
+func TestWalletSigner(t *testing.T) {
+	var calls int
+	signer := NewWalletSigner(mnemonicSignerFunc(func(psbt string) (string, error) {
+		calls++
+		return "signed:" + psbt, nil
+	}))
+	if signed, err := signer.SignPsbt(context.Background(), "psbt"); err != nil || signed != "signed:psbt" {
+		t.Fatalf("SignPsbt = %q, %v", signed, err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := signer.SignPsbt(ctx, "psbt"); !errors.Is(err, context.Canceled) || calls != 1 {
+		t.Fatalf("SignPsbt = %v after %d calls, want %v without signing", err, calls, context.Canceled)
+	}
+}
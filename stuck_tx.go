@@ -0,0 +1,567 @@
+package rgb_lib
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/UTEXO-Protocol/rgb-lib-go/psbt"
+)
+
+// StuckTxWallet is the subset of Wallet needed by a StuckTxMonitor.
+type StuckTxWallet interface {
+	ListPendingVanillaTxs() ([]PendingVanillaTx, error)
+	ListTransactions(online *Online, skipSync bool) ([]Transaction, error)
+	ListUnspents(online *Online, settledOnly bool, skipSync bool) ([]Unspent, error)
+	AbortPendingVanillaTx(txid string) error
+	CreateUtxosBegin(online Online, upTo bool, num *uint8, size *uint32, feeRate uint64, skipSync bool, dryRun bool) (string, error)
+	CreateUtxosEnd(online Online, signedPsbt string) (uint8, error)
+	SendBtcBegin(online Online, address string, amount uint64, feeRate uint64, skipSync bool, dryRun bool) (string, error)
+	SendBtcEnd(online Online, signedPsbt string) (string, error)
+	DrainToBegin(online Online, address string, feeRate uint64, dryRun bool) (string, error)
+	DrainToEnd(online Online, signedPsbt string) (string, error)
+	MnemonicSigner
+}
+
+// VanillaOp holds the arguments of the call that created a vanilla
+// transaction, so that it can be made again at a higher fee rate. Only the
+// fields of its Type are used. Inputs lists the outpoints spent by the
+// transaction, as "txid:vout"; a replacement must spend at least one of them.
+type VanillaOp struct {
+	Type    WalletTransactionType `json:"type"`
+	FeeRate uint64                `json:"fee_rate"`
+	UpTo    bool                  `json:"up_to,omitempty"`
+	Num     *uint8                `json:"num,omitempty"`
+	Size    *uint32               `json:"size,omitempty"`
+	Address string                `json:"address,omitempty"`
+	Amount  uint64                `json:"amount,omitempty"`
+	Inputs  []string              `json:"inputs,omitempty"`
+}
+
+type StuckTxState string
+
+const (
+	StuckTxPending   StuckTxState = "pending"
+	StuckTxConfirmed StuckTxState = "confirmed"
+	// StuckTxAborted means the monitor aborted the transaction in the wallet
+	// but could not replace it. The transaction may still confirm, and the
+	// wallet may spend its inputs again. The monitor keeps checking it, and
+	// retries the replacement, until it confirms or one of its inputs is
+	// spent by another transaction.
+	StuckTxAborted StuckTxState = "aborted"
+	// StuckTxDropped means the transaction left the pending list without
+	// confirming, e.g. because it was aborted outside the monitor, or that
+	// an aborted transaction was conflicted.
+	StuckTxDropped StuckTxState = "dropped"
+)
+
+// Final reports whether the record can no longer change state.
+func (s StuckTxState) Final() bool {
+	return s != StuckTxPending && s != StuckTxAborted
+}
+
+// ReplacementAttempt records an abort and rebroadcast of a transaction.
+// ToTxid is empty and Error set when the attempt failed.
+type ReplacementAttempt struct {
+	At       int64  `json:"at"`
+	FromTxid string `json:"from_txid"`
+	ToTxid   string `json:"to_txid,omitempty"`
+	FeeRate  uint64 `json:"fee_rate"`
+	Error    string `json:"error,omitempty"`
+}
+
+// StuckTxRecord follows a vanilla transaction and its replacements. Id is the
+// txid of the first transaction and Txid the one currently pending.
+// BroadcastAt is the time the current transaction was broadcast through the
+// monitor; for transactions found by Check, FirstSeen and BroadcastAt are the
+// time of the first Check that saw them, which may be later than their
+// broadcast.
+type StuckTxRecord struct {
+	Id          string                `json:"id"`
+	Txid        string                `json:"txid"`
+	Type        WalletTransactionType `json:"type"`
+	Op          *VanillaOp            `json:"op,omitempty"`
+	State       StuckTxState          `json:"state"`
+	FirstSeen   int64                 `json:"first_seen"`
+	BroadcastAt int64                 `json:"broadcast_at"`
+	Alerted     bool                  `json:"alerted,omitempty"`
+	Attempts    []ReplacementAttempt  `json:"attempts,omitempty"`
+	UpdatedAt   int64                 `json:"updated_at"`
+}
+
+var ErrStuckTxNotFound = errors.New("stuck transaction record not found")
+
+// StuckTxStore persists StuckTxRecords. Get returns ErrStuckTxNotFound for
+// unknown IDs.
+type StuckTxStore interface {
+	Get(id string) (StuckTxRecord, error)
+	Put(record StuckTxRecord) error
+	Pending() ([]StuckTxRecord, error)
+}
+
+// MemoryStuckTxStore keeps records in memory. It is safe for concurrent use.
+type MemoryStuckTxStore struct {
+	*recordStore[StuckTxRecord]
+}
+
+func NewMemoryStuckTxStore() *MemoryStuckTxStore {
+	return &MemoryStuckTxStore{newRecordStore(stuckTxKey, compareStuckTxs, ErrStuckTxNotFound)}
+}
+
+func (s *MemoryStuckTxStore) Pending() ([]StuckTxRecord, error) {
+	return s.list(stuckTxPending), nil
+}
+
+// FileStuckTxStore keeps records in a JSON file, rewritten atomically on
+// every change.
+type FileStuckTxStore struct {
+	*recordStore[StuckTxRecord]
+}
+
+// NewFileStuckTxStore loads the records of the file at path, which is created
+// on the first Put if it does not exist.
+func NewFileStuckTxStore(path string) (*FileStuckTxStore, error) {
+	s, err := loadRecordStore(path, stuckTxKey, compareStuckTxs, ErrStuckTxNotFound)
+	if err != nil {
+		return nil, err
+	}
+	return &FileStuckTxStore{s}, nil
+}
+
+func (s *FileStuckTxStore) Pending() ([]StuckTxRecord, error) {
+	return s.list(stuckTxPending), nil
+}
+
+func stuckTxKey(r StuckTxRecord) string {
+	return r.Id
+}
+
+func compareStuckTxs(a, b StuckTxRecord) int {
+	return cmp.Compare(a.FirstSeen, b.FirstSeen)
+}
+
+func stuckTxPending(r StuckTxRecord) bool {
+	return !r.State.Final()
+}
+
+type StuckAlertKind string
+
+const (
+	// AlertStuck is raised once per transaction pending for AlertAfter.
+	AlertStuck    StuckAlertKind = "stuck"
+	AlertReplaced StuckAlertKind = "replaced"
+	// AlertReplaceFailed is raised when a replacement fails before the
+	// transaction is aborted, e.g. because the abort fails. Err is set.
+	AlertReplaceFailed StuckAlertKind = "replace_failed"
+	// AlertAborted is raised when a transaction was aborted but its
+	// replacement failed. The transaction may still confirm; the record is
+	// left StuckTxAborted. Err is set.
+	AlertAborted StuckAlertKind = "aborted"
+	// AlertFeeCeiling is raised when the bumped fee rate would exceed
+	// MaxFeeRate, and the transaction is left as is.
+	AlertFeeCeiling StuckAlertKind = "fee_ceiling"
+)
+
+type StuckAlert struct {
+	Kind   StuckAlertKind
+	Record StuckTxRecord
+	Err    error
+}
+
+// StuckTxPolicy decides when pending vanilla transactions are reported and
+// replaced.
+type StuckTxPolicy struct {
+	// AlertAfter is the age at which a transaction is reported as stuck.
+	// Zero means one hour.
+	AlertAfter time.Duration
+	// ReplaceAfter is the age at which a transaction is aborted and made
+	// again at a higher fee rate. Zero disables replacement. Only
+	// transactions created through the monitor, or passed to Track, can be
+	// replaced.
+	ReplaceAfter time.Duration
+	// Replace lists the transaction types that may be replaced. Nil allows
+	// all of them.
+	Replace []WalletTransactionType
+	// MaxAttempts caps the replacements of a transaction. Zero means 3.
+	MaxAttempts int
+	// BumpFactor multiplies the fee rate at each replacement, which grows by
+	// at least 1 sat/vB. Zero means 1.5.
+	BumpFactor float64
+	// MaxFeeRate caps replacement fee rates. Zero means no cap.
+	MaxFeeRate uint64
+	// Fees, if set, raises replacement fee rates to its current quote.
+	Fees    *FeePolicy
+	OnAlert func(StuckAlert)
+}
+
+// StuckTxMonitor follows the pending vanilla transactions of a wallet, from
+// CreateUtxos, SendBtc and DrainTo, against their confirmation status. It
+// reports transactions pending for too long and, where the policy allows,
+// aborts them with AbortPendingVanillaTx and makes the same call again at a
+// higher fee rate. The replacement is built with the Begin call of the
+// operation and only signed and broadcast if it spends an input of the
+// transaction it replaces, so that the two conflict. Every replacement
+// attempt is recorded in the store. When the replacement fails after the
+// abort, the record is left StuckTxAborted and AlertAborted is raised.
+//
+// PSBTs are signed with the mnemonic of the wallet, unless WithSigner is
+// used.
+type StuckTxMonitor struct {
+	wallet StuckTxWallet
+	signer Signer
+	online Online
+	store  StuckTxStore
+	policy StuckTxPolicy
+	now    func() time.Time
+
+	mu sync.Mutex
+}
+
+func NewStuckTxMonitor(wallet StuckTxWallet, online Online, store StuckTxStore, policy StuckTxPolicy) *StuckTxMonitor {
+	if policy.AlertAfter <= 0 {
+		policy.AlertAfter = time.Hour
+	}
+	if policy.MaxAttempts <= 0 {
+		policy.MaxAttempts = 3
+	}
+	if policy.BumpFactor <= 0 {
+		policy.BumpFactor = 1.5
+	}
+	return &StuckTxMonitor{wallet: wallet, signer: NewWalletSigner(wallet), online: online, store: store, policy: policy, now: time.Now}
+}
+
+// WithSigner signs PSBTs with signer, for watch-only wallets.
+func (m *StuckTxMonitor) WithSigner(signer Signer) *StuckTxMonitor {
+	m.signer = signer
+	return m
+}
+
+// Track records the call that created txid, making it replaceable. op.Inputs
+// must list the outpoints spent by txid, or replacements are refused.
+func (m *StuckTxMonitor) Track(txid string, op VanillaOp) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.track(txid, op)
+}
+
+func (m *StuckTxMonitor) track(txid string, op VanillaOp) error {
+	now := m.now().Unix()
+	record, err := m.store.Get(txid)
+	if errors.Is(err, ErrStuckTxNotFound) {
+		record = StuckTxRecord{Id: txid, Txid: txid, Type: op.Type, State: StuckTxPending, FirstSeen: now, BroadcastAt: now}
+	} else if err != nil {
+		return err
+	}
+	record.Op = &op
+	record.UpdatedAt = now
+	return m.store.Put(record)
+}
+
+// CreateUtxos creates UTXOs with CreateUtxosBegin and CreateUtxosEnd and
+// tracks the transaction.
+func (m *StuckTxMonitor) CreateUtxos(ctx context.Context, upTo bool, num *uint8, size *uint32, feeRate uint64, skipSync bool) (uint8, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	op := VanillaOp{Type: WalletTransactionTypeCreateUtxos, FeeRate: feeRate, UpTo: upTo, Num: num, Size: size}
+	_, created, err := m.run(ctx, op, skipSync)
+	return created, err
+}
+
+// SendBtc sends bitcoin with SendBtcBegin and SendBtcEnd and tracks the
+// transaction.
+func (m *StuckTxMonitor) SendBtc(ctx context.Context, address string, amount uint64, feeRate uint64, skipSync bool) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	op := VanillaOp{Type: WalletTransactionTypeSendBtc, FeeRate: feeRate, Address: address, Amount: amount}
+	txid, _, err := m.run(ctx, op, skipSync)
+	return txid, err
+}
+
+// DrainTo drains the wallet with DrainToBegin and DrainToEnd and tracks the
+// transaction.
+func (m *StuckTxMonitor) DrainTo(ctx context.Context, address string, feeRate uint64) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	op := VanillaOp{Type: WalletTransactionTypeDrain, FeeRate: feeRate, Address: address}
+	txid, _, err := m.run(ctx, op, false)
+	return txid, err
+}
+
+// run makes the call of op and tracks the resulting transaction. It must be
+// called with m.mu held.
+func (m *StuckTxMonitor) run(ctx context.Context, op VanillaOp, skipSync bool) (string, uint8, error) {
+	unsigned, packet, err := m.begin(op, skipSync)
+	if err != nil {
+		return "", 0, err
+	}
+	op.Inputs = spentOutpoints(packet)
+	created, err := m.end(ctx, op, unsigned)
+	if err != nil {
+		return "", 0, err
+	}
+	txid := packet.UnsignedTx.Txid()
+	return txid, created, m.track(txid, op)
+}
+
+// begin makes the Begin call of op and parses the unsigned PSBT.
+func (m *StuckTxMonitor) begin(op VanillaOp, skipSync bool) (string, *psbt.Packet, error) {
+	var unsigned string
+	var err error
+	switch op.Type {
+	case WalletTransactionTypeCreateUtxos:
+		unsigned, err = m.wallet.CreateUtxosBegin(m.online, op.UpTo, op.Num, op.Size, op.FeeRate, skipSync, false)
+	case WalletTransactionTypeSendBtc:
+		unsigned, err = m.wallet.SendBtcBegin(m.online, op.Address, op.Amount, op.FeeRate, skipSync, false)
+	case WalletTransactionTypeDrain:
+		unsigned, err = m.wallet.DrainToBegin(m.online, op.Address, op.FeeRate, false)
+	default:
+		return "", nil, fmt.Errorf("cannot make %s transactions", op.Type)
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	packet, err := psbt.Parse(unsigned)
+	if err != nil {
+		return "", nil, fmt.Errorf("parse psbt: %w", err)
+	}
+	return unsigned, packet, nil
+}
+
+// end signs unsigned and makes the End call of op, returning the number of
+// UTXOs created by CreateUtxos.
+func (m *StuckTxMonitor) end(ctx context.Context, op VanillaOp, unsigned string) (uint8, error) {
+	signed, err := m.signer.SignPsbt(ctx, unsigned)
+	if err != nil {
+		return 0, fmt.Errorf("sign psbt: %w", err)
+	}
+	switch op.Type {
+	case WalletTransactionTypeCreateUtxos:
+		return m.wallet.CreateUtxosEnd(m.online, signed)
+	case WalletTransactionTypeSendBtc:
+		_, err = m.wallet.SendBtcEnd(m.online, signed)
+	case WalletTransactionTypeDrain:
+		_, err = m.wallet.DrainToEnd(m.online, signed)
+	}
+	return 0, err
+}
+
+func spentOutpoints(packet *psbt.Packet) []string {
+	outpoints := make([]string, 0, len(packet.UnsignedTx.Inputs))
+	for _, in := range packet.UnsignedTx.Inputs {
+		outpoints = append(outpoints, in.PrevOutpoint())
+	}
+	return outpoints
+}
+
+// Check syncs the wallet, updates the records of the pending vanilla
+// transactions and applies the policy to them.
+func (m *StuckTxMonitor) Check(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	pending, err := m.wallet.ListPendingVanillaTxs()
+	if err != nil {
+		return err
+	}
+	txs, err := m.wallet.ListTransactions(&m.online, false)
+	if err != nil {
+		return err
+	}
+	known, confirmed := map[string]bool{}, map[string]bool{}
+	for _, tx := range txs {
+		known[tx.Txid] = true
+		if tx.ConfirmationTime != nil {
+			confirmed[tx.Txid] = true
+		}
+	}
+	records, err := m.store.Pending()
+	if err != nil {
+		return err
+	}
+	byTxid := map[string]StuckTxRecord{}
+	for _, r := range records {
+		byTxid[r.Txid] = r
+	}
+
+	now := m.now().Unix()
+	var errs []error
+	stillPending := map[string]bool{}
+	for _, p := range pending {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		stillPending[p.Txid] = true
+		record, ok := byTxid[p.Txid]
+		if !ok || record.State == StuckTxAborted {
+			if !ok {
+				record = StuckTxRecord{Id: p.Txid, Txid: p.Txid, Type: p.Type, FirstSeen: now, BroadcastAt: now}
+			}
+			record.State, record.UpdatedAt = StuckTxPending, now
+			if err := m.store.Put(record); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+		}
+		if confirmed[p.Txid] {
+			continue
+		}
+		errs = append(errs, m.apply(ctx, record, now))
+	}
+	var unspent map[string]bool
+	for _, r := range records {
+		if stillPending[r.Txid] {
+			continue
+		}
+		switch {
+		case confirmed[r.Txid]:
+			r.State = StuckTxConfirmed
+		case r.State == StuckTxAborted:
+			if unspent == nil {
+				if unspent, err = m.unspentOutpoints(); err != nil {
+					errs = append(errs, err)
+					continue
+				}
+			}
+			if known[r.Txid] || !slices.ContainsFunc(r.Op.Inputs, func(in string) bool { return !unspent[in] }) {
+				errs = append(errs, m.apply(ctx, r, now))
+				continue
+			}
+			// an input is spent by another transaction
+			r.State = StuckTxDropped
+		default:
+			r.State = StuckTxDropped
+		}
+		r.UpdatedAt = now
+		errs = append(errs, m.store.Put(r))
+	}
+	return errors.Join(errs...)
+}
+
+func (m *StuckTxMonitor) unspentOutpoints() (map[string]bool, error) {
+	unspents, err := m.wallet.ListUnspents(&m.online, false, true)
+	if err != nil {
+		return nil, err
+	}
+	outpoints := map[string]bool{}
+	for _, u := range unspents {
+		outpoints[fmt.Sprintf("%s:%d", u.Utxo.Outpoint.Txid, u.Utxo.Outpoint.Vout)] = true
+	}
+	return outpoints, nil
+}
+
+func (m *StuckTxMonitor) apply(ctx context.Context, record StuckTxRecord, now int64) error {
+	age := time.Duration(now-record.BroadcastAt) * time.Second
+	if age >= m.policy.AlertAfter && !record.Alerted {
+		record.Alerted = true
+		record.UpdatedAt = now
+		if err := m.store.Put(record); err != nil {
+			return err
+		}
+		m.alert(AlertStuck, record, nil)
+	}
+	if m.policy.ReplaceAfter <= 0 || age < m.policy.ReplaceAfter || record.Op == nil ||
+		len(record.Attempts) >= m.policy.MaxAttempts ||
+		(m.policy.Replace != nil && !slices.Contains(m.policy.Replace, record.Type)) {
+		return nil
+	}
+	return m.replace(ctx, record, now)
+}
+
+func (m *StuckTxMonitor) bump(feeRate uint64) uint64 {
+	rate := max(uint64(math.Ceil(float64(feeRate)*m.policy.BumpFactor)), feeRate+1)
+	if m.policy.Fees != nil {
+		if quote, err := m.policy.Fees.FeeRate(); err == nil {
+			rate = max(rate, quote)
+		}
+	}
+	return rate
+}
+
+// replace aborts the transaction of record and makes its call again at a
+// bumped fee rate.
+func (m *StuckTxMonitor) replace(ctx context.Context, record StuckTxRecord, now int64) error {
+	op := *record.Op
+	op.FeeRate = m.bump(record.Op.FeeRate)
+	if m.policy.MaxFeeRate > 0 && op.FeeRate > m.policy.MaxFeeRate {
+		m.alert(AlertFeeCeiling, record, nil)
+		return nil
+	}
+	attempt := ReplacementAttempt{At: now, FromTxid: record.Txid, FeeRate: op.FeeRate}
+	txid, aborted, err := m.rebroadcast(ctx, record, &op)
+	if err != nil {
+		attempt.Error = err.Error()
+		if aborted {
+			record.State = StuckTxAborted
+		}
+	} else {
+		attempt.ToTxid = txid
+		record.Txid = txid
+		record.Op = &op
+		record.State = StuckTxPending
+		record.BroadcastAt = now
+		record.Alerted = false
+	}
+	record.Attempts = append(record.Attempts, attempt)
+	record.UpdatedAt = now
+	if perr := m.store.Put(record); perr != nil {
+		return errors.Join(err, perr)
+	}
+	if err != nil {
+		kind := AlertReplaceFailed
+		if aborted {
+			kind = AlertAborted
+			err = fmt.Errorf("%w; %s is aborted in the wallet but may still confirm", err, attempt.FromTxid)
+		}
+		m.alert(kind, record, err)
+		return fmt.Errorf("replace %s: %w", attempt.FromTxid, err)
+	}
+	m.alert(AlertReplaced, record, nil)
+	return nil
+}
+
+// rebroadcast aborts the transaction of record, unless it is aborted
+// already, and builds its replacement from op, setting op.Inputs to the
+// inputs of the replacement. The abort comes first, so that the wallet can
+// spend the inputs of the transaction again. If the replacement cannot be
+// made or spends none of them, it is not broadcast: the transaction stays
+// aborted in the wallet, but may still confirm, as it is not conflicted.
+// aborted reports whether the transaction is aborted.
+func (m *StuckTxMonitor) rebroadcast(ctx context.Context, record StuckTxRecord, op *VanillaOp) (txid string, aborted bool, err error) {
+	if len(op.Inputs) == 0 {
+		return "", false, fmt.Errorf("inputs of %s are unknown", record.Txid)
+	}
+	if record.State != StuckTxAborted {
+		if err := m.wallet.AbortPendingVanillaTx(record.Txid); err != nil {
+			return "", false, fmt.Errorf("abort: %w", err)
+		}
+	}
+	unsigned, packet, err := m.begin(*op, false)
+	if err != nil {
+		return "", true, err
+	}
+	inputs := spentOutpoints(packet)
+	if !slices.ContainsFunc(inputs, func(in string) bool { return slices.Contains(op.Inputs, in) }) {
+		return "", true, fmt.Errorf("replacement spends none of the inputs of %s", record.Txid)
+	}
+	if _, err := m.end(ctx, *op, unsigned); err != nil {
+		return "", true, err
+	}
+	op.Inputs = inputs
+	return packet.UnsignedTx.Txid(), true, nil
+}
+
+func (m *StuckTxMonitor) alert(kind StuckAlertKind, record StuckTxRecord, err error) {
+	if m.policy.OnAlert != nil {
+		m.policy.OnAlert(StuckAlert{Kind: kind, Record: record, Err: err})
+	}
+}
+
+// Run calls Check every interval until ctx is done, passing its errors to
+// onError.
+func (m *StuckTxMonitor) Run(ctx context.Context, interval time.Duration, onError func(error)) error {
+	return runEvery(ctx, interval, onError, m.Check)
+}
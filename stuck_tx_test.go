@@ -0,0 +1,256 @@
+package rgb_lib
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/UTEXO-Protocol/rgb-lib-go/psbt"
+)
+
+// testPsbt returns a version 0 PSBT spending the given "txid:vout" outpoints
+// to a single output.
+func testPsbt(t *testing.T, inputs ...string) string {
+	t.Helper()
+	var tx bytes.Buffer
+	binary.Write(&tx, binary.LittleEndian, uint32(2))
+	tx.WriteByte(byte(len(inputs)))
+	for _, in := range inputs {
+		txid, vout, _ := strings.Cut(in, ":")
+		hash, err := hex.DecodeString(txid)
+		if err != nil || len(hash) != 32 {
+			t.Fatalf("bad outpoint %q", in)
+		}
+		slices.Reverse(hash)
+		n, err := strconv.ParseUint(vout, 10, 32)
+		if err != nil {
+			t.Fatalf("bad outpoint %q", in)
+		}
+		tx.Write(hash)
+		binary.Write(&tx, binary.LittleEndian, uint32(n))
+		tx.WriteByte(0)
+		binary.Write(&tx, binary.LittleEndian, uint32(0xfffffffd))
+	}
+	tx.WriteByte(1)
+	binary.Write(&tx, binary.LittleEndian, uint64(1000))
+	tx.Write([]byte{1, 0x51})
+	binary.Write(&tx, binary.LittleEndian, uint32(0))
+
+	var p bytes.Buffer
+	p.WriteString("psbt\xff")
+	p.Write([]byte{1, 0})
+	p.WriteByte(byte(tx.Len()))
+	p.Write(tx.Bytes())
+	p.WriteByte(0)
+	p.Write(bytes.Repeat([]byte{0}, len(inputs)+1))
+	return base64.StdEncoding.EncodeToString(p.Bytes())
+}
+
+func psbtTxid(t *testing.T, s string) string {
+	t.Helper()
+	packet, err := psbt.Parse(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return packet.UnsignedTx.Txid()
+}
+
+func outpoint(n int) string {
+	return fmt.Sprintf("%064x:0", n)
+}
+
+// fakeStuckTxWallet serves SendBtc calls with the PSBT in next, or fails them
+// with beginErr.
+type fakeStuckTxWallet struct {
+	pending  []PendingVanillaTx
+	txs      []Transaction
+	unspents []Unspent
+	next     string
+	beginErr error
+	aborted  []string
+	ended    []string
+}
+
+func (w *fakeStuckTxWallet) ListPendingVanillaTxs() ([]PendingVanillaTx, error) {
+	return w.pending, nil
+}
+
+func (w *fakeStuckTxWallet) ListTransactions(online *Online, skipSync bool) ([]Transaction, error) {
+	return w.txs, nil
+}
+
+func (w *fakeStuckTxWallet) ListUnspents(online *Online, settledOnly bool, skipSync bool) ([]Unspent, error) {
+	return w.unspents, nil
+}
+
+func (w *fakeStuckTxWallet) AbortPendingVanillaTx(txid string) error {
+	w.aborted = append(w.aborted, txid)
+	w.pending = slices.DeleteFunc(w.pending, func(p PendingVanillaTx) bool { return p.Txid == txid })
+	return nil
+}
+
+func (w *fakeStuckTxWallet) CreateUtxosBegin(online Online, upTo bool, num *uint8, size *uint32, feeRate uint64, skipSync bool, dryRun bool) (string, error) {
+	return "", errors.New("unexpected CreateUtxosBegin")
+}
+
+func (w *fakeStuckTxWallet) CreateUtxosEnd(online Online, signedPsbt string) (uint8, error) {
+	return 0, errors.New("unexpected CreateUtxosEnd")
+}
+
+func (w *fakeStuckTxWallet) SendBtcBegin(online Online, address string, amount uint64, feeRate uint64, skipSync bool, dryRun bool) (string, error) {
+	return w.next, w.beginErr
+}
+
+func (w *fakeStuckTxWallet) SendBtcEnd(online Online, signedPsbt string) (string, error) {
+	w.ended = append(w.ended, signedPsbt)
+	return "", nil
+}
+
+func (w *fakeStuckTxWallet) DrainToBegin(online Online, address string, feeRate uint64, dryRun bool) (string, error) {
+	return "", errors.New("unexpected DrainToBegin")
+}
+
+func (w *fakeStuckTxWallet) DrainToEnd(online Online, signedPsbt string) (string, error) {
+	return "", errors.New("unexpected DrainToEnd")
+}
+
+func (w *fakeStuckTxWallet) SignPsbt(unsignedPsbt string) (string, error) {
+	return unsignedPsbt, nil
+}
+
+func unspentAt(op string) Unspent {
+	txid, vout, _ := strings.Cut(op, ":")
+	n, _ := strconv.ParseUint(vout, 10, 32)
+	return Unspent{Utxo: Utxo{Outpoint: Outpoint{Txid: txid, Vout: uint32(n)}, Exists: true}}
+}
+
+// newStuckTxTest tracks a SendBtc transaction spending outpoint(1), pending
+// for two hours, on a monitor replacing transactions after one hour.
+func newStuckTxTest(t *testing.T) (*StuckTxMonitor, *fakeStuckTxWallet, string, *[]StuckAlert) {
+	t.Helper()
+	wallet := &fakeStuckTxWallet{}
+	var alerts []StuckAlert
+	store := NewMemoryStuckTxStore()
+	m := NewStuckTxMonitor(wallet, Online{}, store, StuckTxPolicy{
+		ReplaceAfter: time.Hour,
+		OnAlert:      func(a StuckAlert) { alerts = append(alerts, a) },
+	})
+	start := time.Now()
+	m.now = func() time.Time { return start }
+	wallet.next = testPsbt(t, outpoint(1))
+	txid, err := m.SendBtc(context.Background(), "addr", 1000, 2, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wallet.pending = []PendingVanillaTx{{Txid: txid, Type: WalletTransactionTypeSendBtc}}
+	wallet.unspents = []Unspent{unspentAt(outpoint(1))}
+	m.now = func() time.Time { return start.Add(2 * time.Hour) }
+	return m, wallet, txid, &alerts
+}
+
+func stuckTxRecord(t *testing.T, m *StuckTxMonitor, id string) StuckTxRecord {
+	t.Helper()
+	r, err := m.store.Get(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func lastAlert(t *testing.T, alerts []StuckAlert) StuckAlert {
+	t.Helper()
+	if len(alerts) == 0 {
+		t.Fatal("no alert")
+	}
+	return alerts[len(alerts)-1]
+}
+
+func TestStuckTxBeginFailsAfterAbort(t *testing.T) {
+	m, wallet, txid, alerts := newStuckTxTest(t)
+	wallet.beginErr = errTest
+	if err := m.Check(context.Background()); !errors.Is(err, errTest) {
+		t.Fatalf("Check = %v, want %v", err, errTest)
+	}
+	if !slices.Equal(wallet.aborted, []string{txid}) {
+		t.Fatalf("aborted %v, want [%s]", wallet.aborted, txid)
+	}
+	if a := lastAlert(t, *alerts); a.Kind != AlertAborted || !errors.Is(a.Err, errTest) {
+		t.Fatalf("alert %s %v, want %s", a.Kind, a.Err, AlertAborted)
+	}
+	if r := stuckTxRecord(t, m, txid); r.State != StuckTxAborted || r.Txid != txid {
+		t.Fatalf("record %s %s, want %s %s", r.State, r.Txid, StuckTxAborted, txid)
+	}
+
+	// the aborted transaction is still followed, and replaced once possible
+	wallet.beginErr = nil
+	wallet.next = testPsbt(t, outpoint(1), outpoint(2))
+	if err := m.Check(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(wallet.aborted) != 1 {
+		t.Fatalf("aborted %d times, want 1", len(wallet.aborted))
+	}
+	r := stuckTxRecord(t, m, txid)
+	if want := psbtTxid(t, wallet.next); r.State != StuckTxPending || r.Txid != want {
+		t.Fatalf("record %s %s, want %s %s", r.State, r.Txid, StuckTxPending, want)
+	}
+	if len(r.Attempts) != 2 || r.Attempts[0].Error == "" || r.Attempts[1].ToTxid != r.Txid {
+		t.Fatalf("attempts %+v", r.Attempts)
+	}
+}
+
+func TestStuckTxAbortedConfirmsOrConflicts(t *testing.T) {
+	for _, c := range []struct {
+		name   string
+		update func(w *fakeStuckTxWallet, txid string)
+		want   StuckTxState
+	}{
+		{"confirmed", func(w *fakeStuckTxWallet, txid string) {
+			w.txs = []Transaction{{Txid: txid, ConfirmationTime: &BlockTime{}}}
+		}, StuckTxConfirmed},
+		{"conflicted", func(w *fakeStuckTxWallet, txid string) {
+			w.unspents = nil
+		}, StuckTxDropped},
+		{"unconfirmed", func(w *fakeStuckTxWallet, txid string) {
+			w.txs = []Transaction{{Txid: txid}}
+			w.unspents = nil
+		}, StuckTxAborted},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			m, wallet, txid, _ := newStuckTxTest(t)
+			wallet.beginErr = errTest
+			m.Check(context.Background())
+			c.update(wallet, txid)
+			m.Check(context.Background())
+			if r := stuckTxRecord(t, m, txid); r.State != c.want {
+				t.Fatalf("state %s, want %s", r.State, c.want)
+			}
+		})
+	}
+}
+
+func TestStuckTxReplacementWithoutSharedInput(t *testing.T) {
+	m, wallet, txid, alerts := newStuckTxTest(t)
+	wallet.next = testPsbt(t, outpoint(3))
+	if err := m.Check(context.Background()); err == nil {
+		t.Fatal("Check replaced the transaction with one spending none of its inputs")
+	}
+	if len(wallet.ended) != 1 {
+		t.Fatalf("%d End calls, want only the original one", len(wallet.ended))
+	}
+	if a := lastAlert(t, *alerts); a.Kind != AlertAborted {
+		t.Fatalf("alert %s, want %s", a.Kind, AlertAborted)
+	}
+	if r := stuckTxRecord(t, m, txid); r.State != StuckTxAborted || r.Txid != txid {
+		t.Fatalf("record %s %s, want %s %s", r.State, r.Txid, StuckTxAborted, txid)
+	}
+}
@@ -0,0 +1,389 @@
+package rgb_lib
+
+import (
+	"container/heap"
+	"errors"
+	"fmt"
+	"iter"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TransferSource is the subset of Wallet and MultisigWallet needed to query
+// transfers across assets.
+type TransferSource interface {
+	ListAssets(filterAssetSchemas []AssetSchema) (Assets, error)
+	ListTransfers(assetFilter AssetFilter, txid *string) ([]Transfer, error)
+}
+
+// AssetTransfer is a Transfer along with the asset it belongs to. AssetId is
+// nil for transfers that are not bound to any asset.
+type AssetTransfer struct {
+	AssetId *string
+	Transfer
+}
+
+type TransferOrder uint8
+
+const (
+	TransferOrderCreatedAsc TransferOrder = iota
+	TransferOrderCreatedDesc
+)
+
+var ErrInvalidTransferCursor = errors.New("invalid transfer cursor")
+
+// TransferCursor points at the last transfer of a page. Transfers are ordered
+// by CreatedAt and then by Idx, which is unique within a wallet.
+type TransferCursor struct {
+	CreatedAt int64
+	Idx       int32
+}
+
+// String encodes the cursor so that it can be handed to API clients.
+func (c TransferCursor) String() string {
+	return fmt.Sprintf("%d-%d", c.CreatedAt, c.Idx)
+}
+
+// ParseTransferCursor decodes a cursor produced by TransferCursor.String.
+func ParseTransferCursor(s string) (TransferCursor, error) {
+	sep := strings.LastIndexByte(s, '-')
+	if sep <= 0 {
+		return TransferCursor{}, fmt.Errorf("%w: %q", ErrInvalidTransferCursor, s)
+	}
+	createdAt, idx := s[:sep], s[sep+1:]
+	c, err := strconv.ParseInt(createdAt, 10, 64)
+	if err != nil {
+		return TransferCursor{}, fmt.Errorf("%w: %q", ErrInvalidTransferCursor, s)
+	}
+	i, err := strconv.ParseInt(idx, 10, 32)
+	if err != nil {
+		return TransferCursor{}, fmt.Errorf("%w: %q", ErrInvalidTransferCursor, s)
+	}
+	return TransferCursor{CreatedAt: c, Idx: int32(i)}, nil
+}
+
+func cursorOf(t Transfer) TransferCursor {
+	return TransferCursor{CreatedAt: t.CreatedAt, Idx: t.Idx}
+}
+
+func (c TransferCursor) less(o TransferCursor) bool {
+	if c.CreatedAt != o.CreatedAt {
+		return c.CreatedAt < o.CreatedAt
+	}
+	return c.Idx < o.Idx
+}
+
+// TransferPage is a page of query results. Next is nil on the last page.
+type TransferPage struct {
+	Transfers []AssetTransfer
+	Next      *TransferCursor
+}
+
+// TransferQuery selects transfers across one or more assets. Queries are
+// immutable values: every method returns an updated copy, so a base query can
+// be shared and refined per request.
+//
+//	page, err := NewTransferQuery().
+//		WithAssets(assetId).
+//		WithStatus(TransferStatusSettled).
+//		OrderBy(TransferOrderCreatedDesc).
+//		Limit(50).
+//		Run(wallet)
+type TransferQuery struct {
+	assetIds   []string
+	noAsset    bool
+	txid       *string
+	statuses   []TransferStatus
+	kinds      []TransferKind
+	from       *int64
+	to         *int64
+	recipients []string
+	predicates []func(AssetTransfer) bool
+	order      TransferOrder
+	limit      int
+	after      *TransferCursor
+}
+
+// NewTransferQuery returns a query matching every transfer of every asset
+// known to the wallet, including transfers not bound to an asset.
+func NewTransferQuery() TransferQuery {
+	return TransferQuery{noAsset: true}
+}
+
+// WithAssets restricts the query to the given assets. Transfers not bound to
+// an asset are excluded unless WithNoAsset is also used.
+func (q TransferQuery) WithAssets(assetIds ...string) TransferQuery {
+	q.assetIds = append(slices.Clip(q.assetIds), assetIds...)
+	q.noAsset = false
+	return q
+}
+
+// WithNoAsset includes transfers that are not bound to any asset.
+func (q TransferQuery) WithNoAsset() TransferQuery {
+	q.noAsset = true
+	return q
+}
+
+// WithTxid restricts the query to transfers of a single bitcoin transaction.
+func (q TransferQuery) WithTxid(txid string) TransferQuery {
+	q.txid = &txid
+	return q
+}
+
+func (q TransferQuery) WithStatus(statuses ...TransferStatus) TransferQuery {
+	q.statuses = append(slices.Clip(q.statuses), statuses...)
+	return q
+}
+
+func (q TransferQuery) WithKind(kinds ...TransferKind) TransferQuery {
+	q.kinds = append(slices.Clip(q.kinds), kinds...)
+	return q
+}
+
+// CreatedBetween restricts the query to transfers created in [from, to). A
+// zero time leaves that side of the range open.
+func (q TransferQuery) CreatedBetween(from, to time.Time) TransferQuery {
+	q.from, q.to = nil, nil
+	if !from.IsZero() {
+		f := from.Unix()
+		q.from = &f
+	}
+	if !to.IsZero() {
+		t := to.Unix()
+		q.to = &t
+	}
+	return q
+}
+
+func (q TransferQuery) WithRecipientId(recipientIds ...string) TransferQuery {
+	q.recipients = append(slices.Clip(q.recipients), recipientIds...)
+	return q
+}
+
+// Where adds a custom predicate. All predicates must match.
+func (q TransferQuery) Where(predicate func(AssetTransfer) bool) TransferQuery {
+	q.predicates = append(slices.Clip(q.predicates), predicate)
+	return q
+}
+
+func (q TransferQuery) OrderBy(order TransferOrder) TransferQuery {
+	q.order = order
+	return q
+}
+
+// Limit sets the page size. Zero means no limit.
+func (q TransferQuery) Limit(n int) TransferQuery {
+	q.limit = max(n, 0)
+	return q
+}
+
+// After resumes the query after the given cursor, following the query order.
+func (q TransferQuery) After(cursor TransferCursor) TransferQuery {
+	q.after = &cursor
+	return q
+}
+
+// Matches reports whether a transfer satisfies the query filters, ignoring the
+// asset selection and the cursor.
+func (q TransferQuery) Matches(t AssetTransfer) bool {
+	if len(q.statuses) > 0 && !slices.Contains(q.statuses, t.Status) {
+		return false
+	}
+	if len(q.kinds) > 0 && !slices.Contains(q.kinds, t.Kind) {
+		return false
+	}
+	if q.from != nil && t.CreatedAt < *q.from {
+		return false
+	}
+	if q.to != nil && t.CreatedAt >= *q.to {
+		return false
+	}
+	if len(q.recipients) > 0 && (t.RecipientId == nil || !slices.Contains(q.recipients, *t.RecipientId)) {
+		return false
+	}
+	for _, p := range q.predicates {
+		if !p(t) {
+			return false
+		}
+	}
+	return true
+}
+
+// precedes reports whether a sorts before b in the query order.
+func (q TransferQuery) precedes(a, b TransferCursor) bool {
+	if q.order == TransferOrderCreatedDesc {
+		return b.less(a)
+	}
+	return a.less(b)
+}
+
+func (q TransferQuery) afterCursor(t Transfer) bool {
+	return q.after == nil || q.precedes(*q.after, cursorOf(t))
+}
+
+// scan lists the transfers of every selected asset and calls yield for the
+// ones matching the query and the cursor.
+func (q TransferQuery) scan(src TransferSource, yield func(AssetTransfer)) error {
+	assetIds := q.assetIds
+	if assetIds == nil {
+		assets, err := src.ListAssets(nil)
+		if err != nil {
+			return err
+		}
+		assetIds = AssetIds(assets)
+	}
+	for _, assetId := range assetIds {
+		transfers, err := src.ListTransfers(AssetFilterId{AssetId: assetId}, q.txid)
+		if err != nil {
+			return err
+		}
+		for _, t := range transfers {
+			at := AssetTransfer{AssetId: &assetId, Transfer: t}
+			if q.afterCursor(t) && q.Matches(at) {
+				yield(at)
+			}
+		}
+	}
+	if q.noAsset {
+		transfers, err := src.ListTransfers(AssetFilterNone{}, q.txid)
+		if err != nil {
+			return err
+		}
+		for _, t := range transfers {
+			at := AssetTransfer{Transfer: t}
+			if q.afterCursor(t) && q.Matches(at) {
+				yield(at)
+			}
+		}
+	}
+	return nil
+}
+
+// Run executes the query and returns the first page after the cursor. When a
+// limit is set only the best limit+1 candidates are kept while scanning, so
+// paging through a large history does not sort it all on every request.
+func (q TransferQuery) Run(src TransferSource) (TransferPage, error) {
+	if q.limit == 0 {
+		transfers, err := q.collect(src)
+		return TransferPage{Transfers: transfers}, err
+	}
+
+	// max-heap on the query order holding the limit+1 first matches
+	top := &transferHeap{query: q}
+	err := q.scan(src, func(t AssetTransfer) {
+		if top.Len() <= q.limit {
+			heap.Push(top, t)
+		} else if q.precedes(cursorOf(t.Transfer), cursorOf(top.items[0].Transfer)) {
+			top.items[0] = t
+			heap.Fix(top, 0)
+		}
+	})
+	if err != nil {
+		return TransferPage{}, err
+	}
+	transfers := top.items
+	q.sort(transfers)
+	page := TransferPage{Transfers: transfers}
+	if len(transfers) > q.limit {
+		page.Transfers = transfers[:q.limit]
+		next := cursorOf(page.Transfers[q.limit-1].Transfer)
+		page.Next = &next
+	}
+	return page, nil
+}
+
+// All executes the query and iterates over every match in order, starting
+// after the cursor. The limit, if set, caps the number of yielded transfers.
+// The wallet is read once, before the first value is yielded.
+func (q TransferQuery) All(src TransferSource) iter.Seq2[AssetTransfer, error] {
+	return func(yield func(AssetTransfer, error) bool) {
+		transfers, err := q.collect(src)
+		if err != nil {
+			yield(AssetTransfer{}, err)
+			return
+		}
+		if q.limit > 0 && len(transfers) > q.limit {
+			transfers = transfers[:q.limit]
+		}
+		for _, t := range transfers {
+			if !yield(t, nil) {
+				return
+			}
+		}
+	}
+}
+
+func (q TransferQuery) collect(src TransferSource) ([]AssetTransfer, error) {
+	var transfers []AssetTransfer
+	err := q.scan(src, func(t AssetTransfer) {
+		transfers = append(transfers, t)
+	})
+	if err != nil {
+		return nil, err
+	}
+	q.sort(transfers)
+	return transfers, nil
+}
+
+func (q TransferQuery) sort(transfers []AssetTransfer) {
+	slices.SortFunc(transfers, func(a, b AssetTransfer) int {
+		ca, cb := cursorOf(a.Transfer), cursorOf(b.Transfer)
+		switch {
+		case q.precedes(ca, cb):
+			return -1
+		case q.precedes(cb, ca):
+			return 1
+		default:
+			return 0
+		}
+	})
+}
+
+type transferHeap struct {
+	query TransferQuery
+	items []AssetTransfer
+}
+
+func (h *transferHeap) Len() int { return len(h.items) }
+
+func (h *transferHeap) Less(i, j int) bool {
+	return h.query.precedes(cursorOf(h.items[j].Transfer), cursorOf(h.items[i].Transfer))
+}
+
+func (h *transferHeap) Swap(i, j int) { h.items[i], h.items[j] = h.items[j], h.items[i] }
+
+func (h *transferHeap) Push(x any) { h.items = append(h.items, x.(AssetTransfer)) }
+
+func (h *transferHeap) Pop() any {
+	last := h.items[len(h.items)-1]
+	h.items = h.items[:len(h.items)-1]
+	return last
+}
+
+// AssetIds returns the IDs of all the assets in the given list.
+func AssetIds(assets Assets) []string {
+	var ids []string
+	if assets.Nia != nil {
+		for _, a := range *assets.Nia {
+			ids = append(ids, a.AssetId)
+		}
+	}
+	if assets.Uda != nil {
+		for _, a := range *assets.Uda {
+			ids = append(ids, a.AssetId)
+		}
+	}
+	if assets.Cfa != nil {
+		for _, a := range *assets.Cfa {
+			ids = append(ids, a.AssetId)
+		}
+	}
+	if assets.Ifa != nil {
+		for _, a := range *assets.Ifa {
+			ids = append(ids, a.AssetId)
+		}
+	}
+	return ids
+}
@@ -0,0 +1,114 @@
+package rgb_lib
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"testing"
+)
+
+// queryWallet returns a wallet with transfers spread over two assets and
+// the transfers not bound to an asset, in no particular order. Several
+// transfers share a creation time, so that pages have to split on Idx.
+func queryWallet() *fakeWallet {
+	wallet := newFakeWallet()
+	rng := rand.New(rand.NewPCG(1, 2))
+	for idx := range int32(30) {
+		assetId := []string{"rgb:a", "rgb:b", ""}[rng.IntN(3)]
+		status := TransferStatusSettled
+		if idx%4 == 0 {
+			status = TransferStatusFailed
+		}
+		wallet.transfers[assetId] = append(wallet.transfers[assetId], Transfer{
+			Idx: idx, CreatedAt: int64(rng.IntN(10)), Status: status,
+		})
+	}
+	return wallet
+}
+
+func transferIdxs(transfers []AssetTransfer) []int32 {
+	var idxs []int32
+	for _, t := range transfers {
+		idxs = append(idxs, t.Idx)
+	}
+	return idxs
+}
+
+func TestTransferQueryPages(t *testing.T) {
+	wallet := queryWallet()
+	for _, order := range []TransferOrder{TransferOrderCreatedAsc, TransferOrderCreatedDesc} {
+		for _, limit := range []int{1, 3, 7, 22, 40} {
+			t.Run(fmt.Sprintf("order %d limit %d", order, limit), func(t *testing.T) {
+				q := NewTransferQuery().WithAssets("rgb:a", "rgb:b").WithNoAsset().
+					WithStatus(TransferStatusSettled).OrderBy(order)
+				var all []AssetTransfer
+				for at, err := range q.All(wallet) {
+					if err != nil {
+						t.Fatal(err)
+					}
+					all = append(all, at)
+				}
+				if len(all) != 22 {
+					t.Fatalf("%d settled transfers, want 22", len(all))
+				}
+				for i := 1; i < len(all); i++ {
+					if !q.precedes(cursorOf(all[i-1].Transfer), cursorOf(all[i].Transfer)) {
+						t.Fatalf("transfers %d and %d out of order", all[i-1].Idx, all[i].Idx)
+					}
+				}
+
+				var paged []AssetTransfer
+				for q := q.Limit(limit); ; {
+					page, err := q.Run(wallet)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if len(page.Transfers) > limit {
+						t.Fatalf("page of %d transfers, over the limit", len(page.Transfers))
+					}
+					paged = append(paged, page.Transfers...)
+					if page.Next == nil {
+						break
+					}
+					// the cursor survives a round trip through an API client
+					next, err := ParseTransferCursor(page.Next.String())
+					if err != nil || next != *page.Next {
+						t.Fatalf("ParseTransferCursor(%s) = %v, %v", page.Next, next, err)
+					}
+					q = q.After(next)
+				}
+				if got, want := transferIdxs(paged), transferIdxs(all); !slices.Equal(got, want) {
+					t.Fatalf("pages %v, want %v", got, want)
+				}
+			})
+		}
+	}
+}
+
+func TestTransferQueryAssets(t *testing.T) {
+	wallet := queryWallet()
+	count := func(q TransferQuery) int {
+		page, err := q.Run(wallet)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(page.Transfers)
+	}
+	a, b, none := len(wallet.transfers["rgb:a"]), len(wallet.transfers["rgb:b"]), len(wallet.transfers[""])
+	if n := count(NewTransferQuery()); n != a+b+none {
+		t.Fatalf("%d transfers, want all %d", n, a+b+none)
+	}
+	if n := count(NewTransferQuery().WithAssets("rgb:a")); n != a {
+		t.Fatalf("%d transfers, want the %d of rgb:a", n, a)
+	}
+	page, _ := NewTransferQuery().WithAssets("rgb:b").Limit(1).Run(wallet)
+	if at := page.Transfers[0]; at.AssetId == nil || *at.AssetId != "rgb:b" {
+		t.Fatalf("transfer %+v, want one of rgb:b", at)
+	}
+	for _, s := range []string{"", "-1", "1-", "x-1", "1-x", "1-99999999999"} {
+		if _, err := ParseTransferCursor(s); !errors.Is(err, ErrInvalidTransferCursor) {
+			t.Errorf("ParseTransferCursor(%q) = %v, want %v", s, err, ErrInvalidTransferCursor)
+		}
+	}
+}
@@ -0,0 +1,251 @@
+package rgb_lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+type GraphNodeKind string
+
+const (
+	GraphNodeInput      GraphNodeKind = "input"
+	GraphNodeTransition GraphNodeKind = "transition"
+	GraphNodeAssignment GraphNodeKind = "assignment"
+	GraphNodeOutput     GraphNodeKind = "output"
+)
+
+// GraphNode is a vertex of a TransitionGraph. Vin and Vout link input and
+// output nodes, and the assignments placed on them, to the PSBT.
+type GraphNode struct {
+	Id          string        `json:"id"`
+	Kind        GraphNodeKind `json:"kind"`
+	Label       string        `json:"label"`
+	AssetId     string        `json:"asset_id,omitempty"`
+	Vin         *uint32       `json:"vin,omitempty"`
+	Vout        *uint32       `json:"vout,omitempty"`
+	AmountSat   *uint64       `json:"amount_sat,omitempty"`
+	Assignment  string        `json:"assignment,omitempty"`
+	IsOurs      bool          `json:"is_ours"`
+	IsConcealed bool          `json:"is_concealed,omitempty"`
+}
+
+type GraphEdge struct {
+	From  string `json:"from"`
+	To    string `json:"to"`
+	Label string `json:"label,omitempty"`
+}
+
+// TransitionGraph is the DAG of an RGB transfer: bitcoin inputs feed state
+// transitions through the allocations they carry, and transitions produce
+// assignments placed on bitcoin outputs or on concealed seals.
+type TransitionGraph struct {
+	Txid        string      `json:"txid,omitempty"`
+	CloseMethod string      `json:"close_method"`
+	Nodes       []GraphNode `json:"nodes"`
+	Edges       []GraphEdge `json:"edges"`
+}
+
+// describeAssignment formats fungible amounts with the precision of their
+// asset.
+func describeAssignment(a Assignment, precision uint8) string {
+	switch a := a.(type) {
+	case AssignmentFungible:
+		return "fungible " + Amount{Raw: a.Amount, Precision: precision}.TrimmedString()
+	case AssignmentNonFungible:
+		return "non-fungible"
+	case AssignmentInflationRight:
+		return "inflation right " + Amount{Raw: a.Amount, Precision: precision}.TrimmedString()
+	case AssignmentLinkRight:
+		return "link right"
+	default:
+		return "any"
+	}
+}
+
+func shortId(id string) string {
+	if len(id) > 16 {
+		return id[:8] + "…" + id[len(id)-6:]
+	}
+	return id
+}
+
+// NewTransitionGraph builds the graph of an RGB inspection. psbt is optional
+// and, when given, adds the bitcoin inputs and outputs not touched by RGB
+// together with their amounts. meta is used to show amounts with the
+// precision of their asset and may be nil; amounts of assets unknown to meta
+// are shown in raw units.
+func NewTransitionGraph(meta MetadataSource, rgb RgbInspection, psbt *PsbtInspection) *TransitionGraph {
+	g := &TransitionGraph{CloseMethod: rgb.CloseMethod.String()}
+	nodes := map[string]bool{}
+	addNode := func(n GraphNode) {
+		if !nodes[n.Id] {
+			nodes[n.Id] = true
+			g.Nodes = append(g.Nodes, n)
+		}
+	}
+	inputNode := func(vin uint32) string {
+		n := GraphNode{Id: fmt.Sprintf("vin%d", vin), Kind: GraphNodeInput, Label: fmt.Sprintf("vin %d", vin), Vin: &vin}
+		if psbt != nil && int(vin) < len(psbt.Inputs) {
+			in := psbt.Inputs[vin]
+			n.Label = fmt.Sprintf("vin %d %s:%d", vin, shortId(in.Outpoint.Txid), in.Outpoint.Vout)
+			n.AmountSat = &in.AmountSat
+			n.IsOurs = in.IsMine
+		}
+		addNode(n)
+		return n.Id
+	}
+	outputNode := func(vout uint32) string {
+		n := GraphNode{Id: fmt.Sprintf("vout%d", vout), Kind: GraphNodeOutput, Label: fmt.Sprintf("vout %d", vout), Vout: &vout}
+		if psbt != nil && int(vout) < len(psbt.Outputs) {
+			out := psbt.Outputs[vout]
+			switch {
+			case out.Address != nil:
+				n.Label = fmt.Sprintf("vout %d %s", vout, shortId(*out.Address))
+			case out.IsOpReturn:
+				n.Label = fmt.Sprintf("vout %d OP_RETURN", vout)
+			}
+			n.AmountSat = &out.AmountSat
+			n.IsOurs = out.IsMine
+		}
+		addNode(n)
+		return n.Id
+	}
+
+	if psbt != nil {
+		g.Txid = psbt.Txid
+		for i := range psbt.Inputs {
+			inputNode(uint32(i))
+		}
+	}
+	for o, op := range rgb.Operations {
+		var precision uint8
+		if meta != nil {
+			if m, err := meta.GetAssetMetadata(op.AssetId); err == nil {
+				precision = m.Precision
+			}
+		}
+		for t, tr := range op.Transitions {
+			tid := fmt.Sprintf("op%d_t%d", o, t)
+			addNode(GraphNode{
+				Id:      tid,
+				Kind:    GraphNodeTransition,
+				Label:   fmt.Sprintf("%s %s", tr.Type, shortId(op.AssetId)),
+				AssetId: op.AssetId,
+			})
+			for _, in := range tr.Inputs {
+				g.Edges = append(g.Edges, GraphEdge{From: inputNode(in.Vin), To: tid, Label: describeAssignment(in.Assignment, precision)})
+			}
+			for a, out := range tr.Outputs {
+				aid := fmt.Sprintf("%s_a%d", tid, a)
+				addNode(GraphNode{
+					Id:          aid,
+					Kind:        GraphNodeAssignment,
+					Label:       describeAssignment(out.Assignment, precision),
+					AssetId:     op.AssetId,
+					Vout:        out.Vout,
+					Assignment:  describeAssignment(out.Assignment, precision),
+					IsOurs:      out.IsOurs,
+					IsConcealed: out.IsConcealed,
+				})
+				g.Edges = append(g.Edges, GraphEdge{From: tid, To: aid})
+				if out.Vout != nil {
+					g.Edges = append(g.Edges, GraphEdge{From: aid, To: outputNode(*out.Vout)})
+				}
+			}
+		}
+	}
+	if psbt != nil {
+		for i := range psbt.Outputs {
+			outputNode(uint32(i))
+		}
+	}
+	return g
+}
+
+func (g *TransitionGraph) JSON() ([]byte, error) {
+	return json.MarshalIndent(g, "", "  ")
+}
+
+func dotQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
+
+// DOT renders the graph in the Graphviz DOT language, with inputs on the left
+// and outputs on the right.
+func (g *TransitionGraph) DOT() string {
+	var b strings.Builder
+	b.WriteString("digraph rgb_transfer {\n  rankdir=LR;\n  node [fontname=\"monospace\"];\n")
+	if g.Txid != "" {
+		fmt.Fprintf(&b, "  label=%s;\n", dotQuote("tx "+g.Txid+" ("+g.CloseMethod+")"))
+	}
+	for _, n := range g.Nodes {
+		var attrs string
+		switch n.Kind {
+		case GraphNodeInput, GraphNodeOutput:
+			attrs = "shape=box"
+		case GraphNodeTransition:
+			attrs = "shape=ellipse, style=filled, fillcolor=lightblue"
+		case GraphNodeAssignment:
+			attrs = "shape=note"
+			if n.IsConcealed {
+				attrs += ", style=dashed"
+			}
+		}
+		label := n.Label
+		if n.AmountSat != nil {
+			label += fmt.Sprintf("\n%d sat", *n.AmountSat)
+		}
+		if n.IsOurs {
+			attrs += ", color=darkgreen"
+			if n.Kind == GraphNodeAssignment {
+				label += "\nours"
+			}
+		}
+		fmt.Fprintf(&b, "  %s [label=%s, %s];\n", n.Id, dotQuote(label), attrs)
+	}
+	for _, e := range g.Edges {
+		if e.Label != "" {
+			fmt.Fprintf(&b, "  %s -> %s [label=%s];\n", e.From, e.To, dotQuote(e.Label))
+		} else {
+			fmt.Fprintf(&b, "  %s -> %s;\n", e.From, e.To)
+		}
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+func mermaidQuote(s string) string {
+	return `"` + strings.NewReplacer(`"`, "#quot;", "\n", "<br/>").Replace(s) + `"`
+}
+
+// Mermaid renders the graph as a Mermaid flowchart.
+func (g *TransitionGraph) Mermaid() string {
+	var b strings.Builder
+	b.WriteString("flowchart LR\n")
+	for _, n := range g.Nodes {
+		label := n.Label
+		if n.AmountSat != nil {
+			label += fmt.Sprintf("\n%d sat", *n.AmountSat)
+		}
+		if n.IsOurs && n.Kind == GraphNodeAssignment {
+			label += "\nours"
+		}
+		switch n.Kind {
+		case GraphNodeTransition:
+			fmt.Fprintf(&b, "  %s((%s))\n", n.Id, mermaidQuote(label))
+		case GraphNodeAssignment:
+			fmt.Fprintf(&b, "  %s>%s]\n", n.Id, mermaidQuote(label))
+		default:
+			fmt.Fprintf(&b, "  %s[%s]\n", n.Id, mermaidQuote(label))
+		}
+	}
+	for _, e := range g.Edges {
+		if e.Label != "" {
+			fmt.Fprintf(&b, "  %s -->|%s| %s\n", e.From, mermaidQuote(e.Label), e.To)
+		} else {
+			fmt.Fprintf(&b, "  %s --> %s\n", e.From, e.To)
+		}
+	}
+	return b.String()
+}
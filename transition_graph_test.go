@@ -0,0 +1,49 @@
+package rgb_lib
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTransitionGraphAmounts(t *testing.T) {
+	meta := newFakeWallet()
+	meta.metadata["rgb:a"] = Metadata{Name: "Asset A", Precision: 2}
+	vout := uint32(1)
+	transfer := rgbTransition(TypeOfTransitionTransfer, 12345, 2345, 10000)
+	transfer.Outputs[0].Vout = &vout
+	rgb := RgbInspection{Operations: []RgbOperationInfo{
+		{AssetId: "rgb:a", Transitions: []RgbTransitionInfo{transfer}},
+		{AssetId: "rgb:b", Transitions: []RgbTransitionInfo{rgbTransition(TypeOfTransitionTransfer, 700, 0, 700)}},
+	}}
+
+	g := NewTransitionGraph(meta, rgb, nil)
+	labels := map[string]string{}
+	for _, e := range g.Edges {
+		if e.Label != "" {
+			labels[e.From+" "+e.To] = e.Label
+		}
+	}
+	for _, n := range g.Nodes {
+		if n.Kind == GraphNodeAssignment {
+			labels[n.Id] = n.Label
+		}
+	}
+	for key, want := range map[string]string{
+		"vin0 op0_t0": "fungible 123.45",
+		"op0_t0_a0":   "fungible 23.45",
+		"op0_t0_a1":   "fungible 100",
+		// rgb:b is unknown to meta
+		"vin0 op1_t0": "fungible 700",
+	} {
+		if labels[key] != want {
+			t.Errorf("%s labelled %q, want %q", key, labels[key], want)
+		}
+	}
+	if dot := g.DOT(); !strings.Contains(dot, `vin0 -> op0_t0 [label="fungible 123.45"]`) || !strings.Contains(dot, "op0_t0_a0 -> vout1;") {
+		t.Fatalf("DOT =\n%s", dot)
+	}
+
+	if raw := NewTransitionGraph(nil, rgb, nil); raw.Nodes[2].Label != "fungible 2345" {
+		t.Fatalf("assignment without metadata labelled %q, want raw units", raw.Nodes[2].Label)
+	}
+}
@@ -0,0 +1,333 @@
+package rgb_lib
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// ColdWallet is the side of a treasury receiving sweeps. Wallet implements
+// it, including watch-only wallets; wrap a MultisigWallet with
+// NewMultisigColdWallet.
+type ColdWallet interface {
+	WitnessReceive(assetId *string, assignment Assignment, expirationTimestamp *uint64, transportEndpoints []string, minConfirmations uint8) (ReceiveData, error)
+	GetAddress() (string, error)
+}
+
+type multisigColdWallet struct {
+	wallet MultisigWalletInterface
+	online Online
+}
+
+// NewMultisigColdWallet adapts a MultisigWallet, whose receive methods need
+// an Online, to ColdWallet.
+func NewMultisigColdWallet(wallet MultisigWalletInterface, online Online) ColdWallet {
+	return multisigColdWallet{wallet: wallet, online: online}
+}
+
+func (w multisigColdWallet) WitnessReceive(assetId *string, assignment Assignment, expirationTimestamp *uint64, transportEndpoints []string, minConfirmations uint8) (ReceiveData, error) {
+	return w.wallet.WitnessReceive(w.online, assetId, assignment, expirationTimestamp, transportEndpoints, minConfirmations)
+}
+
+func (w multisigColdWallet) GetAddress() (string, error) {
+	return w.wallet.GetAddress(w.online)
+}
+
+// HotWallet is the subset of Wallet needed on the hot side of a treasury.
+type HotWallet interface {
+	ColdWallet
+	GetAssetBalance(assetId string) (Balance, error)
+	GetBtcBalance(online *Online, skipSync bool) (BtcBalance, error)
+	Send(online Online, recipientMap map[string][]Recipient, donation bool, feeRate uint64, minConfirmations uint8, expirationTimestamp *uint64) (OperationResult, error)
+	SendBtc(online Online, address string, amount uint64, feeRate uint64, skipSync bool) (string, error)
+}
+
+// Threshold bounds a hot balance, in raw asset units or sats. Above Ceiling,
+// the surplus over Target is swept to cold; below Floor, a top-up to Target
+// is requested. A zero Ceiling disables sweeping and a zero Floor top-ups.
+type Threshold struct {
+	Floor   uint64
+	Target  uint64
+	Ceiling uint64
+}
+
+func (t Threshold) validate() error {
+	if (t.Floor > 0 && t.Floor > t.Target) || (t.Ceiling > 0 && t.Ceiling < t.Target) {
+		return fmt.Errorf("threshold needs floor <= target <= ceiling, got %d, %d, %d", t.Floor, t.Target, t.Ceiling)
+	}
+	return nil
+}
+
+type AuditKind string
+
+const (
+	AuditSweepAsset AuditKind = "sweep_asset"
+	AuditSweepBtc   AuditKind = "sweep_btc"
+	AuditTopUp      AuditKind = "top_up_request"
+	// AuditFailed records a failed movement; Error is set.
+	AuditFailed AuditKind = "failed"
+)
+
+// AuditEntry records a treasury movement. AssetId is empty for BTC and
+// Destination holds the invoice or address paid or to pay.
+type AuditEntry struct {
+	Time             int64     `json:"time"`
+	Kind             AuditKind `json:"kind"`
+	AssetId          string    `json:"asset_id,omitempty"`
+	Amount           uint64    `json:"amount"`
+	Destination      string    `json:"destination,omitempty"`
+	Txid             string    `json:"txid,omitempty"`
+	BatchTransferIdx *int32    `json:"batch_transfer_idx,omitempty"`
+	Error            string    `json:"error,omitempty"`
+}
+
+// AuditLog stores audit entries. Append must be durable when it returns.
+type AuditLog interface {
+	Append(entry AuditEntry) error
+}
+
+// FileAuditLog appends audit entries to a file, one JSON object per line.
+type FileAuditLog struct {
+	mu   sync.Mutex
+	path string
+}
+
+func NewFileAuditLog(path string) *FileAuditLog {
+	return &FileAuditLog{path: path}
+}
+
+func (l *FileAuditLog) Append(entry AuditEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	f, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// TopUpRequest asks the cold side to send Amount to the hot wallet, paying
+// Invoice for an asset or Address for BTC.
+type TopUpRequest struct {
+	AssetId string
+	Amount  uint64
+	Invoice string
+	Address string
+}
+
+type TreasuryOptions struct {
+	// Assets maps asset IDs to their thresholds, in raw units.
+	Assets map[string]Threshold
+	// Btc is the threshold of the vanilla balance, in sats. Its Target must
+	// be above zero when sweeping is enabled, to leave room for the fee.
+	Btc Threshold
+	// FeeRate is used for sweeps, unless Fees is set.
+	FeeRate            uint64
+	Fees               *FeePolicy
+	MinConfirmations   uint8
+	TransportEndpoints []string
+	// WitnessAmountSat is the bitcoin amount sent with asset sweeps, which
+	// pay witness invoices. Zero means 1000.
+	WitnessAmountSat uint64
+	// SweepExpiry is the validity of the cold invoices paid by asset sweeps,
+	// which are paid right away. Zero means 10 minutes.
+	SweepExpiry time.Duration
+	// TopUpInterval is the minimum time between two top-up requests for the
+	// same balance, and the validity of their hot invoices, so that a new
+	// request replaces an expired one. Zero means one hour.
+	TopUpInterval time.Duration
+	// OnTopUp receives top-up requests, to be approved and signed on the cold
+	// side.
+	OnTopUp func(TopUpRequest)
+}
+
+// Treasury keeps the balances of a hot wallet between thresholds, sweeping
+// surplus to a cold wallet and requesting top-ups from it. Sweeps pay the
+// spendable balance only; top-ups are decided on the future balance, so that
+// a top-up in flight is not requested again. Every movement is appended to
+// the audit log.
+type Treasury struct {
+	hot    HotWallet
+	cold   ColdWallet
+	online Online
+	audit  AuditLog
+	opts   TreasuryOptions
+	now    func() time.Time
+
+	mu         sync.Mutex
+	lastTopUps map[string]time.Time
+}
+
+func NewTreasury(hot HotWallet, cold ColdWallet, online Online, audit AuditLog, opts TreasuryOptions) (*Treasury, error) {
+	for assetId, t := range opts.Assets {
+		if err := t.validate(); err != nil {
+			return nil, fmt.Errorf("asset %s: %w", assetId, err)
+		}
+	}
+	if err := opts.Btc.validate(); err != nil {
+		return nil, fmt.Errorf("btc: %w", err)
+	}
+	if opts.Btc.Ceiling > 0 && opts.Btc.Target == 0 {
+		return nil, errors.New("btc: sweeping needs a target above zero to pay the fee")
+	}
+	if opts.WitnessAmountSat == 0 {
+		opts.WitnessAmountSat = 1000
+	}
+	if opts.SweepExpiry <= 0 {
+		opts.SweepExpiry = 10 * time.Minute
+	}
+	if opts.TopUpInterval <= 0 {
+		opts.TopUpInterval = time.Hour
+	}
+	return &Treasury{hot: hot, cold: cold, online: online, audit: audit, opts: opts, now: time.Now, lastTopUps: map[string]time.Time{}}, nil
+}
+
+// Rebalance checks every threshold once, sweeping or requesting top-ups as
+// needed.
+func (t *Treasury) Rebalance(ctx context.Context) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var errs []error
+	for assetId, threshold := range t.opts.Assets {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		balance, err := t.hot.GetAssetBalance(assetId)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("asset %s: %w", assetId, err))
+			continue
+		}
+		errs = append(errs, t.rebalance(assetId, threshold, balance))
+	}
+	if t.opts.Btc != (Threshold{}) {
+		balance, err := t.hot.GetBtcBalance(&t.online, false)
+		if err != nil {
+			return errors.Join(append(errs, err)...)
+		}
+		errs = append(errs, t.rebalance("", t.opts.Btc, balance.Vanilla))
+	}
+	return errors.Join(errs...)
+}
+
+func (t *Treasury) rebalance(assetId string, threshold Threshold, balance Balance) error {
+	switch {
+	case threshold.Ceiling > 0 && balance.Spendable > threshold.Ceiling:
+		return t.sweep(assetId, balance.Spendable-threshold.Target)
+	case threshold.Floor > 0 && balance.Future < threshold.Floor:
+		return t.topUp(assetId, threshold.Target-balance.Future)
+	}
+	return nil
+}
+
+func (t *Treasury) feeRate() (uint64, error) {
+	if t.opts.Fees != nil {
+		return t.opts.Fees.FeeRate()
+	}
+	return t.opts.FeeRate, nil
+}
+
+func (t *Treasury) sweep(assetId string, amount uint64) error {
+	entry := AuditEntry{Kind: AuditSweepAsset, AssetId: assetId, Amount: amount}
+	if assetId == "" {
+		entry.Kind = AuditSweepBtc
+	}
+	err := t.sweepTo(&entry)
+	if err != nil {
+		entry.Error = fmt.Sprintf("%s: %v", entry.Kind, err)
+		entry.Kind = AuditFailed
+	}
+	return errors.Join(err, t.log(entry))
+}
+
+func (t *Treasury) sweepTo(entry *AuditEntry) error {
+	feeRate, err := t.feeRate()
+	if err != nil {
+		return err
+	}
+	if entry.AssetId == "" {
+		if entry.Destination, err = t.cold.GetAddress(); err != nil {
+			return err
+		}
+		entry.Txid, err = t.hot.SendBtc(t.online, entry.Destination, entry.Amount, feeRate, false)
+		return err
+	}
+	expiration := uint64(t.now().Add(t.opts.SweepExpiry).Unix())
+	receive, err := t.cold.WitnessReceive(&entry.AssetId, AssignmentFungible{Amount: entry.Amount}, &expiration, t.opts.TransportEndpoints, t.opts.MinConfirmations)
+	if err != nil {
+		return fmt.Errorf("cold invoice: %w", err)
+	}
+	entry.Destination = receive.Invoice
+	recipient := Recipient{
+		RecipientId:        receive.RecipientId,
+		WitnessData:        &WitnessData{AmountSat: t.opts.WitnessAmountSat},
+		Assignment:         AssignmentFungible{Amount: entry.Amount},
+		TransportEndpoints: t.opts.TransportEndpoints,
+	}
+	res, err := t.hot.Send(t.online, map[string][]Recipient{entry.AssetId: {recipient}}, false, feeRate, t.opts.MinConfirmations, nil)
+	if err != nil {
+		return err
+	}
+	entry.Txid, entry.BatchTransferIdx = res.Txid, &res.BatchTransferIdx
+	return nil
+}
+
+func (t *Treasury) topUp(assetId string, amount uint64) error {
+	now := t.now()
+	if last, ok := t.lastTopUps[assetId]; ok && now.Sub(last) < t.opts.TopUpInterval {
+		return nil
+	}
+	req := TopUpRequest{AssetId: assetId, Amount: amount}
+	entry := AuditEntry{Kind: AuditTopUp, AssetId: assetId, Amount: amount}
+	var err error
+	if assetId == "" {
+		req.Address, err = t.hot.GetAddress()
+		entry.Destination = req.Address
+	} else {
+		var receive ReceiveData
+		expiration := uint64(now.Add(t.opts.TopUpInterval).Unix())
+		receive, err = t.hot.WitnessReceive(&assetId, AssignmentFungible{Amount: amount}, &expiration, t.opts.TransportEndpoints, t.opts.MinConfirmations)
+		req.Invoice, entry.Destination = receive.Invoice, receive.Invoice
+	}
+	if err != nil {
+		entry.Kind, entry.Error = AuditFailed, fmt.Sprintf("%s: %v", AuditTopUp, err)
+		return errors.Join(err, t.log(entry))
+	}
+	t.lastTopUps[assetId] = now
+	if err := t.log(entry); err != nil {
+		return err
+	}
+	if t.opts.OnTopUp != nil {
+		t.opts.OnTopUp(req)
+	}
+	return nil
+}
+
+func (t *Treasury) log(entry AuditEntry) error {
+	entry.Time = t.now().Unix()
+	if err := t.audit.Append(entry); err != nil {
+		return fmt.Errorf("audit log: %w", err)
+	}
+	return nil
+}
+
+// Run calls Rebalance every interval until ctx is done, passing its errors
+// to onError.
+func (t *Treasury) Run(ctx context.Context, interval time.Duration, onError func(error)) error {
+	return runEvery(ctx, interval, onError, t.Rebalance)
+}
@@ -0,0 +1,124 @@
+package rgb_lib
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type memoryAuditLog []AuditEntry
+
+func (l *memoryAuditLog) Append(entry AuditEntry) error {
+	*l = append(*l, entry)
+	return nil
+}
+
+func auditKinds(log memoryAuditLog) []AuditKind {
+	var kinds []AuditKind
+	for _, e := range log {
+		kinds = append(kinds, e.Kind)
+	}
+	return kinds
+}
+
+func newTreasuryTest(t *testing.T, opts TreasuryOptions) (*Treasury, *fakeWallet, *fakeWallet, *memoryAuditLog, *time.Time) {
+	t.Helper()
+	hot, cold := newFakeWallet(), newFakeWallet()
+	audit := &memoryAuditLog{}
+	treasury, err := NewTreasury(hot, cold, Online{}, audit, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1700000000, 0)
+	treasury.now = func() time.Time { return now }
+	return treasury, hot, cold, audit, &now
+}
+
+func TestTreasurySweep(t *testing.T) {
+	treasury, hot, cold, audit, _ := newTreasuryTest(t, TreasuryOptions{
+		Assets: map[string]Threshold{"rgb:a": {Target: 500, Ceiling: 1000}},
+		Btc:    Threshold{Target: 50_000, Ceiling: 100_000},
+	})
+	hot.balances["rgb:a"] = Balance{Spendable: 1500, Future: 1500}
+	hot.btcBalance.Vanilla = Balance{Spendable: 150_000, Future: 150_000}
+	if err := treasury.Rebalance(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(hot.sends) != 1 || cold.receives != 1 {
+		t.Fatalf("%d sends for %d cold invoices, want 1", len(hot.sends), cold.receives)
+	}
+	if exp := cold.expirations[0]; exp == nil || *exp != 1700000000+600 {
+		t.Fatalf("cold invoice expiration %v, want the sweep expiry", exp)
+	}
+	r := hot.sends[0]["rgb:a"][0]
+	if r.RecipientId != "recipient1" || r.Assignment != (AssignmentFungible{Amount: 1000}) || r.WitnessData.AmountSat != 1000 {
+		t.Fatalf("sweep recipient %+v, want 1000 to the cold invoice", r)
+	}
+	if len(hot.btcSends) != 1 || hot.btcSends[0] != "address 100000" {
+		t.Fatalf("bitcoin sweeps %v, want 100000 sats to the cold address", hot.btcSends)
+	}
+	if len(*audit) != 2 || (*audit)[0].Txid != "tx1" || (*audit)[1].Kind != AuditSweepBtc || (*audit)[1].Txid != "btctx1" {
+		t.Fatalf("audit %+v", *audit)
+	}
+
+	// a failed sweep is audited, and tried again on the next rebalance
+	hot.balances["rgb:a"] = Balance{Spendable: 1200}
+	hot.btcBalance.Vanilla = Balance{}
+	hot.sendBegin = func(map[string][]Recipient) (SendBeginResult, error) { return SendBeginResult{}, errTest }
+	if err := treasury.Rebalance(context.Background()); !errors.Is(err, errTest) {
+		t.Fatalf("Rebalance = %v, want %v", err, errTest)
+	}
+	if last := (*audit)[len(*audit)-1]; last.Kind != AuditFailed || last.Amount != 700 || last.Error == "" {
+		t.Fatalf("audit entry %+v, want a failed sweep of 700", last)
+	}
+}
+
+func TestTreasuryTopUp(t *testing.T) {
+	var requests []TopUpRequest
+	treasury, hot, _, audit, now := newTreasuryTest(t, TreasuryOptions{
+		Assets:  map[string]Threshold{"rgb:a": {Floor: 100, Target: 500}},
+		Btc:     Threshold{Floor: 10_000, Target: 50_000},
+		OnTopUp: func(r TopUpRequest) { requests = append(requests, r) },
+	})
+	hot.balances["rgb:a"] = Balance{Spendable: 50, Future: 50}
+	hot.btcBalance.Vanilla = Balance{Spendable: 2000, Future: 2000}
+	for range 2 {
+		if err := treasury.Rebalance(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := []TopUpRequest{{AssetId: "rgb:a", Amount: 450, Invoice: "invoice:recipient1"}, {Amount: 48_000, Address: "address"}}
+	if len(requests) != 2 || requests[0] != want[0] || requests[1] != want[1] {
+		t.Fatalf("requests %+v, want %+v", requests, want)
+	}
+	if exp := hot.expirations[0]; exp == nil || *exp != uint64(now.Add(time.Hour).Unix()) {
+		t.Fatalf("top-up invoice expiration %v, want the top-up interval", exp)
+	}
+	if kinds := auditKinds(*audit); len(kinds) != 2 || kinds[0] != AuditTopUp || kinds[1] != AuditTopUp {
+		t.Fatalf("audit %v, want two top-ups", kinds)
+	}
+
+	// a top-up in flight counts in the future balance
+	*now = now.Add(2 * time.Hour)
+	hot.balances["rgb:a"] = Balance{Spendable: 50, Future: 500}
+	hot.btcBalance.Vanilla = Balance{Spendable: 2000, Future: 50_000}
+	if err := treasury.Rebalance(context.Background()); err != nil || len(requests) != 2 {
+		t.Fatalf("Rebalance = %v with %d requests, want none new", err, len(requests))
+	}
+}
+
+func TestTreasuryThresholds(t *testing.T) {
+	hot, cold := newFakeWallet(), newFakeWallet()
+	audit := NewFileAuditLog(filepath.Join(t.TempDir(), "audit.jsonl"))
+	for name, opts := range map[string]TreasuryOptions{
+		"floor above target":       {Assets: map[string]Threshold{"rgb:a": {Floor: 10, Target: 5}}},
+		"ceiling below target":     {Assets: map[string]Threshold{"rgb:a": {Target: 10, Ceiling: 5}}},
+		"btc sweep without target": {Btc: Threshold{Ceiling: 5}},
+	} {
+		if _, err := NewTreasury(hot, cold, Online{}, audit, opts); err == nil {
+			t.Errorf("%s: NewTreasury succeeded", name)
+		}
+	}
+}
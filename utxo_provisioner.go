@@ -0,0 +1,175 @@
+package rgb_lib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ProvisionWallet is the subset of Wallet needed by a UtxoProvisioner.
+type ProvisionWallet interface {
+	ListUnspents(online *Online, settledOnly bool, skipSync bool) ([]Unspent, error)
+	GetWalletData() WalletData
+	GetBtcBalance(online *Online, skipSync bool) (BtcBalance, error)
+	CreateUtxos(online Online, upTo bool, num *uint8, size *uint32, feeRate uint64, skipSync bool) (uint8, error)
+}
+
+type ProvisionAlertKind string
+
+const (
+	// AlertLowVanilla is raised when the spendable vanilla balance is below
+	// ProvisionOptions.MinVanillaSat.
+	AlertLowVanilla ProvisionAlertKind = "low_vanilla"
+	// AlertInsufficientBitcoins is raised when CreateUtxos fails for lack of
+	// vanilla funds. Needed and Available are set.
+	AlertInsufficientBitcoins ProvisionAlertKind = "insufficient_bitcoins"
+)
+
+type ProvisionAlert struct {
+	Kind      ProvisionAlertKind
+	Status    UtxoStatus
+	Needed    uint64
+	Available uint64
+	Err       error
+}
+
+// UtxoStatus is a snapshot of the colorable UTXOs and vanilla funds of a
+// wallet.
+type UtxoStatus struct {
+	AllocationSlots
+	Vanilla Balance
+	// Low reports whether the status is below a low-water mark.
+	Low bool
+}
+
+type ProvisionOptions struct {
+	// MinFreeSlots and MinFreeUtxos are the low-water marks: UTXOs are
+	// created when the free allocation slots or the colorable UTXOs with a
+	// free slot fall below them. Zero MinFreeSlots means 1.
+	MinFreeSlots int
+	MinFreeUtxos int
+	// Num and Size are passed to CreateUtxos, with upTo false. Nil uses the
+	// wallet defaults.
+	Num     *uint8
+	Size    *uint32
+	FeeRate uint64
+	// MinInterval is the minimum time between CreateUtxos attempts. Zero
+	// means 10 minutes.
+	MinInterval time.Duration
+	// MinVanillaSat raises AlertLowVanilla when the spendable vanilla balance
+	// falls below it. Zero disables the alert.
+	MinVanillaSat uint64
+	OnAlert       func(ProvisionAlert)
+}
+
+// UtxoProvisioner keeps enough colorable UTXOs in a wallet for sends and
+// receives not to fail with InsufficientAllocationSlots. Check creates UTXOs
+// when a low-water mark is crossed, at most once per MinInterval.
+type UtxoProvisioner struct {
+	wallet ProvisionWallet
+	online Online
+	opts   ProvisionOptions
+	now    func() time.Time
+	create func(ctx context.Context, num *uint8, size *uint32, feeRate uint64) (uint8, error)
+
+	mu          sync.Mutex
+	lastAttempt time.Time
+}
+
+func NewUtxoProvisioner(wallet ProvisionWallet, online Online, opts ProvisionOptions) *UtxoProvisioner {
+	if opts.MinFreeSlots <= 0 {
+		opts.MinFreeSlots = 1
+	}
+	if opts.MinInterval <= 0 {
+		opts.MinInterval = 10 * time.Minute
+	}
+	p := &UtxoProvisioner{wallet: wallet, online: online, opts: opts, now: time.Now}
+	p.create = func(_ context.Context, num *uint8, size *uint32, feeRate uint64) (uint8, error) {
+		return wallet.CreateUtxos(online, false, num, size, feeRate, true)
+	}
+	return p
+}
+
+// WithSigner creates UTXOs through a SigningWallet, for watch-only wallets.
+func (p *UtxoProvisioner) WithSigner(w *SigningWallet) *UtxoProvisioner {
+	p.create = func(ctx context.Context, num *uint8, size *uint32, feeRate uint64) (uint8, error) {
+		return w.CreateUtxos(ctx, p.online, false, num, size, feeRate, true)
+	}
+	return p
+}
+
+// Status syncs the wallet and returns its UTXO status.
+func (p *UtxoProvisioner) Status() (UtxoStatus, error) {
+	unspents, err := p.wallet.ListUnspents(&p.online, false, false)
+	if err != nil {
+		return UtxoStatus{}, err
+	}
+	balance, err := p.wallet.GetBtcBalance(&p.online, true)
+	if err != nil {
+		return UtxoStatus{}, err
+	}
+	s := UtxoStatus{
+		AllocationSlots: CountAllocationSlots(unspents, p.wallet.GetWalletData().MaxAllocationsPerUtxo),
+		Vanilla:         balance.Vanilla,
+	}
+	s.Low = s.FreeSlots < p.opts.MinFreeSlots || s.FreeUtxos < p.opts.MinFreeUtxos
+	return s, nil
+}
+
+// Check creates UTXOs if the wallet is below a low-water mark and the last
+// attempt is older than MinInterval. It returns the number of UTXOs created.
+func (p *UtxoProvisioner) Check(ctx context.Context) (uint8, error) {
+	s, err := p.Status()
+	if err != nil {
+		return 0, err
+	}
+	if p.opts.MinVanillaSat > 0 && s.Vanilla.Spendable < p.opts.MinVanillaSat {
+		p.alert(ProvisionAlert{Kind: AlertLowVanilla, Status: s, Needed: p.opts.MinVanillaSat, Available: s.Vanilla.Spendable})
+	}
+	if !s.Low {
+		return 0, nil
+	}
+	if !p.attempt() {
+		return 0, nil
+	}
+
+	created, err := p.create(ctx, p.opts.Num, p.opts.Size, p.opts.FeeRate)
+	if err != nil {
+		var insufficient *RgbLibErrorInsufficientBitcoins
+		if errors.As(err, &insufficient) {
+			p.alert(ProvisionAlert{Kind: AlertInsufficientBitcoins, Status: s, Needed: insufficient.Needed, Available: insufficient.Available, Err: err})
+		}
+		return 0, fmt.Errorf("create utxos: %w", err)
+	}
+	return created, nil
+}
+
+// attempt reports whether a CreateUtxos attempt is allowed by the rate limit,
+// recording it if so.
+func (p *UtxoProvisioner) attempt() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := p.now()
+	if !p.lastAttempt.IsZero() && now.Sub(p.lastAttempt) < p.opts.MinInterval {
+		return false
+	}
+	p.lastAttempt = now
+	return true
+}
+
+func (p *UtxoProvisioner) alert(a ProvisionAlert) {
+	if p.opts.OnAlert != nil {
+		p.opts.OnAlert(a)
+	}
+}
+
+// Run calls Check every interval until ctx is done, passing its errors to
+// onError.
+func (p *UtxoProvisioner) Run(ctx context.Context, interval time.Duration, onError func(error)) error {
+	return runEvery(ctx, interval, onError, func(ctx context.Context) error {
+		_, err := p.Check(ctx)
+		return err
+	})
+}
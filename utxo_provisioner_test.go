@@ -0,0 +1,68 @@
+package rgb_lib
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestUtxoProvisionerCheck(t *testing.T) {
+	wallet := newFakeWallet()
+	// the only colorable UTXO is full
+	wallet.unspents[0].RgbAllocations = make([]RgbAllocation, wallet.data.MaxAllocationsPerUtxo)
+	wallet.btcBalance.Vanilla.Spendable = 1000
+	var alerts []ProvisionAlert
+	p := NewUtxoProvisioner(wallet, Online{}, ProvisionOptions{
+		MinVanillaSat: 5000,
+		OnAlert:       func(a ProvisionAlert) { alerts = append(alerts, a) },
+	})
+	now := time.Unix(1700000000, 0)
+	p.now = func() time.Time { return now }
+
+	if created, err := p.Check(context.Background()); err != nil || created != 5 {
+		t.Fatalf("Check = %d, %v, want 5 UTXOs created", created, err)
+	}
+	if len(alerts) != 1 || alerts[0].Kind != AlertLowVanilla || alerts[0].Available != 1000 || !alerts[0].Status.Low {
+		t.Fatalf("alerts %+v, want a low vanilla alert", alerts)
+	}
+
+	// the wallet still looks full, but the last attempt is too recent
+	if created, err := p.Check(context.Background()); err != nil || created != 0 || wallet.utxosCreated != 5 {
+		t.Fatalf("Check = %d, %v with %d UTXOs created, want no attempt", created, err, wallet.utxosCreated)
+	}
+
+	now = now.Add(10 * time.Minute)
+	wallet.createUtxos = func(*uint8) (uint8, error) { return 0, NewRgbLibErrorInsufficientBitcoins(3000, 1000) }
+	if _, err := p.Check(context.Background()); !errors.Is(err, ErrRgbLibErrorInsufficientBitcoins) {
+		t.Fatalf("Check = %v, want %v", err, ErrRgbLibErrorInsufficientBitcoins)
+	}
+	if a := alerts[len(alerts)-1]; a.Kind != AlertInsufficientBitcoins || a.Needed != 3000 || a.Available != 1000 {
+		t.Fatalf("alert %+v, want an insufficient bitcoins alert", a)
+	}
+
+	// a free slot is enough with the default low-water mark
+	now = now.Add(10 * time.Minute)
+	wallet.unspents[0].RgbAllocations = wallet.unspents[0].RgbAllocations[1:]
+	if created, err := p.Check(context.Background()); err != nil || created != 0 {
+		t.Fatalf("Check = %d, %v, want nothing created", created, err)
+	}
+}
+
+func TestUtxoProvisionerRun(t *testing.T) {
+	wallet := newFakeWallet()
+	wallet.unspents = nil
+	wallet.createUtxos = func(*uint8) (uint8, error) { return 0, errTest }
+	p := NewUtxoProvisioner(wallet, Online{}, ProvisionOptions{MinInterval: time.Nanosecond})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var errs []error
+	err := p.Run(ctx, time.Millisecond, func(err error) {
+		if errs = append(errs, err); len(errs) == 2 {
+			cancel()
+		}
+	})
+	if !errors.Is(err, context.Canceled) || len(errs) != 2 || !errors.Is(errs[1], errTest) {
+		t.Fatalf("Run = %v with errors %v, want two test errors then cancellation", err, errs)
+	}
+}
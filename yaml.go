@@ -0,0 +1,400 @@
+package rgb_lib
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+var errYAML = errors.New("yaml")
+
+// yamlLine is a line of a YAML document. text has comments and trailing
+// spaces removed and is empty for blank and comment lines.
+type yamlLine struct {
+	n      int
+	indent int
+	raw    string
+	text   string
+}
+
+// yamlParser decodes the block subset of YAML used by manifests: mappings,
+// sequences, plain, quoted and block (| and >) scalars, and flow sequences of
+// scalars. Anchors, tags and flow mappings are not supported. Plain numbers
+// decode as json.Number so that large amounts stay exact: they are rewritten
+// in decimal notation, without exponent, so 1e3 and 0x3e8 both decode as
+// 1000.
+type yamlParser struct {
+	lines []yamlLine
+	pos   int
+}
+
+// decodeYAML decodes data into map[string]any, []any, string, bool,
+// json.Number or nil values.
+func decodeYAML(data []byte) (any, error) {
+	p := &yamlParser{}
+	for i, raw := range strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n") {
+		if strings.HasPrefix(raw, "\t") {
+			return nil, fmt.Errorf("%w: line %d: tab indentation", errYAML, i+1)
+		}
+		if t := strings.TrimSpace(raw); t == "---" || t == "..." {
+			raw = ""
+		}
+		text := strings.TrimRight(stripYAMLComment(raw), " \t")
+		indent := len(text) - len(strings.TrimLeft(text, " "))
+		p.lines = append(p.lines, yamlLine{n: i + 1, indent: indent, raw: raw, text: strings.TrimLeft(text, " ")})
+	}
+	p.skipBlank()
+	if p.pos == len(p.lines) {
+		return nil, nil
+	}
+	v, err := p.node(p.lines[p.pos].indent)
+	if err != nil {
+		return nil, err
+	}
+	p.skipBlank()
+	if p.pos < len(p.lines) {
+		return nil, p.errorf("unexpected content")
+	}
+	return v, nil
+}
+
+func stripYAMLComment(s string) string {
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else if c == '\\' && quote == '"' {
+				i++
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || s[i-1] == ' ' || s[i-1] == '\t'):
+			return s[:i]
+		}
+	}
+	return s
+}
+
+func (p *yamlParser) skipBlank() {
+	for p.pos < len(p.lines) && p.lines[p.pos].text == "" {
+		p.pos++
+	}
+}
+
+func (p *yamlParser) errorf(format string, args ...any) error {
+	n := len(p.lines)
+	if p.pos < len(p.lines) {
+		n = p.lines[p.pos].n
+	}
+	return fmt.Errorf("%w: line %d: %s", errYAML, n, fmt.Sprintf(format, args...))
+}
+
+// node parses the block starting at the current line, indented by indent.
+func (p *yamlParser) node(indent int) (any, error) {
+	line := p.lines[p.pos]
+	if isYAMLSeqItem(line.text) {
+		return p.sequence(indent)
+	}
+	if _, _, ok := splitYAMLKey(line.text); ok {
+		return p.mapping(indent)
+	}
+	p.pos++
+	return yamlScalar(line.text)
+}
+
+func isYAMLSeqItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+func (p *yamlParser) sequence(indent int) ([]any, error) {
+	items := []any{}
+	for p.skipBlank(); p.pos < len(p.lines); p.skipBlank() {
+		line := p.lines[p.pos]
+		// a mapping key may hold a sequence at its own indentation
+		if line.indent < indent || (line.indent == indent && !isYAMLSeqItem(line.text)) {
+			break
+		}
+		if line.indent > indent {
+			return nil, p.errorf("bad indentation")
+		}
+		rest := strings.TrimLeft(line.text[1:], " ")
+		var item any
+		var err error
+		if rest == "" {
+			p.pos++
+			item, err = p.nested(indent)
+		} else {
+			// parse the rest of the line as a block indented past the dash
+			p.lines[p.pos].indent = indent + len(line.text) - len(rest)
+			p.lines[p.pos].text = rest
+			item, err = p.node(p.lines[p.pos].indent)
+		}
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// nested parses the block following a key or dash with no inline value, or
+// returns nil if there is none.
+func (p *yamlParser) nested(indent int) (any, error) {
+	p.skipBlank()
+	if p.pos == len(p.lines) {
+		return nil, nil
+	}
+	next := p.lines[p.pos]
+	if next.indent > indent {
+		return p.node(next.indent)
+	}
+	return nil, nil
+}
+
+func (p *yamlParser) mapping(indent int) (map[string]any, error) {
+	m := map[string]any{}
+	for p.skipBlank(); p.pos < len(p.lines); p.skipBlank() {
+		line := p.lines[p.pos]
+		if line.indent < indent {
+			break
+		}
+		key, rest, ok := splitYAMLKey(line.text)
+		if line.indent > indent || !ok {
+			return nil, p.errorf("bad indentation")
+		}
+		if _, dup := m[key]; dup {
+			return nil, p.errorf("duplicate key %q", key)
+		}
+		p.pos++
+		var v any
+		var err error
+		switch {
+		case rest == "":
+			p.skipBlank()
+			if p.pos < len(p.lines) && p.lines[p.pos].indent == indent && isYAMLSeqItem(p.lines[p.pos].text) {
+				v, err = p.sequence(indent)
+			} else {
+				v, err = p.nested(indent)
+			}
+		case rest[0] == '|' || rest[0] == '>':
+			v, err = p.blockScalar(indent, rest)
+		default:
+			v, err = yamlScalar(rest)
+		}
+		if err != nil {
+			return nil, err
+		}
+		m[key] = v
+	}
+	return m, nil
+}
+
+// blockScalar reads the literal (|) or folded (>) scalar following a key at
+// indent. Chomping indicators are accepted; the result keeps one final
+// newline unless "-" is given.
+func (p *yamlParser) blockScalar(indent int, header string) (string, error) {
+	if strings.Trim(header[1:], "+-") != "" {
+		return "", p.errorf("unsupported block scalar header %q", header)
+	}
+	var lines []string
+	blockIndent := -1
+	for p.pos < len(p.lines) {
+		raw := p.lines[p.pos].raw
+		trimmed := strings.TrimLeft(raw, " ")
+		if trimmed == "" {
+			lines = append(lines, "")
+			p.pos++
+			continue
+		}
+		n := len(raw) - len(trimmed)
+		if n <= indent {
+			break
+		}
+		if blockIndent < 0 {
+			blockIndent = n
+		}
+		if n < blockIndent {
+			return "", p.errorf("bad indentation in block scalar")
+		}
+		lines = append(lines, raw[blockIndent:])
+		p.pos++
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	sep := "\n"
+	if header[0] == '>' {
+		sep = " "
+	}
+	s := strings.Join(lines, sep)
+	if !strings.Contains(header, "-") && s != "" {
+		s += "\n"
+	}
+	return s, nil
+}
+
+// splitYAMLKey splits "key: value" or "key:" lines.
+func splitYAMLKey(text string) (string, string, bool) {
+	if isYAMLSeqItem(text) || strings.HasPrefix(text, "[") || strings.HasPrefix(text, "{") {
+		return "", "", false
+	}
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case (c == '"' || c == '\'') && i == 0:
+			quote = c
+		case c == ':' && (i+1 == len(text) || text[i+1] == ' '):
+			key, err := yamlScalar(strings.TrimSpace(text[:i]))
+			s, ok := key.(string)
+			if err != nil || !ok {
+				return "", "", false
+			}
+			return s, strings.TrimSpace(text[i+1:]), true
+		}
+	}
+	return "", "", false
+}
+
+func yamlScalar(s string) (any, error) {
+	switch {
+	case s == "", s == "~", s == "null":
+		return nil, nil
+	case s == "true":
+		return true, nil
+	case s == "false":
+		return false, nil
+	case s[0] == '"':
+		v, err := strconv.Unquote(s)
+		if err != nil {
+			return nil, fmt.Errorf("%w: bad double-quoted string %s", errYAML, s)
+		}
+		return v, nil
+	case s[0] == '\'':
+		if len(s) < 2 || s[len(s)-1] != '\'' {
+			return nil, fmt.Errorf("%w: bad single-quoted string %s", errYAML, s)
+		}
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'"), nil
+	case s[0] == '[':
+		return yamlFlowSequence(s)
+	case s[0] == '{', s[0] == '&', s[0] == '*', s[0] == '!':
+		return nil, fmt.Errorf("%w: unsupported syntax %s", errYAML, s)
+	}
+	if n, ok := yamlNumber(s); ok {
+		return n, nil
+	}
+	return s, nil
+}
+
+// yamlNumber converts the integers and floats of the YAML 1.2 core schema,
+// such as 7, +0.5, .5, 1.5e3, 0x1f and 0o17, to decimal json.Numbers. The
+// conversion is exact; exponents beyond ±64 are left as strings.
+func yamlNumber(s string) (json.Number, bool) {
+	base := 0
+	switch {
+	case strings.HasPrefix(s, "0x"):
+		base = 16
+	case strings.HasPrefix(s, "0o"):
+		base = 8
+	}
+	if base != 0 {
+		n, ok := new(big.Int).SetString(s[2:], base)
+		if !ok || strings.ContainsAny(s[2:], "+-_") {
+			return "", false
+		}
+		return json.Number(n.String()), true
+	}
+
+	sign := ""
+	if s[0] == '-' || s[0] == '+' {
+		sign, s = strings.TrimPrefix(s[:1], "+"), s[1:]
+	}
+	mantissa, exponent, hasExp := strings.Cut(strings.ToLower(s), "e")
+	intPart, fracPart, _ := strings.Cut(mantissa, ".")
+	if intPart == "" && fracPart == "" || !isDigits(intPart) || !isDigits(fracPart) {
+		return "", false
+	}
+	exp := 0
+	if hasExp {
+		var err error
+		if exp, err = strconv.Atoi(exponent); err != nil || exp < -64 || exp > 64 {
+			return "", false
+		}
+	}
+	// move the decimal point of intPart.fracPart by exp digits
+	digits := intPart + fracPart
+	point := len(intPart) + exp
+	switch {
+	case point <= 0:
+		intPart, fracPart = "0", strings.Repeat("0", -point)+digits
+	case point >= len(digits):
+		intPart, fracPart = digits+strings.Repeat("0", point-len(digits)), ""
+	default:
+		intPart, fracPart = digits[:point], digits[point:]
+	}
+	if hasExp {
+		fracPart = strings.TrimRight(fracPart, "0")
+	}
+	if intPart = strings.TrimLeft(intPart, "0"); intPart == "" {
+		intPart = "0"
+	}
+	if fracPart != "" {
+		return json.Number(sign + intPart + "." + fracPart), true
+	}
+	return json.Number(sign + intPart), true
+}
+
+func isDigits(s string) bool {
+	return strings.Trim(s, "0123456789") == ""
+}
+
+func yamlFlowSequence(s string) ([]any, error) {
+	if s[len(s)-1] != ']' {
+		return nil, fmt.Errorf("%w: unterminated flow sequence %s", errYAML, s)
+	}
+	items := []any{}
+	inner := strings.TrimSpace(s[1 : len(s)-1])
+	if inner == "" {
+		return items, nil
+	}
+	var quote byte
+	start := 0
+	for i := 0; i <= len(inner); i++ {
+		if i < len(inner) {
+			c := inner[i]
+			switch {
+			case quote != 0:
+				if c == quote {
+					quote = 0
+				} else if c == '\\' && quote == '"' {
+					i++
+				}
+				continue
+			case c == '"' || c == '\'':
+				quote = c
+				continue
+			case c == '[' || c == '{':
+				return nil, fmt.Errorf("%w: nested flow collections are not supported", errYAML)
+			case c != ',':
+				continue
+			}
+		}
+		v, err := yamlScalar(strings.TrimSpace(inner[start:i]))
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, v)
+		start = i + 1
+	}
+	return items, nil
+}
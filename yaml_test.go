@@ -0,0 +1,77 @@
+package rgb_lib
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestDecodeYAML(t *testing.T) {
+	type m = map[string]any
+	type s = []any
+	n := func(v string) json.Number { return json.Number(v) }
+	for _, c := range []struct {
+		name string
+		doc  string
+		want any
+	}{
+		{"empty", "# nothing\n", nil},
+		{"scalars", "a: 1\nb: text\nc: true\nd: ~\ne:\n", m{"a": n("1"), "b": "text", "c": true, "d": nil, "e": nil}},
+		{"document markers", "---\na: 1\n...\n", m{"a": n("1")}},
+		{"comments", "# header\na: x # note\nb: 'it''s # not'\nc: \"a\\\"b # c\" # d\nd: x#y\n",
+			m{"a": "x", "b": "it's # not", "c": "a\"b # c", "d": "x#y"}},
+		{"quoted keys and numbers", "\"a b\": 1\n'2': \"2\"\n", m{"a b": n("1"), "2": "2"}},
+		{"block sequence of mappings", `
+assets:
+  - id: a
+    amounts:
+      - 1
+      - "2.5"
+  -   id: b
+      name: B
+`, m{"assets": s{m{"id": "a", "amounts": s{n("1"), "2.5"}}, m{"id": "b", "name": "B"}}}},
+		{"sequence at key indentation", "a:\n- 1\n-\n  - 2\nb: 3\n", m{"a": s{n("1"), s{n("2")}}, "b": n("3")}},
+		{"nested sequences", "- - 1\n  - 2\n- 3\n-\n", s{s{n("1"), n("2")}, n("3"), nil}},
+		{"flow sequences", "a: [x, \"y, z\", 'w', 1, ~]\nb: []\n", m{"a": s{"x", "y, z", "w", n("1"), nil}, "b": s{}}},
+		{"literal block", "a: |\n  one\n    two\n\n  three\n\nb: 1\n", m{"a": "one\n  two\n\nthree\n", "b": n("1")}},
+		{"folded block stripped", "a: >-\n  one\n  two\n", m{"a": "one two"}},
+		{"empty block", "a: |\nb: 1\n", m{"a": "", "b": n("1")}},
+		{"numbers", "[7, -1.50, 007, +5, .5, 1., 1e3, 1.5E-2, -2.5e+1, 0x1F, 0o17, 1_000, 0xg, 1e100, .inf, 1.2.3, 12ab]",
+			s{n("7"), n("-1.50"), n("7"), n("5"), n("0.5"), n("1"), n("1000"), n("0.015"), n("-25"), n("31"), n("15"),
+				"1_000", "0xg", "1e100", ".inf", "1.2.3", "12ab"}},
+		{"large integer", "18446744073709551616", n("18446744073709551616")},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := decodeYAML([]byte(c.doc))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Fatalf("decodeYAML = %#v, want %#v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestDecodeYAMLInvalid(t *testing.T) {
+	for name, doc := range map[string]string{
+		"tab indentation":        "a:\n\tb: 1\n",
+		"over-indented key":      "a: 1\n  b: 2\n",
+		"over-indented item":     "- a\n  - b\n",
+		"sequence after mapping": "a: 1\n- b\n",
+		"duplicate key":          "a: 1\na: 2\n",
+		"anchor":                 "a: &x 1\n",
+		"flow mapping":           "a: {b: 1}\n",
+		"nested flow sequence":   "a: [[1]]\n",
+		"unterminated flow":      "a: [1, 2\n",
+		"unterminated quote":     "a: \"x\n",
+		"block scalar header":    "a: |2\n  x\n",
+		"block scalar indent":    "a: |\n    x\n  y\n",
+		"trailing content":       "a\nb\n",
+	} {
+		if v, err := decodeYAML([]byte(doc)); !errors.Is(err, errYAML) {
+			t.Errorf("%s: decodeYAML = %#v, %v, want a yaml error", name, v, err)
+		}
+	}
+}